@@ -0,0 +1,80 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"golang.org/x/net/context"
+)
+
+const (
+	// apiRetryMaxAttempts is how often a call vCenter rejected as busy is
+	// sent, backing off exponentially from apiRetryInitialBackoff.
+	apiRetryMaxAttempts    = 5
+	apiRetryInitialBackoff = 500 * time.Millisecond
+)
+
+// throttledRoundTripper bounds the number of simultaneous calls all resources
+// of the provider make to vCenter, so large applies stay below its
+// concurrency limits. Calls vCenter rejects as busy are retried with
+// exponential backoff.
+type throttledRoundTripper struct {
+	soap.RoundTripper
+
+	// slots holds a token per running call. It is nil when the calls are not
+	// bounded.
+	slots chan struct{}
+}
+
+func newThrottledRoundTripper(rt soap.RoundTripper, maxConcurrent int) *throttledRoundTripper {
+	t := &throttledRoundTripper{RoundTripper: rt}
+	if maxConcurrent > 0 {
+		t.slots = make(chan struct{}, maxConcurrent)
+	}
+	return t
+}
+
+func (t *throttledRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	// Task waits long poll the property collector. They only wait on vCenter
+	// and would block the other calls for the duration of the task.
+	if _, ok := req.(*methods.WaitForUpdatesExBody); !ok && t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-t.slots }()
+	}
+
+	backoff := apiRetryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := t.RoundTripper.RoundTrip(ctx, req, res)
+		if err == nil || !isServerBusyError(err) || attempt == apiRetryMaxAttempts {
+			return err
+		}
+		log.Printf("[WARN] vCenter is busy, retrying in %s (attempt %d of %d): %s", backoff, attempt, apiRetryMaxAttempts, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func validateAPIMaxConcurrent(v interface{}, k string) (ws []string, errors []error) {
+	if v.(int) < 0 {
+		errors = append(errors, fmt.Errorf("%s: %d is negative, use 0 to not limit the calls", k, v.(int)))
+	}
+	return
+}
+
+// isServerBusyError reports whether vCenter rejected a call because it is
+// overloaded, which it answers with HTTP 503 before processing the call.
+func isServerBusyError(err error) bool {
+	return strings.HasPrefix(err.Error(), "503 ")
+}
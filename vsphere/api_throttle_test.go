@@ -0,0 +1,86 @@
+package vsphere
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"golang.org/x/net/context"
+)
+
+// countingRoundTripper records the highest number of simultaneous calls and
+// fails the first calls with the given errors.
+type countingRoundTripper struct {
+	sync.Mutex
+	running, max, calls int
+	errs                []error
+}
+
+func (c *countingRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	c.Lock()
+	c.running++
+	c.calls++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	var err error
+	if len(c.errs) > 0 {
+		err, c.errs = c.errs[0], c.errs[1:]
+	}
+	c.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.Lock()
+	c.running--
+	c.Unlock()
+	return err
+}
+
+func TestThrottledRoundTripper_bounded(t *testing.T) {
+	inner := &countingRoundTripper{}
+	rt := newThrottledRoundTripper(inner, 3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rt.RoundTrip(context.TODO(), &methods.RetrieveServiceContentBody{}, &methods.RetrieveServiceContentBody{})
+		}()
+	}
+	wg.Wait()
+
+	if inner.max > 3 {
+		t.Fatalf("expected at most 3 simultaneous calls, got %d", inner.max)
+	}
+	if inner.calls != 20 {
+		t.Fatalf("expected 20 calls, got %d", inner.calls)
+	}
+}
+
+func TestThrottledRoundTripper_retryBusy(t *testing.T) {
+	inner := &countingRoundTripper{errs: []error{
+		errors.New("503 Service Unavailable"),
+		errors.New("503 Service Unavailable"),
+	}}
+	rt := newThrottledRoundTripper(inner, 0)
+	if err := rt.RoundTrip(context.TODO(), &methods.RetrieveServiceContentBody{}, &methods.RetrieveServiceContentBody{}); err != nil {
+		t.Fatalf("expected the call to succeed after retrying, got %s", err)
+	}
+	if inner.calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", inner.calls)
+	}
+
+	inner = &countingRoundTripper{errs: []error{errors.New("500 Internal Server Error")}}
+	rt = newThrottledRoundTripper(inner, 0)
+	if err := rt.RoundTrip(context.TODO(), &methods.RetrieveServiceContentBody{}, &methods.RetrieveServiceContentBody{}); err == nil {
+		t.Fatal("expected the error to be returned")
+	}
+	if inner.calls != 1 {
+		t.Fatalf("expected other errors not to be retried, got %d attempts", inner.calls)
+	}
+}
@@ -0,0 +1,154 @@
+package vsphere
+
+import (
+	"log"
+	"sync"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"golang.org/x/net/context"
+)
+
+// inventoryCache keeps inventory objects which are looked up over and over
+// by the resources of a single plan or apply, keyed by inventory path. The
+// provider process only lives for one run, so entries never go stale by age;
+// they are dropped whenever a resource changes the inventory.
+//
+// The lock only guards the maps, the lookups run without it so resources
+// don't wait on each other's round trips. A lookup which raced with an
+// invalidation is returned but not stored, see generation.
+type inventoryCache struct {
+	sync.Mutex
+	// generation is bumped by every reset.
+	generation  int
+	datacenters map[string]*object.Datacenter
+	dcFolders   map[string]*object.DatacenterFolders
+	networks    map[string]object.NetworkReference
+	datastores  map[string]*object.Datastore
+}
+
+func newInventoryCache() *inventoryCache {
+	c := &inventoryCache{}
+	c.reset()
+	return c
+}
+
+func (c *inventoryCache) reset() {
+	c.generation++
+	c.datacenters = make(map[string]*object.Datacenter)
+	c.dcFolders = make(map[string]*object.DatacenterFolders)
+	c.networks = make(map[string]object.NetworkReference)
+	c.datastores = make(map[string]*object.Datastore)
+}
+
+// invalidateCache has to be called after every write to the inventory.
+func (c *VSphereClient) invalidateCache() {
+	c.cache.Lock()
+	defer c.cache.Unlock()
+
+	log.Printf("[DEBUG] Invalidating inventory cache")
+	c.cache.reset()
+}
+
+// getDatacenter is the cached variant of getDatacenter. An empty name selects
+// the default datacenter.
+func (c *VSphereClient) getDatacenter(name string) (*object.Datacenter, error) {
+	name = normalizeDatacenterName(name)
+	c.cache.Lock()
+	dc, ok := c.cache.datacenters[name]
+	gen := c.cache.generation
+	c.cache.Unlock()
+	if ok {
+		return dc, nil
+	}
+
+	dc, err := getDatacenter(c.vimClient, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.Lock()
+	defer c.cache.Unlock()
+	if c.cache.generation == gen {
+		c.cache.datacenters[name] = dc
+	}
+	return dc, nil
+}
+
+// getFinder returns a new finder of the datacenter. Finders are not shared,
+// as they are not safe for concurrent use and the caller may switch them to
+// another datacenter; only the datacenter itself comes from the cache.
+func (c *VSphereClient) getFinder(dc *object.Datacenter) *find.Finder {
+	return find.NewFinder(c.vimClient.Client, true).SetDatacenter(dc)
+}
+
+func (c *VSphereClient) getDatacenterFolders(dc *object.Datacenter) (*object.DatacenterFolders, error) {
+	c.cache.Lock()
+	folders, ok := c.cache.dcFolders[dc.InventoryPath]
+	gen := c.cache.generation
+	c.cache.Unlock()
+	if ok {
+		return folders, nil
+	}
+
+	folders, err := dc.Folders(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.Lock()
+	defer c.cache.Unlock()
+	if c.cache.generation == gen {
+		c.cache.dcFolders[dc.InventoryPath] = folders
+	}
+	return folders, nil
+}
+
+// getNetwork looks up a network of the datacenter by name or path.
+func (c *VSphereClient) getNetwork(dc *object.Datacenter, name string) (object.NetworkReference, error) {
+	key := dc.InventoryPath + "/" + name
+	c.cache.Lock()
+	net, ok := c.cache.networks[key]
+	gen := c.cache.generation
+	c.cache.Unlock()
+	if ok {
+		return net, nil
+	}
+
+	net, err := c.getFinder(dc).Network(context.TODO(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.Lock()
+	defer c.cache.Unlock()
+	if c.cache.generation == gen {
+		c.cache.networks[key] = net
+	}
+	return net, nil
+}
+
+// getDatastore looks up a datastore of the datacenter by name or path. An
+// empty name selects the default datastore.
+func (c *VSphereClient) getDatastore(dc *object.Datacenter, name string) (*object.Datastore, error) {
+	key := dc.InventoryPath + "/" + name
+	c.cache.Lock()
+	ds, ok := c.cache.datastores[key]
+	gen := c.cache.generation
+	c.cache.Unlock()
+	if ok {
+		return ds, nil
+	}
+
+	ds, err := getDatastore(c.getFinder(dc), name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.Lock()
+	defer c.cache.Unlock()
+	if c.cache.generation == gen {
+		c.cache.datastores[key] = ds
+	}
+	return ds, nil
+}
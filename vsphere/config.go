@@ -21,10 +21,49 @@ type Config struct {
 	Debug         bool
 	DebugPath     string
 	DebugPathRun  string
+
+	DefaultVMFolder     string
+	DefaultResourcePool string
+
+	// APIMaxConcurrent bounds the simultaneous calls to vCenter, 0 does not
+	// bound them.
+	APIMaxConcurrent int
+
+	// LogLevel is the minimum level of the resource log lines of this
+	// provider, empty logs every level.
+	LogLevel string
+}
+
+// VSphereClient is the provider meta handed to every resource. Besides the
+// vSphere client it carries the provider wide placement defaults.
+type VSphereClient struct {
+	vimClient           *govmomi.Client
+	vsphereServer       string
+	defaultVMFolder     string
+	defaultResourcePool string
+	cache               *inventoryCache
+
+	// correlationID tags the log lines of this run.
+	correlationID string
+
+	// macReservations are the MAC addresses allocated during this run.
+	macReservations *macReservations
+
+	// logLevel is the index in logLevels of the minimum level of the
+	// resource log lines.
+	logLevel int
+
+	// instanceUUID identifies the connected vCenter independent of the name
+	// it is reached by. It is empty for ESXi hosts.
+	instanceUUID string
+
+	// apiVersion is the version of the connected vCenter, which gates the
+	// features it supports. It is unset when it could not be detected.
+	apiVersion vSphereVersion
 }
 
 // Client() returns a new client for accessing VMWare vSphere.
-func (c *Config) Client() (*govmomi.Client, error) {
+func (c *Config) Client() (*VSphereClient, error) {
 	u, err := url.Parse("https://" + c.VSphereServer + "/sdk")
 	if err != nil {
 		return nil, fmt.Errorf("Error parse url: %s", err)
@@ -42,9 +81,30 @@ func (c *Config) Client() (*govmomi.Client, error) {
 		return nil, fmt.Errorf("Error setting up client: %s", err)
 	}
 
-	log.Printf("[INFO] VMWare vSphere Client configured for URL: %s", c.VSphereServer)
+	client.RoundTripper = newThrottledRoundTripper(client.RoundTripper, c.APIMaxConcurrent)
+
+	correlationID := newCorrelationID()
+	log.Printf("[INFO] VMWare vSphere Client configured for URL: %s, correlation ID %s", c.VSphereServer, correlationID)
+
+	about := client.ServiceContent.About
+	apiVersion, err := parseVSphereVersion(about.Version)
+	if err != nil {
+		log.Printf("[WARN] Cannot detect the vSphere version, features are not checked against it: %s", err)
+	}
+	log.Printf("[INFO] Connected to %s", about.FullName)
 
-	return client, nil
+	return &VSphereClient{
+		vimClient:           client,
+		vsphereServer:       c.VSphereServer,
+		defaultVMFolder:     c.DefaultVMFolder,
+		defaultResourcePool: c.DefaultResourcePool,
+		cache:               newInventoryCache(),
+		macReservations:     &macReservations{},
+		correlationID:       correlationID,
+		logLevel:            minLogLevel(c.LogLevel),
+		instanceUUID:        about.InstanceUuid,
+		apiVersion:          apiVersion,
+	}, nil
 }
 
 func (c *Config) EnableDebug() error {
@@ -80,6 +140,7 @@ func (c *Config) EnableDebug() error {
 		Path: r,
 	}
 
-	debug.SetProvider(&p)
+	debug.SetProvider(redactingDebugProvider{&p})
+	log.Printf("[INFO] Writing vSphere SOAP traces to %s", r)
 	return nil
 }
@@ -0,0 +1,163 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+func dataSourceVSphereComputeClusterHostGroup() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceVSphereComputeClusterHostGroupRead,
+
+		Schema: map[string]*schema.Schema{
+			"datacenter": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			// Name or inventory path of the cluster.
+			"cluster": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			// Limits host_groups to the group of this name, which has to
+			// exist.
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			"names": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"host_groups": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"hosts": &schema.Schema{
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"host_ids": &schema.Schema{
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// flattenClusterHostGroups returns the host groups of the cluster sorted by
+// name, or only the group called name if it is set. hostNames maps the
+// moids of the hosts to their names.
+func flattenClusterHostGroups(info *types.ClusterConfigInfoEx, hostNames map[string]string, name string) ([]interface{}, error) {
+	var groups []*types.ClusterHostGroup
+	for _, group := range info.Group {
+		g, ok := group.(*types.ClusterHostGroup)
+		if !ok || (name != "" && g.Name != name) {
+			continue
+		}
+		groups = append(groups, g)
+	}
+	if name != "" && len(groups) == 0 {
+		return nil, fmt.Errorf("host group %s not found", name)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+	result := make([]interface{}, 0, len(groups))
+	for _, g := range groups {
+		hosts := make([]string, 0, len(g.Host))
+		hostIDs := make([]string, 0, len(g.Host))
+		for _, ref := range g.Host {
+			hosts = append(hosts, hostNames[ref.Value])
+			hostIDs = append(hostIDs, ref.Value)
+		}
+		result = append(result, map[string]interface{}{
+			"name":     g.Name,
+			"hosts":    hosts,
+			"host_ids": hostIDs,
+		})
+	}
+	return result, nil
+}
+
+func dataSourceVSphereComputeClusterHostGroupRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*VSphereClient)
+	dc, err := client.getDatacenter(d.Get("datacenter").(string))
+	if err != nil {
+		return err
+	}
+
+	clusterName := d.Get("cluster").(string)
+	cr, err := client.getFinder(dc).ComputeResource(context.TODO(), clusterName)
+	if err != nil {
+		return fmt.Errorf("cluster %s not found: %s", clusterName, err)
+	}
+	if cr.Reference().Type != "ClusterComputeResource" {
+		return fmt.Errorf("%s is a standalone host, not a cluster", clusterName)
+	}
+	cluster := object.NewClusterComputeResource(client.vimClient.Client, cr.Reference())
+	info, err := getClusterConfigInfoEx(cluster)
+	if err != nil {
+		return err
+	}
+
+	var refs []types.ManagedObjectReference
+	for _, group := range info.Group {
+		if g, ok := group.(*types.ClusterHostGroup); ok {
+			refs = append(refs, g.Host...)
+		}
+	}
+	hostNames := make(map[string]string)
+	if len(refs) > 0 {
+		var hosts []mo.HostSystem
+		collector := property.DefaultCollector(client.vimClient.Client)
+		if err := collector.Retrieve(context.TODO(), refs, []string{"name"}, &hosts); err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			hostNames[host.Self.Value] = host.Name
+		}
+	}
+
+	groups, err := flattenClusterHostGroups(info, hostNames, d.Get("name").(string))
+	if err != nil {
+		return fmt.Errorf("cluster %s: %s", clusterName, err)
+	}
+	log.Printf("[DEBUG] Host groups of cluster %s: %#v", clusterName, groups)
+
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.(map[string]interface{})["name"].(string))
+	}
+
+	id := cluster.Reference().Value
+	if name := d.Get("name").(string); name != "" {
+		id += ":" + name
+	}
+	d.SetId(id)
+	d.Set("names", names)
+	d.Set("host_groups", groups)
+	return nil
+}
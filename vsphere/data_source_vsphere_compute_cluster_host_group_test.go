@@ -0,0 +1,48 @@
+package vsphere
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestAccVSphereComputeClusterHostGroup_flatten(t *testing.T) {
+	info := &types.ClusterConfigInfoEx{
+		Group: []types.BaseClusterGroupInfo{
+			&types.ClusterHostGroup{
+				ClusterGroupInfo: types.ClusterGroupInfo{Name: "rack2"},
+				Host:             []types.ManagedObjectReference{{Type: "HostSystem", Value: "host-2"}},
+			},
+			&types.ClusterVmGroup{
+				ClusterGroupInfo: types.ClusterGroupInfo{Name: "db"},
+			},
+			&types.ClusterHostGroup{
+				ClusterGroupInfo: types.ClusterGroupInfo{Name: "rack1"},
+				Host:             []types.ManagedObjectReference{{Type: "HostSystem", Value: "host-1"}},
+			},
+		},
+	}
+	hostNames := map[string]string{"host-1": "esx1", "host-2": "esx2"}
+
+	groups, err := flattenClusterHostGroups(info, hostNames, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"name": "rack1", "hosts": []string{"esx1"}, "host_ids": []string{"host-1"}},
+		map[string]interface{}{"name": "rack2", "hosts": []string{"esx2"}, "host_ids": []string{"host-2"}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, groups)
+	}
+
+	groups, err = flattenClusterHostGroups(info, hostNames, "rack2")
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("expected only rack2, got %#v (%v)", groups, err)
+	}
+	// VM groups are not host groups.
+	if _, err := flattenClusterHostGroups(info, hostNames, "db"); err == nil {
+		t.Fatal("expected an error for a VM group")
+	}
+}
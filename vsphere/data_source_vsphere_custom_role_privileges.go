@@ -0,0 +1,141 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+func dataSourceVSphereCustomRolePrivileges() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceVSphereCustomRolePrivilegesRead,
+
+		Schema: map[string]*schema.Schema{
+			// Lists the privileges of this role in role_privileges.
+			"role_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			"role_id": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"role_privileges": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			// The IDs of all privileges, e.g. VirtualMachine.Interact.PowerOn.
+			"privilege_ids": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"privileges": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						"name": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						"group": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						// The privilege is checked on the parent of the entity.
+						"on_parent": &schema.Schema{
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// flattenPrivileges returns the privilege IDs and blocks sorted by ID.
+func flattenPrivileges(privs []types.AuthorizationPrivilege) ([]string, []interface{}) {
+	sorted := make([]types.AuthorizationPrivilege, len(privs))
+	copy(sorted, privs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PrivId < sorted[j].PrivId })
+
+	ids := make([]string, 0, len(sorted))
+	blocks := make([]interface{}, 0, len(sorted))
+	for _, p := range sorted {
+		ids = append(ids, p.PrivId)
+		blocks = append(blocks, map[string]interface{}{
+			"id":        p.PrivId,
+			"name":      p.Name,
+			"group":     p.PrivGroupName,
+			"on_parent": p.OnParent,
+		})
+	}
+	return ids, blocks
+}
+
+// rolePrivileges returns the sorted privileges of the named role.
+func rolePrivileges(roleList object.AuthorizationRoleList, name string) (*types.AuthorizationRole, []string, error) {
+	role := roleList.ByName(name)
+	if role == nil {
+		return nil, nil, fmt.Errorf("Role '%s' not found.", name)
+	}
+	privs := make([]string, len(role.Privilege))
+	copy(privs, role.Privilege)
+	sort.Strings(privs)
+	return role, privs, nil
+}
+
+func dataSourceVSphereCustomRolePrivilegesRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*VSphereClient).vimClient
+	am := object.NewAuthorizationManager(client.Client)
+
+	var mam mo.AuthorizationManager
+	collector := property.DefaultCollector(client.Client)
+	if err := collector.RetrieveOne(context.TODO(), am.Reference(), []string{"privilegeList"}, &mam); err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Found %d privileges", len(mam.PrivilegeList))
+
+	ids, blocks := flattenPrivileges(mam.PrivilegeList)
+	d.Set("privilege_ids", ids)
+	d.Set("privileges", blocks)
+
+	id := "privileges"
+	if name, ok := d.GetOk("role_name"); ok {
+		roleList, err := am.RoleList(context.TODO())
+		if err != nil {
+			return err
+		}
+		role, privs, err := rolePrivileges(roleList, name.(string))
+		if err != nil {
+			return err
+		}
+		d.Set("role_id", role.RoleId)
+		d.Set("role_privileges", privs)
+		id = fmt.Sprintf("privileges/%d", role.RoleId)
+	}
+
+	d.SetId(id)
+	return nil
+}
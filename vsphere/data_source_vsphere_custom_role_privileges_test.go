@@ -0,0 +1,36 @@
+package vsphere
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestAccVSphereCustomRolePrivileges_flatten(t *testing.T) {
+	ids, blocks := flattenPrivileges([]types.AuthorizationPrivilege{
+		{PrivId: "VirtualMachine.Interact.PowerOn", Name: "PowerOn", PrivGroupName: "VirtualMachine.Interact"},
+		{PrivId: "System.Read", Name: "Read", PrivGroupName: "System"},
+	})
+	if !reflect.DeepEqual(ids, []string{"System.Read", "VirtualMachine.Interact.PowerOn"}) {
+		t.Fatalf("unexpected privilege IDs: %#v", ids)
+	}
+	if block := blocks[1].(map[string]interface{}); block["group"] != "VirtualMachine.Interact" || block["name"] != "PowerOn" {
+		t.Fatalf("unexpected privilege: %#v", block)
+	}
+
+	roles := object.AuthorizationRoleList{
+		{RoleId: 10, Name: "operator", Privilege: []string{"VirtualMachine.Interact.PowerOn", "System.Read"}},
+	}
+	role, privs, err := rolePrivileges(roles, "operator")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if role.RoleId != 10 || !reflect.DeepEqual(privs, []string{"System.Read", "VirtualMachine.Interact.PowerOn"}) {
+		t.Fatalf("unexpected role privileges: %d %#v", role.RoleId, privs)
+	}
+	if _, _, err = rolePrivileges(roles, "missing"); err == nil {
+		t.Fatalf("expected an error for an unknown role")
+	}
+}
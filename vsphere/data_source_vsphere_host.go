@@ -0,0 +1,245 @@
+package vsphere
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+func dataSourceVSphereHost() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceVSphereHostRead,
+
+		Schema: map[string]*schema.Schema{
+			// Name or inventory path of the host, e.g. cluster1/esx1.example.com.
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			"datacenter": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			"moid": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"version": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"vendor": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"model": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"cpu_model": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"cpu_packages": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"cpu_cores": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"cpu_threads": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"cpu_mhz": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			// In MB.
+			"memory": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"connection_state": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"maintenance_mode": &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+
+			// The EVC mode the host runs in and the most capable one it
+			// supports, e.g. intel-sandybridge.
+			"current_evc_mode": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"max_evc_mode": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"datastores": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"networks": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			// The boolean capabilities of the host by their name in snake
+			// case, e.g. vmotion_supported or nested_hv_supported.
+			"capabilities": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// snakeCase converts a field name like NestedHVSupported to
+// nested_hv_supported.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b bytes.Buffer
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// flattenHostCapabilities returns the boolean capabilities the host reports.
+// Capabilities it does not report are left out.
+func flattenHostCapabilities(capability *types.HostCapability) map[string]interface{} {
+	capabilities := make(map[string]interface{})
+	if capability == nil {
+		return capabilities
+	}
+
+	v := reflect.ValueOf(*capability)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := snakeCase(v.Type().Field(i).Name)
+		switch field.Kind() {
+		case reflect.Bool:
+			capabilities[name] = strconv.FormatBool(field.Bool())
+		case reflect.Ptr:
+			if !field.IsNil() && field.Elem().Kind() == reflect.Bool {
+				capabilities[name] = strconv.FormatBool(field.Elem().Bool())
+			}
+		}
+	}
+	return capabilities
+}
+
+// managedObjectNames returns the sorted names of the managed objects.
+func managedObjectNames(collector *property.Collector, refs []types.ManagedObjectReference) ([]string, error) {
+	names := make([]string, 0, len(refs))
+	if len(refs) == 0 {
+		return names, nil
+	}
+	var entities []mo.ManagedEntity
+	if err := collector.Retrieve(context.TODO(), refs, []string{"name"}, &entities); err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func dataSourceVSphereHostRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*VSphereClient).vimClient
+	dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
+	if err != nil {
+		return err
+	}
+	finder := find.NewFinder(client.Client, true)
+	finder = finder.SetDatacenter(dc)
+
+	name := d.Get("name").(string)
+	host, err := finder.HostSystem(context.TODO(), name)
+	if err != nil {
+		return fmt.Errorf("host %s not found: %s", name, err)
+	}
+
+	var mhost mo.HostSystem
+	collector := property.DefaultCollector(client.Client)
+	props := []string{"summary", "capability", "datastore", "network", "runtime"}
+	if err := collector.RetrieveOne(context.TODO(), host.Reference(), props, &mhost); err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Host %s summary: %#v", name, mhost.Summary)
+
+	datastores, err := managedObjectNames(collector, mhost.Datastore)
+	if err != nil {
+		return err
+	}
+	networks, err := managedObjectNames(collector, mhost.Network)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(host.Reference().Value)
+	d.Set("moid", host.Reference().Value)
+	if hw := mhost.Summary.Hardware; hw != nil {
+		d.Set("vendor", hw.Vendor)
+		d.Set("model", hw.Model)
+		d.Set("cpu_model", hw.CpuModel)
+		d.Set("cpu_packages", int(hw.NumCpuPkgs))
+		d.Set("cpu_cores", int(hw.NumCpuCores))
+		d.Set("cpu_threads", int(hw.NumCpuThreads))
+		d.Set("cpu_mhz", int(hw.CpuMhz))
+		d.Set("memory", int(hw.MemorySize/1024/1024))
+	}
+	if product := mhost.Summary.Config.Product; product != nil {
+		d.Set("version", product.Version)
+	}
+	d.Set("connection_state", string(mhost.Runtime.ConnectionState))
+	d.Set("maintenance_mode", mhost.Runtime.InMaintenanceMode)
+	d.Set("current_evc_mode", mhost.Summary.CurrentEVCModeKey)
+	d.Set("max_evc_mode", mhost.Summary.MaxEVCModeKey)
+	d.Set("datastores", datastores)
+	d.Set("networks", networks)
+	d.Set("capabilities", flattenHostCapabilities(mhost.Capability))
+	return nil
+}
@@ -0,0 +1,32 @@
+package vsphere
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestAccVSphereHost_capabilities(t *testing.T) {
+	for name, expected := range map[string]string{
+		"VmotionSupported":          "vmotion_supported",
+		"NestedHVSupported":         "nested_hv_supported",
+		"FtSupported":               "ft_supported",
+		"VmDirectPathGen2Supported": "vm_direct_path_gen2_supported",
+	} {
+		if got := snakeCase(name); got != expected {
+			t.Fatalf("expected %s for %s, got %s", expected, name, got)
+		}
+	}
+
+	capabilities := flattenHostCapabilities(&types.HostCapability{
+		VmotionSupported:  true,
+		NestedHVSupported: types.NewBool(false),
+	})
+	if capabilities["vmotion_supported"] != "true" || capabilities["nested_hv_supported"] != "false" {
+		t.Fatalf("unexpected capabilities: %#v", capabilities)
+	}
+	// Capabilities the host does not report are left out.
+	if _, ok := capabilities["ft_supported"]; ok {
+		t.Fatalf("expected ft_supported to be left out: %#v", capabilities)
+	}
+}
@@ -0,0 +1,204 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+func dataSourceVSphereTemplate() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceVSphereTemplateRead,
+
+		Schema: map[string]*schema.Schema{
+			// Path of the template relative to the VM folder of the
+			// datacenter, as in the template of a disk.
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			"datacenter": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			"uuid": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			// false when the source is a virtual machine rather than a
+			// template.
+			"is_template": &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+
+			"guest_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			// e.g. vmx-11
+			"hardware_version": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"cpu": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"memory": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"network_interface_count": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			// The networks of the network interfaces, in device order.
+			"networks": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"disk": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"label": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						// In GB, rounded up.
+						"size": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+
+						"thin": &schema.Schema{
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+
+						"datastore": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						"path": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// flattenTemplateDisks returns the disks of a template in device order.
+func flattenTemplateDisks(devices object.VirtualDeviceList) []interface{} {
+	disks := make([]interface{}, 0)
+	for _, device := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		vd := device.(*types.VirtualDisk)
+
+		// Round up, a clone cannot have a smaller disk than its template.
+		size := (vd.CapacityInKB + 1024*1024 - 1) / (1024 * 1024)
+		disk := map[string]interface{}{
+			"label": devices.Name(vd),
+			"size":  int(size),
+			"thin":  false,
+		}
+
+		var fileName string
+		switch backing := vd.Backing.(type) {
+		case *types.VirtualDiskFlatVer2BackingInfo:
+			fileName = backing.FileName
+			if backing.ThinProvisioned != nil {
+				disk["thin"] = *backing.ThinProvisioned
+			}
+		case *types.VirtualDiskSparseVer2BackingInfo:
+			fileName = backing.FileName
+			disk["thin"] = true
+		case *types.VirtualDiskSeSparseBackingInfo:
+			fileName = backing.FileName
+			disk["thin"] = true
+		}
+		dpath := new(object.DatastorePath)
+		if dpath.FromString(fileName) {
+			disk["datastore"] = dpath.Datastore
+			disk["path"] = dpath.Path
+		}
+
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+// templateNetworks returns the networks of the network interfaces of a
+// template in device order.
+func templateNetworks(devices object.VirtualDeviceList) []string {
+	networks := make([]string, 0)
+	for _, device := range devices.SelectByType((*types.VirtualEthernetCard)(nil)) {
+		card := device.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		networks = append(networks, networkBackingName(card))
+	}
+	return networks
+}
+
+func dataSourceVSphereTemplateRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*VSphereClient).vimClient
+	dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
+	if err != nil {
+		return err
+	}
+	finder := find.NewFinder(client.Client, true)
+	finder = finder.SetDatacenter(dc)
+
+	name := d.Get("name").(string)
+	template, err := finder.VirtualMachine(context.TODO(), name)
+	if err != nil {
+		return fmt.Errorf("template %s not found: %s", name, err)
+	}
+
+	var mvm mo.VirtualMachine
+	if err := template.Properties(context.TODO(), template.Reference(), []string{"config"}, &mvm); err != nil {
+		return err
+	}
+	if mvm.Config == nil {
+		return fmt.Errorf("template %s has no configuration", name)
+	}
+	log.Printf("[DEBUG] Template %s config: %#v", name, mvm.Config)
+
+	devices := object.VirtualDeviceList(mvm.Config.Hardware.Device)
+	networks := templateNetworks(devices)
+
+	d.SetId(mvm.Config.Uuid)
+	d.Set("uuid", mvm.Config.Uuid)
+	d.Set("is_template", mvm.Config.Template)
+	d.Set("guest_id", mvm.Config.GuestId)
+	d.Set("hardware_version", mvm.Config.Version)
+	d.Set("cpu", mvm.Config.Hardware.NumCPU)
+	d.Set("memory", mvm.Config.Hardware.MemoryMB)
+	d.Set("network_interface_count", len(networks))
+	d.Set("networks", networks)
+	if err := d.Set("disk", flattenTemplateDisks(devices)); err != nil {
+		return fmt.Errorf("Invalid disks to set: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package vsphere
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func testTemplateDisk(key int32, capacityInKB int64, fileName string, thin bool) *types.VirtualDisk {
+	return &types.VirtualDisk{
+		VirtualDevice: types.VirtualDevice{
+			Key: key,
+			Backing: &types.VirtualDiskFlatVer2BackingInfo{
+				VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{FileName: fileName},
+				ThinProvisioned:              types.NewBool(thin),
+			},
+		},
+		CapacityInKB: capacityInKB,
+	}
+}
+
+func TestAccVSphereTemplate_introspection(t *testing.T) {
+	devices := object.VirtualDeviceList{
+		testTemplateDisk(2000, 16*1024*1024, "[datastore1] centos7/centos7.vmdk", true),
+		testNetworkCard(4000, "VM Network", "00:50:56:00:00:01"),
+		testTemplateDisk(2001, 1536*1024, "[datastore2] centos7/centos7_1.vmdk", false),
+		testNetworkCard(4001, "backend", "00:50:56:00:00:02"),
+	}
+
+	disks := flattenTemplateDisks(devices)
+	if len(disks) != 2 {
+		t.Fatalf("expected 2 disks, got %#v", disks)
+	}
+	root := disks[0].(map[string]interface{})
+	if root["size"] != 16 || root["thin"] != true || root["datastore"] != "datastore1" || root["path"] != "centos7/centos7.vmdk" {
+		t.Fatalf("unexpected root disk: %#v", root)
+	}
+	// A partial GB is rounded up.
+	if data := disks[1].(map[string]interface{}); data["size"] != 2 || data["thin"] != false {
+		t.Fatalf("unexpected data disk: %#v", data)
+	}
+
+	if networks := templateNetworks(devices); !reflect.DeepEqual(networks, []string{"VM Network", "backend"}) {
+		t.Fatalf("unexpected networks: %#v", networks)
+	}
+}
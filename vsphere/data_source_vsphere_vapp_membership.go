@@ -0,0 +1,147 @@
+package vsphere
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vsphere_vapp_membership reads the virtual machines which are currently
+// members of a vApp, so members added outside of Terraform can be flagged.
+
+func dataSourceVSphereVAppMembership() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceVSphereVAppMembershipRead,
+
+		Schema: map[string]*schema.Schema{
+			"datacenter": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			// Inventory path of the vApp, e.g. parent_vapp/vapp1.
+			"path": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			// Names or moids of the virtual machines which are expected in
+			// the vApp, the other members are listed in unmanaged_members.
+			"managed_members": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"power_state": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"members": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"moid": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"power_state": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+
+			// Names of the members which are not in managed_members.
+			"unmanaged_members": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// flattenVAppMembers returns the members of the vApp sorted by name, and the
+// names of the members which are neither named nor referenced by moid in
+// managed.
+func flattenVAppMembers(mvms []mo.VirtualMachine, managed []string) ([]interface{}, []string) {
+	known := make(map[string]bool)
+	for _, m := range managed {
+		known[m] = true
+	}
+	sort.Slice(mvms, func(i, j int) bool { return mvms[i].Name < mvms[j].Name })
+
+	members := make([]interface{}, 0, len(mvms))
+	unmanaged := make([]string, 0)
+	for _, mvm := range mvms {
+		members = append(members, map[string]interface{}{
+			"name":        mvm.Name,
+			"moid":        mvm.Self.Value,
+			"power_state": string(mvm.Runtime.PowerState),
+		})
+		if !known[mvm.Name] && !known[mvm.Self.Value] {
+			unmanaged = append(unmanaged, mvm.Name)
+		}
+	}
+	return members, unmanaged
+}
+
+func dataSourceVSphereVAppMembershipRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*VSphereClient)
+	dc, err := client.getDatacenter(d.Get("datacenter").(string))
+	if err != nil {
+		return err
+	}
+
+	path := d.Get("path").(string)
+	vapp, err := client.getFinder(dc).VirtualApp(context.TODO(), path)
+	if err != nil {
+		return fmt.Errorf("vApp %s not found: %s", path, err)
+	}
+
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(client.vimClient.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.Reference(), []string{"summary", "vm"}, &mvapp); err != nil {
+		return err
+	}
+
+	var mvms []mo.VirtualMachine
+	if len(mvapp.Vm) > 0 {
+		if err := collector.Retrieve(context.TODO(), mvapp.Vm, []string{"name", "runtime.powerState"}, &mvms); err != nil {
+			return err
+		}
+	}
+	var vmStates []types.VirtualMachinePowerState
+	for _, mvm := range mvms {
+		vmStates = append(vmStates, mvm.Runtime.PowerState)
+	}
+	var state types.VirtualAppVAppState
+	if summary, ok := mvapp.Summary.(*types.VirtualAppSummary); ok {
+		state = summary.VAppState
+	}
+
+	var managed []string
+	for _, v := range d.Get("managed_members").([]interface{}) {
+		managed = append(managed, v.(string))
+	}
+	members, unmanaged := flattenVAppMembers(mvms, managed)
+
+	d.SetId(vapp.Reference().Value)
+	d.Set("power_state", vAppPowerState(state, vmStates))
+	d.Set("members", members)
+	d.Set("unmanaged_members", unmanaged)
+	return nil
+}
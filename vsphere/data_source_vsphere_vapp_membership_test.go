@@ -0,0 +1,34 @@
+package vsphere
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestAccVSphereVAppMembership_flatten(t *testing.T) {
+	vm := func(moid, name string, state types.VirtualMachinePowerState) mo.VirtualMachine {
+		mvm := mo.VirtualMachine{Runtime: types.VirtualMachineRuntimeInfo{PowerState: state}}
+		mvm.Self = types.ManagedObjectReference{Type: vAppEntityTypeVm, Value: moid}
+		mvm.Name = name
+		return mvm
+	}
+	mvms := []mo.VirtualMachine{
+		vm("vm-2", "web", types.VirtualMachinePowerStatePoweredOn),
+		vm("vm-3", "stray", types.VirtualMachinePowerStatePoweredOff),
+		vm("vm-1", "db", types.VirtualMachinePowerStatePoweredOn),
+	}
+
+	members, unmanaged := flattenVAppMembers(mvms, []string{"db", "vm-2"})
+	if len(members) != 3 || members[0].(map[string]interface{})["name"] != "db" {
+		t.Fatalf("expected the members sorted by name, got %#v", members)
+	}
+	if members[1].(map[string]interface{})["power_state"] != "poweredOff" {
+		t.Fatalf("unexpected power state of stray: %#v", members[1])
+	}
+	if !reflect.DeepEqual(unmanaged, []string{"stray"}) {
+		t.Fatalf("expected stray to be unmanaged, got %#v", unmanaged)
+	}
+}
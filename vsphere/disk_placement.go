@@ -0,0 +1,281 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// diskDatastore places a disk of a template, or of a VM of a template vApp,
+// on a datastore other than the one of the clone. Disks are identified by
+// their label, e.g. "Hard disk 2".
+type diskDatastore struct {
+	entity    string
+	label     string
+	datastore string
+}
+
+// templateDiskDatastoreSchema returns the schema of the per disk placement.
+// With entity the disks belong to the VMs of a template vApp.
+func templateDiskDatastoreSchema(entity bool) *schema.Schema {
+	s := map[string]*schema.Schema{
+		"label": &schema.Schema{
+			Type:        schema.TypeString,
+			Required:    true,
+			Description: "Label of the disk of the template, e.g. Hard disk 2.",
+		},
+		"datastore": &schema.Schema{
+			Type:     schema.TypeString,
+			Required: true,
+		},
+	}
+	if entity {
+		s["entity"] = &schema.Schema{
+			Type:        schema.TypeString,
+			Required:    true,
+			Description: "Name of the VM of the template vApp.",
+		}
+	}
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		ForceNew: true,
+		Elem:     &schema.Resource{Schema: s},
+	}
+}
+
+func parseDiskDatastores(vL []interface{}) []diskDatastore {
+	var placements []diskDatastore
+	for _, v := range vL {
+		m := v.(map[string]interface{})
+		p := diskDatastore{
+			label:     m["label"].(string),
+			datastore: m["datastore"].(string),
+		}
+		if entity, ok := m["entity"].(string); ok {
+			p.entity = entity
+		}
+		placements = append(placements, p)
+	}
+	return placements
+}
+
+// resolveDatastore returns the datastore of the given name. Disks of a clone
+// are placed on datastores, not on datastore clusters.
+func resolveDatastore(c *govmomi.Client, dcFolders *object.DatacenterFolders, name string) (types.ManagedObjectReference, error) {
+	ref, err := getDatastoreObject(c, dcFolders, name)
+	if err != nil {
+		return ref, err
+	}
+	if ref.Type == "StoragePod" {
+		return ref, fmt.Errorf("%s is a datastore cluster, disks can only be placed on datastores", name)
+	}
+	return ref, nil
+}
+
+// diskLocatorsByLabel returns the locators placing the labeled disks of the
+// devices on their datastore.
+func diskLocatorsByLabel(devices object.VirtualDeviceList, datastores map[string]types.ManagedObjectReference) ([]types.VirtualMachineRelocateSpecDiskLocator, error) {
+	var locators []types.VirtualMachineRelocateSpecDiskLocator
+	var labels []string
+	found := make(map[string]bool)
+	for _, device := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		d := device.GetVirtualDevice()
+		if d.DeviceInfo == nil {
+			continue
+		}
+		label := d.DeviceInfo.GetDescription().Label
+		labels = append(labels, label)
+		ds, ok := datastores[label]
+		if !ok {
+			continue
+		}
+		found[label] = true
+		locators = append(locators, types.VirtualMachineRelocateSpecDiskLocator{
+			DiskId:    d.Key,
+			Datastore: ds,
+		})
+	}
+
+	var missing []string
+	for label := range datastores {
+		if !found[label] {
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("disks %s not found, the disks are %s",
+			strings.Join(missing, ", "), strings.Join(labels, ", "))
+	}
+	return locators, nil
+}
+
+// mergeDiskLocators adds the locators to the relocate spec. A disk which is
+// already located keeps its backing and only changes its datastore.
+func mergeDiskLocators(spec *types.VirtualMachineRelocateSpec, locators []types.VirtualMachineRelocateSpecDiskLocator) {
+	for _, l := range locators {
+		merged := false
+		for i := range spec.Disk {
+			if spec.Disk[i].DiskId == l.DiskId {
+				spec.Disk[i].Datastore = l.Datastore
+				merged = true
+			}
+		}
+		if !merged {
+			spec.Disk = append(spec.Disk, l)
+		}
+	}
+}
+
+// templateDiskLocators places the disks of the template listed in
+// template_disk_datastore.
+func (vm *virtualMachine) templateDiskLocators(c *govmomi.Client, dcFolders *object.DatacenterFolders, template *object.VirtualMachine) ([]types.VirtualMachineRelocateSpecDiskLocator, error) {
+	if len(vm.templateDiskDatastores) == 0 {
+		return nil, nil
+	}
+	if vm.linkedClone {
+		return nil, fmt.Errorf("template_disk_datastore cannot be used with linked_clone")
+	}
+
+	datastores := make(map[string]types.ManagedObjectReference)
+	for _, p := range vm.templateDiskDatastores {
+		ref, err := resolveDatastore(c, dcFolders, p.datastore)
+		if err != nil {
+			return nil, err
+		}
+		datastores[p.label] = ref
+	}
+	devices, err := template.Device(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	locators, err := diskLocatorsByLabel(devices, datastores)
+	if err != nil {
+		return nil, fmt.Errorf("template_disk_datastore of template %s: %s", vm.template, err)
+	}
+	return locators, nil
+}
+
+// validateDiskPlacement checks that the entities of entity_datastore and
+// disk_datastore are VMs of the source vApp and that their datastores exist.
+func (vapp *vApp) validateDiskPlacement() error {
+	t := vapp.vAppToClone
+	if len(t.entityDatastores) == 0 && len(t.diskDatastores) == 0 {
+		return nil
+	}
+
+	sourceVApp, err := vapp.finder.VirtualApp(context.TODO(), t.name)
+	if err != nil {
+		return fmt.Errorf("template_vapp %s not found: %s", t.name, err)
+	}
+	sourceVMs, err := vapp.getVAppVMsByName(sourceVApp.Reference())
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	check := func(attr, entity, datastore string) {
+		if _, ok := sourceVMs[entity]; !ok {
+			errs = append(errs, fmt.Sprintf("%s: %s is not a VM of vApp %s", attr, entity, t.name))
+		}
+		if _, err := resolveDatastore(vapp.c, vapp.dcFolders, datastore); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", attr, err))
+		}
+	}
+	for name, datastore := range t.entityDatastores {
+		check("entity_datastore", name, datastore)
+	}
+	for _, p := range t.diskDatastores {
+		check("disk_datastore", p.entity, p.datastore)
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("Invalid datastore placement of template_vapp:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// entityResourceMapping places the VMs of the template vApp listed in
+// entity_datastore on their datastore.
+func (vapp *vApp) entityResourceMapping(sourceVApp *object.VirtualApp) ([]types.VAppCloneSpecResourceMap, error) {
+	if len(vapp.vAppToClone.entityDatastores) == 0 {
+		return nil, nil
+	}
+	sourceVMs, err := vapp.getVAppVMsByName(sourceVApp.Reference())
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping []types.VAppCloneSpecResourceMap
+	for name, datastore := range vapp.vAppToClone.entityDatastores {
+		mvm, ok := sourceVMs[name]
+		if !ok {
+			return nil, fmt.Errorf("entity_datastore: %s is not a VM of vApp %s", name, vapp.vAppToClone.name)
+		}
+		ref, err := resolveDatastore(vapp.c, vapp.dcFolders, datastore)
+		if err != nil {
+			return nil, err
+		}
+		mapping = append(mapping, types.VAppCloneSpecResourceMap{
+			Source:   mvm.Reference(),
+			Location: &ref,
+		})
+	}
+	return mapping, nil
+}
+
+// applyDiskPlacement moves the disks of the cloned VMs listed in
+// disk_datastore. CloneVApp_Task places each VM as a whole, so the disks are
+// relocated once the clone exists.
+func (vapp *vApp) applyDiskPlacement() error {
+	if len(vapp.vAppToClone.diskDatastores) == 0 {
+		return nil
+	}
+	clonedVMs, err := vapp.getVAppVMsByName(vapp.createdVApp.Reference())
+	if err != nil {
+		return err
+	}
+
+	byEntity := make(map[string]map[string]types.ManagedObjectReference)
+	for _, p := range vapp.vAppToClone.diskDatastores {
+		ref, err := resolveDatastore(vapp.c, vapp.dcFolders, p.datastore)
+		if err != nil {
+			return err
+		}
+		if byEntity[p.entity] == nil {
+			byEntity[p.entity] = make(map[string]types.ManagedObjectReference)
+		}
+		byEntity[p.entity][p.label] = ref
+	}
+
+	for name, datastores := range byEntity {
+		mvm, ok := clonedVMs[name]
+		if !ok || mvm.Config == nil {
+			return fmt.Errorf("disk_datastore: VM %s not found in cloned vApp %s", name, vapp.name)
+		}
+		locators, err := diskLocatorsByLabel(object.VirtualDeviceList(mvm.Config.Hardware.Device), datastores)
+		if err != nil {
+			return fmt.Errorf("disk_datastore of VM %s: %s", name, err)
+		}
+
+		log.Printf("[INFO] Placing %d disk(s) of VM %s", len(locators), name)
+		vm := object.NewVirtualMachine(vapp.c.Client, mvm.Reference())
+		spec := types.VirtualMachineRelocateSpec{Disk: locators}
+		task, err := vm.Relocate(context.TODO(), spec, types.VirtualMachineMovePriorityDefaultPriority)
+		if err != nil {
+			return err
+		}
+		if err := vapp.waitForTask(task, fmt.Sprintf("place the disks of VM %s", name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package vsphere
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// vimFaultFromError extracts the vSphere fault carried by a task or SOAP
+// error. It returns nil for errors which do not originate from vCenter.
+func vimFaultFromError(err error) types.BaseMethodFault {
+	switch e := err.(type) {
+	case task.Error:
+		return e.Fault()
+	case *task.Error:
+		return e.Fault()
+	}
+
+	if soap.IsSoapFault(err) {
+		if f, ok := soap.ToSoapFault(err).VimFault().(types.BaseMethodFault); ok {
+			return f
+		}
+	}
+
+	if soap.IsVimFault(err) {
+		return soap.ToVimFault(err)
+	}
+
+	return nil
+}
+
+// isManagedObjectNotFoundError reports whether err says that the referenced
+// managed object no longer exists.
+func isManagedObjectNotFoundError(err error) bool {
+	_, ok := vimFaultFromError(err).(*types.ManagedObjectNotFound)
+	return ok
+}
+
+// translateVSphereError turns common vCenter faults into messages naming the
+// affected entity and a possible remediation. Errors which are not vSphere
+// faults, or faults without a translation, are returned unchanged.
+func translateVSphereError(err error, entity string) error {
+	if err == nil {
+		return nil
+	}
+
+	fault := vimFaultFromError(err)
+	if fault == nil {
+		return err
+	}
+
+	switch f := fault.(type) {
+	case *types.DuplicateName:
+		return fmt.Errorf("%s: an object named %q already exists at this location. "+
+			"Choose a different name or remove the existing object first. (%s)",
+			entity, f.Name, err)
+
+	case *types.NoPermission:
+		return fmt.Errorf("%s: the user lacks the privilege %q on %s. "+
+			"Grant the privilege to the user or use an account which holds it. (%s)",
+			entity, f.PrivilegeId, f.Object.Value, err)
+
+	case *types.InvalidPowerState:
+		return fmt.Errorf("%s: the operation is not allowed in power state %q, expected %q. "+
+			"Power the entity on or off as required and retry. (%s)",
+			entity, f.ExistingState, f.RequestedState, err)
+
+	case types.BaseInsufficientResourcesFault:
+		return fmt.Errorf("%s: the target cluster, host or resource pool has insufficient "+
+			"resources. Lower the reservations or free capacity on the target and retry. (%s)",
+			entity, err)
+
+	case types.BaseInvalidState:
+		return fmt.Errorf("%s: the entity is in a state which does not allow this "+
+			"operation, e.g. another task is running or it is in maintenance mode. "+
+			"Wait for pending tasks to finish and retry. (%s)",
+			entity, err)
+	}
+
+	return err
+}
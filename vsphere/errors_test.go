@@ -0,0 +1,45 @@
+package vsphere
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func testTaskError(fault types.BaseMethodFault) error {
+	return task.Error{
+		LocalizedMethodFault: &types.LocalizedMethodFault{
+			Fault:            fault,
+			LocalizedMessage: "fault message",
+		},
+	}
+}
+
+func TestTranslateVSphereError(t *testing.T) {
+	cases := []struct {
+		err    error
+		expMsg string
+	}{
+		{testTaskError(&types.DuplicateName{Name: "web01"}), "an object named \"web01\" already exists"},
+		{testTaskError(&types.NoPermission{PrivilegeId: "VirtualMachine.Inventory.Create"}), "lacks the privilege"},
+		{testTaskError(&types.InsufficientMemoryResourcesFault{}), "insufficient resources"},
+		{testTaskError(&types.InvalidPowerState{ExistingState: types.VirtualMachinePowerStatePoweredOn}), "power state \"poweredOn\""},
+		{testTaskError(&types.InvalidState{}), "does not allow this operation"},
+		{testTaskError(&types.NotFound{}), "fault message"},
+		{errors.New("plain error"), "plain error"},
+	}
+
+	for _, c := range cases {
+		err := translateVSphereError(c.err, "virtual machine foo")
+		if !strings.Contains(err.Error(), c.expMsg) {
+			t.Errorf("expected error containing %q, got %q", c.expMsg, err)
+		}
+	}
+
+	if translateVSphereError(nil, "foo") != nil {
+		t.Errorf("expected nil error to stay nil")
+	}
+}
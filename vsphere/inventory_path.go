@@ -0,0 +1,220 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// Folder paths of virtual machines and vApps are relative to the VM folder
+// of the datacenter, e.g. "web/frontend" for /dc1/vm/web/frontend. Datacenter
+// names are the name or path of the datacenter below the root folder.
+
+// normalizeFolderPath returns the folder path in the form the resources
+// expect, without surrounding whitespace and slashes and without the vm/
+// prefix of the datacenter VM folder.
+func normalizeFolderPath(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "vm" {
+		return ""
+	}
+	return strings.TrimPrefix(p, "vm/")
+}
+
+// normalizeDatacenterName returns the datacenter name or path without
+// surrounding whitespace and slashes.
+func normalizeDatacenterName(p string) string {
+	return strings.Trim(strings.TrimSpace(p), "/")
+}
+
+// folderPathStateFunc and datacenterNameStateFunc store the normalized
+// value, so "/web/" and "web" do not differ in plans.
+func folderPathStateFunc(v interface{}) string {
+	return normalizeFolderPath(v.(string))
+}
+
+func datacenterNameStateFunc(v interface{}) string {
+	return normalizeDatacenterName(v.(string))
+}
+
+// canonicalInventoryPath returns the full inventory path in the form the
+// resources use as ID, with a leading slash, without a trailing slash and
+// without empty segments, e.g. /dc1/vm/web/frontend.
+func canonicalInventoryPath(p string) string {
+	var segments []string
+	for _, segment := range strings.Split(p, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// isManagedObjectID reports whether a resource ID is a managed object ID, like
+// resgroup-v42, and not the inventory path older states hold.
+func isManagedObjectID(id string) bool {
+	return id != "" && !strings.Contains(id, "/")
+}
+
+// managedObjectInventoryPath returns the canonical inventory path of a
+// managed entity by walking up its parents. vApps are placed in the VM folder
+// tree by their parent folder or parent vApp, their parent is the resource
+// pool.
+func managedObjectInventoryPath(c *vim25.Client, ref types.ManagedObjectReference) (string, error) {
+	collector := property.DefaultCollector(c)
+	var names []string
+	for {
+		var name string
+		var parent *types.ManagedObjectReference
+		if ref.Type == vAppEntityTypeVApp {
+			var mvapp mo.VirtualApp
+			if err := collector.RetrieveOne(context.TODO(), ref, []string{"name", "parentFolder", "parentVApp"}, &mvapp); err != nil {
+				return "", err
+			}
+			name, parent = mvapp.Name, mvapp.ParentFolder
+			if parent == nil {
+				parent = mvapp.ParentVApp
+			}
+		} else {
+			var me mo.ManagedEntity
+			if err := collector.RetrieveOne(context.TODO(), ref, []string{"name", "parent"}, &me); err != nil {
+				return "", err
+			}
+			name, parent = me.Name, me.Parent
+		}
+		// The root folder is not part of inventory paths.
+		if parent == nil {
+			break
+		}
+		names = append([]string{name}, names...)
+		ref = *parent
+	}
+	return canonicalInventoryPath(strings.Join(names, "/")), nil
+}
+
+// migrateInventoryPathToMoid rewrites an inventory path ID to the managed
+// object ID, which is kept in the moid attribute. States without it are
+// looked up by path with the client, if there is one.
+func migrateInventoryPathToMoid(is *terraform.InstanceState, meta interface{}) error {
+	if is.ID == "" {
+		return nil
+	}
+	if is.Attributes == nil {
+		is.Attributes = make(map[string]string)
+	}
+	// A path of an object in the root of its folder has no slash, like a
+	// moid, the moid attribute tells them apart.
+	if moid := is.Attributes["moid"]; moid != "" {
+		if moid != is.ID {
+			is.Attributes["inventory_path"] = canonicalInventoryPath(is.ID)
+			is.ID = moid
+		}
+		return nil
+	}
+	if isManagedObjectID(is.ID) {
+		return nil
+	}
+	is.Attributes["inventory_path"] = canonicalInventoryPath(is.ID)
+
+	client, ok := meta.(*VSphereClient)
+	if !ok {
+		log.Printf("[DEBUG] No moid for ID %s, it is looked up by path on refresh", is.ID)
+		return nil
+	}
+	ref, err := object.NewSearchIndex(client.vimClient.Client).FindByInventoryPath(
+		context.TODO(), strings.TrimPrefix(canonicalInventoryPath(is.ID), "/"))
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		log.Printf("[DEBUG] %s not found, it is removed from the state on refresh", is.ID)
+		return nil
+	}
+	is.ID = ref.Reference().Value
+	is.Attributes["moid"] = is.ID
+	return nil
+}
+
+// migrateInventoryPathID rewrites an ID holding a path relative to a folder
+// of the datacenter, like vm, to the canonical inventory path. Without a
+// client the datacenter name from the state is taken as its path, and an ID
+// of a resource without a datacenter is left to the next refresh.
+func migrateInventoryPathID(is *terraform.InstanceState, meta interface{}, folder string) error {
+	if is.ID == "" || strings.HasPrefix(is.ID, "/") {
+		return nil
+	}
+
+	dcName := is.Attributes["datacenter"]
+	var dcPath string
+	if client, ok := meta.(*VSphereClient); ok {
+		dc, err := client.getDatacenter(dcName)
+		if err != nil {
+			return err
+		}
+		dcPath = dc.InventoryPath
+	} else if dcName != "" {
+		dcPath = dcName
+	} else {
+		log.Printf("[DEBUG] No datacenter for ID %s, it is canonicalized on refresh", is.ID)
+		return nil
+	}
+
+	is.ID = canonicalInventoryPath(dcPath + "/" + folder + "/" + is.ID)
+	return nil
+}
+
+// checkInventoryPath returns why a normalized inventory path is malformed, or
+// an empty string.
+func checkInventoryPath(p string) string {
+	for _, segment := range strings.Split(p, "/") {
+		switch segment {
+		case "":
+			return "must not contain empty path segments"
+		case ".", "..":
+			return "must not contain relative path segments"
+		}
+	}
+	return ""
+}
+
+// validateFolderPath checks a folder path relative to the VM folder of the
+// datacenter.
+func validateFolderPath(v interface{}, k string) (ws []string, errors []error) {
+	value := normalizeFolderPath(v.(string))
+	if value == "" {
+		return
+	}
+	if msg := checkInventoryPath(value); msg != "" {
+		errors = append(errors, fmt.Errorf("%s: folder path %q %s", k, v, msg))
+	}
+	return
+}
+
+// validateDatacenterName checks the name or path of a datacenter.
+func validateDatacenterName(v interface{}, k string) (ws []string, errors []error) {
+	value := normalizeDatacenterName(v.(string))
+	if value == "" {
+		return
+	}
+	if msg := checkInventoryPath(value); msg != "" {
+		errors = append(errors, fmt.Errorf("%s: datacenter %q %s", k, v, msg))
+		return
+	}
+	for _, segment := range strings.Split(value, "/") {
+		switch segment {
+		case "vm", "host", "datastore", "network":
+			errors = append(errors, fmt.Errorf(
+				"%s: datacenter %q must name the datacenter, not a folder inside it", k, v))
+			return
+		}
+	}
+	return
+}
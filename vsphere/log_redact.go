@@ -0,0 +1,60 @@
+package vsphere
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+
+	"github.com/vmware/govmomi/vim25/debug"
+)
+
+const redactedValue = "<redacted>"
+
+var (
+	// goSensitiveFieldRegexp matches password and secret fields of structs
+	// and maps formatted with %#v or %+v, e.g. adminPassword:secret or
+	// "admin_password":"secret".
+	goSensitiveFieldRegexp = regexp.MustCompile(`(?i)(\b\w*(?:password|secret)\w*"?:\s*)("(?:[^"\\]|\\.)*"|[^\s,})]+)`)
+
+	// soapSensitiveElementRegexp matches password and secret elements of the
+	// SOAP traces of the vSphere API, e.g. the password of Login or the
+	// adminPassword of a customization spec.
+	soapSensitiveElementRegexp = regexp.MustCompile(`(?is)(<(?:\w+:)?\w*(?:password|secret)\w*(?:\s[^>]*)?>).*?(</(?:\w+:)?\w*(?:password|secret)\w*>)`)
+)
+
+// redactSensitive masks the values of password and secret fields in log
+// output.
+func redactSensitive(s string) string {
+	s = goSensitiveFieldRegexp.ReplaceAllString(s, "${1}"+redactedValue)
+	return soapSensitiveElementRegexp.ReplaceAllString(s, "${1}"+redactedValue+"${2}")
+}
+
+// logRedactedf logs like log.Printf, with the values of password and secret
+// fields masked. It is meant for debug lines dumping resource data or specs.
+func logRedactedf(format string, v ...interface{}) {
+	log.Print(redactSensitive(fmt.Sprintf(format, v...)))
+}
+
+// redactingDebugProvider masks passwords and secrets in the SOAP traces
+// written with client_debug.
+type redactingDebugProvider struct {
+	debug.Provider
+}
+
+func (p redactingDebugProvider) NewFile(s string) io.WriteCloser {
+	return redactingWriter{p.Provider.NewFile(s)}
+}
+
+type redactingWriter struct {
+	io.WriteCloser
+}
+
+// Write masks each chunk on its own. The SOAP client writes every request
+// and response body in one piece, so elements are not split.
+func (w redactingWriter) Write(b []byte) (int, error) {
+	if _, err := w.WriteCloser.Write([]byte(redactSensitive(string(b)))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
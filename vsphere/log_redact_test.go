@@ -0,0 +1,34 @@
+package vsphere
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactSensitive(t *testing.T) {
+	cases := []struct {
+		in, secret string
+	}{
+		{`vsphere.windowsOptConfig{productKey:"K", adminPassword:"s3cr3t", domainUser:"admin"}`, "s3cr3t"},
+		{`{productKey:K adminPassword:s3cr3t domainUser:admin}`, "s3cr3t"},
+		{`map[string]interface {}{"admin_password":"s3cr3t", "domain":"example.com"}`, "s3cr3t"},
+		{`<Login><userName>admin</userName><password>s3cr3t</password></Login>`, "s3cr3t"},
+		{`<adminPassword><value>s3cr3t</value><plainText>true</plainText></adminPassword>`, "s3cr3t"},
+	}
+	for _, c := range cases {
+		out := redactSensitive(c.in)
+		if strings.Contains(out, c.secret) || !strings.Contains(out, redactedValue) {
+			t.Fatalf("secret not redacted: %s", out)
+		}
+	}
+
+	// Other fields are kept.
+	out := redactSensitive(`{productKey:K adminPassword:s3cr3t domainUser:admin}`)
+	if !strings.Contains(out, "productKey:K") || !strings.Contains(out, "domainUser:admin}") {
+		t.Fatalf("unexpected redaction: %s", out)
+	}
+	out = redactSensitive(`<userName>admin</userName>`)
+	if out != `<userName>admin</userName>` {
+		t.Fatalf("unexpected redaction: %s", out)
+	}
+}
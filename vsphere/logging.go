@@ -0,0 +1,97 @@
+package vsphere
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Log levels of the provider log_level argument, from the most to the least
+// verbose. Log lines carry their level in brackets, e.g. [DEBUG].
+var logLevels = []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR"}
+
+func validateLogLevel(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(strings.ToUpper(v.(string)), k, logLevels)
+}
+
+func logLevelIndex(level string) int {
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// minLogLevel returns the index of the provider log_level, 0 logs every
+// level. The level is kept per client and applied by resourceLogger, the
+// global log output is left alone, as it is shared by every provider
+// configuration in the plugin and by what Terraform and govmomi log.
+func minLogLevel(level string) int {
+	if i := logLevelIndex(strings.ToUpper(level)); i > 0 {
+		return i
+	}
+	return 0
+}
+
+// newCorrelationID returns the ID tagging the log lines of one Terraform
+// run, to tell runs apart in a shared log.
+func newCorrelationID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// resourceLogger tags log lines with the resource type and name, the
+// operation and the correlation ID of the run, e.g.
+// [INFO] [vsphere_vapp web create 3f9c1a2b] ...
+// Messages are redacted like logRedactedf.
+type resourceLogger struct {
+	prefix string
+	min    int
+}
+
+func newResourceLogger(meta interface{}, resourceType string, name string, operation string) *resourceLogger {
+	correlationID := "-"
+	min := 0
+	if client, ok := meta.(*VSphereClient); ok {
+		if client.correlationID != "" {
+			correlationID = client.correlationID
+		}
+		min = client.logLevel
+	}
+	if name == "" {
+		name = "-"
+	}
+	return &resourceLogger{
+		prefix: fmt.Sprintf("[%s %s %s %s]", resourceType, name, operation, correlationID),
+		min:    min,
+	}
+}
+
+// resourceLogName returns the name a resource is logged with, its name
+// attribute or else its ID.
+func resourceLogName(d *schema.ResourceData, nameAttr string) string {
+	if v, ok := d.GetOk(nameAttr); ok {
+		return v.(string)
+	}
+	return d.Id()
+}
+
+func (l *resourceLogger) printf(level string, format string, v ...interface{}) {
+	if logLevelIndex(level) < l.min {
+		return
+	}
+	log.Print(redactSensitive(fmt.Sprintf("[%s] %s %s", level, l.prefix, fmt.Sprintf(format, v...))))
+}
+
+func (l *resourceLogger) Debugf(format string, v ...interface{}) { l.printf("DEBUG", format, v...) }
+func (l *resourceLogger) Infof(format string, v ...interface{})  { l.printf("INFO", format, v...) }
+func (l *resourceLogger) Warnf(format string, v ...interface{})  { l.printf("WARN", format, v...) }
+func (l *resourceLogger) Errorf(format string, v ...interface{}) { l.printf("ERROR", format, v...) }
@@ -0,0 +1,47 @@
+package vsphere
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogLevelFilter(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	l := newResourceLogger(&VSphereClient{correlationID: "3f9c1a2b", logLevel: minLogLevel("info")}, "vsphere_vapp", "web", "create")
+	l.Debugf("dropped")
+	l.Infof("kept")
+	l.Errorf("kept")
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 || strings.Contains(buf.String(), "dropped") {
+		t.Fatalf("expected the INFO and ERROR lines, got %q", buf.String())
+	}
+
+	buf.Reset()
+	newResourceLogger(&VSphereClient{}, "vsphere_vapp", "web", "create").Debugf("kept")
+	if !strings.Contains(buf.String(), "[DEBUG] [vsphere_vapp web create -] kept") {
+		t.Fatalf("expected every level without log_level, got %q", buf.String())
+	}
+
+	if _, errs := validateLogLevel("debug", "log_level"); len(errs) > 0 {
+		t.Fatalf("expected lower case levels to pass, got %v", errs)
+	}
+	if _, errs := validateLogLevel("verbose", "log_level"); len(errs) == 0 {
+		t.Fatal("expected an unknown level to fail")
+	}
+}
+
+func TestResourceLogger(t *testing.T) {
+	l := newResourceLogger(&VSphereClient{correlationID: "3f9c1a2b"}, "vsphere_vapp", "web", "create")
+	if l.prefix != "[vsphere_vapp web create 3f9c1a2b]" {
+		t.Fatalf("unexpected prefix: %s", l.prefix)
+	}
+	l = newResourceLogger(nil, "vsphere_vapp", "", "read")
+	if l.prefix != "[vsphere_vapp - read -]" {
+		t.Fatalf("unexpected prefix: %s", l.prefix)
+	}
+}
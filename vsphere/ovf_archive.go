@@ -0,0 +1,268 @@
+package vsphere
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/nfc"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// ovfArchiveTimeoutDefault is the time in minutes an export may take. Exports
+// copy every disk, so they get their own timeout instead of eating into the
+// delete timeout.
+const ovfArchiveTimeoutDefault = 60
+
+// ovfArchive describes where a VM or vApp is exported to before it is
+// destroyed. By default a failed export stops the destroy, so nothing is
+// deleted without its archive; continueOnError deletes it anyway.
+type ovfArchive struct {
+	datastore       string
+	folder          string
+	localPath       string
+	timeout         time.Duration
+	continueOnError bool
+}
+
+func archiveOnDestroySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"datastore": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+
+				"folder": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+
+				"local_path": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+
+				"timeout": &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      ovfArchiveTimeoutDefault,
+					Description:  "The time in minutes the export may take.",
+					ValidateFunc: validateOvfArchiveTimeout,
+				},
+
+				"continue_on_error": &schema.Schema{
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Description: "Deletes the entity even when it could not be archived.",
+				},
+			},
+		},
+	}
+}
+
+func parseOvfArchiveData(d *schema.ResourceData) (*ovfArchive, error) {
+	vL, ok := d.GetOk("archive_on_destroy")
+	if !ok || len(vL.([]interface{})) == 0 || vL.([]interface{})[0] == nil {
+		return nil, nil
+	}
+	v := vL.([]interface{})[0].(map[string]interface{})
+
+	a := &ovfArchive{
+		datastore: v["datastore"].(string),
+		folder:    v["folder"].(string),
+		localPath: v["local_path"].(string),
+		timeout:   time.Duration(v["timeout"].(int)) * time.Minute,
+	}
+	if b, ok := v["continue_on_error"].(bool); ok {
+		a.continueOnError = b
+	}
+	if (a.datastore == "") == (a.localPath == "") {
+		return nil, fmt.Errorf("archive_on_destroy: exactly one of datastore or local_path must be set")
+	}
+	if a.folder != "" && a.datastore == "" {
+		return nil, fmt.Errorf("archive_on_destroy: folder can only be set together with datastore")
+	}
+	return a, nil
+}
+
+// archiveBeforeDelete archives the entity within the archive timeout. The
+// error it returns means the entity must not be deleted.
+func (a *ovfArchive) archiveBeforeDelete(c *govmomi.Client, dc *object.Datacenter, entity types.ManagedObjectReference, name string) error {
+	ctx, cancel := taskContext(a.timeout)
+	defer cancel()
+
+	err := a.archive(ctx, c, dc, entity, name)
+	err = taskTimeoutError(ctx, err, "archive "+name, a.timeout)
+	if err != nil && a.continueOnError {
+		log.Printf("[WARN] Error archiving %s, deleting it anyway: %s", name, err)
+		return nil
+	}
+	return err
+}
+
+// archive exports the powered off VM or vApp entity as OVF into a directory
+// named after it, either below local_path or in the datastore folder.
+func (a *ovfArchive) archive(ctx context.Context, c *govmomi.Client, dc *object.Datacenter, entity types.ManagedObjectReference, name string) error {
+	if a.localPath != "" {
+		dir := filepath.Join(a.localPath, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		_, err := exportOvf(ctx, c, entity, name, dir)
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "terraform-ovf-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := exportOvf(ctx, c, entity, name, dir)
+	if err != nil {
+		return err
+	}
+
+	return a.upload(ctx, c, dc, name, dir, files)
+}
+
+// upload copies the exported files from dir into the archive folder of the
+// datastore.
+func (a *ovfArchive) upload(ctx context.Context, c *govmomi.Client, dc *object.Datacenter, name string, dir string, files []string) error {
+	finder := find.NewFinder(c.Client, true)
+	finder = finder.SetDatacenter(dc)
+	ds, err := getDatastore(finder, a.datastore)
+	if err != nil {
+		return err
+	}
+
+	remoteDir := path.Join(a.folder, name)
+	fm := object.NewFileManager(c.Client)
+	if err := fm.MakeDirectory(ctx, ds.Path(remoteDir), dc, true); err != nil {
+		return fmt.Errorf("Error creating archive folder %s: %s", ds.Path(remoteDir), err)
+	}
+
+	for _, f := range files {
+		dsurl, err := ds.URL(ctx, dc, path.Join(remoteDir, f))
+		if err != nil {
+			return err
+		}
+		log.Printf("[INFO] Uploading %s to %s", f, ds.Path(remoteDir))
+		p := soap.DefaultUpload
+		if err := c.Client.UploadFile(filepath.Join(dir, f), dsurl, &p); err != nil {
+			return fmt.Errorf("Error uploading %s to %s: %s", f, ds.Path(remoteDir), err)
+		}
+	}
+	return nil
+}
+
+// exportOvf downloads the disks of entity into dir and writes the OVF
+// descriptor next to them. It returns the names of all files written.
+func exportOvf(ctx context.Context, c *govmomi.Client, entity types.ManagedObjectReference, name string, dir string) ([]string, error) {
+	var leaseRef types.ManagedObjectReference
+	if entity.Type == vAppEntityTypeVApp {
+		res, err := methods.ExportVApp(ctx, c, &types.ExportVApp{This: entity})
+		if err != nil {
+			return nil, err
+		}
+		leaseRef = res.Returnval
+	} else {
+		res, err := methods.ExportVm(ctx, c, &types.ExportVm{This: entity})
+		if err != nil {
+			return nil, err
+		}
+		leaseRef = res.Returnval
+	}
+
+	lease := nfc.NewLease(c.Client, leaseRef)
+	info, err := lease.Wait(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The updater keeps the lease alive while the disks are downloaded.
+	updater := lease.StartUpdater(ctx, info)
+	defer updater.Done()
+
+	var files []string
+	var ovfFiles []types.OvfFile
+	for i, item := range info.Items {
+		device := info.DeviceUrl[i]
+		if device.Disk == nil || !*device.Disk {
+			continue
+		}
+
+		// Disks of different VMs of a vApp can share their base name.
+		fileName := fmt.Sprintf("%s-%d%s", name, i, path.Ext(item.URL.Path))
+		log.Printf("[INFO] Exporting disk %s of %s", fileName, name)
+		target := filepath.Join(dir, fileName)
+		if err := lease.DownloadFile(ctx, target, item, soap.DefaultDownload); err != nil {
+			lease.Abort(ctx, nil)
+			return nil, fmt.Errorf("Error downloading disk %s of %s: %s", fileName, name, err)
+		}
+		fi, err := os.Stat(target)
+		if err != nil {
+			lease.Abort(ctx, nil)
+			return nil, err
+		}
+
+		files = append(files, fileName)
+		ovfFiles = append(ovfFiles, types.OvfFile{
+			DeviceId: device.Key,
+			Path:     fileName,
+			Size:     fi.Size(),
+		})
+	}
+
+	if err := lease.Complete(ctx); err != nil {
+		return nil, err
+	}
+
+	req := types.CreateDescriptor{
+		This: *c.ServiceContent.OvfManager,
+		Obj:  entity,
+		Cdp: types.OvfCreateDescriptorParams{
+			Name:     name,
+			OvfFiles: ovfFiles,
+		},
+	}
+	res, err := methods.CreateDescriptor(ctx, c, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Returnval.Error) > 0 {
+		return nil, fmt.Errorf("Error creating OVF descriptor of %s: %s", name, res.Returnval.Error[0].LocalizedMessage)
+	}
+
+	descriptor := name + ".ovf"
+	if err := ioutil.WriteFile(filepath.Join(dir, descriptor), []byte(res.Returnval.OvfDescriptor), 0644); err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] Exported %s to %s", name, dir)
+
+	return append([]string{descriptor}, files...), nil
+}
+
+func validateOvfArchiveTimeout(v interface{}, k string) (ws []string, errors []error) {
+	if timeout := v.(int); timeout < 1 {
+		errors = append(errors, fmt.Errorf(
+			"%s: Timeout '%d' must be at least 1 minute.", k, timeout))
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package vsphere
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestParseOvfArchiveData(t *testing.T) {
+	s := map[string]*schema.Schema{"archive_on_destroy": archiveOnDestroySchema()}
+
+	cases := []struct {
+		archive map[string]interface{}
+		expErr  string
+	}{
+		{map[string]interface{}{"datastore": "datastore1", "folder": "archive"}, ""},
+		{map[string]interface{}{"local_path": "/backup"}, ""},
+		{map[string]interface{}{}, "exactly one of datastore or local_path"},
+		{map[string]interface{}{"datastore": "datastore1", "local_path": "/backup"}, "exactly one of datastore or local_path"},
+		{map[string]interface{}{"local_path": "/backup", "folder": "archive"}, "folder can only be set"},
+	}
+
+	for _, c := range cases {
+		d := schema.TestResourceDataRaw(t, s, map[string]interface{}{
+			"archive_on_destroy": []interface{}{c.archive},
+		})
+		_, err := parseOvfArchiveData(d)
+		if c.expErr == "" && err != nil {
+			t.Errorf("%v: unexpected error: %s", c.archive, err)
+		}
+		if c.expErr != "" && (err == nil || !strings.Contains(err.Error(), c.expErr)) {
+			t.Errorf("%v: expected error containing %q, got %v", c.archive, c.expErr, err)
+		}
+	}
+
+	d := schema.TestResourceDataRaw(t, s, map[string]interface{}{
+		"archive_on_destroy": []interface{}{map[string]interface{}{"local_path": "/backup"}},
+	})
+	a, err := parseOvfArchiveData(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if a.timeout != ovfArchiveTimeoutDefault*time.Minute || a.continueOnError {
+		t.Errorf("expected the default timeout and a failing archive to stop the delete, got %v, %v", a.timeout, a.continueOnError)
+	}
+
+	d = schema.TestResourceDataRaw(t, s, map[string]interface{}{
+		"archive_on_destroy": []interface{}{map[string]interface{}{"local_path": "/backup", "timeout": 180, "continue_on_error": true}},
+	})
+	a, err = parseOvfArchiveData(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if a.timeout != 3*time.Hour || !a.continueOnError {
+		t.Errorf("expected timeout 3h and continue_on_error, got %v, %v", a.timeout, a.continueOnError)
+	}
+
+	d = schema.TestResourceDataRaw(t, s, map[string]interface{}{})
+	if a, err := parseOvfArchiveData(d); a != nil || err != nil {
+		t.Errorf("expected no archive without archive_on_destroy, got %v, %v", a, err)
+	}
+}
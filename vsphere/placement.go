@@ -0,0 +1,165 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// placementSpec holds the placement attributes shared by the virtual machine
+// and vApp resources. Empty values take the defaults of the datacenter.
+type placementSpec struct {
+	cluster      string
+	resourcePool string
+	parentVApp   string
+	folder       string
+	datastore    string
+	// host pins the initial placement to an ESXi host, e.g. when DRS is
+	// disabled. It is relative to the cluster, if there is one.
+	host string
+
+	// podPlacement returns the Storage DRS placement when datastore names a
+	// datastore cluster. It depends on how the resource is created, e.g. by
+	// cloning a template.
+	podPlacement func(pod types.ManagedObjectReference, pool *object.ResourcePool, folder *object.Folder) (types.StoragePlacementSpec, error)
+}
+
+// placement is a resolved placementSpec.
+type placement struct {
+	resourcePool *object.ResourcePool
+	folder       *object.Folder
+	datastore    *object.Datastore
+	host         *object.HostSystem
+}
+
+// clusterResourcePoolPath returns the path of the root resource pool of a
+// cluster, relative to the host folder of the datacenter. The cluster name is
+// matched exactly, a glob like "*"+cluster would also match every cluster
+// whose name ends with it.
+func clusterResourcePoolPath(cluster string) string {
+	return cluster + "/Resources"
+}
+
+// placementHostPath returns the path of a host relative to the host folder
+// of the datacenter. A host name without a path is looked up in the cluster.
+func placementHostPath(cluster, host string) string {
+	if cluster != "" && !strings.Contains(host, "/") {
+		return cluster + "/" + host
+	}
+	return host
+}
+
+// resolvePlacement resolves the resource pool, folder and datastore.
+func resolvePlacement(f placementFinder, spec placementSpec) (*placement, error) {
+	p, err := resolvePlacementLocation(f, spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolvePlacementDatastore(f, spec, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// resolvePlacementLocation resolves the resource pool, folder and host. A
+// parent vApp takes precedence over the resource pool, which takes precedence
+// over the cluster. A host without any of them places in its own compute
+// resource.
+func resolvePlacementLocation(f placementFinder, spec placementSpec) (*placement, error) {
+	p := &placement{}
+	if spec.host != "" {
+		host, err := f.HostSystem(placementHostPath(spec.cluster, spec.host))
+		if err != nil {
+			return nil, fmt.Errorf("host %s not found: %s", spec.host, err)
+		}
+		log.Printf("[DEBUG] host: %#v", host)
+		p.host = host
+	}
+
+	switch {
+	case spec.parentVApp != "":
+		parent, err := f.VirtualApp(spec.parentVApp)
+		if err != nil {
+			return nil, err
+		}
+		p.resourcePool = parent.ResourcePool
+	case spec.resourcePool != "":
+		pool, err := f.ResourcePool(spec.resourcePool)
+		if err != nil {
+			return nil, err
+		}
+		p.resourcePool = pool
+	case spec.cluster != "":
+		pool, err := f.ResourcePool(clusterResourcePoolPath(spec.cluster))
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s not found: %s", spec.cluster, err)
+		}
+		p.resourcePool = pool
+	case p.host != nil:
+		pool, err := f.HostResourcePool(p.host)
+		if err != nil {
+			return nil, err
+		}
+		p.resourcePool = pool
+	default:
+		pool, err := f.DefaultResourcePool()
+		if err != nil {
+			return nil, err
+		}
+		p.resourcePool = pool
+	}
+	log.Printf("[DEBUG] resource pool: %#v", p.resourcePool)
+
+	folder, err := f.VMFolder(spec.folder)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[DEBUG] folder: %#v", folder)
+	p.folder = folder
+	return p, nil
+}
+
+// resolvePlacementDatastore resolves the datastore of a placement whose
+// location is resolved. A datastore cluster is resolved to the datastore
+// Storage DRS recommends.
+func resolvePlacementDatastore(f placementFinder, spec placementSpec, p *placement) error {
+	if spec.datastore == "" {
+		ds, err := f.DefaultDatastore()
+		if err != nil {
+			return err
+		}
+		p.datastore = ds
+		log.Printf("[DEBUG] datastore: %#v", ds)
+		return nil
+	}
+
+	ds, err := f.Datastore(spec.datastore)
+	if err != nil {
+		// The finder does not know datastore clusters.
+		ref, err := f.DatastoreOrPod(spec.datastore)
+		if err != nil {
+			return err
+		}
+		if ref.Type != "StoragePod" {
+			ds = f.DatastoreOf(ref)
+		} else {
+			if spec.podPlacement == nil {
+				return fmt.Errorf("datastore cluster %s is not supported here", spec.datastore)
+			}
+			sps, err := spec.podPlacement(ref, p.resourcePool, p.folder)
+			if err != nil {
+				return err
+			}
+			ds, err = f.RecommendDatastore(sps)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	p.datastore = ds
+	log.Printf("[DEBUG] datastore: %#v", ds)
+	return nil
+}
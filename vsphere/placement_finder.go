@@ -0,0 +1,149 @@
+package vsphere
+
+import (
+	"strings"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// placementFinder resolves the inventory objects a resource is placed on
+// within its datacenter. Paths are relative to the datacenter, as with
+// find.Finder. The placement logic only talks to vSphere through it, so it
+// can be tested with a fake.
+type placementFinder interface {
+	DefaultDatastore() (*object.Datastore, error)
+	Datastore(path string) (*object.Datastore, error)
+	// DatastoreOrPod returns the datastore or datastore cluster (StoragePod)
+	// of the given name.
+	DatastoreOrPod(name string) (types.ManagedObjectReference, error)
+	// DatastoreOf returns the datastore of a reference DatastoreOrPod
+	// returned.
+	DatastoreOf(ref types.ManagedObjectReference) *object.Datastore
+	// RecommendDatastore asks Storage DRS for the datastore of a placement.
+	RecommendDatastore(sps types.StoragePlacementSpec) (*object.Datastore, error)
+
+	DefaultResourcePool() (*object.ResourcePool, error)
+	ResourcePool(path string) (*object.ResourcePool, error)
+	VirtualApp(path string) (*object.VirtualApp, error)
+	HostSystem(path string) (*object.HostSystem, error)
+	// HostResourcePool returns the root resource pool of the compute
+	// resource of the host.
+	HostResourcePool(host *object.HostSystem) (*object.ResourcePool, error)
+	// VirtualAppVM returns one of the VMs of the vApp, or nil for an empty
+	// vApp.
+	VirtualAppVM(path string) (*types.ManagedObjectReference, error)
+
+	// VMFolder returns the folder of the given path below the VM folder of
+	// the datacenter, or the VM folder itself for an empty path.
+	VMFolder(path string) (*object.Folder, error)
+}
+
+// govmomiPlacementFinder is the placementFinder of a datacenter.
+type govmomiPlacementFinder struct {
+	c          *govmomi.Client
+	finder     *find.Finder
+	datacenter *object.Datacenter
+	dcFolders  *object.DatacenterFolders
+}
+
+func newPlacementFinder(c *govmomi.Client, finder *find.Finder, dc *object.Datacenter, dcFolders *object.DatacenterFolders) *govmomiPlacementFinder {
+	return &govmomiPlacementFinder{
+		c:          c,
+		finder:     finder,
+		datacenter: dc,
+		dcFolders:  dcFolders,
+	}
+}
+
+func (f *govmomiPlacementFinder) DefaultDatastore() (*object.Datastore, error) {
+	return f.finder.DefaultDatastore(context.TODO())
+}
+
+func (f *govmomiPlacementFinder) Datastore(path string) (*object.Datastore, error) {
+	return f.finder.Datastore(context.TODO(), path)
+}
+
+func (f *govmomiPlacementFinder) DatastoreOrPod(name string) (types.ManagedObjectReference, error) {
+	return getDatastoreObject(f.c, f.dcFolders, name)
+}
+
+func (f *govmomiPlacementFinder) DatastoreOf(ref types.ManagedObjectReference) *object.Datastore {
+	return object.NewDatastore(f.c.Client, ref)
+}
+
+func (f *govmomiPlacementFinder) RecommendDatastore(sps types.StoragePlacementSpec) (*object.Datastore, error) {
+	return findDatastore(f.c, sps)
+}
+
+func (f *govmomiPlacementFinder) DefaultResourcePool() (*object.ResourcePool, error) {
+	return f.finder.DefaultResourcePool(context.TODO())
+}
+
+func (f *govmomiPlacementFinder) ResourcePool(path string) (*object.ResourcePool, error) {
+	return f.finder.ResourcePool(context.TODO(), path)
+}
+
+func (f *govmomiPlacementFinder) VirtualApp(path string) (*object.VirtualApp, error) {
+	return f.finder.VirtualApp(context.TODO(), path)
+}
+
+func (f *govmomiPlacementFinder) HostSystem(path string) (*object.HostSystem, error) {
+	return f.finder.HostSystem(context.TODO(), path)
+}
+
+func (f *govmomiPlacementFinder) HostResourcePool(host *object.HostSystem) (*object.ResourcePool, error) {
+	return host.ResourcePool(context.TODO())
+}
+
+func (f *govmomiPlacementFinder) VirtualAppVM(path string) (*types.ManagedObjectReference, error) {
+	vapp, err := f.VirtualApp(path)
+	if err != nil {
+		return nil, err
+	}
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(f.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.Reference(), []string{"vAppConfig"}, &mvapp); err != nil {
+		return nil, err
+	}
+	var vmRef *types.ManagedObjectReference
+	if mvapp.VAppConfig != nil {
+		for _, entity := range mvapp.VAppConfig.EntityConfig {
+			vmRef = entity.Key
+		}
+	}
+	return vmRef, nil
+}
+
+func (f *govmomiPlacementFinder) VMFolder(path string) (*object.Folder, error) {
+	if path == "" {
+		return f.dcFolders.VmFolder, nil
+	}
+	return findFolder(f.c, strings.TrimPrefix(f.datacenter.InventoryPath, "/"), path)
+}
+
+// storagePodCloneSpec returns the Storage DRS placement of a clone of the VM
+// into the datastore cluster.
+func storagePodCloneSpec(pod types.ManagedObjectReference, vmRef *types.ManagedObjectReference, pool *object.ResourcePool, folder *object.Folder) types.StoragePlacementSpec {
+	rpr := pool.Reference()
+	vmfr := folder.Reference()
+	return types.StoragePlacementSpec{
+		Type: "clone",
+		Vm:   vmRef,
+		PodSelectionSpec: types.StorageDrsPodSelectionSpec{
+			StoragePod: &pod,
+		},
+		CloneSpec: &types.VirtualMachineCloneSpec{
+			Location: types.VirtualMachineRelocateSpec{
+				Pool: &rpr,
+			},
+		},
+		CloneName: "dummy",
+		Folder:    &vmfr,
+	}
+}
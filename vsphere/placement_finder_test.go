@@ -0,0 +1,262 @@
+package vsphere
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// fakePlacementFinder serves a fixed inventory. The empty path names the
+// defaults of the datacenter.
+type fakePlacementFinder struct {
+	datastores    map[string]*object.Datastore
+	datastoreRefs map[string]types.ManagedObjectReference
+	recommended   *object.Datastore
+	placements    []types.StoragePlacementSpec
+	pools         map[string]*object.ResourcePool
+	vapps         map[string]*object.VirtualApp
+	hosts         map[string]*object.HostSystem
+	hostPools     map[string]*object.ResourcePool
+	vappVMs       map[string]*types.ManagedObjectReference
+	folders       map[string]*object.Folder
+}
+
+func newFakePlacementFinder() *fakePlacementFinder {
+	ref := func(t, v string) types.ManagedObjectReference {
+		return types.ManagedObjectReference{Type: t, Value: v}
+	}
+	vm := ref("VirtualMachine", "vm-10")
+	return &fakePlacementFinder{
+		datastores: map[string]*object.Datastore{
+			"":    object.NewDatastore(nil, ref("Datastore", "datastore-1")),
+			"ds2": object.NewDatastore(nil, ref("Datastore", "datastore-2")),
+		},
+		datastoreRefs: map[string]types.ManagedObjectReference{
+			"ds3":  ref("Datastore", "datastore-3"),
+			"pod1": ref("StoragePod", "group-p1"),
+		},
+		recommended: object.NewDatastore(nil, ref("Datastore", "datastore-4")),
+		pools: map[string]*object.ResourcePool{
+			"":                       object.NewResourcePool(nil, ref("ResourcePool", "resgroup-1")),
+			"cluster1/Resources":     object.NewResourcePool(nil, ref("ResourcePool", "resgroup-2")),
+			"cluster1/Resources/web": object.NewResourcePool(nil, ref("ResourcePool", "resgroup-3")),
+		},
+		vapps: map[string]*object.VirtualApp{
+			"parent": object.NewVirtualApp(nil, ref("VirtualApp", "resgroup-v4")),
+			"source": object.NewVirtualApp(nil, ref("VirtualApp", "resgroup-v5")),
+		},
+		hosts: map[string]*object.HostSystem{
+			"cluster1/esxi1": object.NewHostSystem(nil, ref("HostSystem", "host-6")),
+			"esxi2":          object.NewHostSystem(nil, ref("HostSystem", "host-7")),
+		},
+		hostPools: map[string]*object.ResourcePool{
+			"host-6": object.NewResourcePool(nil, ref("ResourcePool", "resgroup-2")),
+			"host-7": object.NewResourcePool(nil, ref("ResourcePool", "resgroup-8")),
+		},
+		vappVMs: map[string]*types.ManagedObjectReference{
+			"source": &vm,
+		},
+		folders: map[string]*object.Folder{
+			"":    object.NewFolder(nil, ref("Folder", "group-v1")),
+			"web": object.NewFolder(nil, ref("Folder", "group-v2")),
+		},
+	}
+}
+
+func (f *fakePlacementFinder) DefaultDatastore() (*object.Datastore, error) {
+	return f.Datastore("")
+}
+
+func (f *fakePlacementFinder) Datastore(path string) (*object.Datastore, error) {
+	if ds, ok := f.datastores[path]; ok {
+		return ds, nil
+	}
+	return nil, fmt.Errorf("datastore '%s' not found", path)
+}
+
+func (f *fakePlacementFinder) DatastoreOrPod(name string) (types.ManagedObjectReference, error) {
+	if ref, ok := f.datastoreRefs[name]; ok {
+		return ref, nil
+	}
+	return types.ManagedObjectReference{}, fmt.Errorf("datastore '%s' not found", name)
+}
+
+func (f *fakePlacementFinder) DatastoreOf(ref types.ManagedObjectReference) *object.Datastore {
+	return object.NewDatastore(nil, ref)
+}
+
+func (f *fakePlacementFinder) RecommendDatastore(sps types.StoragePlacementSpec) (*object.Datastore, error) {
+	f.placements = append(f.placements, sps)
+	return f.recommended, nil
+}
+
+func (f *fakePlacementFinder) DefaultResourcePool() (*object.ResourcePool, error) {
+	return f.ResourcePool("")
+}
+
+func (f *fakePlacementFinder) ResourcePool(path string) (*object.ResourcePool, error) {
+	if pool, ok := f.pools[path]; ok {
+		return pool, nil
+	}
+	return nil, fmt.Errorf("resource pool '%s' not found", path)
+}
+
+func (f *fakePlacementFinder) VirtualApp(path string) (*object.VirtualApp, error) {
+	if vapp, ok := f.vapps[path]; ok {
+		return vapp, nil
+	}
+	return nil, fmt.Errorf("vApp '%s' not found", path)
+}
+
+func (f *fakePlacementFinder) HostSystem(path string) (*object.HostSystem, error) {
+	if host, ok := f.hosts[path]; ok {
+		return host, nil
+	}
+	return nil, fmt.Errorf("host '%s' not found", path)
+}
+
+func (f *fakePlacementFinder) HostResourcePool(host *object.HostSystem) (*object.ResourcePool, error) {
+	return f.hostPools[host.Reference().Value], nil
+}
+
+func (f *fakePlacementFinder) VirtualAppVM(path string) (*types.ManagedObjectReference, error) {
+	if _, err := f.VirtualApp(path); err != nil {
+		return nil, err
+	}
+	return f.vappVMs[path], nil
+}
+
+func (f *fakePlacementFinder) VMFolder(path string) (*object.Folder, error) {
+	if folder, ok := f.folders[path]; ok {
+		return folder, nil
+	}
+	return nil, fmt.Errorf("Cannot find folder %s", path)
+}
+
+func TestAccVSphereVapp_calculateResourcePool(t *testing.T) {
+	cases := []struct {
+		vapp vApp
+		want string
+	}{
+		{vApp{}, "resgroup-1"},
+		{vApp{cluster: "cluster1"}, "resgroup-2"},
+		{vApp{cluster: "cluster1", resourcePool: "cluster1/Resources/web"}, "resgroup-3"},
+		{vApp{resourcePool: "cluster1/Resources/web", parentVApp: "parent"}, "resgroup-v4"},
+	}
+	for _, c := range cases {
+		vapp := c.vapp
+		vapp.placement = newFakePlacementFinder()
+		if err := vapp.calculateLocation(); err != nil {
+			t.Fatalf("%#v: %s", c.vapp, err)
+		}
+		if got := vapp.resourcePoolObj.Reference().Value; got != c.want {
+			t.Fatalf("%#v: expected resource pool %s, got %s", c.vapp, c.want, got)
+		}
+	}
+
+	vapp := vApp{resourcePool: "missing", placement: newFakePlacementFinder()}
+	if err := vapp.calculateLocation(); err == nil {
+		t.Fatal("expected an error for a missing resource pool")
+	}
+}
+
+func TestAccVSphereVapp_calculateDatastore(t *testing.T) {
+	placement := func(v vApp) (vApp, *fakePlacementFinder) {
+		f := newFakePlacementFinder()
+		v.c = &govmomi.Client{}
+		v.placement = f
+		v.vAppToClone = templateVApp{name: "source"}
+		if err := v.calculateLocation(); err != nil {
+			t.Fatal(err)
+		}
+		return v, f
+	}
+
+	cases := []struct {
+		datastore string
+		want      string
+	}{
+		{"", "datastore-1"},
+		{"ds2", "datastore-2"},
+		{"ds3", "datastore-3"},
+		{"pod1", "datastore-4"},
+	}
+	for _, c := range cases {
+		vapp, _ := placement(vApp{datastore: c.datastore})
+		if err := vapp.calculateDatastore(); err != nil {
+			t.Fatalf("%s: %s", c.datastore, err)
+		}
+		if got := vapp.datastoreRef.Value; got != c.want {
+			t.Fatalf("%s: expected datastore %s, got %s", c.datastore, c.want, got)
+		}
+	}
+
+	// Storage DRS places a clone of a VM of the source vApp in the folder
+	// and resource pool of the vApp.
+	vapp, f := placement(vApp{datastore: "pod1", folder: "web"})
+	if err := vapp.calculateDatastore(); err != nil {
+		t.Fatal(err)
+	}
+	sps := f.placements[0]
+	if sps.Vm.Value != "vm-10" || sps.PodSelectionSpec.StoragePod.Value != "group-p1" ||
+		sps.Folder.Value != "group-v2" || sps.CloneSpec.Location.Pool.Value != "resgroup-1" {
+		t.Fatalf("unexpected placement spec: %#v", sps)
+	}
+
+	vapp, f = placement(vApp{datastore: "pod1"})
+	f.vappVMs["source"] = nil
+	if err := vapp.calculateDatastore(); err == nil {
+		t.Fatal("expected an error for a source vApp without VMs")
+	}
+}
+
+func TestResolvePlacement(t *testing.T) {
+	f := newFakePlacementFinder()
+	p, err := resolvePlacement(f, placementSpec{cluster: "cluster1", folder: "web", datastore: "ds3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.resourcePool.Reference().Value != "resgroup-2" || p.folder.Reference().Value != "group-v2" ||
+		p.datastore.Reference().Value != "datastore-3" {
+		t.Fatalf("unexpected placement: %#v", p)
+	}
+
+	// Cluster names are matched exactly, not as a suffix.
+	if _, err := resolvePlacement(f, placementSpec{cluster: "ster1"}); err == nil {
+		t.Fatal("expected an error for a cluster name suffix")
+	}
+
+	if _, err := resolvePlacement(f, placementSpec{datastore: "pod1"}); err == nil {
+		t.Fatal("expected an error for a datastore cluster without Storage DRS placement")
+	}
+}
+
+func TestResolvePlacement_host(t *testing.T) {
+	f := newFakePlacementFinder()
+	cases := []struct {
+		spec placementSpec
+		host string
+		pool string
+	}{
+		{placementSpec{cluster: "cluster1", host: "esxi1"}, "host-6", "resgroup-2"},
+		{placementSpec{host: "cluster1/esxi1"}, "host-6", "resgroup-2"},
+		{placementSpec{host: "esxi2"}, "host-7", "resgroup-8"},
+		{placementSpec{resourcePool: "cluster1/Resources/web", host: "cluster1/esxi1"}, "host-6", "resgroup-3"},
+	}
+	for _, c := range cases {
+		p, err := resolvePlacementLocation(f, c.spec)
+		if err != nil {
+			t.Fatalf("%#v: %s", c.spec, err)
+		}
+		if p.host.Reference().Value != c.host || p.resourcePool.Reference().Value != c.pool {
+			t.Fatalf("%#v: expected host %s in %s, got %#v", c.spec, c.host, c.pool, p)
+		}
+	}
+
+	if _, err := resolvePlacementLocation(f, placementSpec{cluster: "cluster1", host: "esxi2"}); err == nil {
+		t.Fatal("expected an error for a host outside of the cluster")
+	}
+}
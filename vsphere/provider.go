@@ -2,6 +2,8 @@ package vsphere
 
 import (
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
@@ -21,6 +23,7 @@ func Provider() terraform.ResourceProvider {
 			"password": &schema.Schema{
 				Type:        schema.TypeString,
 				Required:    true,
+				Sensitive:   true,
 				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_PASSWORD", nil),
 				Description: "The user password for vSphere API operations.",
 			},
@@ -47,19 +50,45 @@ func Provider() terraform.ResourceProvider {
 				Type:        schema.TypeBool,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_CLIENT_DEBUG", false),
-				Description: "govomomi debug",
+				Description: "Write govmomi SOAP request and response traces to disk.",
 			},
 			"client_debug_path_run": &schema.Schema{
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_CLIENT_DEBUG_PATH_RUN", ""),
-				Description: "govomomi debug path for a single run",
+				Description: "Sub directory of the debug path used for this run. Defaults to a timestamp.",
 			},
 			"client_debug_path": &schema.Schema{
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_CLIENT_DEBUG_PATH", ""),
-				Description: "govomomi debug path for debug",
+				Description: "Base directory for govmomi debug traces. Defaults to ~/.govmomi.",
+			},
+			"default_vm_folder": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_DEFAULT_VM_FOLDER", ""),
+				Description: "Folder used by resources which do not set a folder.",
+			},
+			"default_resource_pool": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_DEFAULT_RESOURCE_POOL", ""),
+				Description: "Resource pool used by resources which do not set a resource pool.",
+			},
+			"log_level": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("VSPHERE_LOG_LEVEL", ""),
+				ValidateFunc: validateLogLevel,
+				Description:  "Minimum level of the resource log lines of this provider: TRACE, DEBUG, INFO, WARN or ERROR. Each provider configuration keeps its own level. TF_LOG still decides what Terraform keeps.",
+			},
+			"api_max_concurrent": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("VSPHERE_API_MAX_CONCURRENT", 0),
+				ValidateFunc: validateAPIMaxConcurrent,
+				Description:  "Maximum number of simultaneous calls to vCenter of all resources, for large parallelism. 0 does not limit them.",
 			},
 		},
 
@@ -69,7 +98,22 @@ func Provider() terraform.ResourceProvider {
 			"vsphere_virtual_disk":    resourceVSphereVirtualDisk(),
 			"vsphere_virtual_machine": resourceVSphereVirtualMachine(),
 			"vsphere_vds_portgroup":   resourceVSphereVdPortgroup(),
+			"vsphere_vds_port_mirror": resourceVSphereVdsPortMirror(),
 			"vsphere_vapp":            resourceVSphereVApp(),
+			"vsphere_vapp_snapshot":   resourceVSphereVAppSnapshot(),
+			"vsphere_vapp_entity":     resourceVSphereVAppEntity(),
+
+			"vsphere_vds_uplink_portgroup": resourceVSphereVdsUplinkPortgroup(),
+			"vsphere_vm_power_policy":      resourceVSphereVMPowerPolicy(),
+			"vsphere_mac_address":          resourceVSphereMacAddress(),
+		},
+
+		DataSourcesMap: map[string]*schema.Resource{
+			"vsphere_compute_cluster_host_group": dataSourceVSphereComputeClusterHostGroup(),
+			"vsphere_custom_role_privileges":     dataSourceVSphereCustomRolePrivileges(),
+			"vsphere_host":                       dataSourceVSphereHost(),
+			"vsphere_template":                   dataSourceVSphereTemplate(),
+			"vsphere_vapp_membership":            dataSourceVSphereVAppMembership(),
 		},
 
 		ConfigureFunc: providerConfigure,
@@ -99,7 +143,80 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		Debug:         d.Get("client_debug").(bool),
 		DebugPathRun:  d.Get("client_debug_path_run").(string),
 		DebugPath:     d.Get("client_debug_path").(string),
+
+		DefaultVMFolder:     normalizeFolderPath(d.Get("default_vm_folder").(string)),
+		DefaultResourcePool: d.Get("default_resource_pool").(string),
+
+		APIMaxConcurrent: d.Get("api_max_concurrent").(int),
+
+		LogLevel: d.Get("log_level").(string),
 	}
 
 	return config.Client()
 }
+
+// setPlacementDefaults fills in folder and resource_pool from the provider
+// defaults when the resource leaves them unset. The values end up in the
+// state, so later lookups by path keep working if the defaults change.
+func setPlacementDefaults(d *schema.ResourceData, c *VSphereClient) {
+	if _, ok := d.GetOk("folder"); !ok && c.defaultVMFolder != "" {
+		log.Printf("[DEBUG] Using default folder %s", c.defaultVMFolder)
+		d.Set("folder", c.defaultVMFolder)
+	}
+
+	if _, ok := d.GetOk("resource_pool"); !ok && c.defaultResourcePool != "" {
+		log.Printf("[DEBUG] Using default resource pool %s", c.defaultResourcePool)
+		d.Set("resource_pool", c.defaultResourcePool)
+	}
+}
+
+func vcenterServerSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Computed:    true,
+		ForceNew:    true,
+		Description: "The vCenter server the resource lives on. Must match the server of the selected provider.",
+	}
+}
+
+func vcenterUUIDSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "The instance UUID of the vCenter server the resource lives on.",
+	}
+}
+
+// checkVCenterServer makes sure a resource is only managed through a provider
+// connected to the vCenter server it lives on. This guards against picking
+// the wrong provider alias when several (linked mode) vCenters are managed
+// from the same configuration. The vCenter is recognized by its instance
+// UUID, so it may be reached by another name than the one recorded. Without
+// a recorded UUID, e.g. for resources created before it was recorded or on
+// ESXi hosts, the names are compared.
+func checkVCenterServer(d *schema.ResourceData, c *VSphereClient) error {
+	v, ok := d.GetOk("vcenter_server")
+	if !ok {
+		d.Set("vcenter_uuid", c.instanceUUID)
+		return d.Set("vcenter_server", c.vsphereServer)
+	}
+
+	server := v.(string)
+	if uuid := d.Get("vcenter_uuid").(string); uuid != "" && c.instanceUUID != "" {
+		if uuid != c.instanceUUID {
+			return fmt.Errorf("Resource targets vCenter server %q (instance %s) but the provider is connected to %q (instance %s). "+
+				"Configure a provider alias for %q and select it with the provider argument of the resource.",
+				server, uuid, c.vsphereServer, c.instanceUUID, server)
+		}
+		return nil
+	}
+
+	if !strings.EqualFold(server, c.vsphereServer) {
+		return fmt.Errorf("Resource targets vCenter server %q but the provider is connected to %q. "+
+			"Configure a provider alias for %q and select it with the provider argument of the resource.",
+			server, c.vsphereServer, server)
+	}
+
+	return d.Set("vcenter_uuid", c.instanceUUID)
+}
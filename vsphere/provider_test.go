@@ -29,6 +29,35 @@ func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = Provider()
 }
 
+func TestCheckVCenterServer(t *testing.T) {
+	s := map[string]*schema.Schema{
+		"vcenter_server": vcenterServerSchema(),
+		"vcenter_uuid":   vcenterUUIDSchema(),
+	}
+	byName := &VSphereClient{vsphereServer: "vc1.example.com", instanceUUID: "uuid-1"}
+	byIP := &VSphereClient{vsphereServer: "10.0.0.1", instanceUUID: "uuid-1"}
+	other := &VSphereClient{vsphereServer: "10.0.0.2", instanceUUID: "uuid-2"}
+
+	d := schema.TestResourceDataRaw(t, s, map[string]interface{}{"vcenter_server": "vc1.example.com"})
+	if err := checkVCenterServer(d, byIP); err == nil {
+		t.Fatal("expected another name to fail without a recorded instance UUID")
+	}
+	if err := checkVCenterServer(d, byName); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if uuid := d.Get("vcenter_uuid").(string); uuid != "uuid-1" {
+		t.Fatalf("expected the instance UUID to be recorded, got %q", uuid)
+	}
+
+	// Once recorded, the same vCenter may be reached by another name.
+	if err := checkVCenterServer(d, byIP); err != nil {
+		t.Fatalf("unexpected error for the same vCenter by IP: %s", err)
+	}
+	if err := checkVCenterServer(d, other); err == nil {
+		t.Fatal("expected another vCenter to fail")
+	}
+}
+
 func testAccPreCheck(t *testing.T) {
 	if v := os.Getenv("VSPHERE_USER"); v == "" {
 		t.Fatal("VSPHERE_USER must be set for acceptance tests")
@@ -32,6 +32,9 @@ func resourceVSphereFile() *schema.Resource {
 		Delete: resourceVSphereFileDelete,
 
 		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
 			"datacenter": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -74,9 +77,12 @@ func resourceVSphereFile() *schema.Resource {
 }
 
 func resourceVSphereFileCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
 
-	log.Printf("[DEBUG] creating file: %#v", d)
-	client := meta.(*govmomi.Client)
+	logRedactedf("[DEBUG] creating file: %#v", d)
+	client := meta.(*VSphereClient).vimClient
 
 	f := file{}
 
@@ -118,7 +124,7 @@ func resourceVSphereFileCreate(d *schema.ResourceData, meta interface{}) error {
 
 	err := createFile(client, &f)
 	if err != nil {
-		return err
+		return translateVSphereError(err, fmt.Sprintf("file %s", f.destinationFile))
 	}
 
 	d.SetId(fmt.Sprintf("[%v] %v/%v", f.datastore, f.datacenter, f.destinationFile))
@@ -193,8 +199,11 @@ func createFile(client *govmomi.Client, f *file) error {
 }
 
 func resourceVSphereFileRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
 
-	log.Printf("[DEBUG] reading file: %#v", d)
+	logRedactedf("[DEBUG] reading file: %#v", d)
 	f := file{}
 
 	if v, ok := d.GetOk("source_datacenter"); ok {
@@ -227,7 +236,7 @@ func resourceVSphereFileRead(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("destination_file argument is required")
 	}
 
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient).vimClient
 	finder := find.NewFinder(client.Client, true)
 
 	dc, err := finder.Datacenter(context.TODO(), f.datacenter)
@@ -256,8 +265,11 @@ func resourceVSphereFileRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceVSphereFileUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
 
-	log.Printf("[DEBUG] updating file: %#v", d)
+	logRedactedf("[DEBUG] updating file: %#v", d)
 
 	if d.HasChange("destination_file") || d.HasChange("datacenter") || d.HasChange("datastore") {
 		// File needs to be moved, get old and new destination changes
@@ -290,7 +302,7 @@ func resourceVSphereFileUpdate(d *schema.ResourceData, meta interface{}) error {
 		}
 
 		// Get old and new dataceter and datastore
-		client := meta.(*govmomi.Client)
+		client := meta.(*VSphereClient).vimClient
 		dcOld, err := getDatacenter(client, oldDataceneter)
 		if err != nil {
 			return err
@@ -327,8 +339,11 @@ func resourceVSphereFileUpdate(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceVSphereFileDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
 
-	log.Printf("[DEBUG] deleting file: %#v", d)
+	logRedactedf("[DEBUG] deleting file: %#v", d)
 	f := file{}
 
 	if v, ok := d.GetOk("datacenter"); ok {
@@ -353,7 +368,7 @@ func resourceVSphereFileDelete(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("destination_file argument is required")
 	}
 
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient).vimClient
 
 	err := deleteFile(client, &f)
 	if err != nil {
@@ -26,6 +26,9 @@ func resourceVSphereFolder() *schema.Resource {
 		Delete: resourceVSphereFolderDelete,
 
 		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
 			"datacenter": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
@@ -47,8 +50,11 @@ func resourceVSphereFolder() *schema.Resource {
 }
 
 func resourceVSphereFolderCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
 
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient).vimClient
 
 	f := folder{
 		path: strings.TrimRight(d.Get("path").(string), "/"),
@@ -60,8 +66,9 @@ func resourceVSphereFolderCreate(d *schema.ResourceData, meta interface{}) error
 
 	err := createFolder(client, &f)
 	if err != nil {
-		return err
+		return translateVSphereError(err, fmt.Sprintf("folder %s", f.path))
 	}
+	meta.(*VSphereClient).invalidateCache()
 
 	d.Set("existing_path", f.existingPath)
 	d.SetId(fmt.Sprintf("%v/%v", f.datacenter, f.path))
@@ -116,9 +123,12 @@ func createFolder(client *govmomi.Client, f *folder) error {
 }
 
 func resourceVSphereFolderRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
 
-	log.Printf("[DEBUG] reading folder: %#v", d)
-	client := meta.(*govmomi.Client)
+	logRedactedf("[DEBUG] reading folder: %#v", d)
+	client := meta.(*VSphereClient).vimClient
 
 	dc, err := getDatacenter(client, d.Get("datacenter").(string))
 	if err != nil {
@@ -144,6 +154,9 @@ func resourceVSphereFolderRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceVSphereFolderDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
 
 	f := folder{
 		path:         strings.TrimRight(d.Get("path").(string), "/"),
@@ -154,12 +167,13 @@ func resourceVSphereFolderDelete(d *schema.ResourceData, meta interface{}) error
 		f.datacenter = v.(string)
 	}
 
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient).vimClient
 
 	err := deleteFolder(client, &f)
 	if err != nil {
 		return err
 	}
+	meta.(*VSphereClient).invalidateCache()
 
 	d.SetId("")
 	return nil
@@ -226,12 +240,19 @@ func deleteFolder(client *govmomi.Client, f *folder) error {
 
 // getDatacenter gets datacenter object
 func getDatacenter(c *govmomi.Client, dc string) (*object.Datacenter, error) {
+	dc = normalizeDatacenterName(dc)
 	finder := find.NewFinder(c.Client, true)
 	if dc != "" {
 		d, err := finder.Datacenter(context.TODO(), dc)
-		return d, err
+		if err != nil {
+			return nil, fmt.Errorf("Error finding datacenter %s on vCenter server %s: %s", dc, c.URL().Host, err)
+		}
+		return d, nil
 	} else {
 		d, err := finder.DefaultDatacenter(context.TODO())
-		return d, err
+		if err != nil {
+			return nil, fmt.Errorf("Error finding default datacenter on vCenter server %s: %s", c.URL().Host, err)
+		}
+		return d, nil
 	}
 }
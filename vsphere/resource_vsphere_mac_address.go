@@ -0,0 +1,260 @@
+package vsphere
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vsphere_mac_address allocates a static MAC address from a prefix. The
+// address follows from name and is kept in state, so a VM which is rebuilt
+// gets the same MAC as long as the allocation stays, e.g.
+// mac_address = "${vsphere_mac_address.web.mac_address}" in its
+// network_interface.
+
+// vCenter only accepts manual MAC addresses with the VMware OUI from
+// 00:50:56:00:00:00 to 00:50:56:3f:ff:ff.
+const vmwareOUI = "00:50:56"
+
+// macReservations are the addresses allocated during this run. Allocations
+// run in parallel and are not on a NIC yet, so check_in_use does not see
+// them.
+type macReservations struct {
+	sync.Mutex
+	reserved map[string]bool
+}
+
+// reserve allocates the address of name and keeps it from the other
+// allocations of this run.
+func (r *macReservations) reserve(prefix string, name string, inUse func(string) bool) (string, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.reserved == nil {
+		r.reserved = make(map[string]bool)
+	}
+	address, err := allocateMacAddress(prefix, name, func(mac string) bool {
+		return r.reserved[mac] || inUse(mac)
+	})
+	if err != nil {
+		return "", err
+	}
+	r.reserved[address] = true
+	return address, nil
+}
+
+func resourceVSphereMacAddress() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceVSphereMacAddressCreate,
+		Read:   resourceVSphereMacAddressRead,
+		Delete: resourceVSphereMacAddressDelete,
+
+		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
+			// Leading octets of the pool, e.g. 00:50:56:3f.
+			"prefix": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      vmwareOUI,
+				ValidateFunc: validateMacPrefix,
+			},
+
+			// Key of the allocation, usually the name of the VM and NIC.
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			// Skips addresses used by a NIC of any VM in vCenter.
+			"check_in_use": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  true,
+			},
+
+			"mac_address": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// parseMacPrefix returns the octets of a prefix of one to five octets.
+func parseMacPrefix(prefix string) ([]byte, error) {
+	parts := strings.Split(prefix, ":")
+	if len(parts) < 1 || len(parts) > 5 {
+		return nil, fmt.Errorf("%q has to have one to five octets", prefix)
+	}
+	octets := make([]byte, 0, len(parts))
+	for _, p := range parts {
+		v, err := strconv.ParseUint(p, 16, 8)
+		if err != nil || len(p) != 2 {
+			return nil, fmt.Errorf("%q is not a MAC address prefix like 00:50:56", prefix)
+		}
+		octets = append(octets, byte(v))
+	}
+	if octets[0]&1 == 1 {
+		return nil, fmt.Errorf("%q is a multicast prefix", prefix)
+	}
+	return octets, nil
+}
+
+func validateMacPrefix(v interface{}, k string) (ws []string, errors []error) {
+	octets, err := parseMacPrefix(v.(string))
+	if err != nil {
+		errors = append(errors, fmt.Errorf("%s: %s", k, err))
+		return
+	}
+	if !isVMwareOUI(octets) || (len(octets) > 3 && octets[3] > 0x3f) {
+		errors = append(errors, fmt.Errorf("%s: vCenter only accepts manual MAC addresses from 00:50:56:00:00:00 to 00:50:56:3f:ff:ff, got prefix %s",
+			k, v.(string)))
+	}
+	return
+}
+
+func isVMwareOUI(octets []byte) bool {
+	return len(octets) >= 3 && octets[0] == 0x00 && octets[1] == 0x50 && octets[2] == 0x56
+}
+
+// allocateMacAddress returns the address of name in the pool of the prefix,
+// skipping the addresses inUse reports.
+func allocateMacAddress(prefix string, name string, inUse func(string) bool) (string, error) {
+	octets, err := parseMacPrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	bits := uint(8 * (6 - len(octets)))
+	size := uint64(1) << bits
+	// The VMware OUI only has 22 bits of manual addresses.
+	if len(octets) == 3 && isVMwareOUI(octets) {
+		size = 1 << 22
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	start := h.Sum64() % size
+	for i := uint64(0); i < size; i++ {
+		n := (start + i) % size
+		mac := make([]byte, 6)
+		copy(mac, octets)
+		for j := 5; j >= len(octets); j-- {
+			mac[j] = byte(n)
+			n >>= 8
+		}
+		address := formatMacAddress(mac)
+		if !inUse(address) {
+			return address, nil
+		}
+	}
+	return "", fmt.Errorf("no free MAC address left with prefix %s", prefix)
+}
+
+func formatMacAddress(mac []byte) string {
+	parts := make([]string, len(mac))
+	for i, b := range mac {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// macAddressesInUse returns the MAC addresses of the NICs of all VMs.
+func macAddressesInUse(client *VSphereClient) (map[string]bool, error) {
+	c := client.vimClient
+	req := types.CreateContainerView{
+		This:      *c.ServiceContent.ViewManager,
+		Container: c.ServiceContent.RootFolder,
+		Type:      []string{"VirtualMachine"},
+		Recursive: true,
+	}
+	res, err := methods.CreateContainerView(context.TODO(), c, &req)
+	if err != nil {
+		return nil, err
+	}
+	defer methods.DestroyView(context.TODO(), c, &types.DestroyView{This: res.Returnval})
+
+	collector := property.DefaultCollector(c.Client)
+	var view mo.ContainerView
+	if err := collector.RetrieveOne(context.TODO(), res.Returnval, []string{"view"}, &view); err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	if len(view.View) == 0 {
+		return used, nil
+	}
+	var mvms []mo.VirtualMachine
+	if err := collector.Retrieve(context.TODO(), view.View, []string{"config.hardware.device"}, &mvms); err != nil {
+		return nil, err
+	}
+	for _, mvm := range mvms {
+		if mvm.Config == nil {
+			continue
+		}
+		for _, device := range mvm.Config.Hardware.Device {
+			if card, ok := device.(types.BaseVirtualEthernetCard); ok {
+				used[strings.ToLower(card.GetVirtualEthernetCard().MacAddress)] = true
+			}
+		}
+	}
+	return used, nil
+}
+
+func resourceVSphereMacAddressCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_mac_address", resourceLogName(d, "name"), "create")
+
+	used := make(map[string]bool)
+	if d.Get("check_in_use").(bool) {
+		var err error
+		used, err = macAddressesInUse(meta.(*VSphereClient))
+		if err != nil {
+			return fmt.Errorf("Error reading the MAC addresses in use: %s", err)
+		}
+	}
+	address, err := meta.(*VSphereClient).macReservations.reserve(d.Get("prefix").(string), d.Get("name").(string), func(mac string) bool {
+		return used[mac]
+	})
+	if err != nil {
+		return err
+	}
+	logger.Infof("Allocated MAC address %s", address)
+
+	d.SetId(address)
+	d.Set("mac_address", address)
+	return nil
+}
+
+// The allocation lives in state only, there is nothing to refresh.
+func resourceVSphereMacAddressRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] MAC address %s of %s", d.Id(), d.Get("name").(string))
+	d.Set("mac_address", d.Id())
+	return nil
+}
+
+func resourceVSphereMacAddressDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,53 @@
+package vsphere
+
+import (
+	"testing"
+)
+
+func TestAccVSphereMacAddress_allocate(t *testing.T) {
+	none := func(string) bool { return false }
+	first, err := allocateMacAddress(vmwareOUI, "web-eth0", none)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first[:8] != vmwareOUI || first[9:11] > "3f" {
+		t.Fatalf("expected a manual VMware MAC address, got %s", first)
+	}
+	// The allocation is stable for a name.
+	if again, _ := allocateMacAddress(vmwareOUI, "web-eth0", none); again != first {
+		t.Fatalf("expected %s again, got %s", first, again)
+	}
+
+	next, err := allocateMacAddress(vmwareOUI, "web-eth0", func(mac string) bool { return mac == first })
+	if err != nil || next == first {
+		t.Fatalf("expected an address other than %s, got %s (%v)", first, next, err)
+	}
+
+	mac, err := allocateMacAddress("02:00:00:00:00", "db", none)
+	if err != nil || mac[:15] != "02:00:00:00:00:" {
+		t.Fatalf("unexpected address %s (%v)", mac, err)
+	}
+	if _, err := allocateMacAddress("02:00:00:00:00", "db", func(string) bool { return true }); err == nil {
+		t.Fatal("expected an error for an exhausted pool")
+	}
+
+	reservations := &macReservations{}
+	reserved, err := reservations.reserve(vmwareOUI, "web-eth0", none)
+	if err != nil || reserved != first {
+		t.Fatalf("expected %s to be reserved, got %s (%v)", first, reserved, err)
+	}
+	if again, err := reservations.reserve(vmwareOUI, "web-eth0", none); err != nil || again == first {
+		t.Fatalf("expected an address other than the reserved %s, got %s (%v)", first, again, err)
+	}
+
+	for _, prefix := range []string{vmwareOUI, "00:50:56:3f"} {
+		if _, errs := validateMacPrefix(prefix, "prefix"); len(errs) > 0 {
+			t.Fatalf("expected prefix %s to be valid, got %v", prefix, errs)
+		}
+	}
+	for _, prefix := range []string{"00:50:56:40", "01:00:5e", "0:50:56", "00:50:56:00:00:00", "00:50", "02:00:00"} {
+		if _, errs := validateMacPrefix(prefix, "prefix"); len(errs) == 0 {
+			t.Fatalf("expected prefix %s to be invalid", prefix)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package vsphere
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"math"
 	"path"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
@@ -24,8 +29,17 @@ const (
 	vAppEntityTypeVApp = "VirtualApp"
 
 	vAppStartOrderMin     = 0
-	vAppStartOrderMax     = 2147483648
+	vAppStartOrderMax     = math.MaxInt32
 	vAppStartOrderDefault = 0
+
+	vAppEntityDelayMin = 0
+	vAppEntityDelayMax = math.MaxInt32
+
+	vAppDescriptionDefault = "Created by Terraform"
+
+	// vApps are powered on after create if they have entities, or always.
+	vAppStartPolicyEntities = "entities"
+	vAppStartPolicyAlways   = "always"
 )
 
 var entityTypeList = []string{
@@ -44,6 +58,11 @@ var startActionList = []string{
 	string(types.VAppAutoStartActionPowerOn),
 }
 
+var startPolicyList = []string{
+	vAppStartPolicyEntities,
+	vAppStartPolicyAlways,
+}
+
 var stopActionList = []string{
 	string(types.VAppAutoStartActionNone),
 	string(types.VAppAutoStartActionPowerOff),
@@ -57,9 +76,16 @@ type vAppNetworkMapping struct {
 }
 
 type templateVApp struct {
-	name            string
-	diskFormat      types.VAppCloneSpecProvisioningType
-	networkMappings []vAppNetworkMapping
+	name              string
+	diskFormat        types.VAppCloneSpecProvisioningType
+	entityDiskFormats map[string]types.VAppCloneSpecProvisioningType
+	networkMappings   []vAppNetworkMapping
+	powerHandling     string
+	quiesce           bool
+	entityDatastores  map[string]string
+	ovfProperties     map[string]string
+	diskDatastores    []diskDatastore
+	sysprep           sysprepSettings
 }
 
 type vAppEntity struct {
@@ -70,6 +96,15 @@ type vAppEntity struct {
 	entityRPPath     string
 	entityMoid       string
 	folder           string
+	host             string
+	hostGroup        string
+	hostname         string
+	ovfProperties    map[string]string
+	domain           string
+	cloned           bool
+
+	// entityID is the ID of entity_ids the entity was added by.
+	entityID string
 }
 
 type vApp struct {
@@ -81,6 +116,7 @@ type vApp struct {
 	resourcePool string
 	folder       string
 	parentVApp   string
+	host         string
 
 	memory types.BaseResourceAllocationInfo
 	cpu    types.BaseResourceAllocationInfo
@@ -91,11 +127,23 @@ type vApp struct {
 	c               *govmomi.Client
 	d               *schema.ResourceData
 	createdVApp     *object.VirtualApp
+	datacenterObj   *object.Datacenter
 	dcFolders       *object.DatacenterFolders
 	folderObj       *object.Folder
 	finder          *find.Finder
+	placement       placementFinder
 	resourcePoolObj *object.ResourcePool
+	hostObj         *object.HostSystem
 	datastoreRef    types.ManagedObjectReference
+
+	// adopted is set when create took over an existing vApp, which is not
+	// destroyed on rollback.
+	adopted bool
+
+	// taskCtx bounds the task waits of the running operation by the
+	// timeout the user configured for it.
+	taskCtx     context.Context
+	taskTimeout time.Duration
 }
 
 func resourceVSphereVApp() *schema.Resource {
@@ -105,30 +153,70 @@ func resourceVSphereVApp() *schema.Resource {
 		Update: resourceVSphereVAppUpdate,
 		Delete: resourceVSphereVAppDelete,
 
-		SchemaVersion: 1,
+		SchemaVersion: 6,
+		MigrateState:  resourceVSphereVAppMigrateState,
+
+		Timeouts: resourceTimeouts(),
 
 		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
 			"name": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
 			},
 			"description": &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
-				Default:  "Created by Terraform",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     vAppDescriptionDefault,
+				Description: "Description of the vApp. Set to \"\" to clear it, without it the default is used.",
 			},
 			"uuid": &schema.Schema{
 				Type:     schema.TypeString,
 				Computed: true,
 			},
-			"datacenter": &schema.Schema{
+			// The same as uuid, under the name vSphere uses for it.
+			"instance_uuid": &schema.Schema{
 				Type:     schema.TypeString,
-				Optional: true,
-				ForceNew: true,
+				Computed: true,
 			},
-			"datastore": &schema.Schema{
+			// The description as vCenter has it, also when description is
+			// not managed.
+			"annotation": &schema.Schema{
 				Type:     schema.TypeString,
-				Optional: true,
+				Computed: true,
+			},
+			"product": vAppProductSchema(),
+			"moid": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			// The ID is the moid, the path is informational and follows
+			// renames and moves in vCenter.
+			"inventory_path": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"resource_pool_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"folder_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"datacenter": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDatacenterName,
+				StateFunc:    datacenterNameStateFunc,
+			},
+			"datastore": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Datastore or datastore cluster of the clone of template_vapp. Without template_vapp a datastore cluster places the virtual machines added as entities when the vApp is created.",
 			},
 			"cluster": &schema.Schema{
 				Type:     schema.TypeString,
@@ -138,30 +226,154 @@ func resourceVSphereVApp() *schema.Resource {
 			"resource_pool": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
 				//ForceNew: true,
 			},
-			"folder": &schema.Schema{
-				Type:     schema.TypeString,
+			// ESXi host the VMs of template_vapp are cloned to, relative
+			// to the cluster if set. Only used on create, so changing it
+			// recreates the vApp.
+			"host": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"placement_policy"},
+			},
+			// Chooses the resource pool of the vApp among the
+			// placement_candidates when it is created.
+			"placement_policy": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ValidateFunc:  validatePlacementPolicy,
+				ConflictsWith: []string{"resource_pool", "cluster"},
+			},
+			// Resource pool paths or cluster names, all clusters of the
+			// datacenter when empty.
+			"placement_candidates": &schema.Schema{
+				Type:     schema.TypeList,
 				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"folder": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateFolderPath,
+				StateFunc:    folderPathStateFunc,
 				//ForceNew: true,
 			},
 			"parent_vapp": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
 				//ForceNew: true,
 			},
+			// The managed object ID of the parent vApp, e.g. the moid of a
+			// vsphere_vapp in the same configuration, so it is created first.
+			"parent_vapp_id": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"parent_vapp"},
+			},
+			"archive_on_destroy": archiveOnDestroySchema(),
+
+			"allow_reparent": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Allows adding entities which are members of another vApp, which moves them out of it.",
+			},
+
+			"delete_behavior": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      vAppDeleteBehaviorDestroy,
+				ValidateFunc: validateDeleteBehavior,
+				Description:  "Set to detach_entities_only to move all entities out of the vApp on destroy, including the ones cloned from template_vapp, and only destroy the empty vApp.",
+			},
+
+			"start_on_create": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Powers on the vApp once it is created, set to false to leave it powered off.",
+			},
+
+			"start_policy": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      vAppStartPolicyEntities,
+				ValidateFunc: validateStartPolicy,
+			},
+
+			// Takes precedence over start_on_create, also read back when
+			// not set.
+			"power_state": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateVAppPowerState,
+			},
+
+			"overall_status": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			// Power states of the virtual machines and child vApps by name.
+			"entity_power_states": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+
+			"entity_ip_addresses":       vAppEntityIPAddressesSchema(),
+			"entity_ip_address_timeout": vAppEntityIPAddressTimeoutSchema(),
+
+			"start_group":              vAppStartGroupSchema(),
+			"restart_on_entity_change": vAppRestartOnEntityChangeSchema(),
+
+			// Effective boot sequence of the entities, one line per start
+			// order.
+			"boot_sequence": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"permission": permissionSchema(),
+
+			"spread_entities": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Keeps the virtual machines of the vApp on different hosts with an anti-affinity rule.",
+			},
+
+			"adopt_existing": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Takes over a vApp which already exists at the path instead of failing to create it. Its description is kept unless another one is configured.",
+			},
+
+			"spread_datastores": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Keeps the virtual machines of the vApp on different datastores of its datastore cluster with a Storage DRS anti-affinity rule.",
+			},
+
 			"entity": &schema.Schema{
 				Type:     schema.TypeSet,
 				Optional: true,
+				Set:      resourceVSphereVAppEntityHash,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"name": &schema.Schema{
-							Type:     schema.TypeString,
-							Required: true,
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Name of the entity, one of name or moid must be set.",
 						},
 						"folder": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateFolderPath,
 						},
 						"type": &schema.Schema{
 							Type:         schema.TypeString,
@@ -169,13 +381,15 @@ func resourceVSphereVApp() *schema.Resource {
 							ValidateFunc: validateEntityType,
 						},
 						"start_order": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
-							Default:  vAppStartOrderDefault,
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      vAppStartOrderDefault,
+							ValidateFunc: validateStartOrder,
 						},
 						"start_delay": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateEntityDelay,
 						},
 						"start_action": &schema.Schema{
 							Type:         schema.TypeString,
@@ -188,8 +402,9 @@ func resourceVSphereVApp() *schema.Resource {
 							ValidateFunc: validateStopAction,
 						},
 						"stop_delay": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateEntityDelay,
 						},
 						"waiting_for_guest": &schema.Schema{
 							Type:     schema.TypeBool,
@@ -199,21 +414,54 @@ func resourceVSphereVApp() *schema.Resource {
 							Type:     schema.TypeBool,
 							Optional: true,
 						},
-						"folder_path": &schema.Schema{
-							Type:     schema.TypeString,
-							Computed: true,
+						"host": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Pins the VM to this host of its cluster with a mandatory VM-host affinity rule.",
 						},
-						"moid": &schema.Schema{
-							Type:     schema.TypeString,
-							Computed: true,
+						"host_group": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Pins the VM to this existing host group of its cluster with a mandatory VM-host affinity rule.",
 						},
-						"resourcepool_path": &schema.Schema{
-							Type:     schema.TypeString,
-							Computed: true,
+						"hostname": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateGuestHostname,
+							Description:  "Hostname set by guest customization on the VM cloned from template_vapp. Only applied when the vApp is created.",
+						},
+						"domain": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "Domain set by guest customization on the VM cloned from template_vapp. Only applied when the vApp is created.",
+						},
+						"ovf_properties": &schema.Schema{
+							Type:        schema.TypeMap,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "User configurable OVF properties of the VM cloned from template_vapp, keyed by property ID. Only applied when the vApp is created.",
+						},
+						"moid": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Managed object ID of the entity, instead of name and folder.",
 						},
 					},
 				},
 			},
+			// IDs or uuids of vsphere_virtual_machine resources added as
+			// entities with the default start settings.
+			"entity_ids": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"entity_id_members": vAppEntityIDMembersSchema(),
+			// The moids and previous locations of the entities.
+			"entity_members": vAppEntityMembersSchema(),
 			"template_vapp": &schema.Schema{
 				Type:     schema.TypeList,
 				Optional: true,
@@ -226,9 +474,64 @@ func resourceVSphereVApp() *schema.Resource {
 							ForceNew: true,
 						},
 						"disk_provisioning": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-							Default:  types.VAppCloneSpecProvisioningTypeSameAsSource,
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      types.VAppCloneSpecProvisioningTypeSameAsSource,
+							ValidateFunc: validateDiskProvisioning,
+						},
+						"entity_disk_provisioning": &schema.Schema{
+							Type:        schema.TypeMap,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "Disk provisioning of individual VMs of the source vApp, keyed by VM name, overriding disk_provisioning.",
+						},
+						"entity_datastore": &schema.Schema{
+							Type:        schema.TypeMap,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "Datastore of individual VMs of the source vApp, keyed by VM name, overriding datastore.",
+						},
+						"disk_datastore": templateDiskDatastoreSchema(true),
+						"ovf_properties": &schema.Schema{
+							Type:        schema.TypeMap,
+							Optional:    true,
+							Sensitive:   true,
+							ForceNew:    true,
+							Description: "User configurable OVF properties of the cloned vApp, keyed by property ID.",
+						},
+						"source_power_handling": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      sourcePowerHandlingClone,
+							ValidateFunc: validateSourcePowerHandling,
+							Description:  "How a source vApp with running VMs is cloned: clone, fail, snapshot or power_off.",
+						},
+						"windows_time_zone": &schema.Schema{
+							Type:        schema.TypeInt,
+							Optional:    true,
+							ForceNew:    true,
+							Default:     sysprepTimeZoneDefault,
+							Description: "Windows time zone index set by guest customization on the Windows VMs with hostname or domain.",
+						},
+						"windows_full_name": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Default:     sysprepNameDefault,
+							Description: "Owner name set by guest customization on the Windows VMs with hostname or domain.",
+						},
+						"windows_organization": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Default:     sysprepNameDefault,
+							Description: "Organization set by guest customization on the Windows VMs with hostname or domain.",
+						},
+						"source_quiesce": &schema.Schema{
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     true,
+							Description: "Quiesce the guest file systems of the running source VMs when source_power_handling is snapshot.",
 						},
 						"network_mapping": &schema.Schema{
 							Type:     schema.TypeSet,
@@ -254,24 +557,45 @@ func resourceVSphereVApp() *schema.Resource {
 }
 
 func resourceVSphereVAppCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vapp", resourceLogName(d, "name"), "create")
+
+	// A vApp nested in a parent vApp inherits its placement from the parent.
+	_, hasParent := d.GetOk("parent_vapp")
+	_, hasParentID := d.GetOk("parent_vapp_id")
+	if !hasParent && !hasParentID {
+		setPlacementDefaults(d, meta.(*VSphereClient))
+	}
 
 	// Construct vAPP Object with some required Attributes
-	vapp, err := constructVApp(d, meta.(*govmomi.Client))
+	vapp, err := constructVApp(d, meta.(*VSphereClient))
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while creating vapp object: %s", err)
+		logger.Errorf("Error while creating vapp object: %s", err)
 		return err
 	}
-	log.Printf("[INFO] resourceVSphereVAppCreate :: Vapp : %s", vapp.name)
+	logger.Infof("Vapp : %s", vapp.name)
+
+	var cancel context.CancelFunc
+	vapp.taskTimeout = d.Timeout(schema.TimeoutCreate)
+	vapp.taskCtx, cancel = taskContext(vapp.taskTimeout)
+	defer cancel()
 
 	err = vapp.populateOptionalVAppAttributes(d)
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while reading Optional Input attributes: %s", err)
+		logger.Errorf("Error while reading Optional Input attributes: %s", err)
+		return err
+	}
+
+	// archive_on_destroy is only used on destroy, catch mistakes early.
+	if _, err := parseOvfArchiveData(d); err != nil {
 		return err
 	}
 
 	err = vapp.populateVAppTemplate(d)
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while reading VApp Template attributes: %s", err)
+		logger.Errorf("Error while reading VApp Template attributes: %s", err)
 		return err
 	}
 
@@ -283,31 +607,147 @@ func resourceVSphereVAppCreate(d *schema.ResourceData, meta interface{}) error {
 
 	err = vapp.populateVAppResourceAllocationInfo()
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while reading VApp Resource Allocation attributes: %s", err)
+		logger.Errorf("Error while reading VApp Resource Allocation attributes: %s", err)
 		return err
 	}
 
-	log.Printf("[DEBUG] resourceVSphereVAppCreate :: vapp : %#v", vapp)
+	logger.Debugf("vapp : %#v", vapp)
+
+	if vL, ok := d.GetOk("entity"); ok {
+		err = validateEntityReferences(vL.(*schema.Set).List())
+		if err != nil {
+			return err
+		}
+		err = validateUniqueEntities(vL.(*schema.Set).List())
+		if err != nil {
+			return err
+		}
+		err = validateEntityAffinity(vL.(*schema.Set).List())
+		if err != nil {
+			return err
+		}
+		err = validateEntityCustomization(vL.(*schema.Set).List(), vapp.vAppToClone.name != "")
+		if err != nil {
+			return err
+		}
+	}
+	err = validateStartGroups(parseVAppStartGroups(d.Get("start_group").([]interface{})), d.Get("entity").(*schema.Set).List())
+	if err != nil {
+		return err
+	}
+
+	if v, ok := d.GetOk("entity_ids"); ok {
+		idEntities, err := vapp.entityIDEntities(v.(*schema.Set).List(), vapp.vAppEntities)
+		if err != nil {
+			return err
+		}
+		vapp.vAppEntities = append(vapp.vAppEntities, idEntities...)
+	}
+
+	if vapp.vAppToClone.name != "" && len(vapp.vAppEntities) > 0 {
+		err = vapp.markClonedEntities()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = vapp.validateEntities(vapp.vAppEntities)
+	if err != nil {
+		return err
+	}
+
+	err = vapp.resolveParentVApp(d)
+	if err != nil {
+		return err
+	}
+
+	err = vapp.applyPlacementPolicy(d)
+	if err != nil {
+		logger.Errorf("Error while placing VApp : %s", err)
+		return err
+	}
+
+	if d.Get("spread_datastores").(bool) {
+		if _, err = vapp.vAppStoragePod(); err != nil {
+			return err
+		}
+	}
+	if _, err = vapp.entityStoragePod(); err != nil {
+		return err
+	}
 
 	err = vapp.calculateLocation()
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while finding resource location : %s", err)
+		logger.Errorf("Error while finding resource location : %s", err)
 		return err
 	}
+	if vapp.hostObj != nil && vapp.vAppToClone.name == "" {
+		return fmt.Errorf("host is only used when cloning template_vapp, the entities of vApp %s stay on their hosts", vapp.name)
+	}
 
-	err = vapp.create()
+	if vapp.vAppToClone.name != "" {
+		err = vapp.validateNetworkMappings()
+		if err != nil {
+			return err
+		}
+		err = vapp.validateDiskProvisioningOverrides()
+		if err != nil {
+			return err
+		}
+		err = vapp.validateDiskPlacement()
+		if err != nil {
+			return err
+		}
+	}
+
+	existing, err := vapp.findExistingVApp()
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while creating VApp : %s", err)
 		return err
 	}
+	if existing != nil {
+		if !d.Get("adopt_existing").(bool) {
+			return fmt.Errorf("vApp %s already exists. Set adopt_existing to manage the existing vApp, "+
+				"or remove or rename it.", getVAppPath(d))
+		}
+		err = vapp.adoptExistingVApp(existing)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = vapp.create()
+		if err != nil {
+			logger.Errorf("Error while creating VApp : %s", err)
+			return translateVSphereError(err, fmt.Sprintf("vApp %s", getVAppPath(d)))
+		}
+	}
 
 	configSpec := types.VAppConfigSpec{}
-	configSpec.Annotation = vapp.description
+	// An adopted vApp keeps its description over the default. Read puts it
+	// into state, so the next plan shows the default instead of create
+	// overwriting the description unseen.
+	if !vapp.adopted || vapp.description != vAppDescriptionDefault {
+		configSpec.Annotation = vapp.description
+	}
+
+	if vapp.vAppToClone.name != "" && len(vapp.vAppEntities) > 0 && !vapp.adopted {
+		err := vapp.customizeClonedEntities()
+		if err != nil {
+			logger.Errorf("Error while customizing cloned Entities: %s", err)
+			vapp.rollbackCreate(nil)
+			return err
+		}
+	}
 
 	if len(vapp.vAppEntities) > 0 {
 		err := vapp.addEntities(vapp.vAppEntities)
 		if err != nil {
-			log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while adding Entities into VApp: %s", err)
+			logger.Errorf("Error while adding Entities into VApp: %s", err)
+			vapp.rollbackCreate(nil)
+			return err
+		}
+		if err := vapp.placeAddedEntities(); err != nil {
+			logger.Errorf("Error while placing Entities on datastore cluster : %s", err)
+			vapp.rollbackCreate(nil)
 			return err
 		}
 
@@ -316,124 +756,333 @@ func resourceVSphereVAppCreate(d *schema.ResourceData, meta interface{}) error {
 
 	err = vapp.updateVApp(configSpec)
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while updating VApp to modify Entities : %s", err)
+		logger.Errorf("Error while updating VApp to modify Entities : %s", err)
+		vapp.rollbackCreate(vapp.vAppEntities)
 		return err
 	}
 
-	err = vapp.powerOnVApp()
+	// configSpec leaves out an empty description, a clone or an adopted
+	// vApp would keep the description it has.
+	if vapp.description == "" {
+		err = vapp.setVAppAnnotation("")
+		if err != nil {
+			logger.Errorf("Error while clearing the description of VApp : %s", err)
+			vapp.rollbackCreate(vapp.vAppEntities)
+			return err
+		}
+	}
+
+	// The rules are in place before the power on, so DRS already places the
+	// entities on their hosts.
+	err = vapp.applyHostAffinity(vapp.vAppEntities)
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppCreate :: Error while Powering On VApp: %s", err)
+		logger.Errorf("Error while setting host affinity of Entities : %s", err)
+		if cerr := vapp.clearHostAffinity(vapp.vAppEntitiesWithHostAffinity()); cerr != nil {
+			logger.Errorf("Error while removing host affinity of Entities : %s", cerr)
+		}
+		vapp.rollbackCreate(vapp.vAppEntities)
 		return err
 	}
 
+	if d.Get("spread_entities").(bool) {
+		err = vapp.applySpreadRule()
+		if err != nil {
+			logger.Errorf("Error while spreading Entities : %s", err)
+			if cerr := vapp.clearSpreadRule(); cerr != nil {
+				logger.Errorf("Error while removing spread rule of Entities : %s", cerr)
+			}
+			if cerr := vapp.clearHostAffinity(vapp.vAppEntitiesWithHostAffinity()); cerr != nil {
+				logger.Errorf("Error while removing host affinity of Entities : %s", cerr)
+			}
+			vapp.rollbackCreate(vapp.vAppEntities)
+			return err
+		}
+	}
+
+	if d.Get("spread_datastores").(bool) {
+		err = vapp.applyDatastoreSpreadRule()
+		if err != nil {
+			logger.Errorf("Error while spreading datastores of Entities : %s", err)
+			if cerr := vapp.clearDatastoreSpreadRule(); cerr != nil {
+				logger.Errorf("Error while removing datastore spread rule of Entities : %s", cerr)
+			}
+			if d.Get("spread_entities").(bool) {
+				if cerr := vapp.clearSpreadRule(); cerr != nil {
+					logger.Errorf("Error while removing spread rule of Entities : %s", cerr)
+				}
+			}
+			if cerr := vapp.clearHostAffinity(vapp.vAppEntitiesWithHostAffinity()); cerr != nil {
+				logger.Errorf("Error while removing host affinity of Entities : %s", cerr)
+			}
+			vapp.rollbackCreate(vapp.vAppEntities)
+			return err
+		}
+	}
+
+	if v, ok := d.GetOk("power_state"); ok {
+		err = vapp.setVAppPowerState(v.(string))
+		if err != nil {
+			logger.Errorf("Error while setting power state of VApp: %s", err)
+			vapp.rollbackCreate(vapp.vAppEntities)
+			return err
+		}
+	} else if d.Get("start_on_create").(bool) && !vapp.adopted {
+		err = vapp.powerOnVApp(d.Get("start_policy").(string))
+		if err != nil {
+			logger.Errorf("Error while Powering On VApp: %s", err)
+			vapp.rollbackCreate(vapp.vAppEntities)
+			return err
+		}
+	} else {
+		logger.Infof("Leaving VApp %s powered off", vapp.name)
+	}
+
 	// Back Populate moid, folder and resourcepool path
 	err = vapp.backPopulateEntiy(vapp.vAppEntities)
 	if err != nil {
 		return err
 	}
+	err = vapp.setEntityIDMembers(vapp.vAppEntities)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(vapp.createdVApp.Reference().Value)
 
-	d.SetId(getVAppPath(d))
+	if _, ok := d.GetOk("permission"); ok {
+		err = parseUserPermissionData(d, vapp.c).setResourcePermission(vapp.createdVApp.Reference())
+		if err != nil {
+			logger.Errorf("Error while setting permission of VApp: %s", err)
+			return err
+		}
+	}
+
+	err = vapp.waitForGuests()
+	if err != nil {
+		return err
+	}
+	err = vapp.waitForEntityIPAddresses(d)
+	if err != nil {
+		return err
+	}
 	return resourceVSphereVAppRead(d, meta)
 }
 
 func resourceVSphereVAppRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vapp", resourceLogName(d, "name"), "read")
 
-	vapp, err := constructVApp(d, meta.(*govmomi.Client))
+	vapp, err := constructVApp(d, meta.(*VSphereClient))
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppRead :: Error while reading vapp object: %s", err)
+		logger.Errorf("Error while reading vapp object: %s", err)
 		return err
 	}
-	log.Printf("[INFO] resourceVSphereVAppRead:: Vapp : %s", vapp.name)
+	logger.Infof("Vapp : %s", vapp.name)
 
-	vapp.createdVApp, err = getCreatedVApp(d, vapp.finder)
+	vapp.createdVApp, err = getCreatedVApp(d, vapp.c, vapp.finder)
 	if err != nil {
 		d.SetId("")
 		return nil
 	}
+	d.SetId(vapp.createdVApp.Reference().Value)
+	d.Set("inventory_path", canonicalInventoryPath(vapp.createdVApp.InventoryPath))
 
 	var mvapp mo.VirtualApp
 	collector := property.DefaultCollector(vapp.c.Client)
-	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"vAppConfig"}, &mvapp); err != nil {
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"name", "vAppConfig", "parent", "parentFolder"}, &mvapp); err != nil {
 		return err
 	}
 
+	d.Set("name", mvapp.Name)
 	d.Set("uuid", mvapp.VAppConfig.InstanceUuid)
+	d.Set("instance_uuid", mvapp.VAppConfig.InstanceUuid)
+	d.Set("description", mvapp.VAppConfig.Annotation)
+	d.Set("annotation", mvapp.VAppConfig.Annotation)
+	if err := d.Set("product", flattenVAppProducts(mvapp.VAppConfig.Product)); err != nil {
+		return err
+	}
+	d.Set("moid", vapp.createdVApp.Reference().Value)
+
+	runtime, err := vapp.readVAppRuntime()
+	if err != nil {
+		return err
+	}
+	d.Set("power_state", runtime.powerState)
+	d.Set("overall_status", runtime.overallStatus)
+	d.Set("entity_power_states", runtime.entityPowerStates)
+
+	addresses, _, err := vapp.readEntityIPAddresses()
+	if err != nil {
+		return err
+	}
+	d.Set("entity_ip_addresses", addresses)
+
+	if err := vapp.reconcileEntities(&mvapp); err != nil {
+		return err
+	}
+
+	bootSequence, err := vapp.readBootSequence(&mvapp)
+	if err != nil {
+		return err
+	}
+	d.Set("boot_sequence", bootSequence)
+
+	if err := readResourcePermission(d, vapp.c, vapp.createdVApp.Reference()); err != nil {
+		return err
+	}
+
+	// The parent is the resource pool or, for nested vApps, the parent vApp.
+	// Only top level vApps have a parent folder.
+	if mvapp.Parent != nil {
+		d.Set("resource_pool_id", mvapp.Parent.Value)
+	}
+	if mvapp.ParentFolder != nil {
+		d.Set("folder_id", mvapp.ParentFolder.Value)
+	} else {
+		d.Set("folder_id", "")
+	}
 
 	return nil
 }
 
 func resourceVSphereVAppUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vapp", resourceLogName(d, "name"), "update")
 
 	// Construct vAPP Object with some required Attributes
-	vapp, err := constructVApp(d, meta.(*govmomi.Client))
+	vapp, err := constructVApp(d, meta.(*VSphereClient))
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppUpdate :: Error while updating vapp object: %s", err)
+		logger.Errorf("Error while updating vapp object: %s", err)
 		return err
 	}
-	log.Printf("[INFO] resourceVSphereVAppUpdate :: Vapp : %s", vapp.name)
+	logger.Infof("Vapp : %s", vapp.name)
+
+	var cancel context.CancelFunc
+	vapp.taskTimeout = d.Timeout(schema.TimeoutUpdate)
+	vapp.taskCtx, cancel = taskContext(vapp.taskTimeout)
+	defer cancel()
 
-	vapp.createdVApp, err = getCreatedVApp(d, vapp.finder)
+	vapp.createdVApp, err = getCreatedVApp(d, vapp.c, vapp.finder)
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppUpdate :: Error while finding VApp: %s", err)
+		logger.Errorf("Error while finding VApp: %s", err)
 		return err
 	}
 
+	if d.HasChange("name") {
+		if err := vapp.renameVApp(); err != nil {
+			return err
+		}
+	}
+
 	err = vapp.populateOptionalVAppAttributes(d)
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppUpdate :: Error while reading Optional Input attributes: %s", err)
+		logger.Errorf("Error while reading Optional Input attributes: %s", err)
 		return err
 	}
 
+	if d.HasChange("archive_on_destroy") {
+		if _, err := parseOvfArchiveData(d); err != nil {
+			return err
+		}
+	}
+
 	configSpec := types.VAppConfigSpec{}
-	var vappModifiedEntities []vAppEntity
+	var vappModifiedEntities, restartEntities []vAppEntity
 	var hasChange, backPopulate bool
 
+	if d.HasChange("entity") || d.HasChange("start_group") {
+		err = validateStartGroups(parseVAppStartGroups(d.Get("start_group").([]interface{})), d.Get("entity").(*schema.Set).List())
+		if err != nil {
+			return err
+		}
+	}
+
 	if d.HasChange("entity") {
+		// Removed entities are dropped from entity_members.
+		backPopulate = true
 		oldEntities, newEntities := d.GetChange("entity")
 		oldEntitySet := oldEntities.(*schema.Set)
 		newEntitySet := newEntities.(*schema.Set)
 
+		err = validateEntityReferences(newEntitySet.List())
+		if err != nil {
+			return err
+		}
+		err = validateUniqueEntities(newEntitySet.List())
+		if err != nil {
+			return err
+		}
+		err = validateEntityAffinity(newEntitySet.List())
+		if err != nil {
+			return err
+		}
+
 		addedEntitySet := newEntitySet.Difference(oldEntitySet)
 		removedEntitySet := oldEntitySet.Difference(newEntitySet)
 
-		log.Printf("[DEBUG] addedEntitySet : %#v\n", addedEntitySet)
-		log.Printf("[DEBUG] removedEntitySet : %#v\n", removedEntitySet)
+		logger.Debugf("addedEntitySet : %#v\n", addedEntitySet)
+		logger.Debugf("removedEntitySet : %#v\n", removedEntitySet)
 
 		//Finding the Modifed Entities
-		var modifiedEntities []interface{}
+		var modifiedEntities, affinityRemovedEntities []interface{}
 		for _, value := range addedEntitySet.List() {
 			addedEntity := value.(map[string]interface{})
 			for _, value := range removedEntitySet.List() {
 				removedEntity := value.(map[string]interface{})
-				if addedEntity["name"] == removedEntity["name"] && addedEntity["type"] == removedEntity["type"] {
-					log.Printf("[DEBUG] Mofifying the enity %#v", addedEntity)
+				if vAppEntityLabel(addedEntity) == vAppEntityLabel(removedEntity) && addedEntity["type"] == removedEntity["type"] {
+					logger.Debugf("Mofifying the enity %#v", addedEntity)
 					addedEntitySet.Remove(addedEntity)
 					removedEntitySet.Remove(removedEntity)
-					addedEntity["moid"] = removedEntity["moid"]
-					addedEntity["folder_path"] = removedEntity["folder_path"]
-					addedEntity["resourcepool_path"] = removedEntity["resourcepool_path"]
 					modifiedEntities = append(modifiedEntities, addedEntity)
+					if entityHasHostAffinity(removedEntity) && !entityHasHostAffinity(addedEntity) {
+						affinityRemovedEntities = append(affinityRemovedEntities, removedEntity)
+					}
 					break
 				}
 			}
 		}
+		// New entities are never clones of template_vapp.
+		err = validateEntityCustomization(addedEntitySet.List(), false)
+		if err != nil {
+			return err
+		}
 
-		log.Printf("[DEBUG] addedEntities : %#v\n", addedEntitySet.List())
-		log.Printf("[DEBUG] removedEntities : %#v\n", removedEntitySet.List())
-		log.Printf("[DEBUG] modifiedEntities : %#v\n", modifiedEntities)
+		for _, value := range removedEntitySet.List() {
+			if entityHasHostAffinity(value.(map[string]interface{})) {
+				affinityRemovedEntities = append(affinityRemovedEntities, value)
+			}
+		}
+		if len(affinityRemovedEntities) > 0 {
+			err = vapp.clearHostAffinity(vapp.populateVAppEntities(affinityRemovedEntities))
+			if err != nil {
+				return err
+			}
+		}
+
+		logger.Debugf("addedEntities : %#v\n", addedEntitySet.List())
+		logger.Debugf("removedEntities : %#v\n", removedEntitySet.List())
+		logger.Debugf("modifiedEntities : %#v\n", modifiedEntities)
 
 		//Populate Added Entities
 		var vappAddedEntities []vAppEntity
 		if addedEntitySet.Len() > 0 {
 			vappAddedEntities = vapp.populateVAppEntities(addedEntitySet.List())
-			err := vapp.addEntities(vappAddedEntities)
+			err := vapp.validateEntities(vappAddedEntities)
+			if err != nil {
+				return err
+			}
+			err = vapp.addEntities(vappAddedEntities)
 			if err != nil {
 				return err
 			}
 		}
 
 		if removedEntitySet.Len() > 0 {
-			err = vapp.removeEntities(removedEntitySet)
+			err = vapp.removeEntities(vapp.populateVAppEntities(removedEntitySet.List()))
 			if err != nil {
 				return err
 			}
@@ -442,7 +1091,8 @@ func resourceVSphereVAppUpdate(d *schema.ResourceData, meta interface{}) error {
 		//Populate Modified Entities
 		//
 		vappModifiedEntities = vapp.populateVAppEntities(modifiedEntities)
-		log.Printf("[DEBUG] vappModifiedEntities : %#v\n", vappModifiedEntities)
+		logger.Debugf("vappModifiedEntities : %#v\n", vappModifiedEntities)
+		restartEntities = vapp.populateVAppEntities(modifiedEntities)
 
 		//Added Modified Entities
 		for _, v := range vappAddedEntities {
@@ -452,15 +1102,32 @@ func resourceVSphereVAppUpdate(d *schema.ResourceData, meta interface{}) error {
 		if len(vappModifiedEntities) > 0 {
 
 			hasChange = true
-			backPopulate = true
 			configSpec.EntityConfig = vapp.createEntityConfigInfo(vappModifiedEntities)
 		}
 	}
 
-	if d.HasChange("description") {
-		hasChange = true
-		configSpec.Annotation = vapp.description
+	if d.HasChange("entity_ids") {
+		entities := vapp.populateVAppEntities(d.Get("entity").(*schema.Set).List())
+		addedIDEntities, err := vapp.updateEntityIDs(entities)
+		if err != nil {
+			return err
+		}
+		if len(addedIDEntities) > 0 {
+			hasChange = true
+			configSpec.EntityConfig = append(configSpec.EntityConfig, vapp.createEntityConfigInfo(addedIDEntities)...)
+		}
+	}
 
+	if d.HasChange("description") {
+		if vapp.description == "" {
+			err = vapp.setVAppAnnotation("")
+			if err != nil {
+				return err
+			}
+		} else {
+			hasChange = true
+			configSpec.Annotation = vapp.description
+		}
 	}
 
 	if hasChange {
@@ -470,6 +1137,40 @@ func resourceVSphereVAppUpdate(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 
+	err = vapp.applyHostAffinity(vappModifiedEntities)
+	if err != nil {
+		return err
+	}
+
+	// The rule follows the virtual machines in the vApp.
+	if d.Get("spread_entities").(bool) {
+		if d.HasChange("spread_entities") || d.HasChange("entity") || d.HasChange("entity_ids") {
+			err = vapp.applySpreadRule()
+			if err != nil {
+				return err
+			}
+		}
+	} else if d.HasChange("spread_entities") {
+		err = vapp.clearSpreadRule()
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Get("spread_datastores").(bool) {
+		if d.HasChange("spread_datastores") || d.HasChange("entity") || d.HasChange("entity_ids") {
+			err = vapp.applyDatastoreSpreadRule()
+			if err != nil {
+				return err
+			}
+		}
+	} else if d.HasChange("spread_datastores") {
+		err = vapp.clearDatastoreSpreadRule()
+		if err != nil {
+			return err
+		}
+	}
+
 	if backPopulate {
 		err = vapp.backPopulateEntiy(vappModifiedEntities)
 		if err != nil {
@@ -477,47 +1178,144 @@ func resourceVSphereVAppUpdate(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 
+	if d.Get("restart_on_entity_change").(bool) && !d.HasChange("power_state") {
+		err = vapp.restartEntities(restartEntities)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("power_state") {
+		err = vapp.setVAppPowerState(d.Get("power_state").(string))
+		if err != nil {
+			return err
+		}
+		err = vapp.waitForGuests()
+		if err != nil {
+			return err
+		}
+		err = vapp.waitForEntityIPAddresses(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("permission") {
+		err = parseUserPermissionData(d, vapp.c).updateResourcePermission(vapp.createdVApp.Reference())
+		if err != nil {
+			logger.Errorf("Permission update failed: %s", err)
+			return err
+		}
+	}
+
 	return nil
 }
 
 func resourceVSphereVAppDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vapp", resourceLogName(d, "name"), "delete")
 
 	// Construct vAPP Object with some required Attributes
-	vapp, err := constructVApp(d, meta.(*govmomi.Client))
+	vapp, err := constructVApp(d, meta.(*VSphereClient))
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppDelete :: Error while deleting vapp object: %s", err)
+		logger.Errorf("Error while deleting vapp object: %s", err)
 		return err
 	}
 
-	log.Printf("[INFO] resourceVSphereVAppDelete :: Vapp : %s", vapp.name)
+	logger.Infof("Vapp : %s", vapp.name)
+
+	var cancel context.CancelFunc
+	vapp.taskTimeout = d.Timeout(schema.TimeoutDelete)
+	vapp.taskCtx, cancel = taskContext(vapp.taskTimeout)
+	defer cancel()
 
-	vapp.createdVApp, err = getCreatedVApp(vapp.d, vapp.finder)
+	vapp.createdVApp, err = getCreatedVApp(vapp.d, vapp.c, vapp.finder)
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppDelete :: Error while finding VApp: %s", err)
+		logger.Errorf("Error while finding VApp: %s", err)
 		return err
 	}
 
+	// Export the vApp with all its entities before they are moved out.
+	archive, err := parseOvfArchiveData(d)
+	if err != nil {
+		return err
+	}
+	if archive != nil {
+		err = vapp.powerOffVApp()
+		if err != nil {
+			logger.Errorf("Error while powering Off VApp: %s", err)
+			return err
+		}
+		dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
+		if err != nil {
+			return err
+		}
+		logger.Infof("Archiving VApp %s before deleting it", vapp.name)
+		err = archive.archiveBeforeDelete(vapp.c, dc, vapp.createdVApp.Reference(), vapp.name)
+		if err != nil {
+			return fmt.Errorf("Error archiving vApp %s, not deleting it: %s", vapp.name, err)
+		}
+	}
+
+	if d.Get("spread_entities").(bool) {
+		err = vapp.clearSpreadRule()
+		if err != nil {
+			logger.Errorf("Error while removing spread rule of entities: %s", err)
+			return err
+		}
+	}
+
+	if d.Get("spread_datastores").(bool) {
+		err = vapp.clearDatastoreSpreadRule()
+		if err != nil {
+			logger.Errorf("Error while removing datastore spread rule of entities: %s", err)
+			return err
+		}
+	}
+
 	if vL, ok := d.GetOk("entity"); ok {
 		if entitySet, ok := vL.(*schema.Set); ok {
+			vapp.vAppEntities = vapp.populateVAppEntities(entitySet.List())
+			err = vapp.clearHostAffinity(vapp.vAppEntitiesWithHostAffinity())
+			if err != nil {
+				logger.Errorf("Error while removing host affinity of entities: %s", err)
+				return err
+			}
 			if entitySet.Len() > 0 {
-				err = vapp.removeEntities(entitySet)
+				err = vapp.removeEntities(vapp.vAppEntities)
 				if err != nil {
-					log.Printf("[ERROR] resourceVSphereVAppDelete :: Error while removing entities from VApp: %s", err)
+					logger.Errorf("Error while removing entities from VApp: %s", err)
 					return err
 				}
 			}
 		}
 	}
+	for _, member := range vapp.entityIDMembers() {
+		err = vapp.moveEntityOut(member.entityType, member.entityMoid, member.entityRPPath, member.entityFolderPath)
+		if err != nil {
+			logger.Errorf("Error while removing entity %s of entity_ids from VApp: %s", member.entityID, err)
+			return err
+		}
+	}
+	if d.Get("delete_behavior").(string) == vAppDeleteBehaviorDetach {
+		err = vapp.detachRemainingEntities()
+		if err != nil {
+			logger.Errorf("Error while detaching entities from VApp: %s", err)
+			return err
+		}
+	}
 
 	err = vapp.powerOffVApp()
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppDelete :: Error while powering Off VApp: %s", err)
+		logger.Errorf("Error while powering Off VApp: %s", err)
 		return err
 	}
 
 	err = vapp.destroyVApp()
 	if err != nil {
-		log.Printf("[ERROR] resourceVSphereVAppDelete :: Error while deleting VApp: %s", err)
+		logger.Errorf("Error while deleting VApp: %s", err)
 		return err
 	}
 
@@ -538,7 +1336,23 @@ func NewVApp(d *schema.ResourceData, c *govmomi.Client) *vApp {
 	return vapp
 }
 
-func getCreatedVApp(d *schema.ResourceData, f *find.Finder) (*object.VirtualApp, error) {
+// getCreatedVApp returns the vApp of the resource by its managed object ID,
+// so it is still found after a rename or move in vCenter. States which still
+// hold the inventory path as ID, and clones which have no ID yet, are looked
+// up by the configured path.
+func getCreatedVApp(d *schema.ResourceData, c *govmomi.Client, f *find.Finder) (*object.VirtualApp, error) {
+
+	if isManagedObjectID(d.Id()) {
+		ref := types.ManagedObjectReference{Type: vAppEntityTypeVApp, Value: d.Id()}
+		vAppPath, err := managedObjectInventoryPath(c.Client, ref)
+		if err != nil {
+			log.Printf("[ERROR] Couldn't able to find the Created VApp: %s", d.Id())
+			return nil, err
+		}
+		vapp := object.NewVirtualApp(c.Client, ref)
+		vapp.InventoryPath = vAppPath
+		return vapp, nil
+	}
 
 	vAppPath := getVAppPath(d)
 
@@ -567,14 +1381,14 @@ func getVAppPath(d *schema.ResourceData) string {
 
 	} else if v, ok := d.GetOk("folder"); ok && v != "" {
 
-		vAppPath = vAppPathString(v.(string), vAppName)
+		vAppPath = vAppPathString(normalizeFolderPath(v.(string)), vAppName)
 
 	}
 	return vAppPath
 
 }
 
-func (vapp *vApp) powerOnVApp() error {
+func (vapp *vApp) powerOnVApp(policy string) error {
 
 	// Read the Vapp properties to check if they have entities
 	var mvapp mo.VirtualApp
@@ -583,13 +1397,13 @@ func (vapp *vApp) powerOnVApp() error {
 		return err
 	}
 
-	if len(mvapp.VAppConfig.EntityConfig) > 0 {
-		log.Printf("[INFO] Vapp contains Entities to powerOn")
+	if len(mvapp.VAppConfig.EntityConfig) > 0 || policy == vAppStartPolicyAlways {
+		log.Printf("[INFO] Powering on Vapp %s (start_policy %s)", vapp.name, policy)
 		task, err := vapp.createdVApp.PowerOn(context.TODO())
 		if err != nil {
 			return err
 		}
-		err = task.Wait(context.TODO())
+		err = vapp.waitForTask(task, "power on vApp "+vapp.name)
 		if err != nil {
 			// ignore if the vapp is already powered on
 			if f, ok := err.(types.HasFault); ok {
@@ -613,7 +1427,7 @@ func (vapp *vApp) powerOffVApp() error {
 	if err != nil {
 		return err
 	}
-	err = task.Wait(context.TODO())
+	err = vapp.waitForTask(task, "power off vApp "+vapp.name)
 	if err != nil {
 		// ignore if the vapp is already powered off
 		if f, ok := err.(types.HasFault); ok {
@@ -634,7 +1448,7 @@ func (vapp *vApp) destroyVApp() error {
 	if err != nil {
 		return err
 	}
-	err = task.Wait(context.TODO())
+	err = vapp.waitForTask(task, "destroy vApp "+vapp.name)
 	if err != nil {
 		return err
 	}
@@ -642,145 +1456,85 @@ func (vapp *vApp) destroyVApp() error {
 
 }
 
-func vAppPathString(parentFolder string, name string) string {
-	var path string
-	if len(parentFolder) > 0 {
-		path += parentFolder + "/"
-	}
-	return path + name
-}
-
-func (vapp *vApp) getVmref() (*types.ManagedObjectReference, error) {
-	sourceVApp, err := vapp.finder.VirtualApp(context.TODO(), vapp.vAppToClone.name)
-	if err != nil {
-		log.Printf("[ERROR] Coundn't able to find the vapp: %s, to be cloned ", vapp.vAppToClone.name)
-		return nil, err
-	}
-	log.Printf("[DEBUG] sourceVApp: %#v", sourceVApp.ResourcePool)
-
-	// Read the Vapp properties
-	var mvapp mo.VirtualApp
-	collector := property.DefaultCollector(vapp.c.Client)
-	if err := collector.RetrieveOne(context.TODO(), sourceVApp.Reference(), []string{"vAppConfig"}, &mvapp); err != nil {
-		return nil, err
-	}
-	log.Printf("[DEBUG] mvapp: %#v", mvapp.VAppConfig.EntityConfig)
-	var vmRef *types.ManagedObjectReference
-	for _, entities := range mvapp.VAppConfig.EntityConfig {
-		vmRef = entities.Key
-	}
-	log.Printf("[DEBUG] vmRef: %#v", vmRef)
-	return vmRef, nil
-}
-
-func (vapp *vApp) calculateDatastore() error {
-	var datastore *object.Datastore
-	var err error
-	if vapp.datastore == "" {
-		datastore, err = vapp.finder.DefaultDatastore(context.TODO())
-		if err != nil {
-			return err
-		}
-	} else {
-		datastore, err = vapp.finder.Datastore(context.TODO(), vapp.datastore)
-		if err != nil {
-			d, err := getDatastoreObject(vapp.c, vapp.dcFolders, vapp.datastore)
-			if err != nil {
-				return err
-			}
-			if d.Type == "StoragePod" {
-				sp := object.StoragePod{
-					Folder: object.NewFolder(vapp.c.Client, d),
-				}
-				spr := sp.Reference()
-				rpr := vapp.resourcePoolObj.Reference()
-				vmfr := vapp.folderObj.Reference()
-				// Getting a vm reference from Source VApp object
-				vmRef, err := vapp.getVmref()
-				if err != nil {
-					log.Printf("[ERROR] Coundn't able to find a vm in vmRef")
-					return err
-				}
-				sps := types.StoragePlacementSpec{
-					Type: "clone",
-					Vm:   vmRef,
-					PodSelectionSpec: types.StorageDrsPodSelectionSpec{
-						StoragePod: &spr,
-					},
-					CloneSpec: &types.VirtualMachineCloneSpec{
-						Location: types.VirtualMachineRelocateSpec{
-							Pool: &rpr,
-						},
-					},
-					CloneName: "dummy",
-					Folder:    &vmfr,
-				}
-				datastore, err = findDatastore(vapp.c, sps)
-				if err != nil {
-					return err
-				}
-			} else {
-				datastore = object.NewDatastore(vapp.c.Client, d)
-			}
-		}
+// renameVApp renames the vApp to the configured name, which also undoes a
+// rename in vCenter.
+func (vapp *vApp) renameVApp() error {
+	oldName, _ := vapp.d.GetChange("name")
+	log.Printf("[INFO] Renaming vApp %s to %s", oldName, vapp.name)
+
+	req := types.Rename_Task{
+		This:    vapp.createdVApp.Reference(),
+		NewName: vapp.name,
 	}
-	vapp.datastoreRef = datastore.Reference()
-	log.Printf("[DEBUG] datastore: %#v", datastore)
-	return nil
+	res, err := methods.Rename_Task(context.TODO(), vapp.c, &req)
+	if err != nil {
+		return err
+	}
+	task := object.NewTask(vapp.c.Client, res.Returnval)
+	return vapp.waitForTask(task, "rename vApp "+oldName.(string))
 }
 
-func (vapp *vApp) calculateResourcePool() error {
-	var err error
-	var resourcePool *object.ResourcePool
-	var parentVApp *object.VirtualApp
-	if vapp.parentVApp != "" {
-		parentVApp, err = vapp.finder.VirtualApp(context.TODO(), vapp.parentVApp)
-		if err != nil {
-			return err
-		}
-		resourcePool = parentVApp.ResourcePool
-	} else if vapp.resourcePool == "" {
-		if vapp.cluster == "" {
-			resourcePool, err = vapp.finder.DefaultResourcePool(context.TODO())
+// waitForTask waits on a vApp task within the timeout of the running
+// operation, logging its progress. Outside of a create, update or delete the
+// wait is not limited.
+func (vapp *vApp) waitForTask(task *object.Task, operation string) error {
+	ctx := vapp.taskCtx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	return taskTimeoutError(ctx, waitForTaskWithProgress(ctx, task, operation), operation, vapp.taskTimeout)
+}
+
+func vAppPathString(parentFolder string, name string) string {
+	var path string
+	if len(parentFolder) > 0 {
+		path += parentFolder + "/"
+	}
+	return path + name
+}
+
+// placementSpec returns the placement of the vApp. A datastore cluster
+// places a clone of a VM of the source vApp.
+func (vapp *vApp) placementSpec() placementSpec {
+	return placementSpec{
+		cluster:      vapp.cluster,
+		resourcePool: vapp.resourcePool,
+		parentVApp:   vapp.parentVApp,
+		folder:       vapp.folder,
+		datastore:    vapp.datastore,
+		host:         vapp.host,
+		podPlacement: func(pod types.ManagedObjectReference, pool *object.ResourcePool, folder *object.Folder) (types.StoragePlacementSpec, error) {
+			vmRef, err := vapp.placement.VirtualAppVM(vapp.vAppToClone.name)
 			if err != nil {
-				return err
+				log.Printf("[ERROR] Coundn't able to find the vapp: %s, to be cloned ", vapp.vAppToClone.name)
+				return types.StoragePlacementSpec{}, err
 			}
-		} else {
-			resourcePool, err = vapp.finder.ResourcePool(context.TODO(), "*"+vapp.cluster+"/Resources")
-			if err != nil {
-				return err
+			if vmRef == nil {
+				return types.StoragePlacementSpec{}, fmt.Errorf("vApp %s has no VM to place on datastore cluster %s",
+					vapp.vAppToClone.name, vapp.datastore)
 			}
-		}
-	} else {
-		resourcePool, err = vapp.finder.ResourcePool(context.TODO(), vapp.resourcePool)
-		if err != nil {
-			return err
-		}
+			return storagePodCloneSpec(pod, vmRef, pool, folder), nil
+		},
+	}
+}
+
+func (vapp *vApp) calculateDatastore() error {
+	p := &placement{resourcePool: vapp.resourcePoolObj, folder: vapp.folderObj}
+	if err := resolvePlacementDatastore(vapp.placement, vapp.placementSpec(), p); err != nil {
+		return err
 	}
-	vapp.resourcePoolObj = resourcePool
-	log.Printf("[DEBUG] resource pool: %#v", resourcePool)
+	vapp.datastoreRef = p.datastore.Reference()
 	return nil
 }
 
 func (vapp *vApp) calculateLocation() error {
-
-	var err error
-	// Finding or Calculating the resourcePool
-	err = vapp.calculateResourcePool()
+	p, err := resolvePlacementLocation(vapp.placement, vapp.placementSpec())
 	if err != nil {
 		return err
 	}
-
-	// Finding or Calculating the Folder
-	folder := vapp.dcFolders.VmFolder
-	if len(vapp.folder) > 0 {
-		folder, err = findFolder(vapp.c, vapp.datacenter, vapp.folder)
-		if err != nil {
-			return err
-		}
-	}
-	log.Printf("[DEBUG] folder: %#v", folder)
-	vapp.folderObj = folder
+	vapp.resourcePoolObj = p.resourcePool
+	vapp.folderObj = p.folder
+	vapp.hostObj = p.host
 	return nil
 }
 
@@ -810,6 +1564,12 @@ func (vapp *vApp) cloneVApp() error {
 		return err
 	}
 
+	restoreSource, err := vapp.prepareSourceVApp(sourceVApp)
+	if err != nil {
+		return err
+	}
+	defer restoreSource()
+
 	// Creating VAppCloneSpecNetworkMappingPair
 	networkMappingPairs := []types.VAppCloneSpecNetworkMappingPair{}
 	for _, networkMapping := range vapp.vAppToClone.networkMappings {
@@ -840,11 +1600,22 @@ func (vapp *vApp) cloneVApp() error {
 		NetworkMapping: networkMappingPairs,
 	}
 
+	// Placing VMs of the source vApp on their own datastores
+	vappCloneSpec.ResourceMapping, err = vapp.entityResourceMapping(sourceVApp)
+	if err != nil {
+		return err
+	}
+
 	// Adding the folder only if parent vapp is not specified
 	if vapp.parentVApp == "" {
 		vappCloneSpec.VmFolder = &folder
 	}
 
+	if vapp.hostObj != nil {
+		host := vapp.hostObj.Reference()
+		vappCloneSpec.Host = &host
+	}
+
 	// Creating the req for CloneVApp_Task
 	req := types.CloneVApp_Task{
 		This:   sourceVApp.Reference(),
@@ -862,13 +1633,26 @@ func (vapp *vApp) cloneVApp() error {
 	if err != nil {
 		return err
 	}
-	err = task.Wait(context.TODO())
+	err = vapp.waitForTask(task, "clone vApp "+vapp.vAppToClone.name)
 	if err != nil {
 		return err
 	}
 
 	// Getting the  Created VirtualApp Object
-	vapp.createdVApp, err = getCreatedVApp(vapp.d, vapp.finder)
+	vapp.createdVApp, err = getCreatedVApp(vapp.d, vapp.c, vapp.finder)
+	if err != nil {
+		return err
+	}
+
+	err = vapp.applyDiskProvisioningOverrides(sourceVApp)
+	if err != nil {
+		return err
+	}
+	err = vapp.applyDiskPlacement()
+	if err != nil {
+		return err
+	}
+	err = vapp.applyOvfProperties()
 	if err != nil {
 		return err
 	}
@@ -910,7 +1694,7 @@ func (vapp *vApp) createVApp() error {
 func (vapp *vApp) createEntityConfigInfo(vAppEntities []vAppEntity) []types.VAppEntityConfigInfo {
 	vappEntitiesConfigInfo := []types.VAppEntityConfigInfo{}
 	for _, vappEntity := range vAppEntities {
-		log.Printf("[DEBUG] vappEntity : %#v", vappEntity)
+		logRedactedf("[DEBUG] vappEntity : %#v", vappEntity)
 		vappEntityConfigInfo := types.VAppEntityConfigInfo{}
 		vappEntityConfigInfo.StartOrder = vappEntity.StartOrder
 		vappEntityConfigInfo.StartDelay = vappEntity.StartDelay
@@ -957,8 +1741,12 @@ func (vapp *vApp) populateOptionalVAppAttributes(d *schema.ResourceData) error {
 		vapp.resourcePool = v.(string)
 	}
 
+	if v, ok := d.GetOk("host"); ok && v != "" {
+		vapp.host = v.(string)
+	}
+
 	if v, ok := d.GetOk("folder"); ok && v != "" {
-		vapp.folder = v.(string)
+		vapp.folder = normalizeFolderPath(v.(string))
 	}
 
 	if v, ok := d.GetOk("parent_vapp"); ok && v != "" {
@@ -970,6 +1758,7 @@ func (vapp *vApp) populateOptionalVAppAttributes(d *schema.ResourceData) error {
 
 func (vapp *vApp) populateVAppEntities(entitySet []interface{}) []vAppEntity {
 
+	members := vapp.entityMembers()
 	entities := []vAppEntity{}
 	for _, value := range entitySet {
 		entity := value.(map[string]interface{})
@@ -979,7 +1768,7 @@ func (vapp *vApp) populateVAppEntities(entitySet []interface{}) []vAppEntity {
 		newEntity.entityType = getEntityType(entity["type"].(string))
 
 		if v, ok := entity["folder"].(string); ok && v != "" {
-			newEntity.folder = v
+			newEntity.folder = normalizeFolderPath(v)
 		}
 		if v, ok := entity["start_order"].(int); ok {
 			newEntity.StartOrder = int32(v)
@@ -990,7 +1779,7 @@ func (vapp *vApp) populateVAppEntities(entitySet []interface{}) []vAppEntity {
 		if v, ok := entity["stop_delay"].(int); ok && v != 0 {
 			newEntity.StopDelay = int32(v)
 		}
-		if v, ok := entity["wait_for_guest"].(bool); ok {
+		if v, ok := entity["waiting_for_guest"].(bool); ok {
 			newEntity.WaitingForGuest = &v
 		}
 		if v, ok := entity["start_action"].(string); ok && v != "" {
@@ -1002,12 +1791,24 @@ func (vapp *vApp) populateVAppEntities(entitySet []interface{}) []vAppEntity {
 		if v, ok := entity["moid"].(string); ok {
 			newEntity.entityMoid = v
 		}
-		if v, ok := entity["folder_path"].(string); ok && v != "" {
-			newEntity.entityFolderPath = v
+		if member, ok := members[newEntity.key()]; ok {
+			newEntity.entityMoid = member.entityMoid
+			newEntity.entityFolderPath = member.entityFolderPath
+			newEntity.entityRPPath = member.entityRPPath
+		}
+		if v, ok := entity["host"].(string); ok && v != "" {
+			newEntity.host = v
+		}
+		if v, ok := entity["host_group"].(string); ok && v != "" {
+			newEntity.hostGroup = v
+		}
+		if v, ok := entity["hostname"].(string); ok && v != "" {
+			newEntity.hostname = v
 		}
-		if v, ok := entity["resourcepool_path"].(string); ok && v != "" {
-			newEntity.entityRPPath = v
+		if v, ok := entity["domain"].(string); ok && v != "" {
+			newEntity.domain = v
 		}
+		newEntity.ovfProperties = ovfPropertiesMap(entity["ovf_properties"])
 		entities = append(entities, newEntity)
 	}
 	return entities
@@ -1027,6 +1828,50 @@ func (vapp *vApp) populateVAppTemplate(d *schema.ResourceData) error {
 			vAppTemplate.diskFormat = types.VAppCloneSpecProvisioningType(v)
 		}
 
+		vAppTemplate.powerHandling = sourcePowerHandlingClone
+		if v, ok := template["source_power_handling"].(string); ok && v != "" {
+			vAppTemplate.powerHandling = v
+		}
+		if v, ok := template["source_quiesce"].(bool); ok {
+			vAppTemplate.quiesce = v
+		}
+
+		vAppTemplate.sysprep = sysprepSettings{
+			timeZone: sysprepTimeZoneDefault,
+			fullName: sysprepNameDefault,
+			orgName:  sysprepNameDefault,
+		}
+		if v, ok := template["windows_time_zone"].(int); ok {
+			vAppTemplate.sysprep.timeZone = int32(v)
+		}
+		if v, ok := template["windows_full_name"].(string); ok && v != "" {
+			vAppTemplate.sysprep.fullName = v
+		}
+		if v, ok := template["windows_organization"].(string); ok && v != "" {
+			vAppTemplate.sysprep.orgName = v
+		}
+
+		if v, ok := template["entity_disk_provisioning"].(map[string]interface{}); ok && len(v) > 0 {
+			vAppTemplate.entityDiskFormats = make(map[string]types.VAppCloneSpecProvisioningType)
+			for name, format := range v {
+				if _, errs := validateDiskProvisioning(format, "entity_disk_provisioning."+name); len(errs) > 0 {
+					return errs[0]
+				}
+				vAppTemplate.entityDiskFormats[name] = types.VAppCloneSpecProvisioningType(format.(string))
+			}
+		}
+
+		if v, ok := template["entity_datastore"].(map[string]interface{}); ok && len(v) > 0 {
+			vAppTemplate.entityDatastores = make(map[string]string)
+			for name, datastore := range v {
+				vAppTemplate.entityDatastores[name] = datastore.(string)
+			}
+		}
+		if v, ok := template["disk_datastore"].([]interface{}); ok {
+			vAppTemplate.diskDatastores = parseDiskDatastores(v)
+		}
+		vAppTemplate.ovfProperties = ovfPropertiesMap(template["ovf_properties"])
+
 		if netMaps, ok := template["network_mapping"]; ok && netMaps != nil {
 
 			if netMapSet, ok := netMaps.(*schema.Set); ok {
@@ -1099,6 +1944,196 @@ func getEntityRef(finder *find.Finder, entityType string, entityName string) (ty
 	return entityRef, entityFolderPath, nil
 }
 
+// resourceVSphereVAppEntityHash only hashes the configurable attributes of an
+// entity. The computed moid and paths are left out, so back-populating them
+// does not change the identity of an entity within the set.
+func resourceVSphereVAppEntityHash(v interface{}) int {
+	var buf bytes.Buffer
+	m := v.(map[string]interface{})
+
+	buf.WriteString(fmt.Sprintf("%s-", m["name"].(string)))
+	buf.WriteString(fmt.Sprintf("%s-", m["type"].(string)))
+	// The moid is only configured, and hashed, for entities without name.
+	if m["name"].(string) == "" {
+		if v, ok := m["moid"]; ok {
+			buf.WriteString(fmt.Sprintf("moid:%s-", v.(string)))
+		}
+	}
+	if v, ok := m["folder"]; ok {
+		buf.WriteString(fmt.Sprintf("%s-", normalizeFolderPath(v.(string))))
+	}
+	if v, ok := m["start_order"]; ok {
+		buf.WriteString(fmt.Sprintf("%d-", v.(int)))
+	}
+	if v, ok := m["start_delay"]; ok {
+		buf.WriteString(fmt.Sprintf("%d-", v.(int)))
+	}
+	if v, ok := m["start_action"]; ok {
+		buf.WriteString(fmt.Sprintf("%s-", v.(string)))
+	}
+	if v, ok := m["stop_action"]; ok {
+		buf.WriteString(fmt.Sprintf("%s-", v.(string)))
+	}
+	if v, ok := m["stop_delay"]; ok {
+		buf.WriteString(fmt.Sprintf("%d-", v.(int)))
+	}
+	if v, ok := m["waiting_for_guest"]; ok {
+		buf.WriteString(fmt.Sprintf("%t-", v.(bool)))
+	}
+	if v, ok := m["destroy_with_parent"]; ok {
+		buf.WriteString(fmt.Sprintf("%t-", v.(bool)))
+	}
+	// Only hashed when set, to keep the hashes of existing entities.
+	if v, ok := m["host"]; ok && v.(string) != "" {
+		buf.WriteString(fmt.Sprintf("host:%s-", v.(string)))
+	}
+	if v, ok := m["host_group"]; ok && v.(string) != "" {
+		buf.WriteString(fmt.Sprintf("host_group:%s-", v.(string)))
+	}
+	if v, ok := m["hostname"]; ok && v.(string) != "" {
+		buf.WriteString(fmt.Sprintf("hostname:%s-", v.(string)))
+	}
+	if v, ok := m["domain"]; ok && v.(string) != "" {
+		buf.WriteString(fmt.Sprintf("domain:%s-", v.(string)))
+	}
+	if props := ovfPropertiesMap(m["ovf_properties"]); len(props) > 0 {
+		var keys []string
+		for key := range props {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			buf.WriteString(fmt.Sprintf("ovf:%s=%s-", key, props[key]))
+		}
+	}
+
+	return hashcode.String(buf.String())
+}
+
+// validateUniqueEntities rejects entities which refer to the same inventory
+// object more than once, e.g. with a different start order.
+func validateUniqueEntities(entities []interface{}) error {
+	seen := make(map[string]bool)
+	for _, value := range entities {
+		entity := value.(map[string]interface{})
+		folder, _ := entity["folder"].(string)
+		folder = normalizeFolderPath(folder)
+		key := fmt.Sprintf("%s:%s", entity["type"].(string), vAppPathString(folder, vAppEntityLabel(entity)))
+		if seen[key] {
+			return fmt.Errorf("Entity %s of type %s is configured more than once",
+				vAppPathString(folder, vAppEntityLabel(entity)), entity["type"].(string))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// validateEntities resolves every entity before anything is changed, so a
+// typo in an entity name or folder fails before a half configured vApp is
+// left behind. The terraform SDK in use has no plan time hook (such as
+// CustomizeDiff) with access to the vSphere connection, so this is the
+// earliest point the lookup can happen.
+func (vapp *vApp) validateEntities(vAppEntities []vAppEntity) error {
+	var errs []string
+	for _, vappEntity := range vAppEntities {
+		if vappEntity.cloned {
+			continue
+		}
+		_, _, err := vapp.entityRef(vappEntity)
+		if err != nil {
+			if vappEntity.byMoid() {
+				errs = append(errs, fmt.Sprintf("entity %s: %s", vappEntity.entityMoid, err))
+				continue
+			}
+			folder := vappEntity.folder
+			if folder == "" {
+				folder = vapp.dcFolders.VmFolder.InventoryPath
+			}
+			errs = append(errs, fmt.Sprintf("entity %s not found in folder %s: %s",
+				vappEntity.name, folder, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid vApp entities:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// validateNetworkMappings checks the network mappings of template_vapp
+// against the source vApp before it is cloned, as the clone task only fails
+// at the first network it cannot resolve. Every source_network_label has to
+// be a network of the source vApp, every destination_network_label has to
+// exist, and networks of the source vApp which the target resource pool
+// cannot reach have to be mapped.
+func (vapp *vApp) validateNetworkMappings() error {
+	sourceVApp, err := vapp.finder.VirtualApp(context.TODO(), vapp.vAppToClone.name)
+	if err != nil {
+		return fmt.Errorf("template_vapp %s not found: %s", vapp.vAppToClone.name, err)
+	}
+
+	collector := property.DefaultCollector(vapp.c.Client)
+	var msrc mo.VirtualApp
+	if err := collector.RetrieveOne(context.TODO(), sourceVApp.Reference(), []string{"network"}, &msrc); err != nil {
+		return err
+	}
+	var sourceNetworks []mo.Network
+	if len(msrc.Network) > 0 {
+		if err := collector.Retrieve(context.TODO(), msrc.Network, []string{"name"}, &sourceNetworks); err != nil {
+			return err
+		}
+	}
+
+	// The networks the hosts of the target cluster are connected to.
+	var mrp mo.ResourcePool
+	if err := collector.RetrieveOne(context.TODO(), vapp.resourcePoolObj.Reference(), []string{"owner"}, &mrp); err != nil {
+		return err
+	}
+	var mcr mo.ComputeResource
+	if err := collector.RetrieveOne(context.TODO(), mrp.Owner, []string{"network"}, &mcr); err != nil {
+		return err
+	}
+	reachable := make(map[string]bool)
+	for _, ref := range mcr.Network {
+		reachable[ref.Value] = true
+	}
+
+	sourceNames := make(map[string]bool)
+	for _, network := range sourceNetworks {
+		sourceNames[network.Name] = true
+	}
+
+	var errs []string
+	mapped := make(map[string]bool)
+	for _, mapping := range vapp.vAppToClone.networkMappings {
+		srcName := path.Base(mapping.srcNetLabel)
+		switch {
+		case !sourceNames[srcName]:
+			errs = append(errs, fmt.Sprintf("source_network_label %s is not a network of vApp %s",
+				mapping.srcNetLabel, vapp.vAppToClone.name))
+		case mapped[srcName]:
+			errs = append(errs, fmt.Sprintf("source_network_label %s is mapped more than once", mapping.srcNetLabel))
+		}
+		mapped[srcName] = true
+
+		if _, err := vapp.finder.Network(context.TODO(), mapping.destNetLabel); err != nil {
+			errs = append(errs, fmt.Sprintf("destination_network_label %s not found: %s", mapping.destNetLabel, err))
+		}
+	}
+
+	for _, network := range sourceNetworks {
+		if !mapped[network.Name] && !reachable[network.Self.Value] {
+			errs = append(errs, fmt.Sprintf("network %s of vApp %s is not available in the target resource pool and has to be mapped",
+				network.Name, vapp.vAppToClone.name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid network mappings of template_vapp:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
 func validateEntityType(v interface{}, k string) (ws []string, errors []error) {
 	value := v.(string)
 	if value != entityInputVm && value != entityInputVapp {
@@ -1117,6 +2152,10 @@ func validateStartAction(v interface{}, k string) (ws []string, errors []error)
 	return
 }
 
+func validateStartPolicy(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, startPolicyList)
+}
+
 func validateStopAction(v interface{}, k string) (ws []string, errors []error) {
 	value := v.(string)
 	found := false
@@ -1134,12 +2173,37 @@ func validateStopAction(v interface{}, k string) (ws []string, errors []error) {
 	return
 }
 
+func validateStartOrder(v interface{}, k string) (ws []string, errors []error) {
+	order := v.(int)
+
+	if order < vAppStartOrderMin || order > vAppStartOrderMax {
+		errors = append(errors, fmt.Errorf(
+			"%s: Start order '%d' is out of allowed range (%d - %d).",
+			k, order, vAppStartOrderMin, vAppStartOrderMax))
+	}
+	return
+}
+
+func validateEntityDelay(v interface{}, k string) (ws []string, errors []error) {
+	delay := v.(int)
+
+	if delay < vAppEntityDelayMin || delay > vAppEntityDelayMax {
+		errors = append(errors, fmt.Errorf(
+			"%s: Delay '%d' is out of allowed range (%d - %d).",
+			k, delay, vAppEntityDelayMin, vAppEntityDelayMax))
+	}
+	return
+}
+
 func (vapp *vApp) addEntities(vAppEntities []vAppEntity) error {
 	//Get the Entities Object Ref
-	var entityList []types.ManagedObjectReference
+	var entityList, vmList, vAppList []types.ManagedObjectReference
 	for i, vappEntity := range vAppEntities {
-		entityFullName := vAppPathString(vappEntity.folder, vappEntity.name)
-		entityRef, entityPath, err := getEntityRef(vapp.finder, vappEntity.entityType, entityFullName)
+		// Cloned entities are members of the vApp already.
+		if vappEntity.cloned {
+			continue
+		}
+		entityRef, entityPath, err := vapp.entityRef(vappEntity)
 		if err != nil {
 			return err
 		}
@@ -1147,28 +2211,32 @@ func (vapp *vApp) addEntities(vAppEntities []vAppEntity) error {
 		vAppEntities[i].entityMoid = entityRef.Value
 		entityList = append(entityList, entityRef)
 		if vappEntity.entityType == vAppEntityTypeVm {
-			var mo mo.VirtualMachine
-			collector := property.DefaultCollector(vapp.c.Client)
-			if err := collector.RetrieveOne(context.TODO(), entityRef, []string{"resourcePool"}, &mo); err != nil {
-				return err
-			}
-			log.Printf("[DEBUG] mo.ResourcePool : %#v", mo.ResourcePool)
-			Element, _ := vapp.finder.Element(context.TODO(), *mo.ResourcePool)
-			vAppEntities[i].entityRPPath = Element.Path
+			vmList = append(vmList, entityRef)
 		} else if vappEntity.entityType == vAppEntityTypeVApp {
-			var mo mo.VirtualApp
-			collector := property.DefaultCollector(vapp.c.Client)
-			if err := collector.RetrieveOne(context.TODO(), entityRef, []string{"parent"}, &mo); err != nil {
-				return err
-			}
-			log.Printf("[DEBUG] mo.Parent : %#v", mo.Parent)
-			Element, _ := vapp.finder.Element(context.TODO(), *mo.Parent)
-			vAppEntities[i].entityRPPath = Element.Path
+			vAppList = append(vAppList, entityRef)
 		} else {
 			return fmt.Errorf("vappEntity Type should be either vm or vapp")
 		}
 	}
-	log.Printf("[DEBUG] addEntities :: vAppEntities : %#v", vAppEntities)
+
+	parents, err := vapp.getEntityParents(vmList, vAppList)
+	if err != nil {
+		return err
+	}
+	if err := checkEntityReparent(parents, vapp.createdVApp.Reference(), vapp.d.Get("allow_reparent").(bool)); err != nil {
+		return err
+	}
+	rpPaths, err := vapp.getEntityResourcePoolPaths(parents)
+	if err != nil {
+		return err
+	}
+	for i := range vAppEntities {
+		vAppEntities[i].entityRPPath = rpPaths[vAppEntities[i].entityMoid]
+	}
+	logRedactedf("[DEBUG] addEntities :: vAppEntities : %#v", vAppEntities)
+	if len(entityList) == 0 {
+		return nil
+	}
 
 	// Creating the req for MoveIntoResourcePool
 	req := types.MoveIntoResourcePool{
@@ -1176,73 +2244,180 @@ func (vapp *vApp) addEntities(vAppEntities []vAppEntity) error {
 		List: entityList,
 	}
 	log.Printf("[DEBUG] addEntities : req %#v", req)
-	_, err := methods.MoveIntoResourcePool(context.TODO(), vapp.c, &req)
+	_, err = methods.MoveIntoResourcePool(context.TODO(), vapp.c, &req)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (vapp *vApp) removeEntities(entitySet *schema.Set) error {
-	for _, value := range entitySet.List() {
-		entity := value.(map[string]interface{})
-		entityType := getEntityType(entity["type"].(string))
-		entityMoid := entity["moid"].(string)
-		entityFolderPath := entity["folder_path"].(string)
-		entityRPPath := entity["resourcepool_path"].(string)
+// getEntityResourcePoolPaths returns the inventory path of the current
+// resource pool of every entity keyed by moid. Every distinct resource pool is
+// only resolved once.
+func (vapp *vApp) getEntityResourcePoolPaths(parents map[string]types.ManagedObjectReference) (map[string]string, error) {
+	rpPaths := make(map[string]string)
+	elementPaths := make(map[types.ManagedObjectReference]string)
+	for moid, parent := range parents {
+		if path, ok := elementPaths[parent]; ok {
+			rpPaths[moid] = path
+			continue
+		}
+		element, err := vapp.finder.Element(context.TODO(), parent)
+		if err != nil {
+			return nil, err
+		}
+		elementPaths[parent] = element.Path
+		rpPaths[moid] = element.Path
+	}
 
-		// Prepare the EnityList
-		entityRef := types.ManagedObjectReference{}
-		entityRef.Type = entityType
-		entityRef.Value = entityMoid
+	return rpPaths, nil
+}
 
-		var entityList []types.ManagedObjectReference
-		entityList = append(entityList, entityRef)
+// getEntityParents returns the resource pool or vApp every entity is in,
+// keyed by moid. The properties of all VMs and of all vApps are fetched with
+// one property collector call each.
+func (vapp *vApp) getEntityParents(vmList, vAppList []types.ManagedObjectReference) (map[string]types.ManagedObjectReference, error) {
+	collector := property.DefaultCollector(vapp.c.Client)
+	parents := make(map[string]types.ManagedObjectReference)
 
-		// Find Resource pool Reference
-		si := object.NewSearchIndex(vapp.c.Client)
-		resourcePoolObjRef, err := si.FindByInventoryPath(
-			context.TODO(), entityRPPath)
-		if err != nil {
-			return fmt.Errorf("Error reading resource pool %s: %s", entityRPPath, err)
-		} else if resourcePoolObjRef == nil {
-			return fmt.Errorf("Cannot find resource pool %s", entityRPPath)
+	if len(vmList) > 0 {
+		var mvms []mo.VirtualMachine
+		if err := collector.Retrieve(context.TODO(), vmList, []string{"resourcePool"}, &mvms); err != nil {
+			return nil, err
 		}
-		resourcePoolRef := resourcePoolObjRef.Reference()
+		for _, mvm := range mvms {
+			if mvm.ResourcePool == nil {
+				return nil, fmt.Errorf("VM %s has no resource pool", mvm.Reference().Value)
+			}
+			parents[mvm.Reference().Value] = *mvm.ResourcePool
+		}
+	}
 
-		// Moving the entity to the Previous ResourcePool
-		req := types.MoveIntoResourcePool{
-			This: resourcePoolRef,
-			List: entityList,
+	if len(vAppList) > 0 {
+		var mvapps []mo.VirtualApp
+		if err := collector.Retrieve(context.TODO(), vAppList, []string{"parent"}, &mvapps); err != nil {
+			return nil, err
 		}
-		_, err = methods.MoveIntoResourcePool(context.TODO(), vapp.c, &req)
-		if err != nil {
-			return err
+		for _, mvapp := range mvapps {
+			if mvapp.Parent == nil {
+				return nil, fmt.Errorf("vApp %s has no parent", mvapp.Reference().Value)
+			}
+			parents[mvapp.Reference().Value] = *mvapp.Parent
 		}
+	}
+	log.Printf("[DEBUG] Entity parents : %#v", parents)
+	return parents, nil
+}
 
-		// Find Folder Reference
-		si = object.NewSearchIndex(vapp.c.Client)
-		folderObjRef, err := si.FindByInventoryPath(
-			context.TODO(), entityFolderPath)
+func (vapp *vApp) removeEntities(entities []vAppEntity) error {
+	for _, entity := range entities {
+		err := vapp.moveEntityOut(entity.entityType, entity.entityMoid, entity.entityRPPath, entity.entityFolderPath)
 		if err != nil {
-			return fmt.Errorf("Error reading folder %s: %s", entityFolderPath, err)
-		} else if folderObjRef == nil {
-			return fmt.Errorf("Cannot find folder %s", entityFolderPath)
+			return err
 		}
-		folderRef := folderObjRef.Reference()
+	}
+	return nil
+}
 
-		// Moving the entity to the Previous Folder
-		reqf := types.MoveIntoFolder_Task{
-			This: folderRef,
-			List: entityList,
-		}
-		_, err = methods.MoveIntoFolder_Task(context.TODO(), vapp.c, &reqf)
+// moveEntityOut moves an entity out of the vApp back into its previous
+// resource pool and folder.
+func (vapp *vApp) moveEntityOut(entityType string, entityMoid string, entityRPPath string, entityFolderPath string) error {
+	// Entities cloned with the vApp have no previous location, they stay in
+	// the vApp and are destroyed with it.
+	if entityRPPath == "" {
+		log.Printf("[DEBUG] Entity %s has no previous resource pool, keeping it in the vApp", entityMoid)
+		return nil
+	}
+
+	// Prepare the EnityList
+	entityRef := types.ManagedObjectReference{}
+	entityRef.Type = entityType
+	entityRef.Value = entityMoid
+
+	var entityList []types.ManagedObjectReference
+	entityList = append(entityList, entityRef)
+
+	// Find Resource pool Reference
+	si := object.NewSearchIndex(vapp.c.Client)
+	resourcePoolObjRef, err := si.FindByInventoryPath(
+		context.TODO(), entityRPPath)
+	if err != nil {
+		return fmt.Errorf("Error reading resource pool %s: %s", entityRPPath, err)
+	} else if resourcePoolObjRef == nil {
+		return fmt.Errorf("Cannot find resource pool %s", entityRPPath)
+	}
+	resourcePoolRef := resourcePoolObjRef.Reference()
+
+	// Moving the entity to the Previous ResourcePool
+	req := types.MoveIntoResourcePool{
+		This: resourcePoolRef,
+		List: entityList,
+	}
+	_, err = methods.MoveIntoResourcePool(context.TODO(), vapp.c, &req)
+	if err != nil {
+		return err
+	}
+
+	// Find Folder Reference
+	folderObjRef, err := si.FindByInventoryPath(
+		context.TODO(), entityFolderPath)
+	if err != nil {
+		return fmt.Errorf("Error reading folder %s: %s", entityFolderPath, err)
+	} else if folderObjRef == nil {
+		return fmt.Errorf("Cannot find folder %s", entityFolderPath)
+	}
+	folderRef := folderObjRef.Reference()
+
+	// Moving the entity to the Previous Folder
+	reqf := types.MoveIntoFolder_Task{
+		This: folderRef,
+		List: entityList,
+	}
+	_, err = methods.MoveIntoFolder_Task(context.TODO(), vapp.c, &reqf)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rollbackCreate makes a best effort to remove a partially created vApp so a
+// retry starts from scratch. Entities which were moved into the vApp are
+// moved back first; the vApp is only destroyed once it is empty, as
+// destroying it would destroy its members as well.
+func (vapp *vApp) rollbackCreate(movedEntities []vAppEntity) {
+	log.Printf("[WARN] Rolling back creation of vApp %s", vapp.name)
+
+	for _, entity := range movedEntities {
+		err := vapp.moveEntityOut(entity.entityType, entity.entityMoid, entity.entityRPPath, entity.entityFolderPath)
 		if err != nil {
-			return err
+			log.Printf("[ERROR] Rollback of vApp %s failed, could not move entity %s out: %s",
+				vapp.name, entity.name, err)
+			return
 		}
+	}
 
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"vm", "resourcePool"}, &mvapp); err != nil {
+		log.Printf("[ERROR] Rollback of vApp %s failed: %s", vapp.name, err)
+		return
+	}
+	if len(mvapp.Vm) > 0 || len(mvapp.ResourcePool.ResourcePool) > 0 {
+		log.Printf("[ERROR] Rollback of vApp %s skipped, the vApp still contains entities", vapp.name)
+		return
+	}
+	if vapp.adopted {
+		log.Printf("[WARN] Keeping adopted vApp %s", vapp.name)
+		return
+	}
+
+	if err := vapp.powerOffVApp(); err != nil {
+		log.Printf("[ERROR] Rollback of vApp %s failed to power it off: %s", vapp.name, err)
+	}
+	if err := vapp.destroyVApp(); err != nil {
+		log.Printf("[ERROR] Rollback of vApp %s failed to destroy it: %s", vapp.name, err)
 	}
-	return nil
 }
 
 func getEntityType(eType string) string {
@@ -1257,50 +2432,26 @@ func getEntityType(eType string) string {
 }
 
 func (vapp *vApp) backPopulateEntiy(vAppEntities []vAppEntity) error {
-	var entities []interface{}
-	//entities := make([]map[string]interface{}, 0)
-	if vL, ok := vapp.d.GetOk("entity"); ok {
-		if entitySet, ok := vL.(*schema.Set); ok {
-			for _, value := range entitySet.List() {
-				entity := value.(map[string]interface{})
-				var added bool
-				for _, vappEntity := range vAppEntities {
-					if entity["name"] == vappEntity.name && getEntityType(entity["type"].(string)) == vappEntity.entityType { // Need to add folder also TODO
-						log.Printf("[DEBUG] Updating for entity : %s", vappEntity.name)
-						entity["folder_path"] = vappEntity.entityFolderPath
-						entity["resourcepool_path"] = vappEntity.entityRPPath
-						entity["moid"] = vappEntity.entityMoid
-						entities = append(entities, entity)
-						added = true
-						break
-					}
-				}
-				if !added {
-					entities = append(entities, entity)
-				}
-			}
-		}
-	}
-	err := vapp.d.Set("entity", entities)
-	if err != nil {
-		return fmt.Errorf("Invalid entity to set: %#v", entities)
+	if err := vapp.setEntityMembers(vAppEntities); err != nil {
+		return fmt.Errorf("Invalid entity members to set: %s", err)
 	}
 	return nil
 }
 
-func constructVApp(d *schema.ResourceData, client *govmomi.Client) (*vApp, error) {
+func constructVApp(d *schema.ResourceData, c *VSphereClient) (*vApp, error) {
 	// Creating and Populating vapp object with Client, ResourceData, Datacenter and finder
-	vapp := NewVApp(d, client)
+	vapp := NewVApp(d, c.vimClient)
 
-	dc, err := getDatacenter(client, d.Get("datacenter").(string))
+	dc, err := c.getDatacenter(d.Get("datacenter").(string))
 	if err != nil {
 		return nil, err
 	}
-	vapp.finder = find.NewFinder(client.Client, true)
-	vapp.finder = vapp.finder.SetDatacenter(dc)
-	vapp.dcFolders, err = dc.Folders(context.TODO())
+	vapp.finder = c.getFinder(dc)
+	vapp.datacenterObj = dc
+	vapp.dcFolders, err = c.getDatacenterFolders(dc)
 	if err != nil {
 		return nil, err
 	}
+	vapp.placement = newPlacementFinder(c.vimClient, vapp.finder, dc, vapp.dcFolders)
 	return vapp, nil
 }
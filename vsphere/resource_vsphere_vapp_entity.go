@@ -0,0 +1,328 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vsphere_vapp_entity adds a single VM or vApp to a vApp, so different
+// modules can add and remove entities independently of each other. The vApp
+// should not list the entity in its own entity set as well.
+
+func resourceVSphereVAppEntity() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceVSphereVAppEntityCreate,
+		Read:   resourceVSphereVAppEntityRead,
+		Update: resourceVSphereVAppEntityUpdate,
+		Delete: resourceVSphereVAppEntityDelete,
+
+		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
+			"datacenter": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDatacenterName,
+				StateFunc:    datacenterNameStateFunc,
+			},
+
+			"vapp_id": &schema.Schema{
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The managed object ID of the vApp the entity is added to.",
+			},
+
+			"type": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      "vm",
+				ValidateFunc: validateEntityType,
+			},
+
+			"name": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Name of the entity, one of name or moid must be set.",
+			},
+
+			"folder": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateFolderPath,
+				StateFunc:    folderPathStateFunc,
+			},
+
+			"moid": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Description: "Managed object ID of the entity, instead of name and folder.",
+			},
+
+			"start_order": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      vAppStartOrderDefault,
+				ValidateFunc: validateStartOrder,
+			},
+
+			"start_delay": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateEntityDelay,
+			},
+
+			"start_action": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateStartAction,
+			},
+
+			"stop_action": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateStopAction,
+			},
+
+			"stop_delay": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateEntityDelay,
+			},
+
+			"waiting_for_guest": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+
+			"allow_reparent": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Allows adding an entity which is a member of another vApp, which moves it out of it.",
+			},
+
+			// Where the entity was moved from, it is moved back on destroy.
+			"folder_path": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"resourcepool_path": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// vAppEntityResourceID returns the ID of a vsphere_vapp_entity.
+func vAppEntityResourceID(vappID, moid string) string {
+	return vappID + ":" + moid
+}
+
+// parseVAppEntityResourceID returns the vApp and entity moid of an ID.
+func parseVAppEntityResourceID(id string) (string, string, error) {
+	parts := strings.Split(id, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid vApp entity ID %q, expected <vapp_id>:<moid>", id)
+	}
+	return parts[0], parts[1], nil
+}
+
+// vAppOfEntityResource returns the vApp the entity is added to.
+func vAppOfEntityResource(d *schema.ResourceData, c *VSphereClient) (*vApp, error) {
+	dc, err := c.getDatacenter(d.Get("datacenter").(string))
+	if err != nil {
+		return nil, err
+	}
+	vappID := d.Get("vapp_id").(string)
+	return &vApp{
+		name:          vappID,
+		c:             c.vimClient,
+		d:             d,
+		datacenterObj: dc,
+		finder:        c.getFinder(dc),
+		createdVApp:   object.NewVirtualApp(c.vimClient.Client, types.ManagedObjectReference{Type: vAppEntityTypeVApp, Value: vappID}),
+	}, nil
+}
+
+// vAppEntityFromResourceData returns the entity of a vsphere_vapp_entity.
+func vAppEntityFromResourceData(d *schema.ResourceData) vAppEntity {
+	e := vAppEntity{
+		name:             d.Get("name").(string),
+		folder:           normalizeFolderPath(d.Get("folder").(string)),
+		entityType:       getEntityType(d.Get("type").(string)),
+		entityMoid:       d.Get("moid").(string),
+		entityFolderPath: d.Get("folder_path").(string),
+		entityRPPath:     d.Get("resourcepool_path").(string),
+	}
+	e.StartOrder = int32(d.Get("start_order").(int))
+	e.StartDelay = int32(d.Get("start_delay").(int))
+	e.StopDelay = int32(d.Get("stop_delay").(int))
+	e.StartAction = d.Get("start_action").(string)
+	e.StopAction = d.Get("stop_action").(string)
+	waitingForGuest := d.Get("waiting_for_guest").(bool)
+	e.WaitingForGuest = &waitingForGuest
+	return e
+}
+
+func resourceVSphereVAppEntityCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vapp_entity", resourceLogName(d, "name"), "create")
+	client := meta.(*VSphereClient)
+
+	if err := validateEntityReferences([]interface{}{map[string]interface{}{
+		"type":   d.Get("type"),
+		"name":   d.Get("name"),
+		"folder": d.Get("folder"),
+		"moid":   d.Get("moid"),
+	}}); err != nil {
+		return err
+	}
+
+	vapp, err := vAppOfEntityResource(d, client)
+	if err != nil {
+		return err
+	}
+	entities := []vAppEntity{vAppEntityFromResourceData(d)}
+	logger.Infof("Adding entity %s to vApp %s", entities[0].label(), vapp.name)
+	if err := vapp.addEntities(entities); err != nil {
+		return translateVSphereError(err, fmt.Sprintf("entity %s of vApp %s", entities[0].label(), vapp.name))
+	}
+	client.invalidateCache()
+
+	entity := entities[0]
+	d.SetId(vAppEntityResourceID(vapp.name, entity.entityMoid))
+	d.Set("moid", entity.entityMoid)
+	d.Set("folder_path", entity.entityFolderPath)
+	d.Set("resourcepool_path", entity.entityRPPath)
+
+	configSpec := types.VAppConfigSpec{EntityConfig: vapp.createEntityConfigInfo(entities)}
+	if err := vapp.updateVApp(configSpec); err != nil {
+		return translateVSphereError(err, fmt.Sprintf("entity %s of vApp %s", entity.label(), vapp.name))
+	}
+
+	return resourceVSphereVAppEntityRead(d, meta)
+}
+
+func resourceVSphereVAppEntityRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	client := meta.(*VSphereClient).vimClient
+
+	vappID, moid, err := parseVAppEntityResourceID(d.Id())
+	if err != nil {
+		return err
+	}
+
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(client.Client)
+	vappRef := types.ManagedObjectReference{Type: vAppEntityTypeVApp, Value: vappID}
+	if err := collector.RetrieveOne(context.TODO(), vappRef, []string{"vAppConfig"}, &mvapp); err != nil {
+		if isManagedObjectNotFoundError(err) {
+			log.Printf("[WARN] vApp %s of entity %s is gone, removing it from state", vappID, moid)
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+
+	config := findVAppEntityConfig(&mvapp, moid)
+	if config == nil {
+		log.Printf("[WARN] Entity %s is no longer a member of vApp %s, removing it from state", moid, vappID)
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("vapp_id", vappID)
+	d.Set("moid", moid)
+	d.Set("start_order", config.StartOrder)
+	d.Set("start_delay", config.StartDelay)
+	d.Set("stop_delay", config.StopDelay)
+	d.Set("start_action", config.StartAction)
+	d.Set("stop_action", config.StopAction)
+	if config.WaitingForGuest != nil {
+		d.Set("waiting_for_guest", *config.WaitingForGuest)
+	}
+
+	return nil
+}
+
+// findVAppEntityConfig returns the entity configuration of a member of the
+// vApp, or nil if it is no member.
+func findVAppEntityConfig(mvapp *mo.VirtualApp, moid string) *types.VAppEntityConfigInfo {
+	if mvapp.VAppConfig == nil {
+		return nil
+	}
+	for i, c := range mvapp.VAppConfig.EntityConfig {
+		if c.Key != nil && c.Key.Value == moid {
+			return &mvapp.VAppConfig.EntityConfig[i]
+		}
+	}
+	return nil
+}
+
+func resourceVSphereVAppEntityUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vapp_entity", resourceLogName(d, "name"), "update")
+
+	vapp, err := vAppOfEntityResource(d, meta.(*VSphereClient))
+	if err != nil {
+		return err
+	}
+	entity := vAppEntityFromResourceData(d)
+	logger.Infof("Updating entity %s of vApp %s", entity.label(), vapp.name)
+
+	configSpec := types.VAppConfigSpec{EntityConfig: vapp.createEntityConfigInfo([]vAppEntity{entity})}
+	if err := vapp.updateVApp(configSpec); err != nil {
+		return translateVSphereError(err, fmt.Sprintf("entity %s of vApp %s", entity.label(), vapp.name))
+	}
+
+	return resourceVSphereVAppEntityRead(d, meta)
+}
+
+func resourceVSphereVAppEntityDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vapp_entity", resourceLogName(d, "name"), "delete")
+	client := meta.(*VSphereClient)
+
+	vapp, err := vAppOfEntityResource(d, client)
+	if err != nil {
+		return err
+	}
+	entity := vAppEntityFromResourceData(d)
+	logger.Infof("Moving entity %s out of vApp %s", entity.label(), vapp.name)
+	err = vapp.moveEntityOut(entity.entityType, entity.entityMoid, entity.entityRPPath, entity.entityFolderPath)
+	if err != nil && !isManagedObjectNotFoundError(err) {
+		return translateVSphereError(err, fmt.Sprintf("entity %s of vApp %s", entity.label(), vapp.name))
+	}
+	client.invalidateCache()
+
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,44 @@
+package vsphere
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestVSphereVAppEntity_resourceID(t *testing.T) {
+	id := vAppEntityResourceID("resgroup-v10", "vm-42")
+	vappID, moid, err := parseVAppEntityResourceID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vappID != "resgroup-v10" || moid != "vm-42" {
+		t.Fatalf("expected resgroup-v10 and vm-42, got %s and %s", vappID, moid)
+	}
+
+	for _, id := range []string{"", "resgroup-v10", "resgroup-v10:", ":vm-42", "a:b:c"} {
+		if _, _, err := parseVAppEntityResourceID(id); err == nil {
+			t.Fatalf("expected an error for ID %q", id)
+		}
+	}
+}
+
+func TestVSphereVAppEntity_fromResourceData(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceVSphereVAppEntity().Schema, map[string]interface{}{
+		"vapp_id":     "resgroup-v10",
+		"name":        "web",
+		"folder":      "apps",
+		"start_order": 2,
+		"start_delay": 30,
+	})
+	e := vAppEntityFromResourceData(d)
+	if e.entityType != vAppEntityTypeVm || e.name != "web" || e.folder != "apps" {
+		t.Fatalf("unexpected entity %#v", e)
+	}
+	if e.StartOrder != 2 || e.StartDelay != 30 {
+		t.Fatalf("unexpected start settings %#v", e.VAppEntityConfigInfo)
+	}
+	if e.WaitingForGuest == nil || *e.WaitingForGuest {
+		t.Fatalf("expected waiting_for_guest to be false, got %#v", e.WaitingForGuest)
+	}
+}
@@ -0,0 +1,176 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func resourceVSphereVAppMigrateState(
+	v int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if is.Empty() {
+		log.Println("[DEBUG] Empty InstanceState; nothing to migrate.")
+		return is, nil
+	}
+
+	var err error
+	switch v {
+	case 0:
+		// Version 1 is the first released schema, there is nothing to do.
+		log.Println("[INFO] Found vApp State v0; migrating to v1")
+		fallthrough
+	case 1:
+		log.Println("[INFO] Found vApp State v1; migrating to v2")
+		is, err = migrateVSphereVAppStateV1toV2(is)
+		if err != nil {
+			return is, err
+		}
+		fallthrough
+	case 2:
+		log.Println("[INFO] Found vApp State v2; migrating to v3")
+		if is.Empty() {
+			return is, nil
+		}
+		if err = migrateInventoryPathID(is, meta, "vm"); err != nil {
+			return is, err
+		}
+		fallthrough
+	case 3:
+		log.Println("[INFO] Found vApp State v3; migrating to v4")
+		if is.Empty() {
+			return is, nil
+		}
+		if err = migrateInventoryPathToMoid(is, meta); err != nil {
+			return is, err
+		}
+		fallthrough
+	case 4:
+		log.Println("[INFO] Found vApp State v4; migrating to v5")
+		is, err = migrateVSphereVAppStateV4toV5(is)
+		if err != nil {
+			return is, err
+		}
+		fallthrough
+	case 5:
+		// permission turned from a list into a set.
+		log.Println("[INFO] Found vApp State v5; migrating to v6")
+		return is, migratePermissionListToSet(is)
+	default:
+		return is, fmt.Errorf("Unexpected schema version: %d", v)
+	}
+}
+
+// migrateVSphereVAppStateV4toV5 moves the computed moid and paths of the
+// entities out of the entity set into entity_members. The moid stays with
+// entities configured by moid, the set keys do not change.
+func migrateVSphereVAppStateV4toV5(is *terraform.InstanceState) (*terraform.InstanceState, error) {
+	if is.Empty() || is.Attributes == nil {
+		log.Println("[DEBUG] Empty VSphere vApp State; nothing to migrate.")
+		return is, nil
+	}
+
+	entities := make(map[string]map[string]string)
+	for k, v := range is.Attributes {
+		parts := strings.SplitN(k, ".", 3)
+		if len(parts) != 3 || parts[0] != "entity" || parts[1] == "#" {
+			continue
+		}
+		if _, ok := entities[parts[1]]; !ok {
+			entities[parts[1]] = make(map[string]string)
+		}
+		entities[parts[1]][parts[2]] = v
+	}
+
+	codes := make([]string, 0, len(entities))
+	for code := range entities {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	n := 0
+	for _, code := range codes {
+		attrs := entities[code]
+		label := attrs["name"]
+		if label == "" {
+			label = attrs["moid"]
+		} else {
+			delete(is.Attributes, fmt.Sprintf("entity.%s.moid", code))
+		}
+		delete(is.Attributes, fmt.Sprintf("entity.%s.folder_path", code))
+		delete(is.Attributes, fmt.Sprintf("entity.%s.resourcepool_path", code))
+		if attrs["moid"] == "" {
+			continue
+		}
+
+		prefix := fmt.Sprintf("entity_members.%d.", n)
+		is.Attributes[prefix+"key"] = vAppEntityKey(getEntityType(attrs["type"]), attrs["folder"], label)
+		is.Attributes[prefix+"moid"] = attrs["moid"]
+		is.Attributes[prefix+"folder_path"] = attrs["folder_path"]
+		is.Attributes[prefix+"resourcepool_path"] = attrs["resourcepool_path"]
+		n++
+	}
+	is.Attributes["entity_members.#"] = strconv.Itoa(n)
+
+	log.Printf("[DEBUG] Attributes after migration: %#v", is.Attributes)
+	return is, nil
+}
+
+// migrateVSphereVAppStateV1toV2 rewrites the entity set keys, which are now
+// hashed without the computed moid and paths.
+func migrateVSphereVAppStateV1toV2(is *terraform.InstanceState) (*terraform.InstanceState, error) {
+	if is.Empty() || is.Attributes == nil {
+		log.Println("[DEBUG] Empty VSphere vApp State; nothing to migrate.")
+		return is, nil
+	}
+
+	log.Printf("[DEBUG] Attributes before migration: %#v", is.Attributes)
+
+	entities := make(map[string]map[string]string)
+	for k, v := range is.Attributes {
+		parts := strings.SplitN(k, ".", 3)
+		if len(parts) != 3 || parts[0] != "entity" {
+			continue
+		}
+		if _, ok := entities[parts[1]]; !ok {
+			entities[parts[1]] = make(map[string]string)
+		}
+		entities[parts[1]][parts[2]] = v
+	}
+
+	migrated := make(map[string]string)
+	for oldCode, attrs := range entities {
+		entity := make(map[string]interface{})
+		for _, k := range []string{"name", "type", "folder", "start_action", "stop_action"} {
+			entity[k] = attrs[k]
+		}
+		for _, k := range []string{"start_order", "start_delay", "stop_delay"} {
+			n := 0
+			if attrs[k] != "" {
+				var err error
+				if n, err = strconv.Atoi(attrs[k]); err != nil {
+					return is, fmt.Errorf("Invalid value for entity.%s.%s: %s", oldCode, k, err)
+				}
+			}
+			entity[k] = n
+		}
+		for _, k := range []string{"waiting_for_guest", "destroy_with_parent"} {
+			entity[k] = attrs[k] == "true"
+		}
+
+		newCode := strconv.Itoa(resourceVSphereVAppEntityHash(entity))
+		for k, v := range attrs {
+			delete(is.Attributes, fmt.Sprintf("entity.%s.%s", oldCode, k))
+			migrated[fmt.Sprintf("entity.%s.%s", newCode, k)] = v
+		}
+	}
+	for k, v := range migrated {
+		is.Attributes[k] = v
+	}
+
+	log.Printf("[DEBUG] Attributes after migration: %#v", is.Attributes)
+	return is, nil
+}
@@ -0,0 +1,200 @@
+package vsphere
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestVSphereVAppMigrateState(t *testing.T) {
+	newCode := strconv.Itoa(resourceVSphereVAppEntityHash(map[string]interface{}{
+		"name":                "vm1",
+		"type":                "vm",
+		"folder":              "",
+		"start_action":        "",
+		"stop_action":         "",
+		"start_order":         1,
+		"start_delay":         0,
+		"stop_delay":          0,
+		"waiting_for_guest":   false,
+		"destroy_with_parent": false,
+	}))
+
+	cases := map[string]struct {
+		StateVersion int
+		Attributes   map[string]string
+		Expected     map[string]string
+		Meta         interface{}
+	}{
+		"entity rehash": {
+			StateVersion: 1,
+			Attributes: map[string]string{
+				"name":                    "vapp1",
+				"entity.#":                "1",
+				"entity.1234.name":        "vm1",
+				"entity.1234.type":        "vm",
+				"entity.1234.moid":        "vm-42",
+				"entity.1234.start_order": "1",
+			},
+			Expected: map[string]string{
+				"name":                               "vapp1",
+				"entity.#":                           "1",
+				"entity." + newCode + ".name":        "vm1",
+				"entity." + newCode + ".type":        "vm",
+				"entity." + newCode + ".start_order": "1",
+				"entity_members.#":                   "1",
+				"entity_members.0.key":               "VirtualMachine/vm1",
+				"entity_members.0.moid":              "vm-42",
+			},
+		},
+	}
+
+	for tn, tc := range cases {
+		is := &terraform.InstanceState{
+			ID:         "vapp1",
+			Attributes: tc.Attributes,
+		}
+		is, err := resourceVSphereVAppMigrateState(
+			tc.StateVersion, is, tc.Meta)
+
+		if err != nil {
+			t.Fatalf("bad: %s, err: %#v", tn, err)
+		}
+
+		for k, v := range tc.Expected {
+			if is.Attributes[k] != v {
+				t.Fatalf(
+					"bad: %s\n\n expected: %#v -> %#v\n got: %#v -> %#v\n in: %#v",
+					tn, k, v, k, is.Attributes[k], is.Attributes)
+			}
+		}
+
+		if _, ok := is.Attributes["entity.1234.name"]; ok && newCode != "1234" {
+			t.Fatalf("bad: %s, old entity key left behind: %#v", tn, is.Attributes)
+		}
+		if _, ok := is.Attributes["entity."+newCode+".moid"]; ok {
+			t.Fatalf("bad: %s, computed moid left in the entity: %#v", tn, is.Attributes)
+		}
+	}
+}
+
+func TestVSphereVAppMigrateState_entityMembers(t *testing.T) {
+	is := &terraform.InstanceState{
+		ID: "resgroup-v42",
+		Attributes: map[string]string{
+			"moid":                        "resgroup-v42",
+			"entity.#":                    "2",
+			"entity.11.name":              "web",
+			"entity.11.folder":            "/apps/",
+			"entity.11.type":              "vm",
+			"entity.11.moid":              "vm-10",
+			"entity.11.folder_path":       "/dc1/vm/apps",
+			"entity.11.resourcepool_path": "/dc1/host/cluster1/Resources",
+			"entity.22.name":              "",
+			"entity.22.type":              "vapp",
+			"entity.22.moid":              "resgroup-v7",
+			"entity.22.folder_path":       "",
+			"entity.22.resourcepool_path": "",
+		},
+	}
+	is, err := resourceVSphereVAppMigrateState(4, is, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"entity.11.name":                     "web",
+		"entity.22.moid":                     "resgroup-v7",
+		"entity_members.#":                   "2",
+		"entity_members.0.key":               "VirtualMachine/apps/web",
+		"entity_members.0.moid":              "vm-10",
+		"entity_members.0.folder_path":       "/dc1/vm/apps",
+		"entity_members.0.resourcepool_path": "/dc1/host/cluster1/Resources",
+		"entity_members.1.key":               "VirtualApp/resgroup-v7",
+		"entity_members.1.moid":              "resgroup-v7",
+	}
+	for k, v := range expected {
+		if is.Attributes[k] != v {
+			t.Fatalf("expected %s to be %q, got %q in %#v", k, v, is.Attributes[k], is.Attributes)
+		}
+	}
+	for _, k := range []string{"entity.11.moid", "entity.11.folder_path", "entity.22.resourcepool_path"} {
+		if _, ok := is.Attributes[k]; ok {
+			t.Fatalf("expected %s to be removed, got %#v", k, is.Attributes)
+		}
+	}
+}
+
+func TestVSphereVAppMigrateState_moid(t *testing.T) {
+	cases := map[string]struct {
+		ID           string
+		Attributes   map[string]string
+		Expected     string
+		ExpectedPath string
+	}{
+		"canonical path": {
+			ID:           "/dc1/vm/web/vapp1",
+			Attributes:   map[string]string{"moid": "resgroup-v42"},
+			Expected:     "resgroup-v42",
+			ExpectedPath: "/dc1/vm/web/vapp1",
+		},
+		"relative path without folder": {
+			ID:           "vapp1",
+			Attributes:   map[string]string{"datacenter": "dc1", "moid": "resgroup-v42"},
+			Expected:     "resgroup-v42",
+			ExpectedPath: "/dc1/vm/vapp1",
+		},
+		"moid already": {
+			ID:         "resgroup-v42",
+			Attributes: map[string]string{"moid": "resgroup-v42"},
+			Expected:   "resgroup-v42",
+		},
+		"no moid without client": {
+			ID:           "/dc1/vm/vapp1",
+			Attributes:   map[string]string{"name": "vapp1"},
+			Expected:     "/dc1/vm/vapp1",
+			ExpectedPath: "/dc1/vm/vapp1",
+		},
+	}
+
+	for tn, tc := range cases {
+		is := &terraform.InstanceState{
+			ID:         tc.ID,
+			Attributes: tc.Attributes,
+		}
+		is, err := resourceVSphereVAppMigrateState(2, is, nil)
+		if err != nil {
+			t.Fatalf("bad: %s, err: %#v", tn, err)
+		}
+		if is.ID != tc.Expected {
+			t.Fatalf("bad: %s, expected ID %q, got %q", tn, tc.Expected, is.ID)
+		}
+		if is.Attributes["inventory_path"] != tc.ExpectedPath {
+			t.Fatalf("bad: %s, expected inventory_path %q, got %q", tn, tc.ExpectedPath, is.Attributes["inventory_path"])
+		}
+	}
+}
+
+func TestVSphereVAppMigrateState_empty(t *testing.T) {
+	var is *terraform.InstanceState
+	var meta interface{}
+
+	// should handle nil
+	is, err := resourceVSphereVAppMigrateState(1, is, meta)
+
+	if err != nil {
+		t.Fatalf("err: %#v", err)
+	}
+	if is != nil {
+		t.Fatalf("expected nil instancestate, got: %#v", is)
+	}
+
+	// should handle non-nil but empty
+	is = &terraform.InstanceState{}
+	is, err = resourceVSphereVAppMigrateState(1, is, meta)
+
+	if err != nil {
+		t.Fatalf("err: %#v", err)
+	}
+}
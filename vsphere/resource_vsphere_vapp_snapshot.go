@@ -0,0 +1,306 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vAppMemberVM is a virtual machine of a vApp together with the start order
+// the vApp assigns to it.
+type vAppMemberVM struct {
+	ref        types.ManagedObjectReference
+	startOrder int32
+}
+
+func resourceVSphereVAppSnapshot() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceVSphereVAppSnapshotCreate,
+		Read:   resourceVSphereVAppSnapshotRead,
+		Update: resourceVSphereVAppSnapshotUpdate,
+		Delete: resourceVSphereVAppSnapshotDelete,
+
+		Timeouts: resourceTimeouts(),
+
+		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
+			"vapp_id": &schema.Schema{
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The managed object ID of the vApp whose virtual machines are snapshotted.",
+			},
+
+			"snapshot_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"description": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+
+			"memory": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+
+			"quiesce": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+
+			"remove_children": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			"revert_on_destroy": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			"snapshots": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceVSphereVAppSnapshotCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	client := meta.(*VSphereClient).vimClient
+
+	vappID := d.Get("vapp_id").(string)
+	name := d.Get("snapshot_name").(string)
+
+	members, err := getVAppMemberVMs(client, vappID)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("vApp %s has no virtual machines to snapshot", vappID)
+	}
+
+	timeout := d.Timeout(schema.TimeoutCreate)
+	ctx, cancel := taskContext(timeout)
+	defer cancel()
+
+	snapshots := make(map[string]interface{})
+	for _, member := range members {
+		log.Printf("[INFO] Creating snapshot %s of virtual machine %s", name, member.ref.Value)
+		req := types.CreateSnapshot_Task{
+			This:        member.ref,
+			Name:        name,
+			Description: d.Get("description").(string),
+			Memory:      d.Get("memory").(bool),
+			Quiesce:     d.Get("quiesce").(bool),
+		}
+		res, err := methods.CreateSnapshot_Task(context.TODO(), client, &req)
+		if err == nil {
+			var info *types.TaskInfo
+			task := object.NewTask(client.Client, res.Returnval)
+			info, err = task.WaitForResult(ctx, nil)
+			if err == nil {
+				snapshots[member.ref.Value] = info.Result.(types.ManagedObjectReference).Value
+				continue
+			}
+			err = taskTimeoutError(ctx, err, "snapshot virtual machine "+member.ref.Value, timeout)
+		}
+
+		// Leave no partial set of snapshots behind.
+		log.Printf("[ERROR] Snapshot of virtual machine %s failed, removing the snapshots taken so far", member.ref.Value)
+		if rerr := removeVAppSnapshots(context.TODO(), client, snapshots, false); rerr != nil {
+			log.Printf("[ERROR] Could not remove snapshots of vApp %s: %s", vappID, rerr)
+		}
+		return translateVSphereError(err, fmt.Sprintf("snapshot %s of virtual machine %s", name, member.ref.Value))
+	}
+
+	d.SetId(fmt.Sprintf("%s:%s", vappID, name))
+	d.Set("snapshots", snapshots)
+
+	return resourceVSphereVAppSnapshotRead(d, meta)
+}
+
+func resourceVSphereVAppSnapshotRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	client := meta.(*VSphereClient).vimClient
+
+	// Forget snapshots which were removed outside of terraform.
+	snapshots := make(map[string]interface{})
+	for vmID, snapshotID := range d.Get("snapshots").(map[string]interface{}) {
+		vmRef := types.ManagedObjectReference{Type: "VirtualMachine", Value: vmID}
+		var mvm mo.VirtualMachine
+		collector := property.DefaultCollector(client.Client)
+		if err := collector.RetrieveOne(context.TODO(), vmRef, []string{"snapshot"}, &mvm); err != nil {
+			if isManagedObjectNotFoundError(err) {
+				log.Printf("[WARN] Virtual machine %s of snapshot %s is gone", vmID, d.Id())
+				continue
+			}
+			return err
+		}
+		if mvm.Snapshot != nil && snapshotInTree(mvm.Snapshot.RootSnapshotList, snapshotID.(string)) {
+			snapshots[vmID] = snapshotID
+		}
+	}
+
+	if len(snapshots) == 0 {
+		log.Printf("[WARN] No snapshots of %s left, removing it from state", d.Id())
+		d.SetId("")
+		return nil
+	}
+	d.Set("snapshots", snapshots)
+
+	return nil
+}
+
+// Only remove_children and revert_on_destroy can change in place, and they
+// are only read on destroy.
+func resourceVSphereVAppSnapshotUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	return resourceVSphereVAppSnapshotRead(d, meta)
+}
+
+func resourceVSphereVAppSnapshotDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	client := meta.(*VSphereClient).vimClient
+
+	timeout := d.Timeout(schema.TimeoutDelete)
+	ctx, cancel := taskContext(timeout)
+	defer cancel()
+
+	snapshots := d.Get("snapshots").(map[string]interface{})
+
+	if d.Get("revert_on_destroy").(bool) {
+		members, err := getVAppMemberVMs(client, d.Get("vapp_id").(string))
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			snapshotID, ok := snapshots[member.ref.Value]
+			if !ok {
+				continue
+			}
+			log.Printf("[INFO] Reverting virtual machine %s to snapshot %s", member.ref.Value, snapshotID)
+			req := types.RevertToSnapshot_Task{
+				This: types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: snapshotID.(string)},
+			}
+			res, err := methods.RevertToSnapshot_Task(context.TODO(), client, &req)
+			if err != nil {
+				return err
+			}
+			task := object.NewTask(client.Client, res.Returnval)
+			if err := task.Wait(ctx); err != nil {
+				return taskTimeoutError(ctx, err, "revert virtual machine "+member.ref.Value, timeout)
+			}
+		}
+	}
+
+	if err := removeVAppSnapshots(ctx, client, snapshots, d.Get("remove_children").(bool)); err != nil {
+		return taskTimeoutError(ctx, err, "remove snapshots of "+d.Id(), timeout)
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// getVAppMemberVMs returns the virtual machines of a vApp in reverse start
+// order, the order in which the vApp stops them, so that each tier is
+// captured before the tiers it depends on.
+func getVAppMemberVMs(c *govmomi.Client, vappID string) ([]vAppMemberVM, error) {
+	vappRef := types.ManagedObjectReference{Type: vAppEntityTypeVApp, Value: vappID}
+
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vappRef, []string{"vm", "vAppConfig"}, &mvapp); err != nil {
+		return nil, fmt.Errorf("Error reading vApp %s: %s", vappID, err)
+	}
+
+	startOrders := make(map[string]int32)
+	if mvapp.VAppConfig != nil {
+		for _, entity := range mvapp.VAppConfig.EntityConfig {
+			if entity.Key != nil && entity.StartOrder != 0 {
+				startOrders[entity.Key.Value] = entity.StartOrder
+			}
+		}
+	}
+
+	members := make([]vAppMemberVM, 0, len(mvapp.Vm))
+	for _, ref := range mvapp.Vm {
+		members = append(members, vAppMemberVM{ref: ref, startOrder: startOrders[ref.Value]})
+	}
+	sort.Stable(vAppMembersByStopOrder(members))
+
+	return members, nil
+}
+
+type vAppMembersByStopOrder []vAppMemberVM
+
+func (m vAppMembersByStopOrder) Len() int           { return len(m) }
+func (m vAppMembersByStopOrder) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m vAppMembersByStopOrder) Less(i, j int) bool { return m[i].startOrder > m[j].startOrder }
+
+// removeVAppSnapshots removes the snapshots, keyed by virtual machine, and
+// consolidates the disks of each virtual machine.
+func removeVAppSnapshots(ctx context.Context, c *govmomi.Client, snapshots map[string]interface{}, removeChildren bool) error {
+	var errs []string
+	for vmID, snapshotID := range snapshots {
+		log.Printf("[INFO] Removing snapshot %s of virtual machine %s", snapshotID, vmID)
+		req := types.RemoveSnapshot_Task{
+			This:           types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: snapshotID.(string)},
+			RemoveChildren: removeChildren,
+			Consolidate:    types.NewBool(true),
+		}
+		res, err := methods.RemoveSnapshot_Task(context.TODO(), c, &req)
+		if err == nil {
+			task := object.NewTask(c.Client, res.Returnval)
+			err = task.Wait(ctx)
+		}
+		if err != nil && !isManagedObjectNotFoundError(err) {
+			errs = append(errs, fmt.Sprintf("virtual machine %s: %s", vmID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Error removing snapshots: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func snapshotInTree(tree []types.VirtualMachineSnapshotTree, snapshotID string) bool {
+	for _, node := range tree {
+		if node.Snapshot.Value == snapshotID || snapshotInTree(node.ChildSnapshotList, snapshotID) {
+			return true
+		}
+	}
+	return false
+}
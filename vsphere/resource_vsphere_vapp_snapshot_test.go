@@ -0,0 +1,41 @@
+package vsphere
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestVSphereVAppSnapshot_stopOrder(t *testing.T) {
+	vm := func(id string, order int32) vAppMemberVM {
+		return vAppMemberVM{ref: types.ManagedObjectReference{Type: "VirtualMachine", Value: id}, startOrder: order}
+	}
+	members := []vAppMemberVM{vm("db", 1), vm("web1", 3), vm("app", 2), vm("web2", 3), vm("misc", 0)}
+
+	sort.Stable(vAppMembersByStopOrder(members))
+
+	expected := []string{"web1", "web2", "app", "db", "misc"}
+	for i, id := range expected {
+		if members[i].ref.Value != id {
+			t.Fatalf("expected %s at position %d, got %#v", id, i, members)
+		}
+	}
+}
+
+func TestVSphereVAppSnapshot_snapshotInTree(t *testing.T) {
+	snap := func(id string, children ...types.VirtualMachineSnapshotTree) types.VirtualMachineSnapshotTree {
+		return types.VirtualMachineSnapshotTree{
+			Snapshot:          types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: id},
+			ChildSnapshotList: children,
+		}
+	}
+	tree := []types.VirtualMachineSnapshotTree{snap("snapshot-1", snap("snapshot-2", snap("snapshot-3")))}
+
+	if !snapshotInTree(tree, "snapshot-3") {
+		t.Errorf("expected nested snapshot to be found")
+	}
+	if snapshotInTree(tree, "snapshot-4") {
+		t.Errorf("expected unknown snapshot not to be found")
+	}
+}
@@ -3,8 +3,18 @@ package vsphere
 import (
 	//"fmt"
 	//"log"
+	"math"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vim25/xml"
 	/*
 		"github.com/hashicorp/terraform/helper/resource"
 		"github.com/hashicorp/terraform/terraform"
@@ -15,6 +25,10 @@ import (
 	*/)
 
 func TestAccVSphereVapp_validatorFunc(t *testing.T) {
+	// Converted at run time, as the constant overflows int on 32-bit
+	// platforms. It wraps to a negative value there, still out of range.
+	aboveMaxInt32 := int64(math.MaxInt32) + 1
+
 	var validatorCases = []attributeValueValidationTestSpec{
 		{name: "type", validatorFn: validateEntityType,
 			values: []attributeProperty{
@@ -33,6 +47,36 @@ func TestAccVSphereVapp_validatorFunc(t *testing.T) {
 				{value: "powerOff", expErr: "Supported values are"},
 			},
 		},
+		{name: "start_policy", validatorFn: validateStartPolicy,
+			values: []attributeProperty{
+				{value: "entities", successCase: true},
+				{value: "always", successCase: true},
+				{value: "never", expErr: "Supported values are"},
+			},
+		},
+		{name: "placement_policy", validatorFn: validatePlacementPolicy,
+			values: []attributeProperty{
+				{value: "most_free_memory", successCase: true},
+				{value: "most_free_cpu", successCase: true},
+				{value: "round_robin", successCase: true},
+				{value: "random", expErr: "Supported values are"},
+			},
+		},
+		{name: "delete_behavior", validatorFn: validateDeleteBehavior,
+			values: []attributeProperty{
+				{value: "destroy", successCase: true},
+				{value: "detach_entities_only", successCase: true},
+				{value: "detach", expErr: "Supported values are"},
+			},
+		},
+		{name: "power_state", validatorFn: validateVAppPowerState,
+			values: []attributeProperty{
+				{value: "poweredOn", successCase: true},
+				{value: "poweredOff", successCase: true},
+				{value: "suspended", successCase: true},
+				{value: "started", expErr: "Supported values are"},
+			},
+		},
 		{name: "stop_action", validatorFn: validateStopAction,
 			values: []attributeProperty{
 				{value: "none", successCase: true},
@@ -43,11 +87,213 @@ func TestAccVSphereVapp_validatorFunc(t *testing.T) {
 				{value: "unknown", expErr: "Supported values are"},
 			},
 		},
+		{name: "start_order", validatorFn: validateStartOrder,
+			values: []attributeProperty{
+				{value: 0, successCase: true},
+				{value: 10, successCase: true},
+				{value: math.MaxInt32, successCase: true},
+				{value: -1, expErr: "out of allowed range"},
+				{value: int(aboveMaxInt32), expErr: "out of allowed range"},
+			},
+		},
+		{name: "disk_provisioning", validatorFn: validateDiskProvisioning,
+			values: []attributeProperty{
+				{value: "sameAsSource", successCase: true},
+				{value: "thin", successCase: true},
+				{value: "thick", successCase: true},
+				{value: "eagerZeroedThick", expErr: "Supported values are"},
+			},
+		},
+		{name: "source_power_handling", validatorFn: validateSourcePowerHandling,
+			values: []attributeProperty{
+				{value: "clone", successCase: true},
+				{value: "fail", successCase: true},
+				{value: "snapshot", successCase: true},
+				{value: "power_off", successCase: true},
+				{value: "suspend", expErr: "Supported values are"},
+			},
+		},
+		{name: "hostname", validatorFn: validateGuestHostname,
+			values: []attributeProperty{
+				{value: "web01", successCase: true},
+				{value: "db-primary", successCase: true},
+				{value: "web01.example.com", expErr: "single DNS label"},
+				{value: "-web", expErr: "single DNS label"},
+				{value: strings.Repeat("a", 64), expErr: "single DNS label"},
+			},
+		},
+		{name: "start_delay", validatorFn: validateEntityDelay,
+			values: []attributeProperty{
+				{value: 0, successCase: true},
+				{value: 120, successCase: true},
+				{value: -5, expErr: "out of allowed range"},
+				{value: int(aboveMaxInt32), expErr: "out of allowed range"},
+			},
+		},
+		{name: "entity_ip_address_timeout", validatorFn: validateEntityIPAddressTimeout,
+			values: []attributeProperty{
+				{value: 0, successCase: true},
+				{value: 3600, successCase: true},
+				{value: -1, expErr: "cannot be negative"},
+			},
+		},
 	}
 
 	verifySchemaValidationFunctions(t, validatorCases)
 }
 
+func TestAccVSphereVapp_duplicateEntities(t *testing.T) {
+	vm1 := map[string]interface{}{"name": "vm1", "type": "vm", "folder": "apps"}
+	vm1Again := map[string]interface{}{"name": "vm1", "type": "vm", "folder": "apps", "start_order": 2}
+	vm1OtherFolder := map[string]interface{}{"name": "vm1", "type": "vm", "folder": "db"}
+	vapp1 := map[string]interface{}{"name": "vm1", "type": "vapp", "folder": "apps"}
+
+	if err := validateUniqueEntities([]interface{}{vm1, vm1OtherFolder, vapp1}); err != nil {
+		t.Fatalf("expected distinct entities to pass, got: %s", err)
+	}
+
+	err := validateUniqueEntities([]interface{}{vm1, vm1Again})
+	if err == nil || !strings.Contains(err.Error(), "configured more than once") {
+		t.Fatalf("expected duplicate entity error, got: %v", err)
+	}
+}
+
+func TestAccVSphereVapp_entityAffinity(t *testing.T) {
+	entity := func(entityType, host, hostGroup string) map[string]interface{} {
+		return map[string]interface{}{"name": "db", "type": entityType, "host": host, "host_group": hostGroup}
+	}
+
+	if err := validateEntityAffinity([]interface{}{entity("vm", "esx1", ""), entity("vm", "", "licensed"), entity("vapp", "", "")}); err != nil {
+		t.Fatalf("expected valid affinity to pass, got: %s", err)
+	}
+
+	err := validateEntityAffinity([]interface{}{entity("vm", "esx1", "licensed")})
+	if err == nil || !strings.Contains(err.Error(), "only one of host or host_group") {
+		t.Fatalf("expected mutually exclusive error, got: %v", err)
+	}
+
+	err = validateEntityAffinity([]interface{}{entity("vapp", "esx1", "")})
+	if err == nil || !strings.Contains(err.Error(), "only supported for entities of type vm") {
+		t.Fatalf("expected entity type error, got: %v", err)
+	}
+
+	// An unset host must not change the hash of entities in existing state.
+	base := map[string]interface{}{"name": "db", "type": "vm"}
+	if resourceVSphereVAppEntityHash(base) != resourceVSphereVAppEntityHash(entity("vm", "", "")) {
+		t.Fatalf("expected empty host and host_group to keep the entity hash")
+	}
+}
+
+func TestAccVSphereVapp_entityCustomization(t *testing.T) {
+	web := map[string]interface{}{"name": "web", "type": "vm", "hostname": "web01", "domain": "example.com"}
+	app := map[string]interface{}{"name": "app", "type": "vapp", "hostname": "app01", "domain": ""}
+	plain := map[string]interface{}{"name": "db", "type": "vm", "hostname": "", "domain": ""}
+
+	if err := validateEntityCustomization([]interface{}{web, plain}, true); err != nil {
+		t.Fatalf("expected customization of a cloned VM to pass, got: %s", err)
+	}
+	if err := validateEntityCustomization([]interface{}{plain}, false); err != nil {
+		t.Fatalf("expected entities without customization to pass, got: %s", err)
+	}
+
+	err := validateEntityCustomization([]interface{}{web}, false)
+	if err == nil || !strings.Contains(err.Error(), "template_vapp") {
+		t.Fatalf("expected template error, got: %v", err)
+	}
+
+	err = validateEntityCustomization([]interface{}{app}, true)
+	if err == nil || !strings.Contains(err.Error(), "only supported for entities of type vm") {
+		t.Fatalf("expected entity type error, got: %v", err)
+	}
+
+	base := map[string]interface{}{"name": "db", "type": "vm"}
+	if resourceVSphereVAppEntityHash(base) != resourceVSphereVAppEntityHash(plain) {
+		t.Fatalf("expected empty hostname and domain to keep the entity hash")
+	}
+}
+
+func TestAccVSphereVapp_ovfProperties(t *testing.T) {
+	yes, no := true, false
+	props := []types.VAppPropertyInfo{
+		{Key: 0, Id: "hostname", UserConfigurable: &yes},
+		{Key: 1, Id: "ip0", UserConfigurable: &yes},
+		{Key: 2, Id: "build", UserConfigurable: &no},
+	}
+
+	specs, err := ovfPropertySpecs(props, map[string]string{"ip0": "10.0.0.5", "hostname": "vrops01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 || specs[0].Info.Key != 0 || specs[0].Info.Value != "vrops01" ||
+		specs[1].Info.Key != 1 || specs[1].Operation != types.ArrayUpdateOperationEdit {
+		t.Fatalf("bad property specs: %#v", specs)
+	}
+
+	_, err = ovfPropertySpecs(props, map[string]string{"build": "42"})
+	if err == nil || !strings.Contains(err.Error(), "not user configurable") {
+		t.Fatalf("expected a not configurable error, got: %v", err)
+	}
+	_, err = ovfPropertySpecs(props, map[string]string{"dns": "10.0.0.2"})
+	if err == nil || !strings.Contains(err.Error(), "hostname, ip0") {
+		t.Fatalf("expected an unknown property error listing the properties, got: %v", err)
+	}
+
+	web := map[string]interface{}{"name": "web", "type": "vm", "ovf_properties": map[string]interface{}{"ip0": "10.0.0.5"}}
+	err = validateEntityCustomization([]interface{}{web}, false)
+	if err == nil || !strings.Contains(err.Error(), "template_vapp") {
+		t.Fatalf("expected template error, got: %v", err)
+	}
+	base := map[string]interface{}{"name": "web", "type": "vm"}
+	if resourceVSphereVAppEntityHash(base) == resourceVSphereVAppEntityHash(web) {
+		t.Fatalf("expected ovf_properties to change the entity hash")
+	}
+}
+
+func TestAccVSphereVapp_guestCustomizationSpec(t *testing.T) {
+	mvm := mo.VirtualMachine{
+		Name: "web",
+		Config: &types.VirtualMachineConfigInfo{
+			GuestId: "centos64Guest",
+			Hardware: types.VirtualHardware{
+				Device: []types.BaseVirtualDevice{
+					&types.VirtualVmxnet3{},
+					&types.VirtualE1000{},
+					&types.VirtualDisk{},
+				},
+			},
+		},
+	}
+
+	settings := sysprepSettings{timeZone: 4, fullName: "ops", orgName: "example"}
+	spec := guestCustomizationSpec(mvm, "", "example.com", settings)
+	linux, ok := spec.Identity.(*types.CustomizationLinuxPrep)
+	if !ok {
+		t.Fatalf("expected LinuxPrep identity, got %T", spec.Identity)
+	}
+	if name := linux.HostName.(*types.CustomizationFixedName).Name; name != "web" || linux.Domain != "example.com" {
+		t.Fatalf("expected hostname web in example.com, got %s in %s", name, linux.Domain)
+	}
+	if len(spec.NicSettingMap) != 2 {
+		t.Fatalf("expected a DHCP mapping per network adapter, got %d", len(spec.NicSettingMap))
+	}
+
+	mvm.Config.GuestId = "windows9Server64Guest"
+	spec = guestCustomizationSpec(mvm, "web01", "example.com", settings)
+	sysprep, ok := spec.Identity.(*types.CustomizationSysprep)
+	if !ok {
+		t.Fatalf("expected Sysprep identity, got %T", spec.Identity)
+	}
+	if name := sysprep.UserData.ComputerName.(*types.CustomizationFixedName).Name; name != "web01" {
+		t.Fatalf("expected computer name web01, got %s", name)
+	}
+	if len(spec.GlobalIPSettings.DnsSuffixList) != 1 || spec.GlobalIPSettings.DnsSuffixList[0] != "example.com" {
+		t.Fatalf("expected DNS suffix example.com, got %v", spec.GlobalIPSettings.DnsSuffixList)
+	}
+	if sysprep.GuiUnattended.TimeZone != 4 || sysprep.UserData.FullName != "ops" || sysprep.UserData.OrgName != "example" {
+		t.Fatalf("expected the configured Sysprep settings, got %#v", sysprep)
+	}
+}
+
 func testAccPreCheckVapp(t *testing.T) {
 
 	var envList = []string{"VSPHERE_DATACENTER"}
@@ -60,3 +306,382 @@ func testAccPreCheckVapp(t *testing.T) {
 		}
 	}
 }
+
+func TestAccVSphereVapp_powerState(t *testing.T) {
+	cases := []struct {
+		state    types.VirtualAppVAppState
+		vmStates []types.VirtualMachinePowerState
+		expected string
+	}{
+		{types.VirtualAppVAppStateStarted, nil, vAppPowerStateOn},
+		{types.VirtualAppVAppStateStopped, nil, vAppPowerStateOff},
+		{types.VirtualAppVAppStateStopped, []types.VirtualMachinePowerState{
+			types.VirtualMachinePowerStateSuspended, types.VirtualMachinePowerStatePoweredOff}, vAppPowerStateSuspended},
+		{types.VirtualAppVAppStateStopped, []types.VirtualMachinePowerState{
+			types.VirtualMachinePowerStateSuspended, types.VirtualMachinePowerStatePoweredOn}, vAppPowerStateOn},
+	}
+	for _, c := range cases {
+		if actual := vAppPowerState(c.state, c.vmStates); actual != c.expected {
+			t.Fatalf("expected %s for vApp %s with %v, got %s", c.expected, c.state, c.vmStates, actual)
+		}
+	}
+}
+
+func TestAccVSphereVapp_entityIPAddresses(t *testing.T) {
+	vm := func(name string, state types.VirtualMachinePowerState, ip string) mo.VirtualMachine {
+		mvm := mo.VirtualMachine{Runtime: types.VirtualMachineRuntimeInfo{PowerState: state}}
+		mvm.Name = name
+		if ip != "" {
+			mvm.Guest = &types.GuestInfo{IpAddress: ip}
+		}
+		return mvm
+	}
+	addresses, pending := entityIPAddresses([]mo.VirtualMachine{
+		vm("web", types.VirtualMachinePowerStatePoweredOn, "10.0.0.5"),
+		vm("db", types.VirtualMachinePowerStatePoweredOn, ""),
+		vm("spare", types.VirtualMachinePowerStatePoweredOff, ""),
+	})
+	if !reflect.DeepEqual(addresses, map[string]string{"web": "10.0.0.5"}) {
+		t.Fatalf("unexpected addresses %v", addresses)
+	}
+	if !reflect.DeepEqual(pending, []string{"db"}) {
+		t.Fatalf("expected to wait for db only, got %q", pending)
+	}
+}
+
+func TestAccVSphereVapp_restartSequence(t *testing.T) {
+	entity := func(name string, order, delay int32) vAppEntity {
+		e := vAppEntity{name: name}
+		e.StartOrder = order
+		e.StartDelay = delay
+		return e
+	}
+	groups := restartSequence([]vAppEntity{entity("web", 3, 0), entity("db1", 1, 30), entity("app", 2, 0), entity("db2", 1, 60)})
+	var sequence []string
+	for _, g := range groups {
+		var names []string
+		for _, e := range g {
+			names = append(names, e.name)
+		}
+		sequence = append(sequence, strings.Join(names, ","))
+	}
+	if !reflect.DeepEqual(sequence, []string{"db1,db2", "app", "web"}) {
+		t.Fatalf("unexpected restart sequence %q", sequence)
+	}
+	if delay := groupDelay(groups[0], func(e vAppEntity) int32 { return e.StartDelay }); delay != 60*time.Second {
+		t.Fatalf("expected the longest start delay of the group, got %s", delay)
+	}
+}
+
+func TestAccVSphereVapp_groupGuestWaitRefs(t *testing.T) {
+	waiting := true
+	entity := func(kind, moid string, wait bool) vAppEntity {
+		e := vAppEntity{entityType: kind, entityMoid: moid}
+		if wait {
+			e.WaitingForGuest = &waiting
+		}
+		return e
+	}
+	group := []vAppEntity{
+		entity(vAppEntityTypeVm, "vm-1", true),
+		entity(vAppEntityTypeVm, "vm-2", false),
+		entity(vAppEntityTypeVApp, "resgroup-v1", true),
+		entity(vAppEntityTypeVm, "", true),
+	}
+	expected := []types.ManagedObjectReference{{Type: vAppEntityTypeVm, Value: "vm-1"}}
+	if refs := groupGuestWaitRefs(group); !reflect.DeepEqual(refs, expected) {
+		t.Fatalf("expected to wait for vm-1 only, got %v", refs)
+	}
+}
+
+func TestAccVSphereVapp_waitingForGuest(t *testing.T) {
+	ref := func(kind, value string) *types.ManagedObjectReference {
+		return &types.ManagedObjectReference{Type: kind, Value: value}
+	}
+	configs := []types.VAppEntityConfigInfo{
+		{Key: ref("VirtualMachine", "vm-10"), WaitingForGuest: types.NewBool(true)},
+		{Key: ref("VirtualMachine", "vm-11"), WaitingForGuest: types.NewBool(false)},
+		{Key: ref("VirtualMachine", "vm-12")},
+		{Key: ref("VirtualApp", "resgroup-v3"), WaitingForGuest: types.NewBool(true)},
+	}
+	if refs := guestWaitRefs(configs); len(refs) != 1 || refs[0].Value != "vm-10" {
+		t.Fatalf("expected to wait for vm-10 only, got %v", refs)
+	}
+
+	vm := func(name string, state types.VirtualMachinePowerState, tools types.VirtualMachineToolsRunningStatus) mo.VirtualMachine {
+		mvm := mo.VirtualMachine{
+			Runtime: types.VirtualMachineRuntimeInfo{PowerState: state},
+			Guest:   &types.GuestInfo{ToolsRunningStatus: string(tools)},
+		}
+		mvm.Name = name
+		return mvm
+	}
+	pending := guestsNotReady([]mo.VirtualMachine{
+		vm("web", types.VirtualMachinePowerStatePoweredOn, types.VirtualMachineToolsRunningStatusGuestToolsRunning),
+		vm("db", types.VirtualMachinePowerStatePoweredOn, types.VirtualMachineToolsRunningStatusGuestToolsNotRunning),
+		vm("spare", types.VirtualMachinePowerStatePoweredOff, types.VirtualMachineToolsRunningStatusGuestToolsNotRunning),
+	})
+	if !reflect.DeepEqual(pending, []string{"db"}) {
+		t.Fatalf("expected to wait for db only, got %q", pending)
+	}
+}
+
+func TestAccVSphereVapp_clearDescription(t *testing.T) {
+	req := updateVAppAnnotation{
+		This: types.ManagedObjectReference{Type: "VirtualApp", Value: "resgroup-v2"},
+		Spec: vAppAnnotationSpec{Annotation: ""},
+	}
+	out, err := xml.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "<annotation></annotation>") {
+		t.Fatalf("expected an empty annotation in the request, got %s", out)
+	}
+}
+
+func TestAccVSphereVapp_productInfo(t *testing.T) {
+	products := flattenVAppProducts([]types.VAppProductInfo{
+		{Key: 0, Name: "Appliance", Vendor: "Example", Version: "7.0", FullVersion: "7.0.1 build 42"},
+	})
+	if len(products) != 1 {
+		t.Fatalf("expected one product, got %d", len(products))
+	}
+	p := products[0].(map[string]interface{})
+	if p["name"] != "Appliance" || p["version"] != "7.0" || p["full_version"] != "7.0.1 build 42" {
+		t.Fatalf("unexpected product %v", p)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceVSphereVApp().Schema, map[string]interface{}{"name": "app"})
+	if err := d.Set("product", products); err != nil {
+		t.Fatalf("expected the product to match the schema, got %s", err)
+	}
+}
+
+func TestAccVSphereVapp_placementPolicy(t *testing.T) {
+	candidates := []placementCandidate{
+		{path: "/dc1/host/cluster1/Resources", freeMemory: 64 << 30, freeCpu: 8000},
+		{path: "/dc1/host/cluster2/Resources", freeMemory: 128 << 30, freeCpu: 4000},
+		{path: "/dc1/host/cluster3/Resources", freeMemory: 128 << 30, freeCpu: 2000},
+	}
+	if i := selectPlacement(placementPolicyMostFreeMemory, candidates, 0); i != 1 {
+		t.Fatalf("expected cluster2 with the most free memory, got %s", candidates[i].path)
+	}
+	if i := selectPlacement(placementPolicyMostFreeCpu, candidates, 0); i != 0 {
+		t.Fatalf("expected cluster1 with the most free CPU, got %s", candidates[i].path)
+	}
+	for counter, expected := range []int{0, 1, 2, 0} {
+		if i := selectPlacement(placementPolicyRoundRobin, candidates, counter); i != expected {
+			t.Fatalf("expected candidate %d for round %d, got %d", expected, counter, i)
+		}
+	}
+}
+
+func TestAccVSphereVapp_startGroups(t *testing.T) {
+	entity := func(name string, order, delay int) map[string]interface{} {
+		return map[string]interface{}{"name": name, "type": "vm", "start_order": order, "start_delay": delay, "stop_delay": 0}
+	}
+	entities := []interface{}{entity("db1", 1, 30), entity("db2", 1, 30), entity("app", 2, 0), entity("web", 3, 0)}
+	groups := []vAppStartGroup{
+		{name: "db", entities: []string{"db1", "db2"}},
+		{name: "app", entities: []string{"app"}},
+	}
+	if err := validateStartGroups(groups, entities); err != nil {
+		t.Fatalf("expected consistent start groups to pass, got: %s", err)
+	}
+
+	cases := []struct {
+		groups   []vAppStartGroup
+		entities []interface{}
+		want     string
+	}{
+		{[]vAppStartGroup{{name: "db", entities: []string{"db1", "app"}}}, entities, "start_order 2"},
+		{[]vAppStartGroup{{name: "db", entities: []string{"db1", "db2"}}},
+			[]interface{}{entity("db1", 1, 30), entity("db2", 1, 0)}, "start_delay 0"},
+		{[]vAppStartGroup{{name: "app", entities: []string{"app"}}, {name: "db", entities: []string{"db1"}}},
+			entities, "has to start after"},
+		{[]vAppStartGroup{{name: "db", entities: []string{"db1"}}}, entities, "entity db2 is not in start_group db"},
+		{[]vAppStartGroup{{name: "db", entities: []string{"db3"}}}, entities, "db3 is not an entity"},
+		{[]vAppStartGroup{{name: "db", entities: []string{"db1", "db2"}}, {name: "again", entities: []string{"db1"}}},
+			entities, "already in start_group db"},
+	}
+	for _, c := range cases {
+		err := validateStartGroups(c.groups, c.entities)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%#v: expected error containing %q, got: %v", c.groups, c.want, err)
+		}
+	}
+
+	ref := func(v string) *types.ManagedObjectReference {
+		return &types.ManagedObjectReference{Type: "VirtualMachine", Value: v}
+	}
+	configs := []types.VAppEntityConfigInfo{
+		{Key: ref("vm-3"), StartOrder: 2},
+		{Key: ref("vm-1"), StartOrder: 1, StartDelay: 30},
+		{Key: ref("vm-2"), StartOrder: 1, StartDelay: 30},
+	}
+	names := map[string]string{"vm-1": "db1", "vm-2": "db2", "vm-3": "app"}
+	sequence := formatBootSequence(configs, names)
+	expected := []string{"1: db1, db2 (start delay 30s)", "2: app"}
+	if !reflect.DeepEqual(sequence, expected) {
+		t.Fatalf("expected boot sequence %q, got %q", expected, sequence)
+	}
+}
+
+func TestAccVSphereVapp_entityMoid(t *testing.T) {
+	byName := map[string]interface{}{"name": "web", "type": "vm", "folder": "apps", "moid": ""}
+	byMoid := map[string]interface{}{"name": "", "type": "vm", "folder": "", "moid": "vm-42"}
+	if err := validateEntityReferences([]interface{}{byName, byMoid}); err != nil {
+		t.Fatalf("expected entities by name and by moid to pass, got: %s", err)
+	}
+
+	none := map[string]interface{}{"name": "", "type": "vm", "folder": "", "moid": ""}
+	err := validateEntityReferences([]interface{}{none})
+	if err == nil || !strings.Contains(err.Error(), "one of name or moid") {
+		t.Fatalf("expected missing reference error, got: %v", err)
+	}
+	folder := map[string]interface{}{"name": "", "type": "vm", "folder": "apps", "moid": "vm-42"}
+	err = validateEntityReferences([]interface{}{folder})
+	if err == nil || !strings.Contains(err.Error(), "folder can only be set with name") {
+		t.Fatalf("expected folder error, got: %v", err)
+	}
+	both := map[string]interface{}{"name": "web", "type": "vm", "folder": "", "moid": "vm-42"}
+	err = validateEntityReferences([]interface{}{both})
+	if err == nil || !strings.Contains(err.Error(), "only one of name or moid") {
+		t.Fatalf("expected name and moid error, got: %v", err)
+	}
+
+	other := map[string]interface{}{"name": "", "type": "vm", "folder": "", "moid": "vm-43"}
+	if err := validateUniqueEntities([]interface{}{byMoid, other}); err != nil {
+		t.Fatalf("expected distinct moids to pass, got: %s", err)
+	}
+	if err := validateUniqueEntities([]interface{}{byMoid, byMoid}); err == nil {
+		t.Fatal("expected duplicate moid error")
+	}
+
+	if resourceVSphereVAppEntityHash(byMoid) == resourceVSphereVAppEntityHash(other) {
+		t.Fatal("expected entities by moid to hash differently")
+	}
+	populated := map[string]interface{}{"name": "web", "type": "vm", "folder": "apps", "moid": "vm-44"}
+	if resourceVSphereVAppEntityHash(byName) != resourceVSphereVAppEntityHash(populated) {
+		t.Fatal("expected the computed moid of an entity by name to keep its hash")
+	}
+}
+
+func TestAccVSphereVapp_entityIDMembers(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceVSphereVApp().Schema, map[string]interface{}{
+		"name":       "vapp1",
+		"entity_ids": []interface{}{"/dc1/vm/web", "vm-12"},
+	})
+	vapp := &vApp{d: d}
+	entities := []vAppEntity{
+		{name: "db", entityType: vAppEntityTypeVm, entityMoid: "vm-10"},
+		{entityType: vAppEntityTypeVm, entityMoid: "vm-11", entityID: "/dc1/vm/web",
+			entityFolderPath: "/dc1/vm", entityRPPath: "/dc1/host/cluster1/Resources"},
+		{entityType: vAppEntityTypeVm, entityMoid: "vm-12", entityID: "vm-12"},
+	}
+	if err := vapp.setEntityIDMembers(entities); err != nil {
+		t.Fatal(err)
+	}
+
+	members := vapp.entityIDMembers()
+	if len(members) != 2 {
+		t.Fatalf("expected the 2 entities of entity_ids, got %#v", members)
+	}
+	if !reflect.DeepEqual(members[0], entities[1]) {
+		t.Fatalf("expected %#v, got %#v", entities[1], members[0])
+	}
+	if members[1].label() != "vm-12" || !members[1].byMoid() {
+		t.Fatalf("expected entity vm-12 by moid, got %#v", members[1])
+	}
+}
+
+func TestAccVSphereVapp_reconcileEntities(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceVSphereVApp().Schema, map[string]interface{}{
+		"name": "vapp1",
+		"entity": []interface{}{
+			map[string]interface{}{"name": "web", "type": "vm"},
+			map[string]interface{}{"name": "db", "type": "vm"},
+			map[string]interface{}{"name": "new", "type": "vm"},
+		},
+		"entity_ids": []interface{}{"vm-20", "vm-21"},
+	})
+	vapp := &vApp{d: d, name: "vapp1"}
+	if err := vapp.setEntityMembers([]vAppEntity{
+		{name: "web", entityType: vAppEntityTypeVm, entityMoid: "vm-10"},
+		{name: "db", entityType: vAppEntityTypeVm, entityMoid: "vm-11"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := vapp.setEntityIDMembers([]vAppEntity{
+		{entityType: vAppEntityTypeVm, entityMoid: "vm-20", entityID: "vm-20"},
+		{entityType: vAppEntityTypeVm, entityMoid: "vm-21", entityID: "vm-21"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := func(v string) *types.ManagedObjectReference {
+		return &types.ManagedObjectReference{Type: "VirtualMachine", Value: v}
+	}
+	mvapp := mo.VirtualApp{VAppConfig: &types.VAppConfigInfo{
+		EntityConfig: []types.VAppEntityConfigInfo{{Key: ref("vm-10")}, {Key: ref("vm-21")}},
+	}}
+	if err := vapp.reconcileEntities(&mvapp); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, value := range d.Get("entity").(*schema.Set).List() {
+		names = append(names, value.(map[string]interface{})["name"].(string))
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"new", "web"}) {
+		t.Fatalf("expected entities new and web to be kept, got %q", names)
+	}
+	if members := vapp.entityMembers(); len(members) != 1 || members["VirtualMachine/web"].entityMoid != "vm-10" {
+		t.Fatalf("expected the members of web only, got %#v", members)
+	}
+	ids := d.Get("entity_ids").(*schema.Set)
+	if ids.Len() != 1 || !ids.Contains("vm-21") {
+		t.Fatalf("expected entity_ids vm-21, got %#v", ids.List())
+	}
+	if members := vapp.entityIDMembers(); len(members) != 1 || members[0].entityMoid != "vm-21" {
+		t.Fatalf("expected entity_id_members vm-21, got %#v", members)
+	}
+}
+
+func TestAccVSphereVapp_entityReparent(t *testing.T) {
+	self := types.ManagedObjectReference{Type: "VirtualApp", Value: "resgroup-v1"}
+	parents := map[string]types.ManagedObjectReference{
+		"vm-10": {Type: "ResourcePool", Value: "resgroup-8"},
+		"vm-11": self,
+		"vm-12": {Type: "VirtualApp", Value: "resgroup-v2"},
+	}
+
+	err := checkEntityReparent(parents, self, false)
+	if err == nil || !strings.Contains(err.Error(), "vm-12 is a member of vApp resgroup-v2") {
+		t.Fatalf("expected vm-12 to be rejected, got %v", err)
+	}
+	if strings.Contains(err.Error(), "vm-10") || strings.Contains(err.Error(), "vm-11") {
+		t.Fatalf("expected only vm-12 to be rejected, got %v", err)
+	}
+	if err := checkEntityReparent(parents, self, true); err != nil {
+		t.Fatalf("expected reparenting to be allowed, got %v", err)
+	}
+}
+
+func TestAccVSphereVapp_vmsOutsidePod(t *testing.T) {
+	ds := func(v string) types.ManagedObjectReference {
+		return types.ManagedObjectReference{Type: "Datastore", Value: v}
+	}
+	vmDatastores := map[string][]types.ManagedObjectReference{
+		"vm-10": {ds("datastore-1")},
+		"vm-11": {ds("datastore-1"), ds("datastore-9")},
+		"vm-12": {ds("datastore-9")},
+		"vm-13": {ds("datastore-2")},
+	}
+	moids := vmsOutsidePod(vmDatastores, []types.ManagedObjectReference{ds("datastore-1"), ds("datastore-2")})
+	if !reflect.DeepEqual(moids, []string{"vm-11", "vm-12"}) {
+		t.Fatalf("expected vm-11 and vm-12 to be moved, got %q", moids)
+	}
+}
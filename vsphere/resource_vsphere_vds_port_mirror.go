@@ -0,0 +1,772 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+var portMirrorSessionTypeList = []string{
+	string(types.VMwareDVSVspanSessionTypeDvPortMirror),
+	string(types.VMwareDVSVspanSessionTypeMixedDestMirror),
+	string(types.VMwareDVSVspanSessionTypeRemoteMirrorSource),
+	string(types.VMwareDVSVspanSessionTypeRemoteMirrorDest),
+	string(types.VMwareDVSVspanSessionTypeEncapsulatedRemoteMirrorSource),
+}
+
+// The directions of the source traffic which is mirrored, seen from the
+// source ports.
+const (
+	portMirrorDirectionBoth        = "both"
+	portMirrorDirectionTransmitted = "transmitted"
+	portMirrorDirectionReceived    = "received"
+)
+
+var portMirrorDirectionList = []string{
+	portMirrorDirectionBoth,
+	portMirrorDirectionTransmitted,
+	portMirrorDirectionReceived,
+}
+
+type portMirrorSourceNic struct {
+	vm             string
+	interfaceIndex int
+}
+
+type vdsPortMirror struct {
+	datacenter           string
+	vdsName              string
+	name                 string
+	description          string
+	enabled              bool
+	sessionType          string
+	direction            string
+	sourcePorts          []string
+	sourcePortgroups     []string
+	sourceNics           []portMirrorSourceNic
+	destinationPorts     []string
+	destinationUplinks   []string
+	destinationIPs       []string
+	samplingRate         int32
+	mirroredPacketLength int32
+	normalTrafficAllowed bool
+	stripOriginalVlan    bool
+	encapsulationVlanId  int32
+}
+
+func resourceVSphereVdsPortMirror() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceVSphereVdsPortMirrorCreate,
+		Read:   resourceVSphereVdsPortMirrorRead,
+		Update: resourceVSphereVdsPortMirrorUpdate,
+		Delete: resourceVSphereVdsPortMirrorDelete,
+
+		Timeouts: resourceTimeouts(),
+
+		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
+			"datacenter": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDatacenterName,
+				StateFunc:    datacenterNameStateFunc,
+			},
+
+			"vds_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			"description": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			"enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+
+			"session_type": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      string(types.VMwareDVSVspanSessionTypeDvPortMirror),
+				ValidateFunc: validatePortMirrorSessionType,
+			},
+
+			// Which traffic of the sources is mirrored.
+			"source_direction": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      portMirrorDirectionBoth,
+				ValidateFunc: validatePortMirrorDirection,
+			},
+
+			"source_ports": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			// All ports of the portgroups at the time the session is
+			// configured. Ports of ephemeral portgroups only exist while
+			// they are connected.
+			"source_portgroups": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"source_vm_nic": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						// Name or path of the virtual machine.
+						"vm": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"interface_index": &schema.Schema{
+							Type:     schema.TypeInt,
+							Optional: true,
+						},
+					},
+				},
+			},
+
+			"destination_ports": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			"destination_uplinks": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			// Collector addresses of encapsulatedRemoteMirrorSource sessions.
+			"destination_ip_addresses": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+
+			// One of every sampling_rate packets is mirrored.
+			"sampling_rate": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      1,
+				ValidateFunc: validatePortMirrorSamplingRate,
+			},
+
+			// Mirrored packets are cut to this length in bytes, 0 mirrors
+			// them completely.
+			"mirrored_packet_length": &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+
+			"normal_traffic_allowed": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+
+			"strip_original_vlan": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+
+			"encapsulation_vlan_id": &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+
+			"key": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			// The port keys the sources resolved to.
+			"source_port_keys": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func validatePortMirrorSessionType(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, portMirrorSessionTypeList)
+}
+
+func validatePortMirrorDirection(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, portMirrorDirectionList)
+}
+
+func validatePortMirrorSamplingRate(v interface{}, k string) (ws []string, errors []error) {
+	if v.(int) < 1 {
+		errors = append(errors, fmt.Errorf("%s: sampling rate must be at least 1", k))
+	}
+	return
+}
+
+func stringList(v interface{}) []string {
+	var l []string
+	for _, s := range v.([]interface{}) {
+		l = append(l, s.(string))
+	}
+	return l
+}
+
+func parsePortMirrorData(d *schema.ResourceData) *vdsPortMirror {
+	pm := &vdsPortMirror{
+		datacenter:           d.Get("datacenter").(string),
+		vdsName:              d.Get("vds_name").(string),
+		name:                 d.Get("name").(string),
+		description:          d.Get("description").(string),
+		enabled:              d.Get("enabled").(bool),
+		sessionType:          d.Get("session_type").(string),
+		direction:            d.Get("source_direction").(string),
+		sourcePorts:          stringList(d.Get("source_ports")),
+		sourcePortgroups:     stringList(d.Get("source_portgroups")),
+		destinationPorts:     stringList(d.Get("destination_ports")),
+		destinationUplinks:   stringList(d.Get("destination_uplinks")),
+		destinationIPs:       stringList(d.Get("destination_ip_addresses")),
+		samplingRate:         int32(d.Get("sampling_rate").(int)),
+		mirroredPacketLength: int32(d.Get("mirrored_packet_length").(int)),
+		normalTrafficAllowed: d.Get("normal_traffic_allowed").(bool),
+		stripOriginalVlan:    d.Get("strip_original_vlan").(bool),
+		encapsulationVlanId:  int32(d.Get("encapsulation_vlan_id").(int)),
+	}
+	for _, v := range d.Get("source_vm_nic").([]interface{}) {
+		nic := v.(map[string]interface{})
+		pm.sourceNics = append(pm.sourceNics, portMirrorSourceNic{
+			vm:             nic["vm"].(string),
+			interfaceIndex: nic["interface_index"].(int),
+		})
+	}
+	return pm
+}
+
+// validatePortMirrorConfigs checks the sources and destinations the session
+// type needs, which vCenter only reports as an invalid argument.
+func validatePortMirrorConfigs(pm *vdsPortMirror) error {
+	if len(pm.sourcePorts)+len(pm.sourcePortgroups)+len(pm.sourceNics) == 0 &&
+		pm.sessionType != string(types.VMwareDVSVspanSessionTypeRemoteMirrorDest) {
+		return fmt.Errorf("port mirror %s needs source_ports, source_portgroups or source_vm_nic", pm.name)
+	}
+
+	switch pm.sessionType {
+	case string(types.VMwareDVSVspanSessionTypeDvPortMirror):
+		if len(pm.destinationPorts) == 0 || len(pm.destinationUplinks)+len(pm.destinationIPs) > 0 {
+			return fmt.Errorf("port mirror %s of type %s needs destination_ports only", pm.name, pm.sessionType)
+		}
+	case string(types.VMwareDVSVspanSessionTypeRemoteMirrorSource):
+		if len(pm.destinationUplinks) == 0 {
+			return fmt.Errorf("port mirror %s of type %s needs destination_uplinks", pm.name, pm.sessionType)
+		}
+	case string(types.VMwareDVSVspanSessionTypeEncapsulatedRemoteMirrorSource):
+		if len(pm.destinationIPs) == 0 {
+			return fmt.Errorf("port mirror %s of type %s needs destination_ip_addresses", pm.name, pm.sessionType)
+		}
+	default:
+		if len(pm.destinationPorts)+len(pm.destinationUplinks) == 0 {
+			return fmt.Errorf("port mirror %s of type %s needs destination_ports or destination_uplinks", pm.name, pm.sessionType)
+		}
+	}
+	return nil
+}
+
+// portMirrorID returns the ID of a session, which is only unique within its
+// vDS.
+func portMirrorID(dvsMoid string, key string) string {
+	return fmt.Sprintf("%s:%s", dvsMoid, key)
+}
+
+func parsePortMirrorID(id string) (string, string, error) {
+	parts := strings.SplitN(id, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid port mirror ID %s, expected <vds moid>:<session key>", id)
+	}
+	return parts[0], parts[1], nil
+}
+
+// resolveSourcePorts returns the sorted port keys of the configured source
+// ports, portgroups and virtual machine interfaces.
+func (pm *vdsPortMirror) resolveSourcePorts(client *VSphereClient, dvs types.ManagedObjectReference) ([]string, error) {
+	keys := make(map[string]bool)
+	for _, key := range pm.sourcePorts {
+		keys[key] = true
+	}
+
+	for _, name := range pm.sourcePortgroups {
+		portKeys, err := pm.portgroupPortKeys(client, dvs, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range portKeys {
+			keys[key] = true
+		}
+	}
+
+	if len(pm.sourceNics) > 0 {
+		dc, err := client.getDatacenter(pm.datacenter)
+		if err != nil {
+			return nil, err
+		}
+		finder := client.getFinder(dc)
+		for _, nic := range pm.sourceNics {
+			key, err := vmNicPortKey(finder, nic)
+			if err != nil {
+				return nil, err
+			}
+			keys[key] = true
+		}
+	}
+
+	l := make([]string, 0, len(keys))
+	for key := range keys {
+		l = append(l, key)
+	}
+	sort.Strings(l)
+	return l, nil
+}
+
+// portgroupPortKeys returns the keys of the ports of a distributed portgroup.
+func (pm *vdsPortMirror) portgroupPortKeys(client *VSphereClient, dvs types.ManagedObjectReference, name string) ([]string, error) {
+	netRef, err := findNetObjectByName(pm.datacenter, name, client)
+	if err != nil {
+		return nil, err
+	}
+	pg, ok := netRef.(*object.DistributedVirtualPortgroup)
+	if !ok {
+		return nil, fmt.Errorf("source portgroup %s is not a distributed portgroup", name)
+	}
+	var mopg mo.DistributedVirtualPortgroup
+	if err := pg.Properties(context.TODO(), pg.Reference(), []string{"key"}, &mopg); err != nil {
+		return nil, err
+	}
+	req := types.FetchDVPorts{
+		This: dvs,
+		Criteria: &types.DistributedVirtualSwitchPortCriteria{
+			PortgroupKey: []string{mopg.Key},
+		},
+	}
+	res, err := methods.FetchDVPorts(context.TODO(), client.vimClient.Client, &req)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, port := range res.Returnval {
+		keys = append(keys, port.Key)
+	}
+	return keys, nil
+}
+
+// portMirrorSourceDirection returns the direction of the mirrored traffic of
+// a session.
+func portMirrorSourceDirection(session *types.VMwareVspanSession) string {
+	switch {
+	case session.SourcePortTransmitted != nil && session.SourcePortReceived == nil:
+		return portMirrorDirectionTransmitted
+	case session.SourcePortTransmitted == nil && session.SourcePortReceived != nil:
+		return portMirrorDirectionReceived
+	}
+	return portMirrorDirectionBoth
+}
+
+// readSourceData sets the sources of the session. The session only knows the
+// port keys, so the configured portgroups and network interfaces are kept
+// while one of their ports is still a source, and the remaining keys are
+// reported as source_ports. Sources changed outside of Terraform show up in
+// the next plan that way.
+func (pm *vdsPortMirror) readSourceData(d *schema.ResourceData, client *VSphereClient, dvs types.ManagedObjectReference, sourceKeys []string) error {
+	remaining := make(map[string]bool)
+	for _, key := range sourceKeys {
+		remaining[key] = true
+	}
+	claim := func(keys []string) bool {
+		found := false
+		for _, key := range keys {
+			if remaining[key] {
+				delete(remaining, key)
+				found = true
+			}
+		}
+		return found
+	}
+
+	var portgroups []string
+	for _, name := range pm.sourcePortgroups {
+		keys, err := pm.portgroupPortKeys(client, dvs, name)
+		if err != nil {
+			log.Printf("[WARN] Could not read the ports of source portgroup %s: %s", name, err)
+			continue
+		}
+		if claim(keys) {
+			portgroups = append(portgroups, name)
+		}
+	}
+
+	var nics []interface{}
+	if len(pm.sourceNics) > 0 {
+		dc, err := client.getDatacenter(pm.datacenter)
+		if err != nil {
+			return err
+		}
+		finder := client.getFinder(dc)
+		for _, nic := range pm.sourceNics {
+			key, err := vmNicPortKey(finder, nic)
+			if err != nil {
+				log.Printf("[WARN] Could not read the port of source network interface %d of %s: %s", nic.interfaceIndex, nic.vm, err)
+				continue
+			}
+			if claim([]string{key}) {
+				nics = append(nics, map[string]interface{}{
+					"vm":              nic.vm,
+					"interface_index": nic.interfaceIndex,
+				})
+			}
+		}
+	}
+
+	// Explicit ports keep their configured order.
+	var ports []string
+	for _, key := range pm.sourcePorts {
+		if remaining[key] {
+			ports = append(ports, key)
+			delete(remaining, key)
+		}
+	}
+	var others []string
+	for key := range remaining {
+		others = append(others, key)
+	}
+	sort.Strings(others)
+	ports = append(ports, others...)
+
+	if err := d.Set("source_ports", ports); err != nil {
+		return err
+	}
+	if err := d.Set("source_portgroups", portgroups); err != nil {
+		return err
+	}
+	return d.Set("source_vm_nic", nics)
+}
+
+// vmNicPortKey returns the distributed port a network interface of a virtual
+// machine is connected to.
+func vmNicPortKey(finder *find.Finder, nic portMirrorSourceNic) (string, error) {
+	vm, err := finder.VirtualMachine(context.TODO(), nic.vm)
+	if err != nil {
+		return "", err
+	}
+	devices, err := vm.Device(context.TODO())
+	if err != nil {
+		return "", err
+	}
+	cards := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	if nic.interfaceIndex < 0 || nic.interfaceIndex >= len(cards) {
+		return "", fmt.Errorf("virtual machine %s has no network interface %d", nic.vm, nic.interfaceIndex)
+	}
+	backing, ok := cards[nic.interfaceIndex].GetVirtualDevice().Backing.(*types.VirtualEthernetCardDistributedVirtualPortBackingInfo)
+	if !ok {
+		return "", fmt.Errorf("network interface %d of virtual machine %s is not connected to a vDS", nic.interfaceIndex, nic.vm)
+	}
+	return backing.Port.PortKey, nil
+}
+
+// vspanSession builds the session with the resolved source port keys.
+func (pm *vdsPortMirror) vspanSession(key string, sourceKeys []string) *types.VMwareVspanSession {
+	session := &types.VMwareVspanSession{
+		Key:                  key,
+		Name:                 pm.name,
+		Description:          pm.description,
+		Enabled:              pm.enabled,
+		SessionType:          pm.sessionType,
+		SamplingRate:         pm.samplingRate,
+		MirroredPacketLength: pm.mirroredPacketLength,
+		NormalTrafficAllowed: pm.normalTrafficAllowed,
+		StripOriginalVlan:    pm.stripOriginalVlan,
+		EncapsulationVlanId:  pm.encapsulationVlanId,
+	}
+	if len(sourceKeys) > 0 {
+		source := &types.VMwareVspanPort{PortKey: sourceKeys}
+		if pm.direction != portMirrorDirectionReceived {
+			session.SourcePortTransmitted = source
+		}
+		if pm.direction != portMirrorDirectionTransmitted {
+			session.SourcePortReceived = source
+		}
+	}
+	session.DestinationPort = &types.VMwareVspanPort{
+		PortKey:        pm.destinationPorts,
+		UplinkPortName: pm.destinationUplinks,
+		IpAddress:      pm.destinationIPs,
+	}
+	return session
+}
+
+// findPortMirrorDvs returns the vDS of the resource with its config.
+func findPortMirrorDvs(client *VSphereClient, datacenter string, vdsName string) (types.ManagedObjectReference, *types.VMwareDVSConfigInfo, error) {
+	netRef, err := findNetObjectByName(datacenter, vdsName, client)
+	if err != nil {
+		return types.ManagedObjectReference{}, nil, err
+	}
+	return readPortMirrorDvs(client, netRef.Reference())
+}
+
+func readPortMirrorDvs(client *VSphereClient, ref types.ManagedObjectReference) (types.ManagedObjectReference, *types.VMwareDVSConfigInfo, error) {
+	var mdvs mo.VmwareDistributedVirtualSwitch
+	collector := property.DefaultCollector(client.vimClient.Client)
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"config"}, &mdvs); err != nil {
+		return ref, nil, err
+	}
+	config, ok := mdvs.Config.(*types.VMwareDVSConfigInfo)
+	if !ok {
+		return ref, nil, fmt.Errorf("vDS %s does not support port mirroring", ref.Value)
+	}
+	return ref, config, nil
+}
+
+func findVspanSession(config *types.VMwareDVSConfigInfo, key string, name string) *types.VMwareVspanSession {
+	for i := range config.VspanSession {
+		session := &config.VspanSession[i]
+		if (key != "" && session.Key == key) || (key == "" && session.Name == name) {
+			return session
+		}
+	}
+	return nil
+}
+
+// reconfigureVspanSession applies one session change to the vDS.
+func reconfigureVspanSession(client *VSphereClient, dvs types.ManagedObjectReference, configVersion string,
+	op types.ConfigSpecOperation, session *types.VMwareVspanSession, d *schema.ResourceData, timeout string) error {
+
+	spec := &types.VMwareDVSConfigSpec{
+		DVSConfigSpec: types.DVSConfigSpec{ConfigVersion: configVersion},
+		VspanConfigSpec: []types.VMwareDVSVspanConfigSpec{
+			{
+				VspanSession: *session,
+				Operation:    string(op),
+			},
+		},
+	}
+	req := types.ReconfigureDvs_Task{
+		This: dvs,
+		Spec: spec,
+	}
+	res, err := methods.ReconfigureDvs_Task(context.TODO(), client.vimClient.Client, &req)
+	if err != nil {
+		return err
+	}
+
+	operation := fmt.Sprintf("%s port mirror %s", op, session.Name)
+	ctx, cancel := taskContext(d.Timeout(timeout))
+	defer cancel()
+	task := object.NewTask(client.vimClient.Client, res.Returnval)
+	_, err = task.WaitForResult(ctx, nil)
+	return taskTimeoutError(ctx, err, operation, d.Timeout(timeout))
+}
+
+func resourceVSphereVdsPortMirrorCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_port_mirror", resourceLogName(d, "name"), "create")
+	client := meta.(*VSphereClient)
+
+	pm := parsePortMirrorData(d)
+	if err := validatePortMirrorConfigs(pm); err != nil {
+		return err
+	}
+	logger.Infof("Creating port mirror: %#v", pm)
+
+	dvs, config, err := findPortMirrorDvs(client, pm.datacenter, pm.vdsName)
+	if err != nil {
+		return err
+	}
+	if err := requireDVSFeatures(pm.vdsName, config, portMirrorFeatures(pm)...); err != nil {
+		return err
+	}
+	if findVspanSession(config, "", pm.name) != nil {
+		return fmt.Errorf("port mirror %s already exists on vDS %s", pm.name, pm.vdsName)
+	}
+
+	sourceKeys, err := pm.resolveSourcePorts(client, dvs)
+	if err != nil {
+		return err
+	}
+	err = reconfigureVspanSession(client, dvs, config.ConfigVersion, types.ConfigSpecOperationAdd,
+		pm.vspanSession("", sourceKeys), d, schema.TimeoutCreate)
+	if err != nil {
+		return translateVSphereError(err, fmt.Sprintf("port mirror %s", pm.name))
+	}
+
+	// vCenter assigns the key of the new session.
+	_, config, err = readPortMirrorDvs(client, dvs)
+	if err != nil {
+		return err
+	}
+	session := findVspanSession(config, "", pm.name)
+	if session == nil {
+		return fmt.Errorf("port mirror %s not found on vDS %s after creating it", pm.name, pm.vdsName)
+	}
+	d.SetId(portMirrorID(dvs.Value, session.Key))
+	logger.Infof("Created port mirror: %s", d.Id())
+
+	return resourceVSphereVdsPortMirrorRead(d, meta)
+}
+
+func resourceVSphereVdsPortMirrorRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_port_mirror", resourceLogName(d, "name"), "read")
+	client := meta.(*VSphereClient)
+
+	dvsMoid, key, err := parsePortMirrorID(d.Id())
+	if err != nil {
+		return err
+	}
+	dvsRef := types.ManagedObjectReference{Type: "VmwareDistributedVirtualSwitch", Value: dvsMoid}
+	_, config, err := readPortMirrorDvs(client, dvsRef)
+	if err != nil {
+		if isManagedObjectNotFoundError(err) {
+			logger.Warnf("vDS of port mirror %s is gone, removing it from state", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+	session := findVspanSession(config, key, "")
+	if session == nil {
+		logger.Warnf("Port mirror %s is gone, removing it from state", d.Id())
+		d.SetId("")
+		return nil
+	}
+	logger.Debugf("Port mirror session: %#v", session)
+
+	d.Set("key", session.Key)
+	d.Set("name", session.Name)
+	d.Set("description", session.Description)
+	d.Set("enabled", session.Enabled)
+	d.Set("session_type", session.SessionType)
+	d.Set("sampling_rate", int(session.SamplingRate))
+	d.Set("mirrored_packet_length", int(session.MirroredPacketLength))
+	d.Set("normal_traffic_allowed", session.NormalTrafficAllowed)
+	d.Set("strip_original_vlan", session.StripOriginalVlan)
+	d.Set("encapsulation_vlan_id", int(session.EncapsulationVlanId))
+
+	source := session.SourcePortTransmitted
+	if source == nil {
+		source = session.SourcePortReceived
+	}
+	var sourceKeys []string
+	if source != nil {
+		sourceKeys = source.PortKey
+	}
+	d.Set("source_port_keys", sourceKeys)
+	d.Set("source_direction", portMirrorSourceDirection(session))
+	if err := parsePortMirrorData(d).readSourceData(d, client, dvsRef, sourceKeys); err != nil {
+		return err
+	}
+	if dest := session.DestinationPort; dest != nil {
+		d.Set("destination_ports", dest.PortKey)
+		d.Set("destination_uplinks", dest.UplinkPortName)
+		d.Set("destination_ip_addresses", dest.IpAddress)
+	}
+	return nil
+}
+
+func resourceVSphereVdsPortMirrorUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_port_mirror", resourceLogName(d, "name"), "update")
+	client := meta.(*VSphereClient)
+
+	pm := parsePortMirrorData(d)
+	if err := validatePortMirrorConfigs(pm); err != nil {
+		return err
+	}
+
+	dvsMoid, key, err := parsePortMirrorID(d.Id())
+	if err != nil {
+		return err
+	}
+	dvs, config, err := readPortMirrorDvs(client, types.ManagedObjectReference{Type: "VmwareDistributedVirtualSwitch", Value: dvsMoid})
+	if err != nil {
+		return err
+	}
+	logger.Infof("Updating port mirror: %s", d.Id())
+
+	sourceKeys, err := pm.resolveSourcePorts(client, dvs)
+	if err != nil {
+		return err
+	}
+	err = reconfigureVspanSession(client, dvs, config.ConfigVersion, types.ConfigSpecOperationEdit,
+		pm.vspanSession(key, sourceKeys), d, schema.TimeoutUpdate)
+	if err != nil {
+		return translateVSphereError(err, fmt.Sprintf("port mirror %s", pm.name))
+	}
+
+	return resourceVSphereVdsPortMirrorRead(d, meta)
+}
+
+func resourceVSphereVdsPortMirrorDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_port_mirror", resourceLogName(d, "name"), "delete")
+	client := meta.(*VSphereClient)
+
+	dvsMoid, key, err := parsePortMirrorID(d.Id())
+	if err != nil {
+		return err
+	}
+	dvs, config, err := readPortMirrorDvs(client, types.ManagedObjectReference{Type: "VmwareDistributedVirtualSwitch", Value: dvsMoid})
+	if err != nil {
+		return err
+	}
+	logger.Infof("Deleting port mirror: %s", d.Id())
+
+	session := findVspanSession(config, key, "")
+	if session == nil {
+		d.SetId("")
+		return nil
+	}
+	err = reconfigureVspanSession(client, dvs, config.ConfigVersion, types.ConfigSpecOperationRemove,
+		&types.VMwareVspanSession{Key: key, Name: session.Name}, d, schema.TimeoutDelete)
+	if err != nil {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
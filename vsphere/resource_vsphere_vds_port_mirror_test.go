@@ -0,0 +1,77 @@
+package vsphere
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestAccVSphereVdsPortMirror_validatorFunc(t *testing.T) {
+	var validatorCases = []attributeValueValidationTestSpec{
+		{name: "session_type", validatorFn: validatePortMirrorSessionType,
+			values: []attributeProperty{
+				{value: "dvPortMirror", successCase: true},
+				{value: "encapsulatedRemoteMirrorSource", successCase: true},
+				{value: "netflow", expErr: "Supported values are"},
+			},
+		},
+		{name: "source_direction", validatorFn: validatePortMirrorDirection,
+			values: []attributeProperty{
+				{value: "both", successCase: true},
+				{value: "received", successCase: true},
+				{value: "ingress", expErr: "Supported values are"},
+			},
+		},
+		{name: "sampling_rate", validatorFn: validatePortMirrorSamplingRate,
+			values: []attributeProperty{
+				{value: 1, successCase: true},
+				{value: 0, expErr: "at least 1"},
+			},
+		},
+	}
+
+	verifySchemaValidationFunctions(t, validatorCases)
+}
+
+func TestAccVSphereVdsPortMirror_vspanSession(t *testing.T) {
+	pm := &vdsPortMirror{
+		name:             "capture",
+		enabled:          true,
+		sessionType:      string(types.VMwareDVSVspanSessionTypeDvPortMirror),
+		direction:        portMirrorDirectionTransmitted,
+		destinationPorts: []string{"100"},
+		samplingRate:     1,
+	}
+	if err := validatePortMirrorConfigs(pm); err == nil {
+		t.Fatalf("expected an error for a session without sources")
+	}
+
+	pm.sourcePorts = []string{"10"}
+	if err := validatePortMirrorConfigs(pm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	session := pm.vspanSession("key-1", []string{"10", "11"})
+	if session.SourcePortReceived != nil {
+		t.Fatalf("received traffic should not be mirrored: %#v", session.SourcePortReceived)
+	}
+	if session.SourcePortTransmitted == nil || !reflect.DeepEqual(session.SourcePortTransmitted.PortKey, []string{"10", "11"}) {
+		t.Fatalf("bad transmitted source: %#v", session.SourcePortTransmitted)
+	}
+	if session.Key != "key-1" || !reflect.DeepEqual(session.DestinationPort.PortKey, []string{"100"}) {
+		t.Fatalf("bad session: %#v", session)
+	}
+	if direction := portMirrorSourceDirection(session); direction != portMirrorDirectionTransmitted {
+		t.Fatalf("expected direction %s, got %s", portMirrorDirectionTransmitted, direction)
+	}
+	pm.direction = portMirrorDirectionBoth
+	if direction := portMirrorSourceDirection(pm.vspanSession("key-1", []string{"10"})); direction != portMirrorDirectionBoth {
+		t.Fatalf("expected direction %s, got %s", portMirrorDirectionBoth, direction)
+	}
+
+	dvs, key, err := parsePortMirrorID(portMirrorID("dvs-21", "key-1"))
+	if err != nil || dvs != "dvs-21" || key != "key-1" {
+		t.Fatalf("bad ID round trip: %s %s %v", dvs, key, err)
+	}
+}
@@ -4,13 +4,13 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/vmware/govmomi"
-	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 	"golang.org/x/net/context"
@@ -49,6 +49,10 @@ type pgVlan struct {
 	vlanType  string
 	vlanId    int32
 	vlanRange []types.NumericRange
+
+	// inherit clears the VLAN of the portgroup in favor of the one of the
+	// vDS.
+	inherit bool
 }
 
 type vdPortgroup struct {
@@ -59,6 +63,10 @@ type vdPortgroup struct {
 	description   string
 	numPorts      int32
 	pgVlan
+
+	// teaming and security are nil when their blocks are not configured.
+	teaming  *pgTeaming
+	security *pgSecurity
 }
 
 func resourceVSphereVdPortgroup() *schema.Resource {
@@ -68,13 +76,21 @@ func resourceVSphereVdPortgroup() *schema.Resource {
 		Update: resourceVSphereVdPortgroupUpdate,
 		Delete: resourceVSphereVdPortgroupDelete,
 
-		SchemaVersion: 1,
+		SchemaVersion: 4,
+		MigrateState:  resourceVSphereVdPortgroupMigrateState,
+
+		Timeouts: resourceTimeouts(),
 
 		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
 			"datacenter": &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDatacenterName,
+				StateFunc:    datacenterNameStateFunc,
 			},
 
 			"vds_name": &schema.Schema{
@@ -125,27 +141,64 @@ func resourceVSphereVdPortgroup() *schema.Resource {
 							ValidateFunc: validateVlanId,
 						},
 						"vlan_range": &schema.Schema{
-							Type:         schema.TypeString,
-							Optional:     true,
-							ValidateFunc: validateVlanRange,
+							Type:             schema.TypeString,
+							Optional:         true,
+							ValidateFunc:     validateVlanRange,
+							DiffSuppressFunc: suppressEquivalentVlanRange,
 						},
+						"inherit_from_switch": inheritFromSwitchSchema(),
 					},
 				},
 			},
+			"teaming":  portgroupTeamingSchema(),
+			"security": portgroupSecuritySchema(),
+
+			"permission": permissionSchema(),
+
+			"moid": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			// The ID is the moid, the path is informational and follows
+			// renames in vCenter.
+			"inventory_path": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"folder_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"key": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"uplink": &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
 		},
 	}
 }
 
 func resourceVSphereVdPortgroupCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_portgroup", resourceLogName(d, "portgroup_name"), "create")
 
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient)
 	pg, _ := parsePortgroupData(d)
 
 	if err := validatePortgroupConfigs(pg); err != nil {
-		log.Printf("[ERROR] Configuration validation failed.")
+		logger.Errorf("Configuration validation failed.")
 		return err
 	}
-	log.Printf("[INFO] creating vDS portgroup: %#v", pg)
+	logger.Infof("creating vDS portgroup: %#v", pg)
 
 	vdsRef, err := findNetObjectByName(pg.datacenter, pg.vdsName, client)
 	if err != nil {
@@ -159,29 +212,51 @@ func resourceVSphereVdPortgroupCreate(d *schema.ResourceData, meta interface{})
 		Type:        pg.portgroupType,
 		NumPorts:    pg.numPorts,
 	}
+	if pg.portgroupType == string(types.DistributedVirtualPortgroupPortgroupTypeEphemeral) {
+		pgSpec.NumPorts = 0
+	}
 
-	pgSpec.DefaultPortConfig = setPortSettings(pg.pgVlan)
+	portSettings := setPortSettings(pg.pgVlan)
+	if pg.teaming != nil {
+		portSettings.UplinkTeamingPolicy = pg.teaming.teamingPolicy()
+	}
+	if pg.security != nil {
+		portSettings.SecurityPolicy = pg.security.securityPolicy()
+	}
+	pgSpec.DefaultPortConfig = portSettings
 
 	// Now call AddPortgroup API
 	//
 	task, err := vDS.AddPortgroup(context.TODO(), []types.DVPortgroupConfigSpec{pgSpec})
 	if err != nil {
-		return err
+		return translateVSphereError(err, fmt.Sprintf("portgroup %s", pg.portgroupName))
 	}
-	_, err = task.WaitForResult(context.TODO(), nil)
+	ctx, cancel := taskContext(d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+	_, err = task.WaitForResult(ctx, nil)
 	if err != nil {
-		return err
+		err = taskTimeoutError(ctx, err, "create portgroup "+pg.portgroupName, d.Timeout(schema.TimeoutCreate))
+		return translateVSphereError(err, fmt.Sprintf("portgroup %s", pg.portgroupName))
 	}
+	client.invalidateCache()
 
 	// Find the newly created object and set required fields.
 	//
 	netRef, err := findNetObjectByName(pg.datacenter, pg.portgroupName, client)
 	dvsPortGrp := netRef.(*object.DistributedVirtualPortgroup)
-	d.SetId(dvsPortGrp.InventoryPath)
+	d.SetId(dvsPortGrp.Reference().Value)
+
+	if _, ok := d.GetOk("permission"); ok {
+		err = parseUserPermissionData(d, client.vimClient).setResourcePermission(dvsPortGrp.Reference())
+		if err != nil {
+			logger.Errorf("Setting permission of portgroup %s failed: %s", pg.portgroupName, err)
+			return err
+		}
+	}
 
 	if pg.datacenter == "" {
-		dcName := strings.Split(dvsPortGrp.InventoryPath, "/")[0]
-		log.Printf("[INFO] Retrieve DC '%s' from inventory path %s",
+		dcName := strings.Split(strings.TrimPrefix(dvsPortGrp.InventoryPath, "/"), "/")[0]
+		logger.Infof("Retrieve DC '%s' from inventory path %s",
 			dcName, dvsPortGrp.InventoryPath)
 		d.Set("datacenter", dcName)
 	}
@@ -190,33 +265,131 @@ func resourceVSphereVdPortgroupCreate(d *schema.ResourceData, meta interface{})
 }
 
 func resourceVSphereVdPortgroupRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_portgroup", resourceLogName(d, "portgroup_name"), "read")
 
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient)
 	dcName := d.Get("datacenter").(string)
 	pgName := d.Get("portgroup_name").(string)
 
-	log.Printf("[INFO] reading vDS portgroup: [%s]", d.Id())
+	logger.Infof("reading vDS portgroup: [%s]", d.Id())
 
-	netRef, err := findNetObjectByName(dcName, pgName, client)
+	dvsPortGrp, err := getPortgroupFromID(d, client)
 	if err != nil {
+		if isManagedObjectNotFoundError(err) {
+			logger.Warnf("portgroup %s is gone, removing it from state", d.Id())
+			d.SetId("")
+			return nil
+		}
 		return err
 	}
-	if netRef == nil {
+	if dvsPortGrp == nil {
 		d.SetId("")
 		return fmt.Errorf("portgroup '%s' not found in vDS %s in datacenter %s.",
 			pgName, d.Get("vds_name").(string), dcName)
 	}
 
-	log.Printf("[DEBUG] The vDS Portgroup : %#v", netRef)
+	logger.Debugf("The vDS Portgroup : %#v", dvsPortGrp)
+	d.SetId(dvsPortGrp.Reference().Value)
+	d.Set("inventory_path", canonicalInventoryPath(dvsPortGrp.InventoryPath))
+
+	var mopg mo.DistributedVirtualPortgroup
+	err = dvsPortGrp.Properties(context.TODO(), dvsPortGrp.Reference(),
+		[]string{"parent", "key", "name", "config.defaultPortConfig"}, &mopg)
+	if err != nil {
+		return err
+	}
+	d.Set("portgroup_name", mopg.Name)
+
+	if setting, ok := mopg.Config.DefaultPortConfig.(*types.VMwareDVSPortSetting); ok && setting.Vlan != nil {
+		vlan := flattenPortgroupVlan(setting.Vlan)
+		// Without a vlan block only a VLAN set on the portgroup itself is
+		// drift, an inherited one or none is not.
+		_, configured := d.GetOk("vlan")
+		if configured || (!vlan["inherit_from_switch"].(bool) && vlan["type"] != portgroupVlanTypeNone) {
+			if err := d.Set("vlan", []interface{}{vlan}); err != nil {
+				return err
+			}
+		}
+	}
+	if setting, ok := mopg.Config.DefaultPortConfig.(*types.VMwareDVSPortSetting); ok {
+		if err := readPortgroupPolicies(d, setting); err != nil {
+			return err
+		}
+	}
+
+	uplink, err := isUplinkPortgroup(dvsPortGrp)
+	if err != nil {
+		return err
+	}
+
+	d.Set("moid", dvsPortGrp.Reference().Value)
+	d.Set("key", mopg.Key)
+	d.Set("uplink", uplink)
+	if mopg.Parent != nil {
+		d.Set("folder_id", mopg.Parent.Value)
+	}
+
+	return readResourcePermission(d, client.vimClient, dvsPortGrp.Reference())
+}
+
+// isUplinkPortgroup reports whether the portgroup is one of the uplink
+// portgroups of its vDS. Those are owned by the switch and must not be
+// changed or removed through this resource.
+func isUplinkPortgroup(dvsPortGrp *object.DistributedVirtualPortgroup) (bool, error) {
+	var mopg mo.DistributedVirtualPortgroup
+	err := dvsPortGrp.Properties(context.TODO(), dvsPortGrp.Reference(),
+		[]string{"config.distributedVirtualSwitch"}, &mopg)
+	if err != nil {
+		return false, err
+	}
+	if mopg.Config.DistributedVirtualSwitch == nil {
+		return false, nil
+	}
+
+	var modvs mo.DistributedVirtualSwitch
+	collector := property.DefaultCollector(dvsPortGrp.Client())
+	err = collector.RetrieveOne(context.TODO(), *mopg.Config.DistributedVirtualSwitch,
+		[]string{"config.uplinkPortgroup"}, &modvs)
+	if err != nil {
+		return false, err
+	}
+	if modvs.Config == nil {
+		return false, nil
+	}
+
+	for _, ref := range modvs.Config.GetDVSConfigInfo().UplinkPortgroup {
+		if ref == dvsPortGrp.Reference() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func refuseUplinkPortgroup(dvsPortGrp *object.DistributedVirtualPortgroup, pgName string) error {
+	uplink, err := isUplinkPortgroup(dvsPortGrp)
+	if err != nil {
+		return err
+	}
+	if uplink {
+		return fmt.Errorf("portgroup '%s' is an uplink portgroup of its vDS and "+
+			"cannot be managed by vsphere_vds_portgroup, use vsphere_vds_uplink_portgroup to rename it", pgName)
+	}
 	return nil
 }
 
 func resourceVSphereVdPortgroupUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_portgroup", resourceLogName(d, "portgroup_name"), "update")
 
 	pg, _ := parsePortgroupData(d)
 
 	if err := validatePortgroupConfigs(pg); err != nil {
-		log.Printf("[ERROR] Configuration validation failed.")
+		logger.Errorf("Configuration validation failed.")
 		return err
 	}
 
@@ -228,16 +401,27 @@ func resourceVSphereVdPortgroupUpdate(d *schema.ResourceData, meta interface{})
 		pgName = oldpg.(string)
 		pgSpec.Name = pg.portgroupName
 	}
-	log.Printf("[INFO] Updating vDS portgroup: %s", pgName)
+	logger.Infof("Updating vDS portgroup: %s", pgName)
 
-	client := meta.(*govmomi.Client)
-	netRef, err := findNetObjectByName(pg.datacenter, pgName, client)
+	client := meta.(*VSphereClient)
+	dvsPortGrp, err := getPortgroupFromID(d, client)
+	if err == nil && dvsPortGrp == nil {
+		err = fmt.Errorf("portgroup '%s' not found", pgName)
+	}
 	if err != nil {
-		log.Printf("[ERROR] PortGroup '%s' object not found for update", pgName)
+		logger.Errorf("PortGroup '%s' object not found for update", pgName)
+		return err
+	}
+
+	if err := refuseUplinkPortgroup(dvsPortGrp, pgName); err != nil {
 		return err
 	}
 
 	if d.HasChange("portgroup_type") {
+		oldType, _ := d.GetChange("portgroup_type")
+		if err := validatePortgroupTypeChange(dvsPortGrp, oldType.(string), pg.portgroupType); err != nil {
+			return err
+		}
 		pgSpec.Type = pg.portgroupType
 	}
 
@@ -249,13 +433,23 @@ func resourceVSphereVdPortgroupUpdate(d *schema.ResourceData, meta interface{})
 		pgSpec.NumPorts = pg.numPorts
 	}
 
-	if d.HasChange("vlan") {
-		vlancfg := parseVlan(d)
-		pgSpec.DefaultPortConfig = setPortSettings(vlancfg)
+	if d.HasChange("vlan") || d.HasChange("teaming") || d.HasChange("security") {
+		portSettings := setPortSettings(pg.pgVlan)
+		// A removed vlan block clears the VLAN like type none.
+		if d.HasChange("vlan") && portSettings.Vlan == nil {
+			portSettings.Vlan = &types.VmwareDistributedVirtualSwitchVlanIdSpec{VlanId: 0}
+		}
+		// A removed teaming or security block inherits the policy of the
+		// vDS again.
+		if d.HasChange("teaming") {
+			portSettings.UplinkTeamingPolicy = pg.teaming.teamingPolicy()
+		}
+		if d.HasChange("security") {
+			portSettings.SecurityPolicy = pg.security.securityPolicy()
+		}
+		pgSpec.DefaultPortConfig = portSettings
 	}
 
-	dvsPortGrp := netRef.(*object.DistributedVirtualPortgroup)
-
 	var mopg mo.DistributedVirtualPortgroup
 	err = dvsPortGrp.Properties(context.TODO(), dvsPortGrp.Reference(),
 		[]string{"config.configVersion"}, &mopg)
@@ -270,70 +464,77 @@ func resourceVSphereVdPortgroupUpdate(d *schema.ResourceData, meta interface{})
 		return err
 	}
 
-	_, err = task.WaitForResult(context.TODO(), nil)
+	ctx, cancel := taskContext(d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+	_, err = task.WaitForResult(ctx, nil)
 	if err != nil {
-		log.Printf("[ERROR] Portgroup %s updation failed.", pgName)
-		return err
+		logger.Errorf("Portgroup %s updation failed.", pgName)
+		return taskTimeoutError(ctx, err, "update portgroup "+pgName, d.Timeout(schema.TimeoutUpdate))
 	}
+	client.invalidateCache()
 
-	if d.HasChange("portgroup_name") {
-		// Find the newly created object and set required fields.
-		//
-		netRef, err = findNetObjectByName(pg.datacenter, pg.portgroupName, client)
-		if netRef == nil || err != nil {
-			return fmt.Errorf("portgroup '%s' update is not complete.",
-				pg.portgroupName)
+	if d.HasChange("permission") {
+		err = parseUserPermissionData(d, client.vimClient).updateResourcePermission(dvsPortGrp.Reference())
+		if err != nil {
+			logger.Errorf("Permission update of portgroup %s failed: %s", pg.portgroupName, err)
+			return err
 		}
-
-		dvsPortGrp = netRef.(*object.DistributedVirtualPortgroup)
-		d.SetId(dvsPortGrp.InventoryPath)
 	}
 
 	return nil
 }
 
 func resourceVSphereVdPortgroupDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_portgroup", resourceLogName(d, "portgroup_name"), "delete")
 
 	dcName := d.Get("datacenter").(string)
 	pgName := d.Get("portgroup_name").(string)
 
-	log.Printf("[INFO] Deleting vDS portgroup: %s", pgName)
+	logger.Infof("Deleting vDS portgroup: %s", pgName)
 
-	client := meta.(*govmomi.Client)
-	netRef, err := findNetObjectByName(dcName, pgName, client)
+	client := meta.(*VSphereClient)
+	dvsPortGrp, err := getPortgroupFromID(d, client)
+	if err == nil && dvsPortGrp == nil {
+		err = fmt.Errorf("portgroup '%s' not found in datacenter %s", pgName, dcName)
+	}
 	if err != nil {
 		return err
 	}
 
-	dvsPortGrp := netRef.(*object.DistributedVirtualPortgroup)
+	if err := refuseUplinkPortgroup(dvsPortGrp, pgName); err != nil {
+		return err
+	}
 
 	task, err := dvsPortGrp.Destroy(context.TODO())
 	if err != nil {
 		return err
 	}
-	_, err = task.WaitForResult(context.TODO(), nil)
+	ctx, cancel := taskContext(d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+	_, err = task.WaitForResult(ctx, nil)
 	if err != nil {
-		log.Printf("[ERROR] Portgroup %s deletion failed.", pgName)
-		return err
+		logger.Errorf("Portgroup %s deletion failed.", pgName)
+		return taskTimeoutError(ctx, err, "delete portgroup "+pgName, d.Timeout(schema.TimeoutDelete))
 	}
+	client.invalidateCache()
 
 	return nil
 }
 
 func findNetObjectByName(dcName string, netName string,
-	client *govmomi.Client) (object.NetworkReference, error) {
+	client *VSphereClient) (object.NetworkReference, error) {
 
 	log.Printf("[DEBUG] Finding network %s object in datacenter %s", netName, dcName)
-	dc, err := getDatacenter(client, dcName)
+	dc, err := client.getDatacenter(dcName)
 	if err != nil {
 		log.Printf("[ERROR] datacenter '%s' not found", dcName)
 		return nil, err
 	}
 
-	finder := find.NewFinder(client.Client, true)
-	finder = finder.SetDatacenter(dc)
-
-	netRef, err := finder.Network(context.TODO(), netName)
+	netRef, err := client.getNetwork(dc, netName)
 	if err != nil {
 		log.Printf("[ERROR] Network '%s' object not found in datacenter %s.",
 			netName, dcName)
@@ -344,12 +545,35 @@ func findNetObjectByName(dcName string, netName string,
 	return netRef, nil
 }
 
+// getPortgroupFromID returns the portgroup of the resource by its managed
+// object ID, so it is still found after a rename in vCenter. States which
+// still hold the inventory path as ID are looked up by name.
+func getPortgroupFromID(d *schema.ResourceData, client *VSphereClient) (*object.DistributedVirtualPortgroup, error) {
+	if !isManagedObjectID(d.Id()) {
+		pgName, _ := d.GetChange("portgroup_name")
+		netRef, err := findNetObjectByName(d.Get("datacenter").(string), pgName.(string), client)
+		if err != nil || netRef == nil {
+			return nil, err
+		}
+		return netRef.(*object.DistributedVirtualPortgroup), nil
+	}
+
+	ref := types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: d.Id()}
+	path, err := managedObjectInventoryPath(client.vimClient.Client, ref)
+	if err != nil {
+		return nil, err
+	}
+	dvsPortGrp := object.NewDistributedVirtualPortgroup(client.vimClient.Client, ref)
+	dvsPortGrp.InventoryPath = path
+	return dvsPortGrp, nil
+}
+
 func findVdsPgByInventoryPath(d *schema.ResourceData, meta interface{}) (object.Reference, error) {
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient).vimClient
 	pgName := d.Get("portgroup_name").(string)
 
 	pgRef, err := object.NewSearchIndex(client.Client).FindByInventoryPath(
-		context.TODO(), d.Id())
+		context.TODO(), strings.TrimPrefix(d.Id(), "/"))
 	if err != nil {
 		log.Printf("[ERROR] portgroup '%s' search failed.", pgName)
 		return nil, err
@@ -385,6 +609,8 @@ func parsePortgroupData(d *schema.ResourceData) (*vdPortgroup, error) {
 	}
 
 	pg.pgVlan = parseVlan(d)
+	pg.teaming = parsePortgroupTeaming(d)
+	pg.security = parsePortgroupSecurity(d)
 
 	return pg, nil
 }
@@ -404,7 +630,12 @@ func parseVlan(d *schema.ResourceData) (vlancfg pgVlan) {
 		}
 
 		if v, ok := vlan_infos["vlan_range"].(string); ok && v != "" {
-			vlancfg.vlanRange, _ = parseVlanRange(v)
+			vlanRange, _ := parseVlanRange(v)
+			vlancfg.vlanRange = mergeVlanRanges(vlanRange)
+		}
+
+		if v, ok := vlan_infos["inherit_from_switch"].(bool); ok {
+			vlancfg.inherit = v
 		}
 	}
 
@@ -443,10 +674,102 @@ func parseVlanRange(vlanRange string) (result []types.NumericRange, errors error
 	return result, nil
 }
 
+// mergeVlanRanges sorts the ranges and merges the overlapping and adjacent
+// ones, so equal sets of VLANs have equal ranges.
+func mergeVlanRanges(ranges []types.NumericRange) []types.NumericRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sorted := make([]types.NumericRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].End < sorted[j].End
+	})
+
+	merged := []types.NumericRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// formatVlanRange formats ranges like vlan_range, e.g. "1-5,7".
+func formatVlanRange(ranges []types.NumericRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Start == r.End {
+			parts = append(parts, strconv.Itoa(int(r.Start)))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.Start, r.End))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// suppressEquivalentVlanRange hides the diff between two vlan_range values
+// of the same VLANs, e.g. "1-5,6" and "1-6".
+func suppressEquivalentVlanRange(k, old, new string, d *schema.ResourceData) bool {
+	oldRanges, err := parseVlanRange(old)
+	if err != nil {
+		return false
+	}
+	newRanges, err := parseVlanRange(new)
+	if err != nil {
+		return false
+	}
+	return formatVlanRange(mergeVlanRanges(oldRanges)) == formatVlanRange(mergeVlanRanges(newRanges))
+}
+
+// flattenPortgroupVlan returns the vlan block of the VLAN of a portgroup.
+// An inherited VLAN is only reported as inherited.
+func flattenPortgroupVlan(spec types.BaseVmwareDistributedVirtualSwitchVlanSpec) map[string]interface{} {
+	vlan := map[string]interface{}{
+		"type":                portgroupVlanTypeNone,
+		"vlan_id":             0,
+		"vlan_range":          "",
+		"inherit_from_switch": spec.GetVmwareDistributedVirtualSwitchVlanSpec().Inherited,
+	}
+	if vlan["inherit_from_switch"].(bool) {
+		return vlan
+	}
+
+	switch s := spec.(type) {
+	case *types.VmwareDistributedVirtualSwitchVlanIdSpec:
+		if s.VlanId != 0 {
+			vlan["type"] = portgroupVlanTypeVlan
+			vlan["vlan_id"] = int(s.VlanId)
+		}
+	case *types.VmwareDistributedVirtualSwitchPvlanSpec:
+		vlan["type"] = portgroupVlanTypePVid
+		vlan["vlan_id"] = int(s.PvlanId)
+	case *types.VmwareDistributedVirtualSwitchTrunkVlanSpec:
+		vlan["type"] = portgroupVlanTypeTrunking
+		vlan["vlan_range"] = formatVlanRange(mergeVlanRanges(s.VlanId))
+	}
+	return vlan
+}
+
 func setPortSettings(vlan pgVlan) (portSettings *types.VMwareDVSPortSetting) {
 
 	portSettings = new(types.VMwareDVSPortSetting)
 
+	if vlan.inherit {
+		portSettings.Vlan = &types.VmwareDistributedVirtualSwitchVlanIdSpec{
+			InheritablePolicy: types.InheritablePolicy{Inherited: true},
+		}
+		return portSettings
+	}
+
 	switch vlan.vlanType {
 	case portgroupVlanTypeVlan:
 		vlanCnf := new(types.VmwareDistributedVirtualSwitchVlanIdSpec)
@@ -463,8 +786,12 @@ func setPortSettings(vlan pgVlan) (portSettings *types.VMwareDVSPortSetting) {
 		vlanCnf.VlanId = vlan.vlanRange
 		portSettings.Vlan = vlanCnf
 
-	// Nothing to do
+	// VLAN ID 0 clears a VLAN set before, without inheriting the one of
+	// the vDS.
 	case portgroupVlanTypeNone:
+		portSettings.Vlan = &types.VmwareDistributedVirtualSwitchVlanIdSpec{VlanId: 0}
+
+	// Nothing to do
 	default:
 	}
 
@@ -495,10 +822,42 @@ func validatePortgroupType(v interface{}, k string) (ws []string, errors []error
 		errors = append(errors, fmt.Errorf(
 			"%s: Supported values are %s", k, strings.Join(portgroupTypesList, ", ")))
 	}
+	if value == string(types.DistributedVirtualPortgroupPortgroupTypeLateBinding) {
+		ws = append(ws, fmt.Sprintf(
+			"%s: %s is deprecated since vSphere 5.0 and not supported by later vCenter releases, use %s",
+			k, value, types.DistributedVirtualPortgroupPortgroupTypeEarlyBinding))
+	}
 
 	return
 }
 
+// portgroupTypeChangeNeedsIdlePorts reports whether vCenter only allows the
+// change of the port binding while no virtual machine is connected, which is
+// the case for changes from or to ephemeral binding.
+func portgroupTypeChangeNeedsIdlePorts(oldType string, newType string) bool {
+	ephemeral := string(types.DistributedVirtualPortgroupPortgroupTypeEphemeral)
+	return oldType != newType && (oldType == ephemeral || newType == ephemeral)
+}
+
+// validatePortgroupTypeChange refuses a change of portgroup_type vCenter
+// would fail with an opaque fault while the portgroup is in use.
+func validatePortgroupTypeChange(dvsPortGrp *object.DistributedVirtualPortgroup, oldType string, newType string) error {
+	if !portgroupTypeChangeNeedsIdlePorts(oldType, newType) {
+		return nil
+	}
+
+	var mopg mo.DistributedVirtualPortgroup
+	err := dvsPortGrp.Properties(context.TODO(), dvsPortGrp.Reference(), []string{"vm"}, &mopg)
+	if err != nil {
+		return err
+	}
+	if len(mopg.Vm) > 0 {
+		return fmt.Errorf("portgroup_type cannot be changed from '%s' to '%s' while %d virtual machine(s) "+
+			"are connected to the portgroup, disconnect them first", oldType, newType, len(mopg.Vm))
+	}
+	return nil
+}
+
 func validateVlanId(v interface{}, k string) (ws []string, errors []error) {
 
 	vlanId := v.(int)
@@ -567,6 +926,17 @@ func validateVlanType(v interface{}, k string) (ws []string, errors []error) {
 
 func validatePortgroupConfigs(pg *vdPortgroup) error {
 
+	// Ports of ephemeral portgroups are created on demand, vCenter rejects
+	// a port count for them.
+	if pg.portgroupType == string(types.DistributedVirtualPortgroupPortgroupTypeEphemeral) &&
+		pg.numPorts != portgroupNumPortsDefault {
+		return fmt.Errorf("num_ports cannot be set for the portgroup type '%s'", pg.portgroupType)
+	}
+
+	if pg.inherit && (pg.vlanType != portgroupVlanTypeNone || pg.vlanId != 0 || len(pg.vlanRange) > 0) {
+		return fmt.Errorf("vlan: type, vlan_id and vlan_range cannot be set with inherit_from_switch")
+	}
+
 	switch pg.vlanType {
 	case portgroupVlanTypeVlan, portgroupVlanTypePVid:
 		if pg.vlanId == 0 {
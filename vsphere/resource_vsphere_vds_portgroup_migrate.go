@@ -0,0 +1,46 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func resourceVSphereVdPortgroupMigrateState(
+	v int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if is.Empty() {
+		log.Println("[DEBUG] Empty InstanceState; nothing to migrate.")
+		return is, nil
+	}
+
+	switch v {
+	case 0:
+		// Version 1 is the first released schema, there is nothing to do.
+		// Upgrades to later versions chain from here.
+		log.Println("[INFO] Found vDS Portgroup State v0; migrating to v1")
+		fallthrough
+	case 1:
+		// The ID was the inventory path as the finder returned it.
+		log.Println("[INFO] Found vDS Portgroup State v1; migrating to v2")
+		if is.ID != "" {
+			is.ID = canonicalInventoryPath(is.ID)
+		}
+		fallthrough
+	case 2:
+		log.Println("[INFO] Found vDS Portgroup State v2; migrating to v3")
+		if is.Attributes == nil {
+			return is, nil
+		}
+		if err := migrateInventoryPathToMoid(is, meta); err != nil {
+			return is, err
+		}
+		fallthrough
+	case 3:
+		// permission turned from a list into a set.
+		log.Println("[INFO] Found vDS Portgroup State v3; migrating to v4")
+		return is, migratePermissionListToSet(is)
+	default:
+		return is, fmt.Errorf("Unexpected schema version: %d", v)
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/vim25/types"
 	"golang.org/x/net/context"
@@ -113,7 +113,7 @@ func TestAccVSphereVdsPortgroup_UpdateOperation(t *testing.T) {
 }
 
 func testAccCheckVdsPortGroupDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*govmomi.Client)
+	client := testAccProvider.Meta().(*VSphereClient).vimClient
 	finder := find.NewFinder(client.Client, true)
 
 	for _, rs := range s.RootModule().Resources {
@@ -166,6 +166,8 @@ func TestAccVSphereVdsPortgroup_validatorFunc(t *testing.T) {
 			values: []attributeProperty{
 				{value: "Unknown", expErr: "Supported values are"},
 				{value: string(types.DistributedVirtualPortgroupPortgroupTypeEarlyBinding), successCase: true},
+				{value: string(types.DistributedVirtualPortgroupPortgroupTypeEphemeral), successCase: true},
+				{value: string(types.DistributedVirtualPortgroupPortgroupTypeLateBinding), expErr: "is deprecated"},
 			},
 		},
 		{name: "vlan_id", validatorFn: validateVlanId,
@@ -203,6 +205,28 @@ func TestAccVSphereVdsPortgroup_validatorFunc(t *testing.T) {
 	verifySchemaValidationFunctions(t, validatorCases)
 }
 
+func TestAccVSphereVdsPortgroup_typeChange(t *testing.T) {
+	early := string(types.DistributedVirtualPortgroupPortgroupTypeEarlyBinding)
+	late := string(types.DistributedVirtualPortgroupPortgroupTypeLateBinding)
+	ephemeral := string(types.DistributedVirtualPortgroupPortgroupTypeEphemeral)
+
+	cases := []struct {
+		oldType, newType string
+		expected         bool
+	}{
+		{early, late, false},
+		{late, early, false},
+		{early, ephemeral, true},
+		{ephemeral, early, true},
+		{ephemeral, ephemeral, false},
+	}
+	for _, tc := range cases {
+		if got := portgroupTypeChangeNeedsIdlePorts(tc.oldType, tc.newType); got != tc.expected {
+			t.Fatalf("change from %s to %s: expected %t, got %t", tc.oldType, tc.newType, tc.expected, got)
+		}
+	}
+}
+
 func testAccPreCheckVdsPg(t *testing.T) {
 
 	var envList = []string{"VSPHERE_DATACENTER", "VSPHERE_VDS_NAME"}
@@ -215,3 +239,125 @@ func testAccPreCheckVdsPg(t *testing.T) {
 		}
 	}
 }
+
+func TestAccVSphereVdsPortgroup_inheritFromSwitch(t *testing.T) {
+	settings := setPortSettings(pgVlan{vlanType: portgroupVlanTypeNone, inherit: true})
+	vlan, ok := settings.Vlan.(*types.VmwareDistributedVirtualSwitchVlanIdSpec)
+	if !ok || !vlan.Inherited {
+		t.Fatalf("expected the VLAN to be inherited, got %#v", settings.Vlan)
+	}
+	settings = setPortSettings(pgVlan{vlanType: portgroupVlanTypeNone})
+	vlan, ok = settings.Vlan.(*types.VmwareDistributedVirtualSwitchVlanIdSpec)
+	if !ok || vlan.Inherited || vlan.VlanId != 0 {
+		t.Fatalf("expected type none to clear the VLAN, got %#v", settings.Vlan)
+	}
+	if settings := setPortSettings(pgVlan{}); settings.Vlan != nil {
+		t.Fatalf("expected no VLAN without a vlan block, got %#v", settings.Vlan)
+	}
+
+	var teaming *pgTeaming
+	if !teaming.teamingPolicy().Inherited {
+		t.Fatal("expected a removed teaming block to inherit the policy")
+	}
+	teaming = &pgTeaming{policy: portgroupTeamingFailoverExplicit, activeUplinks: []string{"uplink1"}, failback: false}
+	policy := teaming.teamingPolicy()
+	if policy.Inherited || policy.Policy.Value != portgroupTeamingFailoverExplicit || !*policy.RollingOrder.Value {
+		t.Fatalf("unexpected teaming policy %#v", policy)
+	}
+	teaming.inherit = true
+	if !teaming.teamingPolicy().Inherited {
+		t.Fatal("expected inherit_from_switch to inherit the teaming policy")
+	}
+
+	security := &pgSecurity{allowPromiscuous: true}
+	sp := security.securityPolicy()
+	if sp.Inherited || !*sp.AllowPromiscuous.Value || *sp.MacChanges.Value {
+		t.Fatalf("unexpected security policy %#v", sp)
+	}
+	security.inherit = true
+	if !security.securityPolicy().Inherited {
+		t.Fatal("expected inherit_from_switch to inherit the security policy")
+	}
+
+	flat := flattenPortgroupTeaming(policy)
+	if flat["inherit_from_switch"].(bool) || flat["policy"] != portgroupTeamingFailoverExplicit ||
+		flat["failback"].(bool) || !reflect.DeepEqual(flat["active_uplinks"], []string{"uplink1"}) {
+		t.Fatalf("unexpected teaming block %#v", flat)
+	}
+	if !flattenPortgroupTeaming((*pgTeaming)(nil).teamingPolicy())["inherit_from_switch"].(bool) {
+		t.Fatal("expected an inherited teaming policy to be read as inherited")
+	}
+	if flat := flattenPortgroupSecurity(sp); flat["inherit_from_switch"].(bool) || !flat["allow_promiscuous"].(bool) {
+		t.Fatalf("unexpected security block %#v", flat)
+	}
+	if !flattenPortgroupSecurity(security.securityPolicy())["inherit_from_switch"].(bool) {
+		t.Fatal("expected an inherited security policy to be read as inherited")
+	}
+
+	err := validatePortgroupConfigs(&vdPortgroup{pgVlan: pgVlan{vlanType: portgroupVlanTypeVlan, vlanId: 10, inherit: true}})
+	if err == nil {
+		t.Fatal("expected an error for a VLAN ID with inherit_from_switch")
+	}
+}
+
+func TestAccVSphereVdsPortgroup_vlanRangeNormalization(t *testing.T) {
+	cases := []struct {
+		old, new string
+		equal    bool
+	}{
+		{"1-5,6", "1-6", true},
+		{"10-20,1-5", "1-5,10-20", true},
+		{"1-10,5-7", "1-10", true},
+		{"1-5,7", "1-7", false},
+		{"100", "100-100", true},
+		{"1-5", "1-6", false},
+	}
+	for _, tc := range cases {
+		if got := suppressEquivalentVlanRange("vlan.0.vlan_range", tc.old, tc.new, nil); got != tc.equal {
+			t.Fatalf("%q and %q: expected equal to be %t, got %t", tc.old, tc.new, tc.equal, got)
+		}
+	}
+
+	ranges, _ := parseVlanRange("30,1-5,6,10-12,11")
+	if got := formatVlanRange(mergeVlanRanges(ranges)); got != "1-6,10-12,30" {
+		t.Fatalf("expected 1-6,10-12,30, got %s", got)
+	}
+}
+
+func TestAccVSphereVdsPortgroup_flattenVlan(t *testing.T) {
+	cases := []struct {
+		spec     types.BaseVmwareDistributedVirtualSwitchVlanSpec
+		expected map[string]interface{}
+	}{
+		{
+			spec:     &types.VmwareDistributedVirtualSwitchVlanIdSpec{VlanId: 0},
+			expected: map[string]interface{}{"type": "none", "vlan_id": 0, "vlan_range": "", "inherit_from_switch": false},
+		},
+		{
+			spec:     &types.VmwareDistributedVirtualSwitchVlanIdSpec{VlanId: 100},
+			expected: map[string]interface{}{"type": "vlan", "vlan_id": 100, "vlan_range": "", "inherit_from_switch": false},
+		},
+		{
+			spec:     &types.VmwareDistributedVirtualSwitchPvlanSpec{PvlanId: 200},
+			expected: map[string]interface{}{"type": "pvlan", "vlan_id": 200, "vlan_range": "", "inherit_from_switch": false},
+		},
+		{
+			spec: &types.VmwareDistributedVirtualSwitchTrunkVlanSpec{VlanId: []types.NumericRange{
+				{Start: 6, End: 6}, {Start: 1, End: 5},
+			}},
+			expected: map[string]interface{}{"type": "trunking", "vlan_id": 0, "vlan_range": "1-6", "inherit_from_switch": false},
+		},
+		{
+			spec: &types.VmwareDistributedVirtualSwitchVlanIdSpec{
+				InheritablePolicy: types.InheritablePolicy{Inherited: true},
+				VlanId:            100,
+			},
+			expected: map[string]interface{}{"type": "none", "vlan_id": 0, "vlan_range": "", "inherit_from_switch": true},
+		},
+	}
+	for _, tc := range cases {
+		if got := flattenPortgroupVlan(tc.spec); !reflect.DeepEqual(got, tc.expected) {
+			t.Fatalf("%#v: expected %#v, got %#v", tc.spec, tc.expected, got)
+		}
+	}
+}
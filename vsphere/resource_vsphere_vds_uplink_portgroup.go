@@ -0,0 +1,242 @@
+package vsphere
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vsphere_vds_uplink_portgroup controls the name of the uplink portgroup
+// vCenter creates with a vDS, e.g. "dvs1-DVUplinks-123". The portgroup is
+// owned by the switch, so destroying the resource only restores its
+// original name.
+
+func resourceVSphereVdsUplinkPortgroup() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceVSphereVdsUplinkPortgroupCreate,
+		Read:   resourceVSphereVdsUplinkPortgroupRead,
+		Update: resourceVSphereVdsUplinkPortgroupUpdate,
+		Delete: resourceVSphereVdsUplinkPortgroupDelete,
+
+		Timeouts: resourceTimeouts(),
+
+		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
+			"datacenter": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDatacenterName,
+				StateFunc:    datacenterNameStateFunc,
+			},
+
+			"vds_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"name": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"name_format"},
+			},
+
+			"name_format": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"name"},
+				ValidateFunc:  validateUplinkPortgroupNameFormat,
+				Description:   "Name of the uplink portgroup with %s standing for the name of the vDS, e.g. \"%s-uplinks\".",
+			},
+
+			// The name vCenter gave the portgroup, which is restored on
+			// destroy.
+			"original_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"key": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func validateUplinkPortgroupNameFormat(v interface{}, k string) (ws []string, errors []error) {
+	if strings.Count(v.(string), "%s") != 1 {
+		errors = append(errors, fmt.Errorf("%s: %q has to contain %%s exactly once", k, v.(string)))
+	}
+	return
+}
+
+// uplinkPortgroupName returns the configured name of the uplink portgroup.
+func uplinkPortgroupName(d *schema.ResourceData) (string, error) {
+	if v, ok := d.GetOk("name_format"); ok {
+		return strings.Replace(v.(string), "%s", d.Get("vds_name").(string), 1), nil
+	}
+	if v, ok := d.GetOk("name"); ok {
+		return v.(string), nil
+	}
+	return "", fmt.Errorf("one of name or name_format must be set")
+}
+
+// findUplinkPortgroup returns the uplink portgroup of the vDS.
+func findUplinkPortgroup(client *VSphereClient, datacenter string, vdsName string) (types.ManagedObjectReference, error) {
+	netRef, err := findNetObjectByName(datacenter, vdsName, client)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	var mdvs mo.DistributedVirtualSwitch
+	collector := property.DefaultCollector(client.vimClient.Client)
+	if err := collector.RetrieveOne(context.TODO(), netRef.Reference(), []string{"config.uplinkPortgroup"}, &mdvs); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if mdvs.Config == nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("%s is not a vDS", vdsName)
+	}
+	uplinks := mdvs.Config.GetDVSConfigInfo().UplinkPortgroup
+	if len(uplinks) != 1 {
+		return types.ManagedObjectReference{}, fmt.Errorf("vDS %s has %d uplink portgroups, expected one", vdsName, len(uplinks))
+	}
+	return uplinks[0], nil
+}
+
+// renameUplinkPortgroup renames the portgroup and waits for the task.
+func renameUplinkPortgroup(d *schema.ResourceData, client *VSphereClient, ref types.ManagedObjectReference, name string, timeout string) error {
+	req := types.Rename_Task{
+		This:    ref,
+		NewName: name,
+	}
+	res, err := methods.Rename_Task(context.TODO(), client.vimClient, &req)
+	if err != nil {
+		return translateVSphereError(err, fmt.Sprintf("uplink portgroup %s", ref.Value))
+	}
+	ctx, cancel := taskContext(d.Timeout(timeout))
+	defer cancel()
+	task := object.NewTask(client.vimClient.Client, res.Returnval)
+	_, err = task.WaitForResult(ctx, nil)
+	if err != nil {
+		err = taskTimeoutError(ctx, err, "rename uplink portgroup to "+name, d.Timeout(timeout))
+		return translateVSphereError(err, fmt.Sprintf("uplink portgroup %s", ref.Value))
+	}
+	client.invalidateCache()
+	return nil
+}
+
+func resourceVSphereVdsUplinkPortgroupCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_uplink_portgroup", resourceLogName(d, "vds_name"), "create")
+	client := meta.(*VSphereClient)
+
+	name, err := uplinkPortgroupName(d)
+	if err != nil {
+		return err
+	}
+	ref, err := findUplinkPortgroup(client, d.Get("datacenter").(string), d.Get("vds_name").(string))
+	if err != nil {
+		return err
+	}
+
+	var mopg mo.DistributedVirtualPortgroup
+	collector := property.DefaultCollector(client.vimClient.Client)
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"name"}, &mopg); err != nil {
+		return err
+	}
+	d.Set("original_name", mopg.Name)
+
+	if mopg.Name != name {
+		logger.Infof("Renaming uplink portgroup %s to %s", mopg.Name, name)
+		if err := renameUplinkPortgroup(d, client, ref, name, schema.TimeoutCreate); err != nil {
+			return err
+		}
+	}
+	d.SetId(ref.Value)
+
+	return resourceVSphereVdsUplinkPortgroupRead(d, meta)
+}
+
+func resourceVSphereVdsUplinkPortgroupRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_uplink_portgroup", resourceLogName(d, "vds_name"), "read")
+	client := meta.(*VSphereClient)
+
+	var mopg mo.DistributedVirtualPortgroup
+	ref := types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: d.Id()}
+	collector := property.DefaultCollector(client.vimClient.Client)
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"name", "key"}, &mopg); err != nil {
+		if isManagedObjectNotFoundError(err) {
+			logger.Warnf("uplink portgroup %s is gone, removing it from state", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+
+	// With name_format the name follows from the vDS name, a different name
+	// shows as a change of name_format.
+	if _, ok := d.GetOk("name_format"); !ok {
+		d.Set("name", mopg.Name)
+	} else if name, _ := uplinkPortgroupName(d); name != mopg.Name {
+		d.Set("name_format", "")
+	}
+	d.Set("key", mopg.Key)
+	return nil
+}
+
+func resourceVSphereVdsUplinkPortgroupUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_uplink_portgroup", resourceLogName(d, "vds_name"), "update")
+	client := meta.(*VSphereClient)
+
+	name, err := uplinkPortgroupName(d)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Renaming uplink portgroup %s to %s", d.Id(), name)
+	ref := types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: d.Id()}
+	if err := renameUplinkPortgroup(d, client, ref, name, schema.TimeoutUpdate); err != nil {
+		return err
+	}
+
+	return resourceVSphereVdsUplinkPortgroupRead(d, meta)
+}
+
+func resourceVSphereVdsUplinkPortgroupDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vds_uplink_portgroup", resourceLogName(d, "vds_name"), "delete")
+	client := meta.(*VSphereClient)
+
+	original := d.Get("original_name").(string)
+	if original != "" {
+		logger.Infof("Restoring the name %s of uplink portgroup %s", original, d.Id())
+		ref := types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: d.Id()}
+		err := renameUplinkPortgroup(d, client, ref, original, schema.TimeoutDelete)
+		if err != nil && !isManagedObjectNotFoundError(err) {
+			return err
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
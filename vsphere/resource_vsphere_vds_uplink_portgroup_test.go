@@ -0,0 +1,38 @@
+package vsphere
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestAccVSphereVdsUplinkPortgroup_name(t *testing.T) {
+	r := resourceVSphereVdsUplinkPortgroup()
+	cases := []struct {
+		raw  map[string]interface{}
+		name string
+	}{
+		{map[string]interface{}{"vds_name": "dvs1", "name": "uplinks"}, "uplinks"},
+		{map[string]interface{}{"vds_name": "dvs1", "name_format": "%s-uplinks"}, "dvs1-uplinks"},
+		{map[string]interface{}{"vds_name": "dvs1"}, ""},
+	}
+	for _, c := range cases {
+		d := schema.TestResourceDataRaw(t, r.Schema, c.raw)
+		name, err := uplinkPortgroupName(d)
+		if c.name == "" {
+			if err == nil {
+				t.Fatalf("expected an error without name or name_format, got %q", name)
+			}
+			continue
+		}
+		if err != nil || name != c.name {
+			t.Fatalf("expected %q, got %q (%v)", c.name, name, err)
+		}
+	}
+
+	for _, format := range []string{"uplinks", "%s-%s"} {
+		if _, errs := validateUplinkPortgroupNameFormat(format, "name_format"); len(errs) == 0 {
+			t.Fatalf("expected name_format %q to be invalid", format)
+		}
+	}
+}
@@ -31,6 +31,9 @@ func resourceVSphereVirtualDisk() *schema.Resource {
 		Delete: resourceVSphereVirtualDiskDelete,
 
 		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
 			// Size in GB
 			"size": &schema.Schema{
 				Type:     schema.TypeInt,
@@ -90,8 +93,12 @@ func resourceVSphereVirtualDisk() *schema.Resource {
 }
 
 func resourceVSphereVirtualDiskCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+
 	log.Printf("[INFO] Creating Virtual Disk")
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient).vimClient
 
 	vDisk := virtualDisk{
 		size: d.Get("size").(int),
@@ -117,22 +124,19 @@ func resourceVSphereVirtualDiskCreate(d *schema.ResourceData, meta interface{})
 		vDisk.datastore = v.(string)
 	}
 
-	finder := find.NewFinder(client.Client, true)
-
-	dc, err := getDatacenter(client, d.Get("datacenter").(string))
+	dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
 	if err != nil {
 		return fmt.Errorf("Error finding Datacenter: %s: %s", vDisk.datacenter, err)
 	}
-	finder = finder.SetDatacenter(dc)
 
-	ds, err := getDatastore(finder, vDisk.datastore)
+	ds, err := meta.(*VSphereClient).getDatastore(dc, vDisk.datastore)
 	if err != nil {
 		return fmt.Errorf("Error finding Datastore: %s: %s", vDisk.datastore, err)
 	}
 
 	err = createHardDisk(client, vDisk.size, ds.Path(vDisk.vmdkPath), vDisk.initType, vDisk.adapterType, vDisk.datacenter)
 	if err != nil {
-		return err
+		return translateVSphereError(err, fmt.Sprintf("virtual disk %s", ds.Path(vDisk.vmdkPath)))
 	}
 
 	d.SetId(ds.Path(vDisk.vmdkPath))
@@ -142,8 +146,12 @@ func resourceVSphereVirtualDiskCreate(d *schema.ResourceData, meta interface{})
 }
 
 func resourceVSphereVirtualDiskRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+
 	log.Printf("[DEBUG] Reading virtual disk.")
-	client := meta.(*govmomi.Client)
+	client := meta.(*VSphereClient).vimClient
 
 	vDisk := virtualDisk{
 		size: d.Get("size").(int),
@@ -256,7 +264,10 @@ func resourceVSphereVirtualDiskRead(d *schema.ResourceData, meta interface{}) er
 }
 
 func resourceVSphereVirtualDiskDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*govmomi.Client)
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	client := meta.(*VSphereClient).vimClient
 
 	vDisk := virtualDisk{}
 
@@ -267,15 +278,12 @@ func resourceVSphereVirtualDiskDelete(d *schema.ResourceData, meta interface{})
 		vDisk.datastore = v.(string)
 	}
 
-	dc, err := getDatacenter(client, d.Get("datacenter").(string))
+	dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
 	if err != nil {
 		return err
 	}
 
-	finder := find.NewFinder(client.Client, true)
-	finder = finder.SetDatacenter(dc)
-
-	ds, err := getDatastore(finder, vDisk.datastore)
+	ds, err := meta.(*VSphereClient).getDatastore(dc, vDisk.datastore)
 	if err != nil {
 		return err
 	}
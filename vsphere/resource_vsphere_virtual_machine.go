@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/vmware/govmomi"
@@ -43,6 +44,12 @@ type hardDisk struct {
 	vmdkPath   string
 	controller string
 	bootable   bool
+
+	// controllerNumber and unitNumber place disks with controller type
+	// "scsi" on a given controller and unit. A unit number of 0 picks
+	// the next free unit.
+	controllerNumber int32
+	unitNumber       int32
 }
 
 //Additional options Vsphere can use clones of windows machines
@@ -52,6 +59,22 @@ type windowsOptConfig struct {
 	domainUser         string
 	domain             string
 	domainUserPassword string
+	runOnceCommands    []string
+}
+
+// validateDomainJoin checks that a domain join has the domain and the
+// credentials of its administrator, instead of silently not joining.
+func (w windowsOptConfig) validateDomainJoin() error {
+	set := 0
+	for _, v := range []string{w.domain, w.domainUser, w.domainUserPassword} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 0 && set < 3 {
+		return fmt.Errorf("windows_opt_config: joining a domain needs domain, domain_admin_user and domain_admin_password")
+	}
+	return nil
 }
 
 type cdrom struct {
@@ -59,10 +82,6 @@ type cdrom struct {
 	path      string
 }
 
-type memoryAllocation struct {
-	reservation int64
-}
-
 type virtualMachine struct {
 	name                  string
 	folder                string
@@ -72,11 +91,19 @@ type virtualMachine struct {
 	datastore             string
 	vcpu                  int32
 	memoryMb              int64
-	memoryAllocation      memoryAllocation
+	cpuAllocation         resourceAllocation
+	memoryAllocation      resourceAllocation
+	latencySensitivity    string
+	scsiType              string
+	scsiControllerCount   int
+	guestID               string
 	template              string
 	networkInterfaces     []networkInterface
 	hardDisks             []hardDisk
 	cdroms                []cdrom
+	serialPorts           []serialPort
+	usb                   *usbConfig
+	guestAuth             *types.NamePasswordAuthentication
 	domain                string
 	timeZone              string
 	dnsSuffixes           []string
@@ -85,9 +112,35 @@ type virtualMachine struct {
 	linkedClone           bool
 	skipCustomization     bool
 	enableDiskUUID        bool
+	annotation            string
 	windowsOptionalConfig windowsOptConfig
 	customConfigurations  map[string](types.AnyType)
-	permission            *userPermission
+	permission            *resourcePermission
+	bootOptions           *bootOptions
+	faultTolerance        *faultTolerance
+	clusterOverrides      *clusterVmOverrides
+
+	// templateDiskDatastores places disks of the template on datastores
+	// other than the one of the clone.
+	templateDiskDatastores []diskDatastore
+
+	// templateSnapshot is the name or ID of the snapshot of the template
+	// the virtual machine is cloned from.
+	templateSnapshot string
+
+	// host pins the initial placement to an ESXi host.
+	host string
+
+	// postCustomizationCommands run in the guest after the customization.
+	postCustomizationCommands []string
+
+	// networkVerification probes the static addresses once the VM is up.
+	networkVerification *networkVerification
+
+	// taskCtx bounds the task waits of the running operation by the
+	// timeout the user configured for it.
+	taskCtx     context.Context
+	taskTimeout time.Duration
 }
 
 func (v virtualMachine) Path() string {
@@ -103,16 +156,21 @@ func vmPath(folder string, name string) string {
 }
 
 func resourceVSphereVirtualMachine() *schema.Resource {
-	return &schema.Resource{
+	r := &schema.Resource{
 		Create: resourceVSphereVirtualMachineCreate,
 		Read:   resourceVSphereVirtualMachineRead,
 		Update: resourceVSphereVirtualMachineUpdate,
 		Delete: resourceVSphereVirtualMachineDelete,
 
-		SchemaVersion: 1,
+		SchemaVersion: 3,
 		MigrateState:  resourceVSphereVirtualMachineMigrateState,
 
+		Timeouts: resourceTimeouts(),
+
 		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
 			"name": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
@@ -120,9 +178,12 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 			},
 
 			"folder": &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateFolderPath,
+				StateFunc:    folderPathStateFunc,
 			},
 
 			"vcpu": &schema.Schema{
@@ -135,17 +196,12 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 				Required: true,
 			},
 
-			"memory_reservation": &schema.Schema{
-				Type:     schema.TypeInt,
-				Optional: true,
-				Default:  0,
-				ForceNew: true,
-			},
-
 			"datacenter": &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDatacenterName,
+				StateFunc:    datacenterNameStateFunc,
 			},
 
 			"cluster": &schema.Schema{
@@ -154,9 +210,17 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 				ForceNew: true,
 			},
 
+			"host": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "ESXi host the virtual machine is initially placed on, relative to the cluster if set.",
+			},
+
 			"resource_pool": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
 				ForceNew: true,
 			},
 
@@ -166,6 +230,13 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 				Default:  false,
 				ForceNew: true,
 			},
+			"template_disk_datastore": templateDiskDatastoreSchema(false),
+			"template_snapshot": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Name or ID of the snapshot of the template to clone from, instead of its current state.",
+			},
 			"gateway": &schema.Schema{
 				Type:       schema.TypeString,
 				Optional:   true,
@@ -220,6 +291,28 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 				Computed: true,
 			},
 
+			"annotation": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			"guest_id": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateGuestID,
+			},
+
+			"guest_full_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"guest_family": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
 			"custom_configuration_parameters": &schema.Schema{
 				Type:     schema.TypeMap,
 				Optional: true,
@@ -239,12 +332,21 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 						},
 
 						"admin_password": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:      schema.TypeString,
+							Optional:  true,
+							ForceNew:  true,
+							Sensitive: true,
 						},
 
 						"domain_user": &schema.Schema{
+							Type:          schema.TypeString,
+							Optional:      true,
+							ForceNew:      true,
+							Deprecated:    "Please use domain_admin_user",
+							ConflictsWith: []string{"windows_opt_config.0.domain_admin_user"},
+						},
+
+						"domain_admin_user": &schema.Schema{
 							Type:     schema.TypeString,
 							Optional: true,
 							ForceNew: true,
@@ -257,16 +359,48 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 						},
 
 						"domain_user_password": &schema.Schema{
-							Type:     schema.TypeString,
+							Type:          schema.TypeString,
+							Optional:      true,
+							ForceNew:      true,
+							Sensitive:     true,
+							Deprecated:    "Please use domain_admin_password",
+							ConflictsWith: []string{"windows_opt_config.0.domain_admin_password"},
+						},
+
+						"domain_admin_password": &schema.Schema{
+							Type:      schema.TypeString,
+							Optional:  true,
+							ForceNew:  true,
+							Sensitive: true,
+						},
+
+						// Commands run at the first logon of the guest.
+						"run_once_commands": &schema.Schema{
+							Type:     schema.TypeList,
 							Optional: true,
 							ForceNew: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
 						},
 					},
 				},
 			},
 
+			"post_customization_commands": postCustomizationCommandsSchema(),
+
+			"network_verification": networkVerificationSchema(),
+
+			"customization_trigger": customizationTriggerSchema(),
+
 			"network_interface": networkInterfaceSchema(),
 
+			// Index of the network interface whose address is used to connect
+			// to the guest.
+			"connection_interface_index": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validateConnectionInterfaceIndex,
+			},
+
 			"disk": &schema.Schema{
 				Type:     schema.TypeSet,
 				Required: true,
@@ -356,10 +490,60 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 								return
 							},
 						},
+
+						"guest_resize_command": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Command run in the guest with guest_credentials after the disk was grown, e.g. to extend its partition and file system.",
+						},
+
+						"guest_resize_template": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateGuestResizeTemplate,
+							Description:  "Built-in command run in the guest instead of guest_resize_command: growpart for Linux, also growing LVM logical volumes, diskpart for Windows.",
+						},
+
+						"guest_resize_target": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Mount point (growpart, default /) or drive letter (diskpart, default C) extended by guest_resize_template.",
+						},
+
+						"controller_number": &schema.Schema{
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateDiskControllerNumber,
+							Description:  "Bus number of the scsi_type controller of a disk with controller_type scsi.",
+						},
+
+						"unit_number": &schema.Schema{
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateDiskUnitNumber,
+							Description:  "Unit of a disk with controller_type scsi on its controller. The next free unit is used when unset.",
+						},
 					},
 				},
 			},
 
+			"guest_credentials": guestCredentialsSchema(),
+
+			"scsi_type": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateScsiType,
+			},
+
+			"scsi_controller_count": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateScsiControllerCount,
+			},
+
 			"detach_unknown_disks_on_delete": &schema.Schema{
 				Type:     schema.TypeBool,
 				Optional: true,
@@ -386,9 +570,59 @@ func resourceVSphereVirtualMachine() *schema.Resource {
 					},
 				},
 			},
+			"serial_port": serialPortSchema(),
+
+			"usb_controller": usbControllerSchema(),
+
+			"usb_device": usbDeviceSchema(),
+
 			"permission": permissionSchema(),
+
+			"boot_options": bootOptionsSchema(),
+
+			"fault_tolerance": faultToleranceSchema(),
+
+			"archive_on_destroy": archiveOnDestroySchema(),
+
+			"fault_tolerance_state": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"drs_automation_level": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateDrsAutomationLevel,
+			},
+
+			"ha_restart_priority": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateHaRestartPriority,
+			},
+
+			"ha_isolation_response": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateHaIsolationResponse,
+			},
+
+			"latency_sensitivity": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      string(types.LatencySensitivitySensitivityLevelNormal),
+				ValidateFunc: validateLatencySensitivity,
+			},
 		},
 	}
+
+	for _, prefix := range []string{"cpu", "memory"} {
+		for k, v := range resourceAllocationSchema(prefix) {
+			r.Schema[k] = v
+		}
+	}
+
+	return r
 }
 
 func prepareVMforUpdate(d *schema.ResourceData) *virtualMachine {
@@ -428,6 +662,10 @@ func prepareVMforUpdate(d *schema.ResourceData) *virtualMachine {
 }
 
 func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_virtual_machine", resourceLogName(d, "name"), "update")
 	// flag if changes have to be applied
 	hasChanges := false
 	// flag to mark cpu, memory or disk changes
@@ -437,19 +675,26 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 	customizationReq := false
 	var identity_options types.BaseCustomizationIdentitySettings
 	var netConf []types.CustomizationAdapterMapping
+	var guestResizeCommands []string
+	var diskMigrations []diskMigration
+	guestAuth := parseGuestCredentials(d)
+
+	if err := meta.(*VSphereClient).requireFeatures(virtualMachineFeatures(d)...); err != nil {
+		return err
+	}
 
 	// make config spec
 	configSpec := types.VirtualMachineConfigSpec{}
 
-	client := meta.(*govmomi.Client)
-	dc, err := getDatacenter(client, d.Get("datacenter").(string))
+	client := meta.(*VSphereClient).vimClient
+	dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
 	if err != nil {
 		return err
 	}
 	finder := find.NewFinder(client.Client, true)
 	finder = finder.SetDatacenter(dc)
 
-	vm, err := finder.VirtualMachine(context.TODO(), vmPath(d.Get("folder").(string), d.Get("name").(string)))
+	vm, err := finder.VirtualMachine(context.TODO(), vmPath(normalizeFolderPath(d.Get("folder").(string)), d.Get("name").(string)))
 	if err != nil {
 		return err
 	}
@@ -457,15 +702,44 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 	// Read the VM properties (memory and cpu hot add properties)
 	var mov mo.VirtualMachine
 	collector := property.DefaultCollector(client.Client)
-	if err := collector.RetrieveOne(context.TODO(), vm.Reference(), []string{"summary", "config"}, &mov); err != nil {
+	if err := collector.RetrieveOne(context.TODO(), vm.Reference(), []string{"summary", "config", "environmentBrowser"}, &mov); err != nil {
 		return err
 	}
 
+	// All device changes go into configSpec and are applied with a single
+	// reconfiguration. devices tracks the devices the VM will have, so new
+	// devices get distinct keys and unit numbers.
+	devices := object.VirtualDeviceList(mov.Config.Hardware.Device)
+
+	if d.HasChange("archive_on_destroy") {
+		if _, err := parseOvfArchiveData(d); err != nil {
+			return err
+		}
+	}
+
 	// prepare VM struct for update
 	vmUpdateConf := prepareVMforUpdate(d)
 
+	var cancel context.CancelFunc
+	vmUpdateConf.taskTimeout = d.Timeout(schema.TimeoutUpdate)
+	vmUpdateConf.taskCtx, cancel = taskContext(vmUpdateConf.taskTimeout)
+	defer cancel()
+
+	// A changed bandwidth allocation edits the NICs in place.
+	bandwidthChanges, bandwidthOnly, err := nicBandwidthChanges(d, devices)
+	if err != nil {
+		return err
+	}
+	if d.HasChange("network_interface") && bandwidthOnly {
+		hasChanges = true
+		if len(bandwidthChanges) > 0 {
+			configSpec.DeviceChange = append(configSpec.DeviceChange, bandwidthChanges...)
+			cpuMemDiskHasChanges = true
+		}
+	}
+
 	// Handle nic changes
-	if d.HasChange("network_interface") {
+	if d.HasChange("network_interface") && !bandwidthOnly {
 
 		hasChanges = true
 
@@ -473,17 +747,38 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 		netUpdateMap["rebootRequired"] = false
 		netUpdateMap["customizationReq"] = false
 		netUpdateMap["vmUpdateConf"] = vmUpdateConf
-		netUpdateMap["vmMO"] = vm
+		netUpdateMap["devices"] = devices
 
 		if nerr := handleNetworkUpdate(d, netUpdateMap, finder); nerr != nil {
 			return nerr
 		}
+		if len(vmUpdateConf.networkRoutes()) > 0 && guestAuth == nil {
+			return fmt.Errorf("guest_credentials are required to add the routes of the network interfaces")
+		}
 
-		log.Printf("[DEBUG] returned netUpdateMap: %+v", netUpdateMap)
+		logger.Debugf("returned netUpdateMap: %+v", netUpdateMap)
 		netConf = netUpdateMap["netConf"].([]types.CustomizationAdapterMapping)
 		rebootRequired = netUpdateMap["rebootRequired"].(bool)
 		customizationReq = netUpdateMap["customizationReq"].(bool)
 		identity_options = netUpdateMap["identity_options"].(types.BaseCustomizationIdentitySettings)
+		devices = netUpdateMap["devices"].(object.VirtualDeviceList)
+		if deviceChange := netUpdateMap["deviceChange"].([]types.BaseVirtualDeviceConfigSpec); len(deviceChange) > 0 {
+			configSpec.DeviceChange = append(configSpec.DeviceChange, deviceChange...)
+			cpuMemDiskHasChanges = true
+		}
+	}
+
+	// Changed network interfaces are customized already.
+	if d.HasChange("customization_trigger") && !customizationReq {
+		identity, conf, err := vmUpdateConf.recustomization(d, mov.Config.GuestId)
+		if err != nil {
+			return err
+		}
+		identity_options = identity
+		netConf = conf
+		hasChanges = true
+		rebootRequired = true
+		customizationReq = true
 	}
 
 	hasCpuHotAddEnabled := *mov.Config.CpuHotAddEnabled
@@ -527,6 +822,97 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 
 	}
 
+	for _, prefix := range []string{"cpu", "memory"} {
+		if !resourceAllocationHasChange(d, prefix) {
+			continue
+		}
+		ra, err := parseResourceAllocationData(d, prefix)
+		if err != nil {
+			return err
+		}
+		if prefix == "cpu" {
+			configSpec.CpuAllocation = ra.buildResourceAllocationInfo()
+		} else {
+			configSpec.MemoryAllocation = ra.buildResourceAllocationInfo()
+		}
+		hasChanges = true
+		cpuMemDiskHasChanges = true
+	}
+
+	// The new latency sensitivity only takes effect after a power cycle.
+	if d.HasChange("latency_sensitivity") {
+		configSpec.LatencySensitivity = &types.LatencySensitivity{
+			Level: types.LatencySensitivitySensitivityLevel(d.Get("latency_sensitivity").(string)),
+		}
+		hasChanges = true
+		cpuMemDiskHasChanges = true
+		rebootRequired = true
+	}
+
+	if d.HasChange("annotation") {
+		configSpec.Annotation = d.Get("annotation").(string)
+		hasChanges = true
+		cpuMemDiskHasChanges = true
+	}
+
+	// The guest OS type can only be changed while the VM is powered off.
+	if d.HasChange("guest_id") {
+		guestID := d.Get("guest_id").(string)
+		if err := checkGuestIDSupported(client, mov.EnvironmentBrowser, guestID); err != nil {
+			return err
+		}
+		configSpec.GuestId = guestID
+		hasChanges = true
+		cpuMemDiskHasChanges = true
+		rebootRequired = true
+	}
+
+	if d.HasChange("boot_options") {
+		bootOpts, err := parseBootOptionsData(d)
+		if err != nil {
+			return err
+		}
+		// Removing the block puts the VM back on the default boot options.
+		if bootOpts == nil {
+			bootOpts = defaultBootOptions()
+		}
+		configSpec.BootOptions, err = bootOpts.buildBootOptions(devices)
+		if err != nil {
+			return err
+		}
+		configSpec.ExtraConfig = append(configSpec.ExtraConfig, bootOpts.resetOptions()...)
+		if bootOpts.firmware != mov.Config.Firmware {
+			configSpec.Firmware = bootOpts.firmware
+			rebootRequired = true
+		}
+		hasChanges = true
+		cpuMemDiskHasChanges = true
+	}
+
+	// Controllers are added before the disks which may be placed on them.
+	if d.HasChange("scsi_controller_count") {
+		oldCount, newCount := d.GetChange("scsi_controller_count")
+		if newCount.(int) < oldCount.(int) {
+			return fmt.Errorf("[ERROR] scsi_controller_count cannot be lowered from %d to %d, controllers are not removed from a virtual machine",
+				oldCount.(int), newCount.(int))
+		}
+		controllers, err := newDiskControllers(devices, d.Get("scsi_type").(string), newCount.(int))
+		if err != nil {
+			return fmt.Errorf("[ERROR] Update - Error adding disk controllers: %v", err)
+		}
+		for _, c := range controllers {
+			configSpec.DeviceChange = append(configSpec.DeviceChange, &types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationAdd,
+				Device:    c,
+			})
+			devices = append(devices, c)
+		}
+		if len(controllers) > 0 {
+			hasChanges = true
+			cpuMemDiskHasChanges = true
+		}
+	}
+
 	if d.HasChange("disk") {
 		hasChanges = true
 		oldDisks, newDisks := d.GetChange("disk")
@@ -536,8 +922,8 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 		addedDisks := newDiskSet.Difference(oldDiskSet)
 		removedDisks := oldDiskSet.Difference(newDiskSet)
 
-		log.Printf("[DEBUG] addedDisks : %#v\n", addedDisks)
-		log.Printf("[DEBUG] removedDisks : %#v\n", removedDisks)
+		logger.Debugf("addedDisks : %#v\n", addedDisks)
+		logger.Debugf("removedDisks : %#v\n", removedDisks)
 
 		modifiedDisks := make([]map[string]interface{}, 0)
 
@@ -557,13 +943,33 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 				ad["uuid"], rd["uuid"] = "", ""
 				ad["key"], rd["key"] = 0, 0
 				ad["size"], rd["size"] = 0, 0
+				ad["guest_resize_command"], rd["guest_resize_command"] = "", ""
+				ad["guest_resize_template"], rd["guest_resize_template"] = "", ""
+				ad["guest_resize_target"], rd["guest_resize_target"] = "", ""
+				ad["datastore"], rd["datastore"] = "", ""
 				ok := reflect.DeepEqual(ad, rd)
 				if ok {
-					if removedDisk["size"].(int) < newSize {
-						log.Printf("[DEBUG] Mofifying the size to %d", newSize)
-						addedDisks.Remove(addedDisk)
-						removedDisks.Remove(removedDisk)
+					oldSize := removedDisk["size"].(int)
+					if err := validateDiskResize(removedDisk, oldSize, newSize); err != nil {
+						return err
+					}
+					// A disk whose datastore changed is moved with storage
+					// vMotion instead of being recreated.
+					if ds := addedDisk["datastore"].(string); ds != "" && ds != removedDisk["datastore"].(string) {
+						diskMigrations = append(diskMigrations, diskMigration{
+							key:       int32(removedDisk["key"].(int)),
+							datastore: ds,
+						})
+					}
+					// The disk is kept, it is only extended when it grows.
+					addedDisks.Remove(addedDisk)
+					removedDisks.Remove(removedDisk)
+					if oldSize < newSize {
+						logger.Debugf("Mofifying the size to %d", newSize)
 						removedDisk["size"] = newSize
+						removedDisk["guest_resize_command"] = addedDisk["guest_resize_command"]
+						removedDisk["guest_resize_template"] = addedDisk["guest_resize_template"]
+						removedDisk["guest_resize_target"] = addedDisk["guest_resize_target"]
 						modifiedDisks = append(modifiedDisks, removedDisk)
 					}
 					break
@@ -571,23 +977,30 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 			}
 		}
 
-		log.Printf("[DEBUG] addedDisks after resize: %#v\n", addedDisks)
-		log.Printf("[DEBUG] removedDisks after resize: %#v\n", removedDisks)
-		log.Printf("[DEBUG] modifiedDisks after resize: %#v\n", modifiedDisks)
+		logger.Debugf("addedDisks after resize: %#v\n", addedDisks)
+		logger.Debugf("removedDisks after resize: %#v\n", removedDisks)
+		logger.Debugf("modifiedDisks after resize: %#v\n", modifiedDisks)
 
 		// Just Resized disks
 		for _, disk := range modifiedDisks {
-			log.Printf("[DEBUG] Modifying disk  : %#v\n", disk)
-			devices, err := vm.Device(context.TODO())
-			if err != nil {
-				return fmt.Errorf("[ERROR] Update resize Disk - Could not get virtual device list: %v", err)
-			}
+			logger.Debugf("Modifying disk  : %#v\n", disk)
 			v := devices.FindByKey(int32(disk["key"].(int)))
 			virtualDisk, _ := v.(*types.VirtualDisk)
 
 			newSize := disk["size"].(int)
 			virtualDisk.CapacityInKB = int64(newSize * 1024 * 1024)
 
+			command, err := guestResizeCommand(disk)
+			if err != nil {
+				return fmt.Errorf("[ERROR] %s", err)
+			}
+			if command != "" {
+				if guestAuth == nil {
+					return fmt.Errorf("[ERROR] guest_credentials are required to extend the guest partition of disk %s", disk["name"])
+				}
+				guestResizeCommands = append(guestResizeCommands, command)
+			}
+
 			config := &types.VirtualDeviceConfigSpec{
 				Device:    virtualDisk,
 				Operation: types.VirtualDeviceConfigSpecOperationEdit,
@@ -600,21 +1013,30 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 		// Removed disks
 		for _, diskRaw := range removedDisks.List() {
 			if disk, ok := diskRaw.(map[string]interface{}); ok {
-				devices, err := vm.Device(context.TODO())
-				if err != nil {
-					return fmt.Errorf("[ERROR] Update Remove Disk - Could not get virtual device list: %v", err)
-				}
 				virtualDisk := devices.FindByKey(int32(disk["key"].(int)))
+				if virtualDisk == nil {
+					return fmt.Errorf("[ERROR] Update Remove Disk - Could not find disk with key %d", disk["key"].(int))
+				}
 
 				keep := false
 				if v, ok := disk["keep_on_remove"].(bool); ok {
 					keep = v
 				}
 
-				err = vm.RemoveDevice(context.TODO(), keep, virtualDisk)
-				if err != nil {
-					return fmt.Errorf("[ERROR] Update Remove Disk - Error removing disk: %v", err)
+				config := &types.VirtualDeviceConfigSpec{
+					Device:    virtualDisk,
+					Operation: types.VirtualDeviceConfigSpecOperationRemove,
+				}
+				if !keep {
+					config.FileOperation = types.VirtualDeviceConfigSpecFileOperationDestroy
 				}
+				configSpec.DeviceChange = append(configSpec.DeviceChange, config)
+				cpuMemDiskHasChanges = true
+
+				// The unit of the removed disk is free for added disks.
+				devices = devices.Select(func(device types.BaseVirtualDevice) bool {
+					return device.GetVirtualDevice().Key != virtualDisk.GetVirtualDevice().Key
+				})
 			}
 		}
 		// Added disks
@@ -630,7 +1052,7 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 				} else {
 					datastore, err = finder.Datastore(context.TODO(), disk["datastore"].(string))
 					if err != nil {
-						log.Printf("[ERROR] Couldn't find datastore %v.  %s", disk["datastore"].(string), err)
+						logger.Errorf("Couldn't find datastore %v.  %s", disk["datastore"].(string), err)
 						return err
 					}
 				}
@@ -644,15 +1066,12 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 				iops := int64(disk["iops"].(int))
 				controller_type := disk["controller_type"].(string)
 
-				var mo mo.VirtualMachine
-				vm.Properties(context.TODO(), vm.Reference(), []string{"summary", "config"}, &mo)
-
 				var diskPath string
 				switch {
 				case disk["vmdk"] != "":
 					diskPath = disk["vmdk"].(string)
 				case disk["name"] != "":
-					snapshotFullDir := mo.Config.Files.SnapshotDirectory
+					snapshotFullDir := mov.Config.Files.SnapshotDirectory
 
 					// Parse the disk path
 					dpath := new(object.DatastorePath)
@@ -674,23 +1093,47 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 					initType = "thin"
 				}
 
-				log.Printf("[INFO] Attaching disk: %v", diskPath)
-				err = addHardDisk(vm, size, iops, initType, datastore, diskPath, controller_type)
+				logger.Infof("Attaching disk: %v", diskPath)
+				controllerNumber := int32(disk["controller_number"].(int))
+				unitNumber := int32(disk["unit_number"].(int))
+				var deviceChange []types.BaseVirtualDeviceConfigSpec
+				deviceChange, devices, err = buildHardDiskSpecs(devices, size, iops, initType, datastore, diskPath, controller_type, controllerNumber, unitNumber)
 				if err != nil {
-					log.Printf("[ERROR] Add Hard Disk Failed: %v", err)
+					logger.Errorf("Add Hard Disk Failed: %v", err)
 					return err
 				}
+				configSpec.DeviceChange = append(configSpec.DeviceChange, deviceChange...)
+				cpuMemDiskHasChanges = true
 			}
-			if err != nil {
+		}
+	}
+	// Fault tolerance is turned off before any reconfiguration and turned
+	// back on with the new settings once the VM is running again.
+	var ftEnable *faultTolerance
+	if d.HasChange("fault_tolerance") {
+		hasChanges = true
+		oldFt, newFt := d.GetChange("fault_tolerance")
+		if parseFaultToleranceData(oldFt.([]interface{})) != nil {
+			if err := disableFaultTolerance(client, vm); err != nil {
 				return err
 			}
 		}
+		ftEnable = parseFaultToleranceData(newFt.([]interface{}))
 	}
+
 	if d.HasChange("permission") {
 		perm := parseUserPermissionData(d, client)
 		err = perm.updateResourcePermission(vm.Reference())
 		if err != nil {
-			log.Printf("[ERROR] Permission update failed. Error: %s", err)
+			logger.Errorf("Permission update failed. Error: %s", err)
+			return err
+		}
+	}
+
+	if d.HasChange("drs_automation_level") || d.HasChange("ha_restart_priority") ||
+		d.HasChange("ha_isolation_response") {
+		err = parseClusterVmOverrides(d).applyClusterVmOverrides(client, vm.Reference())
+		if err != nil {
 			return err
 		}
 	}
@@ -700,38 +1143,51 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 		return nil
 	}
 
-	log.Printf("[DEBUG] virtual machine config spec: %v", configSpec)
+	logger.Debugf("virtual machine config spec: %v", configSpec)
 
 	if rebootRequired {
-		log.Printf("[INFO] Shutting down virtual machine: %s", d.Id())
+		logger.Infof("Shutting down virtual machine: %s", d.Id())
 
 		task, err := vm.PowerOff(context.TODO())
 		if err != nil {
 			return err
 		}
 
-		err = task.Wait(context.TODO())
+		err = vmUpdateConf.waitForTask(task, "power off virtual machine "+d.Id())
 		if err != nil {
 			return err
 		}
 	}
 
 	if cpuMemDiskHasChanges {
-		log.Printf("[INFO] Reconfiguring virtual machine: %s", d.Id())
+		logger.Infof("Reconfiguring virtual machine: %s", d.Id())
 
 		task, err := vm.Reconfigure(context.TODO(), configSpec)
 		if err != nil {
-			log.Printf("[ERROR] %s", err)
+			return err
 		}
 
-		err = task.Wait(context.TODO())
+		// Device changes are part of the reconfiguration, a failure
+		// leaves the VM in its previous state.
+		err = vmUpdateConf.waitForTask(task, "reconfigure virtual machine "+d.Id())
 		if err != nil {
-			log.Printf("[ERROR] %s", err)
+			return err
+		}
+	}
+
+	if len(diskMigrations) > 0 {
+		dcFolders, err := meta.(*VSphereClient).getDatacenterFolders(dc)
+		if err != nil {
+			return err
+		}
+		diskCount := len(devices.SelectByType((*types.VirtualDisk)(nil)))
+		if err := vmUpdateConf.migrateDisks(client, dcFolders, vm, diskMigrations, diskCount); err != nil {
+			return err
 		}
 	}
 
 	if customizationReq {
-		log.Printf("[INFO] Customizing virtual machine: %s", d.Id())
+		logger.Infof("Customizing virtual machine: %s", d.Id())
 		if err := vmUpdateConf.customizeVm(vm, identity_options, netConf); err != nil {
 			return err
 		}
@@ -743,9 +1199,37 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 			return err
 		}
 
-		err = task.Wait(context.TODO())
+		err = vmUpdateConf.waitForTask(task, "power on virtual machine "+d.Id())
 		if err != nil {
-			log.Printf("[ERROR] %s", err)
+			logger.Errorf("%s", err)
+			if vmUpdateConf.taskCtx.Err() != nil {
+				return err
+			}
+		}
+	}
+
+	// The guest sees the new disk size once the reconfiguration is done.
+	for _, command := range guestResizeCommands {
+		if err := vmUpdateConf.runGuestCommand(vm, guestAuth, command); err != nil {
+			return fmt.Errorf("[ERROR] Extending guest partition failed: %v", err)
+		}
+	}
+
+	// The replaced or customized network interfaces come up without the
+	// routes.
+	if d.HasChange("network_interface") || d.HasChange("customization_trigger") {
+		if err := vmUpdateConf.addGuestRoutes(vm, guestAuth); err != nil {
+			return err
+		}
+		vmUpdateConf.networkVerification = parseNetworkVerification(d)
+		if err := vmUpdateConf.verifyGuestNetwork(); err != nil {
+			return err
+		}
+	}
+
+	if ftEnable != nil {
+		if err := ftEnable.enableFaultTolerance(client, finder, vm); err != nil {
+			return err
 		}
 	}
 
@@ -753,19 +1237,54 @@ func resourceVSphereVirtualMachineUpdate(d *schema.ResourceData, meta interface{
 }
 
 func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*govmomi.Client)
+	logger := newResourceLogger(meta, "vsphere_virtual_machine", resourceLogName(d, "name"), "create")
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	if err := meta.(*VSphereClient).requireFeatures(virtualMachineFeatures(d)...); err != nil {
+		return err
+	}
+
+	client := meta.(*VSphereClient).vimClient
+	setPlacementDefaults(d, meta.(*VSphereClient))
 
 	vm := virtualMachine{
 		name:     d.Get("name").(string),
 		vcpu:     int32(d.Get("vcpu").(int)),
 		memoryMb: int64(d.Get("memory").(int)),
-		memoryAllocation: memoryAllocation{
-			reservation: int64(d.Get("memory_reservation").(int)),
-		},
+	}
+
+	cpuAllocation, err := parseResourceAllocationData(d, "cpu")
+	if err != nil {
+		return err
+	}
+	vm.cpuAllocation = cpuAllocation
+
+	memoryAllocation, err := parseResourceAllocationData(d, "memory")
+	if err != nil {
+		return err
+	}
+	vm.memoryAllocation = memoryAllocation
+
+	// archive_on_destroy is only used on destroy, catch mistakes early.
+	if _, err := parseOvfArchiveData(d); err != nil {
+		return err
+	}
+
+	if v, ok := d.GetOk("latency_sensitivity"); ok {
+		vm.latencySensitivity = v.(string)
+	}
+
+	vm.scsiControllerCount = 1
+	if v, ok := d.GetOk("scsi_type"); ok {
+		vm.scsiType = v.(string)
+	}
+	if v, ok := d.GetOk("scsi_controller_count"); ok {
+		vm.scsiControllerCount = v.(int)
 	}
 
 	if v, ok := d.GetOk("folder"); ok {
-		vm.folder = v.(string)
+		vm.folder = normalizeFolderPath(v.(string))
 	}
 
 	if v, ok := d.GetOk("datacenter"); ok {
@@ -776,6 +1295,10 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 		vm.cluster = v.(string)
 	}
 
+	if v, ok := d.GetOk("host"); ok {
+		vm.host = v.(string)
+	}
+
 	if v, ok := d.GetOk("resource_pool"); ok {
 		vm.resourcePool = v.(string)
 	}
@@ -792,6 +1315,14 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 		vm.linkedClone = v.(bool)
 	}
 
+	if v, ok := d.GetOk("template_snapshot"); ok {
+		vm.templateSnapshot = v.(string)
+	}
+
+	if v, ok := d.GetOk("template_disk_datastore"); ok {
+		vm.templateDiskDatastores = parseDiskDatastores(v.([]interface{}))
+	}
+
 	if v, ok := d.GetOk("skip_customization"); ok {
 		vm.skipCustomization = v.(bool)
 	}
@@ -800,10 +1331,30 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 		vm.enableDiskUUID = v.(bool)
 	}
 
+	if v, ok := d.GetOk("annotation"); ok {
+		vm.annotation = v.(string)
+	}
+
+	if v, ok := d.GetOk("guest_id"); ok {
+		vm.guestID = v.(string)
+	}
+
 	if _, ok := d.GetOk("permission"); ok {
 		vm.permission = parseUserPermissionData(d, client)
 	}
 
+	bootOpts, err := parseBootOptionsData(d)
+	if err != nil {
+		return err
+	}
+	vm.bootOptions = bootOpts
+
+	vm.faultTolerance = parseFaultToleranceData(d.Get("fault_tolerance").([]interface{}))
+
+	if overrides := parseClusterVmOverrides(d); !overrides.isEmpty() {
+		vm.clusterOverrides = overrides
+	}
+
 	if raw, ok := d.GetOk("dns_suffixes"); ok {
 		for _, v := range raw.([]interface{}) {
 			vm.dnsSuffixes = append(vm.dnsSuffixes, v.(string))
@@ -827,7 +1378,7 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 				custom[k] = v
 			}
 			vm.customConfigurations = custom
-			log.Printf("[DEBUG] custom_configuration_parameters init: %v", vm.customConfigurations)
+			logger.Debugf("custom_configuration_parameters init: %v", vm.customConfigurations)
 		}
 	}
 
@@ -837,7 +1388,7 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 			return err
 		}
 		vm.networkInterfaces = networkintfData
-		log.Printf("[DEBUG] network_interface init: %+v", vm.networkInterfaces)
+		logger.Debugf("network_interface init: %+v", vm.networkInterfaces)
 	}
 
 	if vL, ok := d.GetOk("windows_opt_config"); ok {
@@ -858,8 +1409,22 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 		if v, ok := custom_configs["domain_user_password"].(string); ok && v != "" {
 			winOpt.domainUserPassword = v
 		}
+		if v, ok := custom_configs["domain_admin_user"].(string); ok && v != "" {
+			winOpt.domainUser = v
+		}
+		if v, ok := custom_configs["domain_admin_password"].(string); ok && v != "" {
+			winOpt.domainUserPassword = v
+		}
+		if err := winOpt.validateDomainJoin(); err != nil {
+			return err
+		}
+		if vL, ok := custom_configs["run_once_commands"].([]interface{}); ok {
+			for _, v := range vL {
+				winOpt.runOnceCommands = append(winOpt.runOnceCommands, v.(string))
+			}
+		}
 		vm.windowsOptionalConfig = winOpt
-		log.Printf("[DEBUG] windows config init: %v", winOpt)
+		logger.Debugf("windows config init: %+v", winOpt)
 	}
 
 	setVMTemplate(d, &vm)
@@ -912,6 +1477,23 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 					newDisk.controller = v
 				}
 
+				if v, ok := disk["controller_number"].(int); ok && v != 0 {
+					if newDisk.controller != "scsi" {
+						return fmt.Errorf("[ERROR] controller_number is only supported for disks with controller_type scsi")
+					}
+					if v >= vm.scsiControllerCount {
+						return fmt.Errorf("[ERROR] controller_number %d needs scsi_controller_count of at least %d", v, v+1)
+					}
+					newDisk.controllerNumber = int32(v)
+				}
+
+				if v, ok := disk["unit_number"].(int); ok && v != 0 {
+					if newDisk.controller != "scsi" {
+						return fmt.Errorf("[ERROR] unit_number is only supported for disks with controller_type scsi")
+					}
+					newDisk.unitNumber = int32(v)
+				}
+
 				if vVmdk, ok := disk["vmdk"].(string); ok && vVmdk != "" {
 					if v, ok := disk["template"].(string); ok && v != "" {
 						return fmt.Errorf("Cannot specify a vmdk for a template")
@@ -939,7 +1521,7 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 				}
 			}
 			vm.hardDisks = disks
-			log.Printf("[DEBUG] disk init: %v", disks)
+			logger.Debugf("disk init: %v", disks)
 		}
 	}
 
@@ -959,16 +1541,64 @@ func resourceVSphereVirtualMachineCreate(d *schema.ResourceData, meta interface{
 			}
 		}
 		vm.cdroms = cdroms
-		log.Printf("[DEBUG] cdrom init: %v", cdroms)
+		logger.Debugf("cdrom init: %v", cdroms)
 	}
 
-	err := vm.setupVirtualMachine(client)
+	serialPorts, err := parseSerialPortData(d)
 	if err != nil {
 		return err
 	}
+	vm.serialPorts = serialPorts
+	vm.usb = parseUsbData(d)
+
+	vm.networkVerification = parseNetworkVerification(d)
+	vm.postCustomizationCommands = parsePostCustomizationCommands(d)
+	if len(vm.postCustomizationCommands) > 0 {
+		vm.guestAuth = parseGuestCredentials(d)
+		if err := vm.validatePostCustomizationCommands(); err != nil {
+			return err
+		}
+	}
 
-	d.SetId(vm.Path())
-	log.Printf("[INFO] Created virtual machine: %s", d.Id())
+	// Routes are added in the guest once the VM is running.
+	if len(vm.networkRoutes()) > 0 {
+		vm.guestAuth = parseGuestCredentials(d)
+		if vm.guestAuth == nil {
+			return fmt.Errorf("guest_credentials are required to add the routes of the network interfaces")
+		}
+		if !vm.hasBootableVmdk && vm.template == "" {
+			return fmt.Errorf("routes of the network interfaces need a template or bootable disk to start the guest")
+		}
+	}
+
+	if vm.templateSnapshot != "" && vm.template == "" {
+		return fmt.Errorf("template_snapshot needs a disk with a template to clone from")
+	}
+
+	var cancel context.CancelFunc
+	vm.taskTimeout = d.Timeout(schema.TimeoutCreate)
+	vm.taskCtx, cancel = taskContext(vm.taskTimeout)
+	defer cancel()
+
+	err = vm.setupVirtualMachine(client)
+	if err != nil {
+		return translateVSphereError(err, fmt.Sprintf("virtual machine %s", vm.Path()))
+	}
+
+	dc, err := meta.(*VSphereClient).getDatacenter(vm.datacenter)
+	if err != nil {
+		return err
+	}
+	d.SetId(canonicalInventoryPath(dc.InventoryPath + "/vm/" + vm.Path()))
+	logger.Infof("Created virtual machine: %s", d.Id())
+
+	newVM, err := meta.(*VSphereClient).getFinder(dc).VirtualMachine(context.TODO(), vm.Path())
+	if err != nil {
+		return err
+	}
+	if err := vm.runGuestSteps(newVM); err != nil {
+		return translateVSphereError(err, fmt.Sprintf("virtual machine %s", vm.Path()))
+	}
 
 	return resourceVSphereVirtualMachineRead(d, meta)
 }
@@ -990,9 +1620,14 @@ func setVMTemplate(d *schema.ResourceData, vm *virtualMachine) {
 }
 
 func resourceVSphereVirtualMachineRead(d *schema.ResourceData, meta interface{}) error {
-	log.Printf("[DEBUG] virtual machine resource data: %#v", d)
-	client := meta.(*govmomi.Client)
-	dc, err := getDatacenter(client, d.Get("datacenter").(string))
+	logger := newResourceLogger(meta, "vsphere_virtual_machine", resourceLogName(d, "name"), "read")
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+
+	logger.Debugf("virtual machine resource data: %#v", d)
+	client := meta.(*VSphereClient).vimClient
+	dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
 	if err != nil {
 		return err
 	}
@@ -1004,6 +1639,7 @@ func resourceVSphereVirtualMachineRead(d *schema.ResourceData, meta interface{})
 		d.SetId("")
 		return nil
 	}
+	d.SetId(canonicalInventoryPath(vm.InventoryPath))
 
 	state, err := vm.PowerState(context.TODO())
 	if err != nil {
@@ -1012,26 +1648,26 @@ func resourceVSphereVirtualMachineRead(d *schema.ResourceData, meta interface{})
 
 	if state == types.VirtualMachinePowerStatePoweredOn {
 		// wait for interfaces to appear
-		log.Printf("[DEBUG] Waiting for interfaces to appear")
+		logger.Debugf("Waiting for interfaces to appear")
 
 		_, err = vm.WaitForNetIP(context.TODO(), false)
 		if err != nil {
 			return err
 		}
 
-		log.Printf("[DEBUG] Successfully waited for interfaces to appear")
+		logger.Debugf("Successfully waited for interfaces to appear")
 	}
 
 	var mvm mo.VirtualMachine
 	collector := property.DefaultCollector(client.Client)
-	if err := collector.RetrieveOne(context.TODO(), vm.Reference(), []string{"guest", "summary", "datastore", "config"}, &mvm); err != nil {
+	if err := collector.RetrieveOne(context.TODO(), vm.Reference(), []string{"guest", "summary", "datastore", "config", "runtime"}, &mvm); err != nil {
 		return err
 	}
 
-	log.Printf("[DEBUG] Datacenter - %#v", dc)
-	log.Printf("[DEBUG] mvm.Summary.Config - %#v", mvm.Summary.Config)
-	log.Printf("[DEBUG] mvm.Summary.Config - %#v", mvm.Config)
-	log.Printf("[DEBUG] mvm.Guest.Net - %#v", mvm.Guest.Net)
+	logger.Debugf("Datacenter - %#v", dc)
+	logger.Debugf("mvm.Summary.Config - %#v", mvm.Summary.Config)
+	logger.Debugf("mvm.Summary.Config - %#v", mvm.Config)
+	logger.Debugf("mvm.Guest.Net - %#v", mvm.Guest.Net)
 
 	disks := make([]map[string]interface{}, 0)
 	templateDisk := make(map[string]interface{}, 1)
@@ -1050,7 +1686,7 @@ func resourceVSphereVirtualMachineRead(d *schema.ResourceData, meta interface{})
 				diskFullPath = v.FileName
 				diskUuid = v.Uuid
 			}
-			log.Printf("[DEBUG] resourceVSphereVirtualMachineRead - Analyzing disk: %v", diskFullPath)
+			logger.Debugf("resourceVSphereVirtualMachineRead - Analyzing disk: %v", diskFullPath)
 
 			// Parse the disk path
 			dpath := new(object.DatastorePath)
@@ -1096,7 +1732,7 @@ func resourceVSphereVirtualMachineRead(d *schema.ResourceData, meta interface{})
 					}
 				}
 			}
-			log.Printf("[DEBUG] disks: %#v", disks)
+			logger.Debugf("disks: %#v", disks)
 		}
 	}
 	err = d.Set("disk", disks)
@@ -1104,11 +1740,39 @@ func resourceVSphereVirtualMachineRead(d *schema.ResourceData, meta interface{})
 		return fmt.Errorf("Invalid disks to set: %#v", disks)
 	}
 
+	scsiType, scsiControllerCount := readDiskControllers(object.VirtualDeviceList(mvm.Config.Hardware.Device))
+	d.Set("scsi_type", scsiType)
+	d.Set("scsi_controller_count", scsiControllerCount)
+
 	// network
 	if err := readNetworkData(&mvm, d); err != nil {
 		return err
 	}
 
+	if err := readBootOptions(mvm.Config, d); err != nil {
+		return err
+	}
+
+	if err := readSerialAndUsbDevices(object.VirtualDeviceList(mvm.Config.Hardware.Device), d); err != nil {
+		return err
+	}
+
+	if err := readFaultToleranceData(&mvm, d); err != nil {
+		return err
+	}
+
+	if err := readClusterVmOverrides(client, vm.Reference(), d); err != nil {
+		return err
+	}
+
+	if mvm.Config != nil {
+		readResourceAllocation(d, "cpu", mvm.Config.CpuAllocation)
+		readResourceAllocation(d, "memory", mvm.Config.MemoryAllocation)
+		if mvm.Config.LatencySensitivity != nil {
+			d.Set("latency_sensitivity", string(mvm.Config.LatencySensitivity.Level))
+		}
+	}
+
 	var rootDatastore string
 	for _, v := range mvm.Datastore {
 		var md mo.Datastore
@@ -1121,44 +1785,65 @@ func resourceVSphereVirtualMachineRead(d *schema.ResourceData, meta interface{})
 				return err
 			}
 			rootDatastore = msp.Name
-			log.Printf("[DEBUG] %#v", msp.Name)
+			logger.Debugf("%#v", msp.Name)
 		} else {
 			rootDatastore = md.Name
-			log.Printf("[DEBUG] %#v", md.Name)
+			logger.Debugf("%#v", md.Name)
 		}
 		break
 	}
 
 	d.Set("datacenter", dc)
 	d.Set("memory", mvm.Summary.Config.MemorySizeMB)
-	d.Set("memory_reservation", mvm.Summary.Config.MemoryReservation)
 	d.Set("cpu", mvm.Summary.Config.NumCpu)
 	d.Set("datastore", rootDatastore)
 	d.Set("uuid", mvm.Summary.Config.Uuid)
+	d.Set("annotation", mvm.Config.Annotation)
+	readGuestOS(d, &mvm)
 
-	return nil
+	return readResourcePermission(d, client, vm.Reference())
 }
 
 func resourceVSphereVirtualMachineDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*govmomi.Client)
-	dc, err := getDatacenter(client, d.Get("datacenter").(string))
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_virtual_machine", resourceLogName(d, "name"), "delete")
+	client := meta.(*VSphereClient).vimClient
+	dc, err := meta.(*VSphereClient).getDatacenter(d.Get("datacenter").(string))
 	if err != nil {
 		return err
 	}
 	finder := find.NewFinder(client.Client, true)
 	finder = finder.SetDatacenter(dc)
 
-	vm, err := finder.VirtualMachine(context.TODO(), vmPath(d.Get("folder").(string), d.Get("name").(string)))
+	vm, err := finder.VirtualMachine(context.TODO(), vmPath(normalizeFolderPath(d.Get("folder").(string)), d.Get("name").(string)))
 	if err != nil {
 		return err
 	}
 	devices, err := vm.Device(context.TODO())
 	if err != nil {
-		log.Printf("[DEBUG] resourceVSphereVirtualMachineDelete - Failed to get device list: %v", err)
+		logger.Debugf("resourceVSphereVirtualMachineDelete - Failed to get device list: %v", err)
 		return err
 	}
 
-	log.Printf("[INFO] Deleting virtual machine: %s", d.Id())
+	logger.Infof("Deleting virtual machine: %s", d.Id())
+
+	timeout := d.Timeout(schema.TimeoutDelete)
+	ctx, cancel := taskContext(timeout)
+	defer cancel()
+
+	// The primary VM cannot be destroyed while fault tolerance is on.
+	var mvm mo.VirtualMachine
+	if err := vm.Properties(context.TODO(), vm.Reference(), []string{"runtime"}, &mvm); err != nil {
+		return err
+	}
+	if faultToleranceConfigured(&mvm) {
+		if err := disableFaultTolerance(client, vm); err != nil {
+			return err
+		}
+	}
+
 	state, err := vm.PowerState(context.TODO())
 	if err != nil {
 		return err
@@ -1170,9 +1855,21 @@ func resourceVSphereVirtualMachineDelete(d *schema.ResourceData, meta interface{
 			return err
 		}
 
-		err = task.Wait(context.TODO())
+		err = task.Wait(ctx)
 		if err != nil {
-			return err
+			return taskTimeoutError(ctx, err, "power off virtual machine "+d.Id(), timeout)
+		}
+	}
+
+	// Export the VM before anything is removed from it.
+	archive, err := parseOvfArchiveData(d)
+	if err != nil {
+		return err
+	}
+	if archive != nil {
+		logger.Infof("Archiving virtual machine %s before deleting it", d.Id())
+		if err := archive.archiveBeforeDelete(client, dc, vm.Reference(), d.Get("name").(string)); err != nil {
+			return fmt.Errorf("Error archiving virtual machine %s, not deleting it: %s", d.Id(), err)
 		}
 	}
 
@@ -1185,11 +1882,11 @@ func resourceVSphereVirtualMachineDelete(d *schema.ResourceData, meta interface{
 				disk := value.(map[string]interface{})
 
 				if v, ok := disk["keep_on_remove"].(bool); ok && v == true {
-					log.Printf("[DEBUG] not destroying %v", disk["name"])
+					logger.Debugf("not destroying %v", disk["name"])
 					virtualDisk := devices.FindByKey(int32(disk["key"].(int)))
 					err = vm.RemoveDevice(context.TODO(), true, virtualDisk)
 					if err != nil {
-						log.Printf("[ERROR] Update Remove Disk - Error removing disk: %v", err)
+						logger.Errorf("Update Remove Disk - Error removing disk: %v", err)
 						return err
 					}
 				}
@@ -1221,7 +1918,7 @@ func resourceVSphereVirtualMachineDelete(d *schema.ResourceData, meta interface{
 		if len(disksToRemove) != 0 {
 			err = vm.RemoveDevice(context.TODO(), true, disksToRemove...)
 			if err != nil {
-				log.Printf("[ERROR] Update Remove Disk - Error removing disk: %v", err)
+				logger.Errorf("Update Remove Disk - Error removing disk: %v", err)
 				return err
 			}
 		}
@@ -1232,9 +1929,9 @@ func resourceVSphereVirtualMachineDelete(d *schema.ResourceData, meta interface{
 		return err
 	}
 
-	err = task.Wait(context.TODO())
+	err = task.Wait(ctx)
 	if err != nil {
-		return err
+		return taskTimeoutError(ctx, err, "destroy virtual machine "+d.Id(), timeout)
 	}
 
 	d.SetId("")
@@ -1242,17 +1939,43 @@ func resourceVSphereVirtualMachineDelete(d *schema.ResourceData, meta interface{
 }
 
 // addHardDisk adds a new Hard Disk to the VirtualMachine.
-func addHardDisk(vm *object.VirtualMachine, size, iops int64, diskType string, datastore *object.Datastore, diskPath string, controller_type string) error {
+func addHardDisk(vm *object.VirtualMachine, size, iops int64, diskType string, datastore *object.Datastore, diskPath string, controllerType string, controllerNumber, unitNumber int32) error {
 	devices, err := vm.Device(context.TODO())
 	if err != nil {
 		return err
 	}
 	log.Printf("[DEBUG] vm devices: %#v\n", devices)
 
+	deviceChange, _, err := buildHardDiskSpecs(devices, size, iops, diskType, datastore, diskPath, controllerType, controllerNumber, unitNumber)
+	if err != nil {
+		return err
+	}
+	if len(deviceChange) == 0 {
+		return nil
+	}
+
+	task, err := vm.Reconfigure(context.TODO(), types.VirtualMachineConfigSpec{DeviceChange: deviceChange})
+	if err != nil {
+		return err
+	}
+	return task.Wait(context.TODO())
+}
+
+// buildHardDiskSpecs returns the device changes which add a new Hard Disk,
+// and the controller it needs if the VM has none, so they can be applied
+// together with other changes in one reconfiguration. The returned device
+// list includes the new devices for the next disk to pick its unit from.
+func buildHardDiskSpecs(devices object.VirtualDeviceList, size, iops int64, diskType string, datastore *object.Datastore, diskPath string, controllerType string, controllerNumber, unitNumber int32) ([]types.BaseVirtualDeviceConfigSpec, object.VirtualDeviceList, error) {
+	var deviceChange []types.BaseVirtualDeviceConfigSpec
+	var err error
+
 	var controller types.BaseVirtualController
-	switch controller_type {
+	switch controllerType {
 	case "scsi":
-		controller, err = devices.FindDiskController(controller_type)
+		controller, err = findDiskControllerByBus(devices, controllerNumber)
+		if err != nil && controllerNumber > 0 {
+			return nil, devices, err
+		}
 	case "scsi-lsi-parallel":
 		controller = devices.PickController(&types.VirtualLsiLogicController{})
 	case "scsi-buslogic":
@@ -1262,73 +1985,70 @@ func addHardDisk(vm *object.VirtualMachine, size, iops int64, diskType string, d
 	case "scsi-lsi-sas":
 		controller = devices.PickController(&types.VirtualLsiLogicSASController{})
 	case "ide":
-		controller, err = devices.FindDiskController(controller_type)
+		controller, err = devices.FindDiskController(controllerType)
 	default:
-		return fmt.Errorf("[ERROR] Unsupported disk controller provided: %v", controller_type)
+		return nil, devices, fmt.Errorf("[ERROR] Unsupported disk controller provided: %v", controllerType)
 	}
 
 	if err != nil || controller == nil {
 		// Check if max number of scsi controller are already used
 		diskControllers := getSCSIControllers(devices)
 		if len(diskControllers) >= 4 {
-			return fmt.Errorf("[ERROR] Maximum number of SCSI controllers created")
+			return nil, devices, fmt.Errorf("[ERROR] Maximum number of SCSI controllers created")
 		}
 
-		log.Printf("[DEBUG] Couldn't find a %v controller.  Creating one..", controller_type)
+		log.Printf("[DEBUG] Couldn't find a %v controller.  Creating one..", controllerType)
 
 		var c types.BaseVirtualDevice
-		switch controller_type {
+		switch controllerType {
 		case "scsi":
 			// Create scsi controller
 			c, err = devices.CreateSCSIController("scsi")
 			if err != nil {
-				return fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
+				return nil, devices, fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
 			}
 		case "scsi-lsi-parallel":
 			// Create scsi controller
 			c, err = devices.CreateSCSIController("lsilogic")
 			if err != nil {
-				return fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
+				return nil, devices, fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
 			}
 		case "scsi-buslogic":
 			// Create scsi controller
 			c, err = devices.CreateSCSIController("buslogic")
 			if err != nil {
-				return fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
+				return nil, devices, fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
 			}
 		case "scsi-paravirtual":
 			// Create scsi controller
 			c, err = devices.CreateSCSIController("pvscsi")
 			if err != nil {
-				return fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
+				return nil, devices, fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
 			}
 		case "scsi-lsi-sas":
 			// Create scsi controller
 			c, err = devices.CreateSCSIController("lsilogic-sas")
 			if err != nil {
-				return fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
+				return nil, devices, fmt.Errorf("[ERROR] Failed creating SCSI controller: %v", err)
 			}
 		case "ide":
 			// Create ide controller
 			c, err = devices.CreateIDEController()
 			if err != nil {
-				return fmt.Errorf("[ERROR] Failed creating IDE controller: %v", err)
+				return nil, devices, fmt.Errorf("[ERROR] Failed creating IDE controller: %v", err)
 			}
 		default:
-			return fmt.Errorf("[ERROR] Unsupported disk controller provided: %v", controller_type)
+			return nil, devices, fmt.Errorf("[ERROR] Unsupported disk controller provided: %v", controllerType)
 		}
 
-		vm.AddDevice(context.TODO(), c)
-		// Update our devices list
-		devices, err := vm.Device(context.TODO())
-		if err != nil {
-			return err
-		}
-		controller = devices.PickController(c.(types.BaseVirtualController))
-		if controller == nil {
-			log.Printf("[ERROR] Could not find the new %v controller", controller_type)
-			return fmt.Errorf("Could not find the new %v controller", controller_type)
-		}
+		// The new controller is referenced by its temporary key until the
+		// reconfiguration assigns a real one.
+		deviceChange = append(deviceChange, &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationAdd,
+			Device:    c,
+		})
+		devices = append(devices, c)
+		controller = c.(types.BaseVirtualController)
 	}
 
 	log.Printf("[DEBUG] disk controller: %#v\n", controller)
@@ -1336,17 +2056,17 @@ func addHardDisk(vm *object.VirtualMachine, size, iops int64, diskType string, d
 	// TODO Check if diskPath & datastore exist
 	// If diskPath is not specified, pass empty string to CreateDisk()
 	if diskPath == "" {
-		return fmt.Errorf("[ERROR] addHardDisk - No path proided")
+		return nil, devices, fmt.Errorf("[ERROR] addHardDisk - No path proided")
 	} else {
 		diskPath = datastore.Path(diskPath)
 	}
 	log.Printf("[DEBUG] addHardDisk - diskPath: %v", diskPath)
 	disk := devices.CreateDisk(controller, datastore.Reference(), diskPath)
 
-	if strings.Contains(controller_type, "scsi") {
-		unitNumber, err := getNextUnitNumber(devices, controller)
+	if strings.Contains(controllerType, "scsi") {
+		unitNumber, err := pickUnitNumber(devices, controller, unitNumber)
 		if err != nil {
-			return err
+			return nil, devices, err
 		}
 		*disk.UnitNumber = unitNumber
 	}
@@ -1354,37 +2074,47 @@ func addHardDisk(vm *object.VirtualMachine, size, iops int64, diskType string, d
 	existing := devices.SelectByBackingInfo(disk.Backing)
 	log.Printf("[DEBUG] disk: %#v\n", disk)
 
-	if len(existing) == 0 {
-		disk.CapacityInKB = int64(size * 1024 * 1024)
-		if iops != 0 {
-			disk.StorageIOAllocation = &types.StorageIOAllocationInfo{
-				Limit: &iops,
-			}
-		}
-		backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+	if len(existing) > 0 {
+		log.Printf("[DEBUG] addHardDisk: Disk already present.\n")
+		return deviceChange, devices, nil
+	}
 
-		if diskType == "eager_zeroed" {
-			// eager zeroed thick virtual disk
-			backing.ThinProvisioned = types.NewBool(false)
-			backing.EagerlyScrub = types.NewBool(true)
-		} else if diskType == "lazy" {
-			// lazy zeroed thick virtual disk
-			backing.ThinProvisioned = types.NewBool(false)
-			backing.EagerlyScrub = types.NewBool(false)
-		} else if diskType == "thin" {
-			// thin provisioned virtual disk
-			backing.ThinProvisioned = types.NewBool(true)
+	disk.CapacityInKB = int64(size * 1024 * 1024)
+	if iops != 0 {
+		disk.StorageIOAllocation = &types.StorageIOAllocationInfo{
+			Limit: &iops,
 		}
+	}
+	backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
 
-		log.Printf("[DEBUG] addHardDisk: %#v\n", disk)
-		log.Printf("[DEBUG] addHardDisk capacity: %#v\n", disk.CapacityInKB)
+	if diskType == "eager_zeroed" {
+		// eager zeroed thick virtual disk
+		backing.ThinProvisioned = types.NewBool(false)
+		backing.EagerlyScrub = types.NewBool(true)
+	} else if diskType == "lazy" {
+		// lazy zeroed thick virtual disk
+		backing.ThinProvisioned = types.NewBool(false)
+		backing.EagerlyScrub = types.NewBool(false)
+	} else if diskType == "thin" {
+		// thin provisioned virtual disk
+		backing.ThinProvisioned = types.NewBool(true)
+	}
 
-		return vm.AddDevice(context.TODO(), disk)
-	} else {
-		log.Printf("[DEBUG] addHardDisk: Disk already present.\n")
+	log.Printf("[DEBUG] addHardDisk: %#v\n", disk)
+	log.Printf("[DEBUG] addHardDisk capacity: %#v\n", disk.CapacityInKB)
 
-		return nil
+	// Without a capacity an existing vmdk is attached, otherwise the file
+	// is created.
+	config := &types.VirtualDeviceConfigSpec{
+		Operation: types.VirtualDeviceConfigSpecOperationAdd,
+		Device:    disk,
+	}
+	if disk.CapacityInKB != 0 {
+		config.FileOperation = types.VirtualDeviceConfigSpecFileOperationCreate
 	}
+	deviceChange = append(deviceChange, config)
+	devices = append(devices, disk)
+	return deviceChange, devices, nil
 }
 
 func getSCSIControllers(vmDevices object.VirtualDeviceList) []*types.VirtualController {
@@ -1405,14 +2135,17 @@ func getSCSIControllers(vmDevices object.VirtualDeviceList) []*types.VirtualCont
 func getNextUnitNumber(devices object.VirtualDeviceList, c types.BaseVirtualController) (int32, error) {
 	key := c.GetVirtualController().Key
 
-	var unitNumbers [16]bool
-	unitNumbers[7] = true
+	unitNumbers := make([]bool, scsiUnitNumberCount)
+	unitNumbers[scsiReservedUnitNumber] = true
+	if _, ok := c.(*types.VirtualNVMEController); ok {
+		unitNumbers = make([]bool, nvmeUnitNumberCount)
+	}
 
 	for _, device := range devices {
 		d := device.GetVirtualDevice()
 
 		if d.ControllerKey == key {
-			if d.UnitNumber != nil {
+			if d.UnitNumber != nil && int(*d.UnitNumber) < len(unitNumbers) {
 				unitNumbers[*d.UnitNumber] = true
 			}
 		}
@@ -1629,6 +2362,28 @@ func createCdroms(client *govmomi.Client, vm *object.VirtualMachine, datacenter
 	return nil
 }
 
+// placementSpec returns the placement of the virtual machine. A datastore
+// cluster places the spec build returns, in the folder of the virtual
+// machine.
+func (vm *virtualMachine) placementSpec(c *govmomi.Client, build func(sp object.StoragePod) types.StoragePlacementSpec) placementSpec {
+	spec := placementSpec{
+		cluster:      vm.cluster,
+		resourcePool: vm.resourcePool,
+		folder:       vm.folder,
+		datastore:    vm.datastore,
+		host:         vm.host,
+	}
+	if build != nil {
+		spec.podPlacement = func(pod types.ManagedObjectReference, pool *object.ResourcePool, folder *object.Folder) (types.StoragePlacementSpec, error) {
+			sps := build(object.StoragePod{Folder: object.NewFolder(c.Client, pod)})
+			fr := folder.Reference()
+			sps.Folder = &fr
+			return sps, nil
+		}
+	}
+	return spec
+}
+
 func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 	dc, err := getDatacenter(c, vm.datacenter)
 
@@ -1654,46 +2409,17 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		}
 	}
 
-	var resourcePool *object.ResourcePool
-	if vm.resourcePool == "" {
-		if vm.cluster == "" {
-			resourcePool, err = finder.DefaultResourcePool(context.TODO())
-			if err != nil {
-				return err
-			}
-		} else {
-			resourcePool, err = finder.ResourcePool(context.TODO(), "*"+vm.cluster+"/Resources")
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		resourcePool, err = finder.ResourcePool(context.TODO(), vm.resourcePool)
-		if err != nil {
-			return err
-		}
-	}
-	log.Printf("[DEBUG] resource pool: %#v", resourcePool)
-
 	dcFolders, err := dc.Folders(context.TODO())
 	if err != nil {
 		return err
 	}
-	log.Printf("[DEBUG] folder: %#v", vm.folder)
 
-	folder := dcFolders.VmFolder
-	if len(vm.folder) > 0 {
-		si := object.NewSearchIndex(c.Client)
-		folderRef, err := si.FindByInventoryPath(
-			context.TODO(), fmt.Sprintf("%v/vm/%v", vm.datacenter, vm.folder))
-		if err != nil {
-			return fmt.Errorf("Error reading folder %s: %s", vm.folder, err)
-		} else if folderRef == nil {
-			return fmt.Errorf("Cannot find folder %s", vm.folder)
-		} else {
-			folder = folderRef.(*object.Folder)
-		}
+	placementFinder := newPlacementFinder(c, finder, dc, dcFolders)
+	location, err := resolvePlacementLocation(placementFinder, vm.placementSpec(nil, nil))
+	if err != nil {
+		return err
 	}
+	resourcePool, folder := location.resourcePool, location.folder
 
 	// make config spec
 	configSpec := types.VirtualMachineConfigSpec{
@@ -1701,15 +2427,32 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		NumCPUs:           vm.vcpu,
 		NumCoresPerSocket: 1,
 		MemoryMB:          vm.memoryMb,
-		MemoryAllocation: &types.ResourceAllocationInfo{
-			Reservation: &vm.memoryAllocation.reservation,
-		},
+		CpuAllocation:     vm.cpuAllocation.buildResourceAllocationInfo(),
+		MemoryAllocation:  vm.memoryAllocation.buildResourceAllocationInfo(),
 		Flags: &types.VirtualMachineFlagInfo{
 			DiskUuidEnabled: &vm.enableDiskUUID,
 		},
+		Annotation: vm.annotation,
 	}
-	if vm.template == "" {
-		configSpec.GuestId = "otherLinux64Guest"
+	if vm.guestID != "" {
+		envBrowser, err := resourcePoolEnvironmentBrowser(c, resourcePool)
+		if err != nil {
+			return err
+		}
+		if err := checkGuestIDSupported(c, envBrowser, vm.guestID); err != nil {
+			return err
+		}
+		configSpec.GuestId = vm.guestID
+	} else if vm.template == "" {
+		configSpec.GuestId = defaultGuestID
+	}
+	if vm.bootOptions != nil {
+		configSpec.Firmware = vm.bootOptions.firmware
+	}
+	if vm.latencySensitivity != "" {
+		configSpec.LatencySensitivity = &types.LatencySensitivity{
+			Level: types.LatencySensitivitySensitivityLevel(vm.latencySensitivity),
+		}
 	}
 	log.Printf("[DEBUG] virtual machine config spec: %v", configSpec)
 
@@ -1731,44 +2474,16 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		log.Printf("[DEBUG] virtual machine Extra Config spec: %v", configSpec.ExtraConfig)
 	}
 
-	var datastore *object.Datastore
-	if vm.datastore == "" {
-		datastore, err = finder.DefaultDatastore(context.TODO())
-		if err != nil {
-			return err
-		}
-	} else {
-		datastore, err = finder.Datastore(context.TODO(), vm.datastore)
-		if err != nil {
-			// TODO: datastore cluster support in govmomi finder function
-			d, err := getDatastoreObject(c, dcFolders, vm.datastore)
-			if err != nil {
-				return err
-			}
-
-			if d.Type == "StoragePod" {
-				sp := object.StoragePod{
-					Folder: object.NewFolder(c.Client, d),
-				}
-
-				var sps types.StoragePlacementSpec
-				if vm.template != "" {
-					sps = buildStoragePlacementSpecClone(c, dcFolders, template, resourcePool, sp)
-				} else {
-					sps = buildStoragePlacementSpecCreate(dcFolders, resourcePool, sp, configSpec)
-				}
-
-				datastore, err = findDatastore(c, sps)
-				if err != nil {
-					return err
-				}
-			} else {
-				datastore = object.NewDatastore(c.Client, d)
-			}
+	spec := vm.placementSpec(c, func(sp object.StoragePod) types.StoragePlacementSpec {
+		if vm.template != "" {
+			return buildStoragePlacementSpecClone(c, dcFolders, template, resourcePool, sp)
 		}
+		return buildStoragePlacementSpecCreate(dcFolders, resourcePool, sp, configSpec)
+	})
+	if err := resolvePlacementDatastore(placementFinder, spec, location); err != nil {
+		return err
 	}
-
-	log.Printf("[DEBUG] datastore: %#v", datastore)
+	datastore := location.datastore
 
 	// network
 	networkDevices, networkConfigs, err := populateNetworkDeviceAndConfig(vm.networkInterfaces, vm.template, finder)
@@ -1785,26 +2500,35 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 			return err
 		}
 		log.Printf("[DEBUG] datastore: %#v", mds.Name)
-		scsi, err := object.SCSIControllerTypes().CreateSCSIController("scsi")
+		scsiType := vm.scsiType
+		if scsiType == "" {
+			scsiType = "scsi"
+		}
+		controllers, err := newDiskControllers(object.VirtualDeviceList{}, scsiType, vm.scsiControllerCount)
 		if err != nil {
-			log.Printf("[ERROR] %s", err)
+			return err
 		}
 
-		configSpec.DeviceChange = append(configSpec.DeviceChange, &types.VirtualDeviceConfigSpec{
-			Operation: types.VirtualDeviceConfigSpecOperationAdd,
-			Device:    scsi,
-		})
+		for _, controller := range controllers {
+			configSpec.DeviceChange = append(configSpec.DeviceChange, &types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationAdd,
+				Device:    controller,
+			})
+		}
 
 		configSpec.Files = &types.VirtualMachineFileInfo{VmPathName: fmt.Sprintf("[%s]", mds.Name)}
 
-		task, err = folder.CreateVM(context.TODO(), configSpec, resourcePool, nil)
+		task, err = folder.CreateVM(context.TODO(), configSpec, resourcePool, location.host)
 		if err != nil {
 			log.Printf("[ERROR] %s", err)
 		}
 
-		err = task.Wait(context.TODO())
+		err = vm.waitForTask(task, "create virtual machine "+vm.name)
 		if err != nil {
 			log.Printf("[ERROR] %s", err)
+			if vm.taskCtx != nil && vm.taskCtx.Err() != nil {
+				return err
+			}
 		}
 
 	} else {
@@ -1813,6 +2537,18 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		if err != nil {
 			return err
 		}
+		if location.host != nil {
+			hr := location.host.Reference()
+			relocateSpec.Host = &hr
+		}
+
+		// Disks of the template listed in template_disk_datastore are
+		// placed apart from the rest of the virtual machine.
+		diskLocators, err := vm.templateDiskLocators(c, dcFolders, template)
+		if err != nil {
+			return err
+		}
+		mergeDiskLocators(&relocateSpec, diskLocators)
 
 		log.Printf("[DEBUG] relocate spec: %v", relocateSpec)
 
@@ -1823,11 +2559,9 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 			Config:   &configSpec,
 			PowerOn:  false,
 		}
-		if vm.linkedClone {
-			if template_mo.Snapshot == nil {
-				return fmt.Errorf("`linkedClone=true`, but image VM has no snapshots")
-			}
-			cloneSpec.Snapshot = template_mo.Snapshot.CurrentSnapshot
+		cloneSpec.Snapshot, err = vm.cloneSnapshot(template_mo.Snapshot)
+		if err != nil {
+			return err
 		}
 		log.Printf("[DEBUG] clone spec: %v", cloneSpec)
 
@@ -1837,9 +2571,12 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		}
 	}
 
-	err = task.Wait(context.TODO())
+	err = vm.waitForTask(task, "create virtual machine "+vm.name)
 	if err != nil {
 		log.Printf("[ERROR] %s", err)
+		if vm.taskCtx != nil && vm.taskCtx.Err() != nil {
+			return err
+		}
 	}
 
 	newVM, err := finder.VirtualMachine(context.TODO(), vm.Path())
@@ -1873,6 +2610,17 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		return err
 	}
 
+	if err := vm.addSerialAndUsbDevices(newVM); err != nil {
+		return err
+	}
+
+	// A template brings its own controllers, add those it lacks.
+	if vm.template != "" {
+		if err := vm.addDiskControllers(newVM); err != nil {
+			return err
+		}
+	}
+
 	newVM.Properties(context.TODO(), newVM.Reference(), []string{"summary", "config"}, &vm_mo)
 	firstDisk := 0
 	if vm.template != "" {
@@ -1900,9 +2648,10 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		default:
 			return fmt.Errorf("[ERROR] setupVirtualMachine - Neither vmdk path nor vmdk name was given: %#v", vm.hardDisks[i])
 		}
-		err = addHardDisk(newVM, vm.hardDisks[i].size, vm.hardDisks[i].iops, vm.hardDisks[i].initType, datastore, diskPath, vm.hardDisks[i].controller)
+		disk := vm.hardDisks[i]
+		err = addHardDisk(newVM, disk.size, disk.iops, disk.initType, datastore, diskPath, disk.controller, disk.controllerNumber, disk.unitNumber)
 		if err != nil {
-			err2 := addHardDisk(newVM, vm.hardDisks[i].size, vm.hardDisks[i].iops, vm.hardDisks[i].initType, datastore, diskPath, vm.hardDisks[i].controller)
+			err2 := addHardDisk(newVM, disk.size, disk.iops, disk.initType, datastore, diskPath, disk.controller, disk.controllerNumber, disk.unitNumber)
 			if err2 != nil {
 				return err2
 			}
@@ -1910,11 +2659,37 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		}
 	}
 
+	// Boot order refers to device keys, so apply it once all devices exist.
+	if vm.bootOptions != nil {
+		devices, err := newVM.Device(context.TODO())
+		if err != nil {
+			return err
+		}
+		bootOpts, err := vm.bootOptions.buildBootOptions(devices)
+		if err != nil {
+			return err
+		}
+		task, err := newVM.Reconfigure(context.TODO(), types.VirtualMachineConfigSpec{
+			BootOptions: bootOpts,
+		})
+		if err != nil {
+			return err
+		}
+		err = vm.waitForTask(task, "set boot options of virtual machine "+vm.name)
+		if err != nil {
+			return err
+		}
+	}
+
 	if vm.skipCustomization || vm.template == "" {
 		log.Printf("[DEBUG] VM customization skipped")
 	} else {
 		var identity_options types.BaseCustomizationIdentitySettings
-		if strings.HasPrefix(template_mo.Config.GuestId, "win") {
+		guestID := template_mo.Config.GuestId
+		if vm.guestID != "" {
+			guestID = vm.guestID
+		}
+		if strings.HasPrefix(guestID, "win") {
 			var timeZone int
 			if vm.timeZone == "Etc/UTC" {
 				vm.timeZone = "085"
@@ -1957,11 +2732,13 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 				}
 			}
 
-			identity_options = &types.CustomizationSysprep{
+			sysprep := &types.CustomizationSysprep{
 				GuiUnattended:  guiUnattended,
 				Identification: customIdentification,
 				UserData:       userData,
 			}
+			vm.windowsOptionalConfig.setGuiRunOnce(sysprep)
+			identity_options = sysprep
 		} else {
 			identity_options = &types.CustomizationLinuxPrep{
 				HostName: &types.CustomizationFixedName{
@@ -1983,7 +2760,7 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		if err != nil {
 			return err
 		}
-		_, err = t.WaitForResult(context.TODO(), nil)
+		err = vm.waitForTask(t, "power on virtual machine "+vm.name)
 		if err != nil {
 			return err
 		}
@@ -1993,6 +2770,20 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 		}
 	}
 
+	if vm.faultTolerance != nil {
+		err = vm.faultTolerance.enableFaultTolerance(c, finder, newVM)
+		if err != nil {
+			return err
+		}
+	}
+
+	if vm.clusterOverrides != nil {
+		err = vm.clusterOverrides.applyClusterVmOverrides(c, newVM.Reference())
+		if err != nil {
+			return err
+		}
+	}
+
 	if vm.permission != nil {
 		err = vm.permission.setResourcePermission(newVM.Reference())
 		if err != nil {
@@ -2004,6 +2795,23 @@ func (vm *virtualMachine) setupVirtualMachine(c *govmomi.Client) error {
 	return nil
 }
 
+// runGuestSteps adds the routes, runs the post customization commands and
+// verifies the network in the guest of the powered on VM. Create runs them
+// once the ID is set, so a VM whose guest steps fail is tainted instead of
+// being left behind outside of the state.
+func (vm *virtualMachine) runGuestSteps(newVM *object.VirtualMachine) error {
+	if !vm.hasBootableVmdk && vm.template == "" {
+		return nil
+	}
+	if err := vm.addGuestRoutes(newVM, vm.guestAuth); err != nil {
+		return err
+	}
+	if err := vm.runPostCustomizationCommands(newVM); err != nil {
+		return err
+	}
+	return vm.verifyGuestNetwork()
+}
+
 func (vm *virtualMachine) customizeVm(newVM *object.VirtualMachine, identity_options types.BaseCustomizationIdentitySettings, networkConfigs []types.CustomizationAdapterMapping) error {
 
 	// create CustomizationSpec
@@ -2015,7 +2823,7 @@ func (vm *virtualMachine) customizeVm(newVM *object.VirtualMachine, identity_opt
 		},
 		NicSettingMap: networkConfigs,
 	}
-	log.Printf("[DEBUG] custom spec: %v", customSpec)
+	logRedactedf("[DEBUG] custom spec: %+v", customSpec)
 
 	log.Printf("[DEBUG] VM customization start")
 	taskb, err := newVM.Customize(context.TODO(), customSpec)
@@ -2023,10 +2831,21 @@ func (vm *virtualMachine) customizeVm(newVM *object.VirtualMachine, identity_opt
 		log.Printf(err.Error())
 		return err
 	}
-	_, err = taskb.WaitForResult(context.TODO(), nil)
+	err = vm.waitForTask(taskb, "customize virtual machine "+vm.name)
 	if err != nil {
 		return err
 	}
 	log.Printf("[DEBUG] VM customization finished")
 	return nil
 }
+
+// waitForTask waits on a virtual machine task within the timeout of the
+// running operation, logging its progress. Outside of a create or update the
+// wait is not limited.
+func (vm *virtualMachine) waitForTask(task *object.Task, operation string) error {
+	ctx := vm.taskCtx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	return taskTimeoutError(ctx, waitForTaskWithProgress(ctx, task, operation), operation, vm.taskTimeout)
+}
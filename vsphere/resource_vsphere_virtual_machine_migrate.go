@@ -15,14 +15,26 @@ func resourceVSphereVirtualMachineMigrateState(
 		return is, nil
 	}
 
+	var err error
 	switch v {
 	case 0:
 		log.Println("[INFO] Found Compute Instance State v0; migrating to v1")
-		is, err := migrateVSphereVirtualMachineStateV0toV1(is)
+		is, err = migrateVSphereVirtualMachineStateV0toV1(is)
 		if err != nil {
 			return is, err
 		}
-		return is, nil
+		fallthrough
+	case 1:
+		log.Println("[INFO] Found Compute Instance State v1; migrating to v2")
+		is, err = migrateVSphereVirtualMachineStateV1toV2(is, meta)
+		if err != nil {
+			return is, err
+		}
+		fallthrough
+	case 2:
+		// permission turned from a list into a set.
+		log.Println("[INFO] Found Compute Instance State v2; migrating to v3")
+		return is, migratePermissionListToSet(is)
 	default:
 		return is, fmt.Errorf("Unexpected schema version: %d", v)
 	}
@@ -60,3 +72,20 @@ func migrateVSphereVirtualMachineStateV0toV1(is *terraform.InstanceState) (*terr
 	log.Printf("[DEBUG] Attributes after migration: %#v", is.Attributes)
 	return is, nil
 }
+
+// migrateVSphereVirtualMachineStateV1toV2 rewrites the ID, which was the path
+// relative to the VM folder of the datacenter, to the canonical inventory
+// path.
+func migrateVSphereVirtualMachineStateV1toV2(is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if is.Empty() {
+		log.Println("[DEBUG] Empty VSphere Virtual Machine State; nothing to migrate.")
+		return is, nil
+	}
+
+	log.Printf("[DEBUG] ID before migration: %s", is.ID)
+	if err := migrateInventoryPathID(is, meta, "vm"); err != nil {
+		return is, err
+	}
+	log.Printf("[DEBUG] ID after migration: %s", is.ID)
+	return is, nil
+}
@@ -1,8 +1,10 @@
 package vsphere
 
 import (
+	"strconv"
 	"testing"
 
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
 
@@ -90,3 +92,90 @@ func TestComputeInstanceMigrateState_empty(t *testing.T) {
 		t.Fatalf("err: %#v", err)
 	}
 }
+
+func TestVSphereVirtualMachineMigrateState_canonicalID(t *testing.T) {
+	cases := map[string]struct {
+		ID         string
+		Attributes map[string]string
+		Expected   string
+	}{
+		"relative path": {
+			ID:         "web/frontend01",
+			Attributes: map[string]string{"datacenter": "dc1"},
+			Expected:   "/dc1/vm/web/frontend01",
+		},
+		"trailing slash in datacenter": {
+			ID:         "frontend01",
+			Attributes: map[string]string{"datacenter": "emea/dc1/"},
+			Expected:   "/emea/dc1/vm/frontend01",
+		},
+		"canonical already": {
+			ID:         "/dc1/vm/web/frontend01",
+			Attributes: map[string]string{"datacenter": "dc1"},
+			Expected:   "/dc1/vm/web/frontend01",
+		},
+		"default datacenter": {
+			ID:         "web/frontend01",
+			Attributes: map[string]string{"name": "frontend01"},
+			Expected:   "web/frontend01",
+		},
+	}
+
+	for tn, tc := range cases {
+		is := &terraform.InstanceState{
+			ID:         tc.ID,
+			Attributes: tc.Attributes,
+		}
+		is, err := resourceVSphereVirtualMachineMigrateState(1, is, nil)
+		if err != nil {
+			t.Fatalf("bad: %s, err: %#v", tn, err)
+		}
+		if is.ID != tc.Expected {
+			t.Fatalf("bad: %s, expected ID %q, got %q", tn, tc.Expected, is.ID)
+		}
+	}
+}
+
+func TestVSphereVirtualMachineMigrateState_permissionSet(t *testing.T) {
+	code := strconv.Itoa(schema.HashResource(permissionSchema().Elem.(*schema.Resource))(map[string]interface{}{
+		"user_name": "VSPHERE.LOCAL\\ops",
+		"role":      "ReadOnly",
+		"group":     true,
+		"propagate": true,
+	}))
+
+	is := &terraform.InstanceState{
+		ID: "/dc1/vm/web",
+		Attributes: map[string]string{
+			"permission.#":           "1",
+			"permission.0.user_name": "VSPHERE.LOCAL\\ops",
+			"permission.0.role":      "ReadOnly",
+			"permission.0.group":     "true",
+			"permission.0.propagate": "true",
+		},
+	}
+	is, err := resourceVSphereVirtualMachineMigrateState(2, is, nil)
+	if err != nil {
+		t.Fatalf("err: %#v", err)
+	}
+
+	expected := map[string]string{
+		"permission.#":                  "1",
+		"permission." + code + ".role":  "ReadOnly",
+		"permission." + code + ".group": "true",
+	}
+	for k, v := range expected {
+		if is.Attributes[k] != v {
+			t.Fatalf("expected %s to be %q, got %#v", k, v, is.Attributes)
+		}
+	}
+	if _, ok := is.Attributes["permission.0.user_name"]; ok {
+		t.Fatalf("expected the list key to be removed, got %#v", is.Attributes)
+	}
+
+	// A state which has the set already is left alone.
+	is, err = resourceVSphereVirtualMachineMigrateState(2, is, nil)
+	if err != nil || is.Attributes["permission."+code+".user_name"] != "VSPHERE.LOCAL\\ops" {
+		t.Fatalf("expected the set to be kept, got %#v, %v", is.Attributes, err)
+	}
+}
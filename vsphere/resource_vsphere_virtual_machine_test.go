@@ -3,15 +3,18 @@ package vsphere
 import (
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"path/filepath"
 
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/property"
@@ -1153,8 +1156,1096 @@ func TestAccVSphereVirtualMachine_mac_address(t *testing.T) {
 	})
 }
 
+const testAccCheckVSphereVirtualMachineConfig_annotation = `
+resource "vsphere_virtual_machine" "foo" {
+    name = "terraform-test"
+    annotation = <<EOT
+Managed by Terraform
+Build: acc-test
+EOT
+` + testAccTemplateBasicBodyWithEnd
+
+func TestAccVSphereVirtualMachine_annotation(t *testing.T) {
+	var vm virtualMachine
+	basic_vars := setupTemplateBasicBodyVars()
+	config := basic_vars.testSprintfTemplateBody(testAccCheckVSphereVirtualMachineConfig_annotation)
+
+	test_exists, test_name, test_cpu, test_uuid, test_mem, test_num_disk, test_num_of_nic, test_nic_label :=
+		TestFuncData{vm: vm, label: basic_vars.label}.testCheckFuncBasic()
+
+	log.Printf("[DEBUG] template= %s", testAccCheckVSphereVirtualMachineConfig_annotation)
+	log.Printf("[DEBUG] template config= %s", config)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testBasicPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckVSphereVirtualMachineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					test_exists, test_name, test_cpu, test_uuid, test_mem, test_num_disk, test_num_of_nic, test_nic_label,
+					resource.TestCheckResourceAttr(
+						"vsphere_virtual_machine.foo", "annotation", "Managed by Terraform\nBuild: acc-test\n"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVSphereVirtualMachine_validatorFunc(t *testing.T) {
+	var validatorCases = []attributeValueValidationTestSpec{
+		{name: "folder", validatorFn: validateFolderPath,
+			values: []attributeProperty{
+				{value: "", successCase: true},
+				{value: "web", successCase: true},
+				{value: "web/frontend", successCase: true},
+				{value: "/web", successCase: true},
+				{value: "web/", successCase: true},
+				{value: " web", successCase: true},
+				{value: "vm/web", successCase: true},
+				{value: "web//frontend", expErr: "must not contain empty path segments"},
+				{value: "web/../db", expErr: "must not contain relative path segments"},
+			},
+		},
+		{name: "datacenter", validatorFn: validateDatacenterName,
+			values: []attributeProperty{
+				{value: "dc1", successCase: true},
+				{value: "emea/dc1", successCase: true},
+				{value: "/dc1/", successCase: true},
+				{value: "emea//dc1", expErr: "must not contain empty path segments"},
+				{value: "dc1/vm", expErr: "not a folder inside it"},
+			},
+		},
+		{name: "firmware", validatorFn: validateFirmware,
+			values: []attributeProperty{
+				{value: "bios", successCase: true},
+				{value: "efi", successCase: true},
+				{value: "uefi", expErr: "Supported values are"},
+				{value: "", expErr: "Supported values are"},
+			},
+		},
+		{name: "boot_order", validatorFn: validateBootDevice,
+			values: []attributeProperty{
+				{value: "disk", successCase: true},
+				{value: "cdrom", successCase: true},
+				{value: "network", successCase: true},
+				{value: "floppy", successCase: true},
+				{value: "pxe", expErr: "Supported values are"},
+			},
+		},
+		{name: "connection_interface_index", validatorFn: validateConnectionInterfaceIndex,
+			values: []attributeProperty{
+				{value: 0, successCase: true},
+				{value: 2, successCase: true},
+				{value: -1, expErr: "must not be negative"},
+			},
+		},
+		{name: "boot_delay", validatorFn: validateBootDelay,
+			values: []attributeProperty{
+				{value: 0, successCase: true},
+				{value: 5000, successCase: true},
+				{value: -1, expErr: "out of allowed range"},
+				{value: 10001, expErr: "out of allowed range"},
+			},
+		},
+		{name: "drs_automation_level", validatorFn: validateDrsAutomationLevel,
+			values: []attributeProperty{
+				{value: "manual", successCase: true},
+				{value: "partiallyAutomated", successCase: true},
+				{value: "fullyAutomated", successCase: true},
+				{value: "automatic", expErr: "Supported values are"},
+			},
+		},
+		{name: "ha_restart_priority", validatorFn: validateHaRestartPriority,
+			values: []attributeProperty{
+				{value: "disabled", successCase: true},
+				{value: "high", successCase: true},
+				{value: "clusterRestartPriority", successCase: true},
+				{value: "urgent", expErr: "Supported values are"},
+			},
+		},
+		{name: "ha_isolation_response", validatorFn: validateHaIsolationResponse,
+			values: []attributeProperty{
+				{value: "none", successCase: true},
+				{value: "powerOff", successCase: true},
+				{value: "shutdown", successCase: true},
+				{value: "reboot", expErr: "Supported values are"},
+			},
+		},
+		{name: "cpu_share_level", validatorFn: validateSharesLevel,
+			values: []attributeProperty{
+				{value: "low", successCase: true},
+				{value: "normal", successCase: true},
+				{value: "high", successCase: true},
+				{value: "custom", successCase: true},
+				{value: "medium", expErr: "Supported values are"},
+			},
+		},
+		{name: "latency_sensitivity", validatorFn: validateLatencySensitivity,
+			values: []attributeProperty{
+				{value: "normal", successCase: true},
+				{value: "high", successCase: true},
+				{value: "low", expErr: "Supported values are"},
+			},
+		},
+		{name: "guest_id", validatorFn: validateGuestID,
+			values: []attributeProperty{
+				{value: "otherLinux64Guest", successCase: true},
+				{value: "windows9Server64Guest", successCase: true},
+				{value: "Guest", expErr: "not a vSphere guest OS identifier"},
+				{value: "rhel7", expErr: "not a vSphere guest OS identifier"},
+			},
+		},
+		{name: "serial_port.type", validatorFn: validateSerialPortType,
+			values: []attributeProperty{
+				{value: "network", successCase: true},
+				{value: "file", successCase: true},
+				{value: "pipe", expErr: "Supported values are"},
+			},
+		},
+		{name: "serial_port.direction", validatorFn: validateSerialPortDirection,
+			values: []attributeProperty{
+				{value: "server", successCase: true},
+				{value: "client", successCase: true},
+				{value: "both", expErr: "Supported values are"},
+			},
+		},
+		{name: "usb_controller", validatorFn: validateUsbControllerType,
+			values: []attributeProperty{
+				{value: "usb2", successCase: true},
+				{value: "usb3", successCase: true},
+				{value: "usb1", expErr: "Supported values are"},
+			},
+		},
+		{name: "scsi_type", validatorFn: validateScsiType,
+			values: []attributeProperty{
+				{value: "lsilogic", successCase: true},
+				{value: "pvscsi", successCase: true},
+				{value: "nvme", successCase: true},
+				{value: "buslogic", expErr: "Supported values are"},
+			},
+		},
+		{name: "scsi_controller_count", validatorFn: validateScsiControllerCount,
+			values: []attributeProperty{
+				{value: 1, successCase: true},
+				{value: 4, successCase: true},
+				{value: 0, expErr: "out of allowed range"},
+				{value: 5, expErr: "out of allowed range"},
+			},
+		},
+		{name: "controller_number", validatorFn: validateDiskControllerNumber,
+			values: []attributeProperty{
+				{value: 0, successCase: true},
+				{value: 3, successCase: true},
+				{value: 4, expErr: "out of allowed range"},
+			},
+		},
+		{name: "unit_number", validatorFn: validateDiskUnitNumber,
+			values: []attributeProperty{
+				{value: 0, successCase: true},
+				{value: 15, successCase: true},
+				{value: 16, expErr: "out of allowed range"},
+				{value: -1, expErr: "out of allowed range"},
+			},
+		},
+		{name: "ipv4_mode", validatorFn: validateIpv4AddressMode,
+			values: []attributeProperty{
+				{value: "dhcp", successCase: true},
+				{value: "static", successCase: true},
+				{value: "manual", successCase: true},
+				{value: "none", successCase: true},
+				{value: "autoconf", expErr: "Supported values are"},
+			},
+		},
+		{name: "ipv6_mode", validatorFn: validateIpv6AddressMode,
+			values: []attributeProperty{
+				{value: "dhcp", successCase: true},
+				{value: "autoconf", successCase: true},
+				{value: "none", successCase: true},
+				{value: "dhcpv6", expErr: "Supported values are"},
+			},
+		},
+		{name: "route.destination", validatorFn: validateRouteDestination,
+			values: []attributeProperty{
+				{value: "10.1.0.0/16", successCase: true},
+				{value: "2001:db8::/32", successCase: true},
+				{value: "10.1.0.0", expErr: "not a network in CIDR notation"},
+			},
+		},
+		{name: "route.gateway", validatorFn: validateRouteGateway,
+			values: []attributeProperty{
+				{value: "10.0.0.1", successCase: true},
+				{value: "fe80::1", successCase: true},
+				{value: "gateway", expErr: "not an IP address"},
+			},
+		},
+	}
+
+	verifySchemaValidationFunctions(t, validatorCases)
+}
+
+func TestAccVSphereVirtualMachine_normalizedInventoryPaths(t *testing.T) {
+	for in, out := range map[string]string{"/web/": "web", "vm/web/frontend": "web/frontend", " /vm/ ": ""} {
+		if v := folderPathStateFunc(in); v != out {
+			t.Fatalf("expected folder %q to be stored as %q, got %q", in, out, v)
+		}
+	}
+	if v := datacenterNameStateFunc("/emea/dc1/"); v != "emea/dc1" {
+		t.Fatalf("expected datacenter to be stored as emea/dc1, got %q", v)
+	}
+}
+
+func TestAccVSphereVirtualMachine_defaultBootOptions(t *testing.T) {
+	opts := defaultBootOptions()
+	bootOpts, err := opts.buildBootOptions(object.VirtualDeviceList{})
+	if err != nil {
+		t.Fatalf("buildBootOptions failed: %s", err)
+	}
+	if opts.firmware != string(types.GuestOsDescriptorFirmwareTypeBios) {
+		t.Fatalf("expected firmware bios, got %q", opts.firmware)
+	}
+	if bootOpts.EfiSecureBootEnabled == nil || *bootOpts.EfiSecureBootEnabled {
+		t.Fatalf("expected secure boot to be disabled, got %v", bootOpts.EfiSecureBootEnabled)
+	}
+
+	reset := map[string]bool{}
+	for _, ov := range opts.resetOptions() {
+		o := ov.GetOptionValue()
+		if o.Value != "" {
+			t.Fatalf("expected %s to be cleared, got %v", o.Key, o.Value)
+		}
+		reset[o.Key] = true
+	}
+	if !reset[bootDelayExtraConfigKey] || !reset[bootOrderExtraConfigKey] {
+		t.Fatalf("expected boot delay and boot order to be reset, got %v", reset)
+	}
+
+	configured := &bootOptions{bootDelay: 5000, bootOrder: []string{bootDeviceDisk}}
+	if ov := configured.resetOptions(); len(ov) != 0 {
+		t.Fatalf("expected no reset of configured boot options, got %d", len(ov))
+	}
+}
+
+func TestAccVSphereVirtualMachine_networkAddressModes(t *testing.T) {
+	// An address read from the guest does not turn a DHCP interface static.
+	err, nics := parseNetworkInterfaceData([]interface{}{
+		map[string]interface{}{"label": "lan", "ipv4_mode": "dhcp", "ipv4_address": "10.0.0.10", "ipv6_mode": "autoconf"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config, err := buildNetworkConfig(nics[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := config.Adapter.Ip.(*types.CustomizationDhcpIpGenerator); !ok {
+		t.Fatalf("expected DHCP for IPv4, got %T", config.Adapter.Ip)
+	}
+	if _, ok := config.Adapter.IpV6Spec.Ip[0].(*types.CustomizationAutoIpV6Generator); !ok {
+		t.Fatalf("expected autoconfiguration for IPv6, got %T", config.Adapter.IpV6Spec.Ip[0])
+	}
+
+	// Without a mode, an address still means a static interface.
+	err, nics = parseNetworkInterfaceData([]interface{}{
+		map[string]interface{}{"label": "lan", "ipv4_address": "10.0.0.10", "ipv4_prefix_length": 24, "ipv6_mode": "none"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config, err = buildNetworkConfig(nics[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ip, ok := config.Adapter.Ip.(*types.CustomizationFixedIp); !ok || ip.IpAddress != "10.0.0.10" {
+		t.Fatalf("expected a fixed IPv4 address, got %#v", config.Adapter.Ip)
+	}
+	if config.Adapter.IpV6Spec != nil {
+		t.Fatalf("expected IPv6 not to be customized, got %#v", config.Adapter.IpV6Spec)
+	}
+
+	err, _ = parseNetworkInterfaceData([]interface{}{
+		map[string]interface{}{"label": "lan", "ipv4_mode": "static"},
+	})
+	if err == nil || !regexp.MustCompile("ipv4_address is required").MatchString(err.Error()) {
+		t.Fatalf("expected missing address error, got: %v", err)
+	}
+}
+
+func TestAccVSphereVirtualMachine_ipv6OnlyNetwork(t *testing.T) {
+	err, nics := parseNetworkInterfaceData([]interface{}{
+		map[string]interface{}{"label": "lan", "ipv4_mode": "none", "ipv6_address": "2001:db8::10", "ipv6_prefix_length": 64, "ipv6_gateway": "2001:db8::1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config, err := buildNetworkConfig(nics[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := config.Adapter.Ip.(*types.CustomizationUnknownIpGenerator); !ok || config.Adapter.SubnetMask != "" {
+		t.Fatalf("expected IPv4 to be left unconfigured, got %#v", config.Adapter)
+	}
+	if ip, ok := config.Adapter.IpV6Spec.Ip[0].(*types.CustomizationFixedIpV6); !ok || ip.SubnetMask != 64 {
+		t.Fatalf("expected a fixed IPv6 address, got %#v", config.Adapter.IpV6Spec.Ip[0])
+	}
+
+	nics[0].ipv6PrefixLength = 0
+	if _, err = buildNetworkConfig(nics[0]); err == nil {
+		t.Fatalf("expected an error for a missing ipv6_prefix_length")
+	}
+
+	err, _ = parseNetworkInterfaceData([]interface{}{
+		map[string]interface{}{"label": "lan", "ipv4_mode": "none", "ipv6_mode": "none"},
+	})
+	if err == nil {
+		t.Fatalf("expected an error for an interface without addresses")
+	}
+
+	// The global address is read back rather than the link-local one, and
+	// used to connect.
+	devices := object.VirtualDeviceList{testNetworkCard(4000, "lan", "00:50:56:00:00:01")}
+	guestNics := []types.GuestNicInfo{
+		{
+			Network:        "lan",
+			DeviceConfigId: 4000,
+			IpConfig: &types.NetIpConfigInfo{
+				IpAddress: []types.NetIpConfigInfoIpAddress{
+					{IpAddress: "2001:db8::10", PrefixLength: 64},
+					{IpAddress: "fe80::250:56ff:fe00:1", PrefixLength: 64},
+				},
+			},
+		},
+	}
+	merged, _ := mergeNetworkInterfaces(nil, devices, guestNics)
+	if merged[0]["ipv6_address"] != "2001:db8::10" {
+		t.Fatalf("expected the global IPv6 address, got %#v", merged[0])
+	}
+	if connInfo := networkConnInfo(merged, 0, "linuxGuest", ""); connInfo["host"] != "2001:db8::10" {
+		t.Fatalf("expected to connect over IPv6, got %#v", connInfo)
+	}
+}
+
+func TestAccVSphereVirtualMachine_networkGateways(t *testing.T) {
+	interfaces := []interface{}{
+		map[string]interface{}{"label": "frontend", "ipv4_address": "10.0.0.10", "ipv4_prefix_length": 24, "ipv4_gateway": "10.0.0.1", "default_gateway": true},
+		map[string]interface{}{
+			"label": "backend", "ipv4_address": "10.0.1.10", "ipv4_prefix_length": 24, "ipv4_gateway": "10.0.1.1",
+			"route": []interface{}{
+				map[string]interface{}{"destination": "10.1.0.0/16", "gateway": "10.0.1.1"},
+			},
+		},
+	}
+	err, nics := parseNetworkInterfaceData(interfaces)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	frontend, _ := buildNetworkConfig(nics[0])
+	backend, _ := buildNetworkConfig(nics[1])
+	if len(frontend.Adapter.Gateway) != 1 || frontend.Adapter.Gateway[0] != "10.0.0.1" {
+		t.Fatalf("expected the default gateway on the frontend, got %#v", frontend.Adapter.Gateway)
+	}
+	if len(backend.Adapter.Gateway) != 0 {
+		t.Fatalf("expected no gateway on the backend, got %#v", backend.Adapter.Gateway)
+	}
+	if len(nics[1].routes) != 1 {
+		t.Fatalf("expected the backend route to be parsed, got %#v", nics[1].routes)
+	}
+
+	cmd := guestRouteCommand("centos64Guest", nics[1].routes[0])
+	if !strings.HasPrefix(cmd, "ip route replace 10.1.0.0/16 via 10.0.1.1 && ") {
+		t.Fatalf("unexpected Linux route command: %s", cmd)
+	}
+	// The route is kept in the network configuration as well.
+	if !strings.Contains(cmd, `line="10.1.0.0/16 via 10.0.1.1 dev $dev"`) || !strings.Contains(cmd, "+ipv4.routes") {
+		t.Fatalf("expected the Linux route to be persisted: %s", cmd)
+	}
+	if strings.Contains(cmd, "{{") {
+		t.Fatalf("unexpected placeholder in Linux route command: %s", cmd)
+	}
+	if cmd := guestRouteCommand("windows9Server64Guest", nics[1].routes[0]); cmd != "route -p add 10.1.0.0 mask 255.255.0.0 10.0.1.1" {
+		t.Fatalf("unexpected Windows route command: %s", cmd)
+	}
+
+	interfaces[1].(map[string]interface{})["default_gateway"] = true
+	err, _ = parseNetworkInterfaceData(interfaces)
+	if err == nil || !regexp.MustCompile("only one network interface").MatchString(err.Error()) {
+		t.Fatalf("expected a conflict of default gateways, got: %v", err)
+	}
+
+	_, err = parseNetworkRoutes([]interface{}{
+		map[string]interface{}{"destination": "2001:db8::/32", "gateway": "10.0.1.1"},
+	})
+	if err == nil {
+		t.Fatalf("expected an error for a gateway of another address family")
+	}
+}
+
+func TestAccVSphereVirtualMachine_diskMigrationSpec(t *testing.T) {
+	ds1 := types.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"}
+	ds2 := types.ManagedObjectReference{Type: "Datastore", Value: "datastore-2"}
+	targets := map[string]types.ManagedObjectReference{"ds1": ds1, "ds2": ds2}
+
+	spec := buildDiskMigrationSpec([]diskMigration{{key: 2000, datastore: "ds1"}}, targets, 2)
+	if spec.Datastore != nil {
+		t.Fatalf("configuration files should stay with the other disk: %#v", spec.Datastore)
+	}
+	if len(spec.Disk) != 1 || spec.Disk[0].DiskId != 2000 || spec.Disk[0].Datastore != ds1 {
+		t.Fatalf("bad disk locators: %#v", spec.Disk)
+	}
+
+	spec = buildDiskMigrationSpec([]diskMigration{{key: 2000, datastore: "ds2"}, {key: 2001, datastore: "ds2"}}, targets, 2)
+	if spec.Datastore == nil || *spec.Datastore != ds2 {
+		t.Fatalf("configuration files should move with all disks: %#v", spec.Datastore)
+	}
+
+	spec = buildDiskMigrationSpec([]diskMigration{{key: 2000, datastore: "ds1"}, {key: 2001, datastore: "ds2"}}, targets, 2)
+	if spec.Datastore != nil {
+		t.Fatalf("configuration files should stay when disks are split: %#v", spec.Datastore)
+	}
+}
+
+func TestAccVSphereVirtualMachine_templateDiskLocators(t *testing.T) {
+	disk := func(key int32, label string) types.BaseVirtualDevice {
+		return &types.VirtualDisk{VirtualDevice: types.VirtualDevice{
+			Key:        key,
+			DeviceInfo: &types.Description{Label: label},
+		}}
+	}
+	devices := object.VirtualDeviceList{disk(2000, "Hard disk 1"), disk(2001, "Hard disk 2")}
+	ds1 := types.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"}
+	ds2 := types.ManagedObjectReference{Type: "Datastore", Value: "datastore-2"}
+
+	locators, err := diskLocatorsByLabel(devices, map[string]types.ManagedObjectReference{"Hard disk 2": ds2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locators) != 1 || locators[0].DiskId != 2001 || locators[0].Datastore != ds2 {
+		t.Fatalf("bad disk locators: %#v", locators)
+	}
+	if _, err := diskLocatorsByLabel(devices, map[string]types.ManagedObjectReference{"Hard disk 3": ds2}); err == nil {
+		t.Fatal("expected an error for an unknown disk label")
+	}
+
+	// The locator of the clone keeps its backing and only moves.
+	spec := types.VirtualMachineRelocateSpec{
+		Datastore: &ds1,
+		Disk: []types.VirtualMachineRelocateSpecDiskLocator{
+			{DiskId: 2001, Datastore: ds1, DiskBackingInfo: &types.VirtualDiskFlatVer2BackingInfo{}},
+		},
+	}
+	mergeDiskLocators(&spec, append(locators, types.VirtualMachineRelocateSpecDiskLocator{DiskId: 2000, Datastore: ds2}))
+	if len(spec.Disk) != 2 {
+		t.Fatalf("bad disk locators: %#v", spec.Disk)
+	}
+	if spec.Disk[0].Datastore != ds2 || spec.Disk[0].DiskBackingInfo == nil {
+		t.Fatalf("existing locator not merged: %#v", spec.Disk[0])
+	}
+	if spec.Disk[1].DiskId != 2000 || spec.Disk[1].Datastore != ds2 {
+		t.Fatalf("locator not added: %#v", spec.Disk[1])
+	}
+}
+
+func TestAccVSphereVirtualMachine_templateSnapshot(t *testing.T) {
+	snapshot := func(id, name string, children ...types.VirtualMachineSnapshotTree) types.VirtualMachineSnapshotTree {
+		return types.VirtualMachineSnapshotTree{
+			Snapshot:          types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: id},
+			Name:              name,
+			ChildSnapshotList: children,
+		}
+	}
+	current := types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: "snapshot-3"}
+	info := &types.VirtualMachineSnapshotInfo{
+		CurrentSnapshot: &current,
+		RootSnapshotList: []types.VirtualMachineSnapshotTree{
+			snapshot("snapshot-1", "base", snapshot("snapshot-2", "patched"), snapshot("snapshot-3", "patched")),
+		},
+	}
+
+	if ref, err := findTemplateSnapshot(info, "base"); err != nil || ref.Value != "snapshot-1" {
+		t.Fatalf("expected snapshot-1 by name, got %v, %v", ref, err)
+	}
+	if ref, err := findTemplateSnapshot(info, "snapshot-2"); err != nil || ref.Value != "snapshot-2" {
+		t.Fatalf("expected snapshot-2 by ID, got %v, %v", ref, err)
+	}
+	if _, err := findTemplateSnapshot(info, "patched"); err == nil || !regexp.MustCompile("snapshot-2, snapshot-3").MatchString(err.Error()) {
+		t.Fatalf("expected an ambiguous name error, got %v", err)
+	}
+	if _, err := findTemplateSnapshot(info, "golden"); err == nil {
+		t.Fatal("expected an error for an unknown snapshot")
+	}
+
+	vm := virtualMachine{linkedClone: true}
+	if ref, err := vm.cloneSnapshot(info); err != nil || *ref != current {
+		t.Fatalf("expected the current snapshot for a linked clone, got %v, %v", ref, err)
+	}
+	vm = virtualMachine{}
+	if ref, err := vm.cloneSnapshot(info); err != nil || ref != nil {
+		t.Fatalf("expected no snapshot for a full clone, got %v, %v", ref, err)
+	}
+}
+
+func TestAccVSphereVirtualMachine_connInfo(t *testing.T) {
+	nics := []map[string]interface{}{
+		{"label": "frontend", "ipv4_address": "10.0.0.10"},
+		{"label": "backend", "ipv4_address": "10.0.1.10"},
+	}
+
+	connInfo := networkConnInfo(nics, 0, "linuxGuest", "")
+	if connInfo["type"] != "ssh" || connInfo["host"] != "10.0.0.10" {
+		t.Fatalf("unexpected Linux connection info: %#v", connInfo)
+	}
+	connInfo = networkConnInfo(nics, 1, "windowsGuest", "")
+	if connInfo["type"] != "winrm" || connInfo["host"] != "10.0.1.10" || connInfo["port"] != "5985" {
+		t.Fatalf("unexpected Windows connection info: %#v", connInfo)
+	}
+	// Without VMware Tools the guest ID tells Windows apart.
+	if connInfo = networkConnInfo(nics, 0, "", "windows9Server64Guest"); connInfo["type"] != "winrm" {
+		t.Fatalf("expected WinRM from the guest ID, got %#v", connInfo)
+	}
+	if connInfo = networkConnInfo(nics, 2, "linuxGuest", ""); connInfo != nil {
+		t.Fatalf("expected no connection info out of range, got %#v", connInfo)
+	}
+}
+
+func TestAccVSphereVirtualMachine_permissionReadBack(t *testing.T) {
+	roles := object.AuthorizationRoleList{
+		{RoleId: -1, Name: "Admin"},
+		{RoleId: -2, Name: "ReadOnly"},
+	}
+	perms := []types.Permission{
+		{Principal: "VSPHERE.LOCAL\\ops", Group: true, RoleId: -1, Propagate: true},
+		{Principal: "VSPHERE.LOCAL\\jdoe", RoleId: -2},
+	}
+
+	perm, err := flattenEntityPermission(perms, roles, "vsphere.local\\jdoe", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(perm) != 1 {
+		t.Fatalf("expected the permission of jdoe, got %#v", perm)
+	}
+	m := perm[0].(map[string]interface{})
+	if m["role"] != "ReadOnly" || m["propagate"] != false || m["user_name"] != "vsphere.local\\jdoe" {
+		t.Fatalf("unexpected permission: %#v", m)
+	}
+
+	// The user is not the group of the same name.
+	perm, err = flattenEntityPermission(perms, roles, "VSPHERE.LOCAL\\ops", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(perm) != 0 {
+		t.Fatalf("expected no permission for the user ops, got %#v", perm)
+	}
+
+	perms[1].RoleId = -3
+	if _, err = flattenEntityPermission(perms, roles, "VSPHERE.LOCAL\\jdoe", false); err == nil {
+		t.Fatalf("expected an error for an unknown role")
+	}
+}
+
+func TestAccVSphereVirtualMachine_multiplePermissions(t *testing.T) {
+	s := map[string]*schema.Schema{
+		"permission": permissionSchema(),
+	}
+
+	d := schema.TestResourceDataRaw(t, s, map[string]interface{}{
+		"permission": []interface{}{
+			map[string]interface{}{"user_name": "VSPHERE.LOCAL\\jdoe", "role": "ReadOnly"},
+			map[string]interface{}{"user_name": "VSPHERE.LOCAL\\ops", "role": "Admin", "group": true, "propagate": false},
+		},
+	})
+	perms := parseUserPermissions(d.Get("permission").(*schema.Set).List())
+	if len(perms) != 2 {
+		t.Fatalf("expected 2 permissions, got %#v", perms)
+	}
+	for _, p := range perms {
+		if p.group && p.propagate {
+			t.Fatalf("expected the group permission not to propagate: %#v", p)
+		}
+		if !p.group && !p.propagate {
+			t.Fatalf("expected the user permission to propagate by default: %#v", p)
+		}
+	}
+	if err := validatePermissions(perms); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A user and a group of the same name are different principals.
+	perms = append(perms, &userPermission{userName: "vsphere.local\\ops", roleName: "ReadOnly"})
+	if err := validatePermissions(perms); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	perms = append(perms, &userPermission{userName: "vsphere.local\\JDOE", roleName: "Admin"})
+	if err := validatePermissions(perms); err == nil {
+		t.Fatalf("expected an error for two roles of the same user")
+	}
+}
+
+func TestAccVSphereVirtualMachine_diskControllers(t *testing.T) {
+	controllers, err := newDiskControllers(object.VirtualDeviceList{}, "pvscsi", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(controllers) != 3 {
+		t.Fatalf("expected 3 controllers, got %d", len(controllers))
+	}
+	devices := object.VirtualDeviceList(controllers)
+	for bus := int32(0); bus < 3; bus++ {
+		c, err := findDiskControllerByBus(devices, bus)
+		if err != nil {
+			t.Fatalf("expected controller %d: %s", bus, err)
+		}
+		if _, ok := c.(*types.ParaVirtualSCSIController); !ok {
+			t.Fatalf("expected a pvscsi controller on bus %d, got %T", bus, c)
+		}
+	}
+	if scsiType, count := readDiskControllers(devices); scsiType != "pvscsi" || count != 3 {
+		t.Fatalf("expected 3 pvscsi controllers to be read, got %d %s", count, scsiType)
+	}
+
+	// Only the missing controllers are added.
+	more, err := newDiskControllers(devices, "pvscsi", 4)
+	if err != nil || len(more) != 1 {
+		t.Fatalf("expected one more controller, got %d: %v", len(more), err)
+	}
+
+	_, err = newDiskControllers(devices, "lsilogic", 2)
+	if err == nil || !regexp.MustCompile("is of type pvscsi").MatchString(err.Error()) {
+		t.Fatalf("expected controller type conflict, got: %v", err)
+	}
+
+	nvme, err := newDiskControllers(object.VirtualDeviceList{}, "nvme", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := nvme[0].(types.BaseVirtualController)
+	if _, err := pickUnitNumber(object.VirtualDeviceList(nvme), c, 7); err != nil {
+		t.Fatalf("expected unit 7 to be usable on NVMe: %s", err)
+	}
+	if _, err := pickUnitNumber(object.VirtualDeviceList(nvme), c, 15); err == nil {
+		t.Fatalf("expected unit 15 to be out of range on NVMe")
+	}
+	if _, err := pickUnitNumber(devices, devices[0].(types.BaseVirtualController), 7); err == nil {
+		t.Fatalf("expected unit 7 to be reserved on SCSI")
+	}
+}
+
+func TestAccVSphereVirtualMachine_hardDiskSpecs(t *testing.T) {
+	datastore := object.NewDatastore(nil, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"})
+
+	// The controller the first disk needs is part of the same changes.
+	changes, devices, err := buildHardDiskSpecs(object.VirtualDeviceList{}, 10, 0, "thin", datastore, "vm/data.vmdk", "scsi", 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected a controller and a disk to be added, got %d changes", len(changes))
+	}
+	controller := changes[0].GetVirtualDeviceConfigSpec().Device
+	if _, ok := controller.(types.BaseVirtualSCSIController); !ok {
+		t.Fatalf("expected a SCSI controller to be added first, got %T", controller)
+	}
+	disk := changes[1].GetVirtualDeviceConfigSpec()
+	if disk.FileOperation != types.VirtualDeviceConfigSpecFileOperationCreate {
+		t.Fatalf("expected the disk file to be created, got %q", disk.FileOperation)
+	}
+	if disk.Device.GetVirtualDevice().ControllerKey != controller.GetVirtualDevice().Key {
+		t.Fatalf("expected the disk to be attached to the new controller")
+	}
+
+	// A second disk reuses the controller and takes the next unit and key.
+	more, devices, err := buildHardDiskSpecs(devices, 0, 0, "thin", datastore, "vm/existing.vmdk", "scsi", 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(more) != 1 {
+		t.Fatalf("expected only a disk to be added, got %d changes", len(more))
+	}
+	second := more[0].GetVirtualDeviceConfigSpec()
+	if second.FileOperation != "" {
+		t.Fatalf("expected an existing vmdk to be attached, got file operation %q", second.FileOperation)
+	}
+	if *second.Device.GetVirtualDevice().UnitNumber == *disk.Device.GetVirtualDevice().UnitNumber {
+		t.Fatalf("expected the disks to use different unit numbers")
+	}
+	if second.Device.GetVirtualDevice().Key == disk.Device.GetVirtualDevice().Key {
+		t.Fatalf("expected the disks to use different keys")
+	}
+	if len(devices) != 3 {
+		t.Fatalf("expected 3 devices to be tracked, got %d", len(devices))
+	}
+}
+
+func testNetworkCard(key int32, label string, mac string) *types.VirtualVmxnet3 {
+	return &types.VirtualVmxnet3{
+		VirtualVmxnet: types.VirtualVmxnet{
+			VirtualEthernetCard: types.VirtualEthernetCard{
+				VirtualDevice: types.VirtualDevice{
+					Key: key,
+					Backing: &types.VirtualEthernetCardNetworkBackingInfo{
+						VirtualDeviceDeviceBackingInfo: types.VirtualDeviceDeviceBackingInfo{DeviceName: label},
+					},
+				},
+				MacAddress: mac,
+			},
+		},
+	}
+}
+
+func TestAccVSphereVirtualMachine_networkInterfaceOrder(t *testing.T) {
+	devices := object.VirtualDeviceList{
+		testNetworkCard(4000, "frontend", "00:50:56:00:00:01"),
+		testNetworkCard(4001, "backend", "00:50:56:00:00:02"),
+	}
+	guestNics := []types.GuestNicInfo{
+		{Network: "backend", MacAddress: "00:50:56:00:00:02", DeviceConfigId: 4001},
+		{Network: "frontend", MacAddress: "00:50:56:00:00:01", DeviceConfigId: 4000},
+		{Network: "", DeviceConfigId: -1},
+	}
+
+	// Before the first read, the interfaces take the NICs by device key.
+	current := []interface{}{
+		map[string]interface{}{"label": "frontend"},
+		map[string]interface{}{"label": "backend"},
+	}
+	networkInterfaces, byGuestIndex := mergeNetworkInterfaces(current, devices, guestNics)
+	if len(networkInterfaces) != 2 {
+		t.Fatalf("expected 2 network interfaces, got %d", len(networkInterfaces))
+	}
+	if networkInterfaces[0]["deviceId"] != 4000 || networkInterfaces[1]["deviceId"] != 4001 {
+		t.Fatalf("expected interfaces in device key order, got %#v", networkInterfaces)
+	}
+	if byGuestIndex[0]["label"] != "backend" {
+		t.Fatalf("expected guest NIC 0 to be the backend interface, got %#v", byGuestIndex[0])
+	}
+
+	// Later reads keep the order of the state, even if the guest reorders.
+	current = []interface{}{
+		map[string]interface{}{"label": "backend", "deviceId": 4001},
+		map[string]interface{}{"label": "frontend", "deviceId": 4000},
+	}
+	networkInterfaces, _ = mergeNetworkInterfaces(current, devices, guestNics)
+	if networkInterfaces[0]["mac_address"] != "00:50:56:00:00:02" || networkInterfaces[1]["mac_address"] != "00:50:56:00:00:01" {
+		t.Fatalf("expected interfaces in state order, got %#v", networkInterfaces)
+	}
+
+	// NICs unknown to the state are appended.
+	networkInterfaces, _ = mergeNetworkInterfaces(current[:1], devices, guestNics)
+	if len(networkInterfaces) != 2 || networkInterfaces[1]["deviceId"] != 4000 {
+		t.Fatalf("expected the unknown NIC to be appended, got %#v", networkInterfaces)
+	}
+}
+
+func TestAccVSphereVirtualMachine_networkInterfaceDevices(t *testing.T) {
+	devices := object.VirtualDeviceList{
+		testNetworkCard(4000, "frontend", "00:50:56:00:00:01"),
+		testNetworkCard(4001, "backend", "00:50:56:00:00:02"),
+	}
+	guestNics := []types.GuestNicInfo{
+		{
+			Network:        "backend",
+			DeviceConfigId: 4001,
+			IpConfig: &types.NetIpConfigInfo{
+				IpAddress: []types.NetIpConfigInfoIpAddress{{IpAddress: "10.0.1.10", PrefixLength: 24}},
+			},
+		},
+		{Network: "frontend", DeviceConfigId: 4000},
+	}
+
+	// The guest addresses are merged onto the NIC of the device.
+	current := []interface{}{
+		map[string]interface{}{"label": "frontend"},
+		map[string]interface{}{"label": "backend"},
+	}
+	networkInterfaces, byGuestIndex := mergeNetworkInterfaces(current, devices, guestNics)
+	if byGuestIndex[0]["ipv4_address"] != "10.0.1.10" || networkInterfaces[1]["ipv4_address"] != "10.0.1.10" {
+		t.Fatalf("expected the guest address on the backend interface, got %#v", networkInterfaces)
+	}
+
+	// Without VMware Tools the NICs are still read from the devices and
+	// the last known addresses kept.
+	current = []interface{}{
+		map[string]interface{}{"label": "frontend", "deviceId": 4000, "ipv4_address": "10.0.0.10"},
+	}
+	networkInterfaces, _ = mergeNetworkInterfaces(current, devices, nil)
+	if len(networkInterfaces) != 2 || networkInterfaces[1]["label"] != "backend" {
+		t.Fatalf("expected the unknown NIC to be appended, got %#v", networkInterfaces)
+	}
+	if networkInterfaces[0]["ipv4_address"] != "10.0.0.10" {
+		t.Fatalf("expected the last known address to be kept, got %#v", networkInterfaces[0])
+	}
+
+	// Interfaces of removed NICs are dropped.
+	networkInterfaces, _ = mergeNetworkInterfaces(current, devices[1:], nil)
+	if len(networkInterfaces) != 1 || networkInterfaces[0]["deviceId"] != 4001 {
+		t.Fatalf("expected only the remaining NIC, got %#v", networkInterfaces)
+	}
+}
+
+func TestAccVSphereVirtualMachine_nicBandwidth(t *testing.T) {
+	if b, err := parseNicBandwidth(map[string]interface{}{"label": "lan"}); b != nil || err != nil {
+		t.Fatalf("expected no allocation, got %#v (%v)", b, err)
+	}
+
+	b, err := parseNicBandwidth(map[string]interface{}{"bandwidth_reservation": 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocation := b.resourceAllocation()
+	if *allocation.Reservation != 100 || *allocation.Limit != -1 || allocation.Share.Level != types.SharesLevelNormal {
+		t.Fatalf("unexpected allocation %#v", allocation)
+	}
+	networkInterface := make(map[string]interface{})
+	flattenNicBandwidth(networkInterface, allocation)
+	if networkInterface["bandwidth_reservation"] != 100 || networkInterface["bandwidth_limit"] != -1 {
+		t.Fatalf("unexpected network interface %#v", networkInterface)
+	}
+
+	for _, network := range []map[string]interface{}{
+		{"bandwidth_reservation": 200, "bandwidth_limit": 100},
+		{"bandwidth_share_level": "custom"},
+	} {
+		if _, err := parseNicBandwidth(network); err == nil {
+			t.Fatalf("expected an error for %#v", network)
+		}
+	}
+
+	old := []interface{}{map[string]interface{}{"label": "lan", "deviceId": 4000, "bandwidth_limit": 100}}
+	limited := []interface{}{map[string]interface{}{"label": "lan", "deviceId": 4000, "bandwidth_limit": 200}}
+	if !onlyNicBandwidthChanged(old, limited) {
+		t.Fatal("expected a changed bandwidth_limit to be changed in place")
+	}
+	moved := []interface{}{map[string]interface{}{"label": "dmz", "deviceId": 4000, "bandwidth_limit": 200}}
+	if onlyNicBandwidthChanged(old, moved) || onlyNicBandwidthChanged(old, append(limited, moved...)) {
+		t.Fatal("expected other changes to replace the network interfaces")
+	}
+}
+
+func TestAccVSphereVirtualMachine_networkVerification(t *testing.T) {
+	addresses := staticAddresses([]networkInterface{
+		{label: "frontend", ipv4Mode: addressModeStatic, ipv4Address: "10.0.0.5", ipv6Mode: addressModeDhcp},
+		{label: "backend", ipv4Mode: addressModeDhcp, ipv6Mode: addressModeStatic, ipv6Address: "fd00::5"},
+	})
+	if len(addresses) != 2 || addresses["frontend"][0] != "10.0.0.5" || addresses["backend"][0] != "fd00::5" {
+		t.Fatalf("unexpected static addresses %#v", addresses)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if err := probeAddress(context.TODO(), "127.0.0.1", port, 100*time.Millisecond); err != nil {
+		t.Fatalf("expected the listener to answer, got %s", err)
+	}
+	l.Close()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 300*time.Millisecond)
+	defer cancel()
+	if err := probeAddress(ctx, "127.0.0.1", port, 100*time.Millisecond); err == nil {
+		t.Fatal("expected an error for a closed port")
+	}
+}
+
+func TestAccVSphereVirtualMachine_customizationTrigger(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceVSphereVirtualMachine().Schema, map[string]interface{}{
+		"name": "web1.example.com",
+		"disk": []interface{}{
+			map[string]interface{}{"template": "tmpl"},
+		},
+		"network_interface": []interface{}{
+			map[string]interface{}{"label": "lan", "ipv4_address": "10.0.0.5", "ipv4_prefix_length": 24},
+		},
+	})
+	vm := prepareVMforUpdate(d)
+
+	identity, netConf, err := vm.recustomization(d, "centos64Guest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prep, ok := identity.(*types.CustomizationLinuxPrep); !ok || prep.HostName.(*types.CustomizationFixedName).Name != "web1" {
+		t.Fatalf("unexpected identity %#v", identity)
+	}
+	if len(netConf) != 1 || netConf[0].Adapter.Ip.(*types.CustomizationFixedIp).IpAddress != "10.0.0.5" {
+		t.Fatalf("unexpected network settings %#v", netConf)
+	}
+
+	if _, _, err := vm.recustomization(d, "windows9Server64Guest"); err == nil {
+		t.Fatal("expected an error for a Windows guest")
+	}
+	vm.skipCustomization = true
+	if _, _, err := vm.recustomization(d, "centos64Guest"); err == nil {
+		t.Fatal("expected an error with skip_customization")
+	}
+	vm.skipCustomization = false
+	vm.template = ""
+	if _, _, err := vm.recustomization(d, "centos64Guest"); err == nil {
+		t.Fatal("expected an error without a template")
+	}
+}
+
+func TestAccVSphereVirtualMachine_diskResize(t *testing.T) {
+	disk := map[string]interface{}{"name": "data"}
+	if err := validateDiskResize(disk, 10, 20); err != nil {
+		t.Fatalf("expected growing a disk to pass, got: %s", err)
+	}
+	err := validateDiskResize(disk, 20, 10)
+	if err == nil || !regexp.MustCompile("cannot be shrunk").MatchString(err.Error()) {
+		t.Fatalf("expected shrink error, got: %v", err)
+	}
+
+	spec := guestCommandSpec("centos64Guest", "growpart /dev/sdb 1 && echo 'done'")
+	if spec.ProgramPath != "/bin/sh" || spec.Arguments != `-c 'growpart /dev/sdb 1 && echo '\''done'\'''` {
+		t.Fatalf("unexpected linux guest command: %s %s", spec.ProgramPath, spec.Arguments)
+	}
+	spec = guestCommandSpec("windows9Server64Guest", "diskpart /s extend.txt")
+	if spec.ProgramPath != `C:\Windows\System32\cmd.exe` || spec.Arguments != "/c diskpart /s extend.txt" {
+		t.Fatalf("unexpected windows guest command: %s %s", spec.ProgramPath, spec.Arguments)
+	}
+
+	command, err := guestResizeCommand(map[string]interface{}{"name": "data", "guest_resize_template": "growpart", "guest_resize_target": "/data"})
+	if err != nil || !regexp.MustCompile(`xfs_growfs "/data"`).MatchString(command) {
+		t.Fatalf("unexpected growpart command: %q, %v", command, err)
+	}
+	if !strings.Contains(command, "pvresize") || !strings.Contains(command, `lvextend -l +100%FREE "$src"`) {
+		t.Fatalf("growpart command does not grow LVM volumes: %q", command)
+	}
+	command, err = guestResizeCommand(map[string]interface{}{"name": "data", "guest_resize_template": "diskpart", "guest_resize_target": "d:"})
+	if err != nil || !regexp.MustCompile(`echo select volume D& echo extend`).MatchString(command) {
+		t.Fatalf("unexpected diskpart command: %q, %v", command, err)
+	}
+	for _, disk := range []map[string]interface{}{
+		{"name": "data", "guest_resize_template": "growpart", "guest_resize_command": "resize2fs /dev/sdb"},
+		{"name": "data", "guest_resize_template": "growpart", "guest_resize_target": "data"},
+		{"name": "data", "guest_resize_template": "diskpart", "guest_resize_target": "/data"},
+	} {
+		if _, err := guestResizeCommand(disk); err == nil {
+			t.Fatalf("expected an error for %#v", disk)
+		}
+	}
+}
+
+func TestAccVSphereVirtualMachine_customizationHooks(t *testing.T) {
+	sysprep := &types.CustomizationSysprep{}
+	windowsOptConfig{adminPassword: "secret", runOnceCommands: []string{"agent.exe /register"}}.setGuiRunOnce(sysprep)
+	if sysprep.GuiRunOnce == nil || sysprep.GuiRunOnce.CommandList[0] != "agent.exe /register" {
+		t.Fatalf("expected the run once commands, got %#v", sysprep.GuiRunOnce)
+	}
+	if !sysprep.GuiUnattended.AutoLogon || sysprep.GuiUnattended.AutoLogonCount != 1 {
+		t.Fatalf("expected a single automatic logon, got %#v", sysprep.GuiUnattended)
+	}
+
+	vm := &virtualMachine{template: "tmpl", postCustomizationCommands: []string{"agent register"}}
+	if err := vm.validatePostCustomizationCommands(); err == nil || !regexp.MustCompile("guest_credentials").MatchString(err.Error()) {
+		t.Fatalf("expected an error without guest_credentials, got %v", err)
+	}
+	vm.guestAuth = &types.NamePasswordAuthentication{Username: "root"}
+	if err := vm.validatePostCustomizationCommands(); err != nil {
+		t.Fatal(err)
+	}
+	vm.skipCustomization = true
+	if err := vm.validatePostCustomizationCommands(); err == nil {
+		t.Fatal("expected an error without customization")
+	}
+
+	if done, err := customizationResult([]types.BaseEvent{&types.CustomizationStartedEvent{}}); done || err != nil {
+		t.Fatalf("expected a started customization to be pending, got %t %v", done, err)
+	}
+	if done, err := customizationResult([]types.BaseEvent{&types.CustomizationSucceeded{}}); !done || err != nil {
+		t.Fatalf("expected a succeeded customization, got %t %v", done, err)
+	}
+	if done, err := customizationResult([]types.BaseEvent{&types.CustomizationLinuxIdentityFailed{}}); !done || err == nil {
+		t.Fatalf("expected a failed customization, got %t %v", done, err)
+	}
+}
+
+func TestAccVSphereVirtualMachine_domainJoin(t *testing.T) {
+	if err := (windowsOptConfig{}).validateDomainJoin(); err != nil {
+		t.Fatalf("expected no domain join to pass, got %s", err)
+	}
+	join := windowsOptConfig{domain: "corp.example.com", domainUser: "admin", domainUserPassword: "secret"}
+	if err := join.validateDomainJoin(); err != nil {
+		t.Fatal(err)
+	}
+	join.domainUserPassword = ""
+	if err := join.validateDomainJoin(); err == nil {
+		t.Fatal("expected an error for a domain join without password")
+	}
+}
+
+func TestAccVSphereVirtualMachine_serialAndUsbDevices(t *testing.T) {
+	s := map[string]*schema.Schema{
+		"serial_port":    serialPortSchema(),
+		"usb_controller": usbControllerSchema(),
+		"usb_device":     usbDeviceSchema(),
+	}
+
+	d := schema.TestResourceDataRaw(t, s, map[string]interface{}{
+		"serial_port": []interface{}{
+			map[string]interface{}{"type": "network", "uri": "telnet://:23000"},
+			map[string]interface{}{"type": "file", "datastore": "datastore1", "path": "vm/console.log"},
+		},
+		"usb_device": []interface{}{
+			map[string]interface{}{"device_name": "vid:0x0529 pid:0x0001"},
+		},
+	})
+	ports, err := parseSerialPortData(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(ports) != 2 || ports[0].direction != "server" || !ports[0].yield {
+		t.Fatalf("unexpected serial ports: %#v", ports)
+	}
+	port := ports[1].buildSerialPort(object.VirtualDeviceList{})
+	if backing, ok := port.Backing.(*types.VirtualSerialPortFileBackingInfo); !ok || backing.FileName != "[datastore1] vm/console.log" {
+		t.Fatalf("unexpected file backing: %#v", port.Backing)
+	}
+
+	// A USB controller is added for the devices if the VM has none.
+	usb := parseUsbData(d)
+	if controllers := usb.buildUsbControllers(object.VirtualDeviceList{}); len(controllers) != 1 {
+		t.Fatalf("expected a USB controller to be added, got %d", len(controllers))
+	}
+	existing := object.VirtualDeviceList{&types.VirtualUSBXHCIController{}}
+	if controllers := usb.buildUsbControllers(existing); len(controllers) != 0 {
+		t.Fatalf("expected the existing USB controller to be used, got %d new", len(controllers))
+	}
+
+	// The devices read back match the configuration.
+	var devices object.VirtualDeviceList
+	for _, p := range ports {
+		devices = append(devices, p.buildSerialPort(devices))
+	}
+	devices = append(devices, usb.buildUsbControllers(devices)...)
+	devices = append(devices, usb.devices[0].buildUsbDevice(devices))
+	if err := readSerialAndUsbDevices(devices, d); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	read, err := parseSerialPortData(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(read) != 2 || read[0].uri != "telnet://:23000" || read[1].datastore != "datastore1" || read[1].path != "vm/console.log" {
+		t.Fatalf("unexpected serial ports read: %#v", read)
+	}
+	if name := d.Get("usb_device.0.device_name").(string); name != "vid:0x0529 pid:0x0001" {
+		t.Fatalf("unexpected USB device read: %s", name)
+	}
+
+	d = schema.TestResourceDataRaw(t, s, map[string]interface{}{
+		"serial_port": []interface{}{
+			map[string]interface{}{"type": "file", "uri": "telnet://:23000"},
+		},
+	})
+	if _, err := parseSerialPortData(d); err == nil || !regexp.MustCompile("needs datastore and path").MatchString(err.Error()) {
+		t.Fatalf("expected file backing error, got: %v", err)
+	}
+}
+
 func testAccCheckVSphereVirtualMachineDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*govmomi.Client)
+	client := testAccProvider.Meta().(*VSphereClient).vimClient
 	finder := find.NewFinder(client.Client, true)
 
 	for _, rs := range s.RootModule().Resources {
@@ -1206,7 +2297,7 @@ func testAccCheckVSphereVirtualMachineExistsHasCustomConfig(n string, vm *virtua
 			return fmt.Errorf("No ID is set")
 		}
 
-		client := testAccProvider.Meta().(*govmomi.Client)
+		client := testAccProvider.Meta().(*VSphereClient).vimClient
 		finder := find.NewFinder(client.Client, true)
 
 		dc, err := finder.Datacenter(context.TODO(), rs.Primary.Attributes["datacenter"])
@@ -1307,7 +2398,7 @@ func testAccCheckVSphereVirtualMachineExists(n string, vm *virtualMachine) resou
 			return fmt.Errorf("No ID is set")
 		}
 
-		client := testAccProvider.Meta().(*govmomi.Client)
+		client := testAccProvider.Meta().(*VSphereClient).vimClient
 		finder := find.NewFinder(client.Client, true)
 
 		dc, err := finder.Datacenter(context.TODO(), rs.Primary.Attributes["datacenter"])
@@ -1472,7 +2563,7 @@ func TestAccVSphereVirtualMachine_DetachUnknownDisks(t *testing.T) {
 }
 
 func createAndAttachDisk(t *testing.T, vmName string, size int, datastore string, diskPath string, diskType string, adapterType string, datacenter string) {
-	client := testAccProvider.Meta().(*govmomi.Client)
+	client := testAccProvider.Meta().(*VSphereClient).vimClient
 	finder := find.NewFinder(client.Client, true)
 
 	dc, err := finder.Datacenter(context.TODO(), datacenter)
@@ -1494,7 +2585,7 @@ func createAndAttachDisk(t *testing.T, vmName string, size int, datastore string
 		t.Fail()
 		return
 	}
-	err = addHardDisk(vm, int64(size), int64(0), diskType, ds, diskPath, adapterType)
+	err = addHardDisk(vm, int64(size), int64(0), diskType, ds, diskPath, adapterType, 0, 0)
 	if err != nil {
 		log.Printf("[ERROR] addHardDisk: %v", err)
 		t.Fail()
@@ -1503,7 +2594,7 @@ func createAndAttachDisk(t *testing.T, vmName string, size int, datastore string
 }
 
 func vmCleanup(dc *object.Datacenter, ds *object.Datastore, vmName string) error {
-	client := testAccProvider.Meta().(*govmomi.Client)
+	client := testAccProvider.Meta().(*VSphereClient).vimClient
 	fileManager := object.NewFileManager(client.Client)
 	task, err := fileManager.DeleteDatastoreFile(context.TODO(), ds.Path(vmName), dc)
 	if err != nil {
@@ -1521,7 +2612,7 @@ func vmCleanup(dc *object.Datacenter, ds *object.Datastore, vmName string) error
 
 func checkForDisk(datacenter string, datastore string, vmName string, path string, exists bool, cleanup bool) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		client := testAccProvider.Meta().(*govmomi.Client)
+		client := testAccProvider.Meta().(*VSphereClient).vimClient
 		finder := find.NewFinder(client.Client, true)
 
 		dc, err := getDatacenter(client, datacenter)
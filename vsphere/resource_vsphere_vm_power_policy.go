@@ -0,0 +1,481 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vsphere_vm_power_policy enforces the power state of a VM or vApp on each
+// apply, since a changed power state shows as a diff. Schedules create
+// vCenter scheduled tasks, e.g. to power off lab VMs in the evening, which
+// are removed with the resource. The VM or vApp keeps its power state on
+// destroy.
+
+var powerScheduleDayList = []string{
+	"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday",
+}
+
+func resourceVSphereVMPowerPolicy() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceVSphereVMPowerPolicyCreate,
+		Read:   resourceVSphereVMPowerPolicyRead,
+		Update: resourceVSphereVMPowerPolicyUpdate,
+		Delete: resourceVSphereVMPowerPolicyDelete,
+
+		Timeouts: resourceTimeouts(),
+
+		Schema: map[string]*schema.Schema{
+			"vcenter_server": vcenterServerSchema(),
+			"vcenter_uuid":   vcenterUUIDSchema(),
+
+			"datacenter": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDatacenterName,
+				StateFunc:    datacenterNameStateFunc,
+			},
+
+			"type": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      entityInputVm,
+				ValidateFunc: validateEntityType,
+			},
+
+			// Name or inventory path of the VM or vApp.
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"power_state": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateVAppPowerState,
+			},
+
+			"schedule": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "vCenter scheduled tasks which change the power state, the time is in UTC.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						// Name of the scheduled task, unique in vCenter.
+						"name": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"power_state": &schema.Schema{
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateVAppPowerState,
+						},
+						"hour": &schema.Schema{
+							Type:         schema.TypeInt,
+							Required:     true,
+							ValidateFunc: validatePowerScheduleHour,
+						},
+						"minute": &schema.Schema{
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validatePowerScheduleMinute,
+						},
+						// Days of the week, every day if empty.
+						"days": &schema.Schema{
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validatePowerScheduleDay,
+							},
+						},
+					},
+				},
+			},
+
+			"scheduled_task_ids": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func validatePowerScheduleHour(v interface{}, k string) (ws []string, errors []error) {
+	if hour := v.(int); hour < 0 || hour > 23 {
+		errors = append(errors, fmt.Errorf("%s: Hour '%d' is out of allowed range (0 - 23).", k, hour))
+	}
+	return
+}
+
+func validatePowerScheduleMinute(v interface{}, k string) (ws []string, errors []error) {
+	if minute := v.(int); minute < 0 || minute > 59 {
+		errors = append(errors, fmt.Errorf("%s: Minute '%d' is out of allowed range (0 - 59).", k, minute))
+	}
+	return
+}
+
+func validatePowerScheduleDay(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, powerScheduleDayList)
+}
+
+// powerSchedule is a schedule block of a vsphere_vm_power_policy.
+type powerSchedule struct {
+	name       string
+	powerState string
+	hour       int32
+	minute     int32
+	days       []string
+}
+
+func parsePowerSchedules(d *schema.ResourceData) []powerSchedule {
+	var schedules []powerSchedule
+	for _, v := range d.Get("schedule").([]interface{}) {
+		m := v.(map[string]interface{})
+		s := powerSchedule{
+			name:       m["name"].(string),
+			powerState: m["power_state"].(string),
+			hour:       int32(m["hour"].(int)),
+			minute:     int32(m["minute"].(int)),
+		}
+		for _, day := range m["days"].([]interface{}) {
+			s.days = append(s.days, day.(string))
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules
+}
+
+// scheduler returns a daily scheduler, or a weekly one if days are set.
+func (s powerSchedule) scheduler() types.BaseTaskScheduler {
+	daily := types.DailyTaskScheduler{
+		HourlyTaskScheduler: types.HourlyTaskScheduler{
+			RecurrentTaskScheduler: types.RecurrentTaskScheduler{Interval: 1},
+			Minute:                 s.minute,
+		},
+		Hour: s.hour,
+	}
+	if len(s.days) == 0 {
+		return &daily
+	}
+	weekly := &types.WeeklyTaskScheduler{DailyTaskScheduler: daily}
+	for _, day := range s.days {
+		switch day {
+		case "sunday":
+			weekly.Sunday = true
+		case "monday":
+			weekly.Monday = true
+		case "tuesday":
+			weekly.Tuesday = true
+		case "wednesday":
+			weekly.Wednesday = true
+		case "thursday":
+			weekly.Thursday = true
+		case "friday":
+			weekly.Friday = true
+		case "saturday":
+			weekly.Saturday = true
+		}
+	}
+	return weekly
+}
+
+// powerAction returns the method of the scheduled task which puts an entity
+// of the type into the power state.
+func powerAction(entityType string, powerState string) (*types.MethodAction, error) {
+	actions := map[string]map[string]string{
+		vAppEntityTypeVm: {
+			vAppPowerStateOn:        "PowerOnVM_Task",
+			vAppPowerStateOff:       "PowerOffVM_Task",
+			vAppPowerStateSuspended: "SuspendVM_Task",
+		},
+		vAppEntityTypeVApp: {
+			vAppPowerStateOn:        "PowerOnVApp_Task",
+			vAppPowerStateOff:       "PowerOffVApp_Task",
+			vAppPowerStateSuspended: "SuspendVApp_Task",
+		},
+	}
+	name, ok := actions[entityType][powerState]
+	if !ok {
+		return nil, fmt.Errorf("unsupported power state %s for %s", powerState, entityType)
+	}
+	action := &types.MethodAction{Name: name}
+	if name == "PowerOffVApp_Task" {
+		// force
+		action.Argument = []types.MethodActionArgument{{Value: false}}
+	}
+	return action, nil
+}
+
+// powerPolicyEntityRef returns the VM or vApp of the resource.
+func powerPolicyEntityRef(d *schema.ResourceData, client *VSphereClient) (types.ManagedObjectReference, error) {
+	if d.Id() != "" {
+		return types.ManagedObjectReference{Type: getEntityType(d.Get("type").(string)), Value: d.Id()}, nil
+	}
+	dc, err := client.getDatacenter(d.Get("datacenter").(string))
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	finder := client.getFinder(dc)
+	name := d.Get("name").(string)
+	var ref object.Reference
+	if d.Get("type").(string) == entityInputVapp {
+		ref, err = finder.VirtualApp(context.TODO(), name)
+	} else {
+		ref, err = finder.VirtualMachine(context.TODO(), name)
+	}
+	if err != nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("%s %s not found: %s", d.Get("type").(string), name, err)
+	}
+	return ref.Reference(), nil
+}
+
+// readEntityPowerState returns the power state of a VM or vApp.
+func readEntityPowerState(client *VSphereClient, ref types.ManagedObjectReference) (string, error) {
+	collector := property.DefaultCollector(client.vimClient.Client)
+	if ref.Type == vAppEntityTypeVm {
+		var mvm mo.VirtualMachine
+		if err := collector.RetrieveOne(context.TODO(), ref, []string{"runtime.powerState"}, &mvm); err != nil {
+			return "", err
+		}
+		return string(mvm.Runtime.PowerState), nil
+	}
+
+	var mvapp mo.VirtualApp
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"summary", "vm"}, &mvapp); err != nil {
+		return "", err
+	}
+	var vmStates []types.VirtualMachinePowerState
+	if len(mvapp.Vm) > 0 {
+		var mvms []mo.VirtualMachine
+		if err := collector.Retrieve(context.TODO(), mvapp.Vm, []string{"runtime.powerState"}, &mvms); err != nil {
+			return "", err
+		}
+		for _, mvm := range mvms {
+			vmStates = append(vmStates, mvm.Runtime.PowerState)
+		}
+	}
+	var state types.VirtualAppVAppState
+	if summary, ok := mvapp.Summary.(*types.VirtualAppSummary); ok {
+		state = summary.VAppState
+	}
+	return vAppPowerState(state, vmStates), nil
+}
+
+// enforcePowerState puts the VM or vApp into the power state of the
+// resource.
+func enforcePowerState(d *schema.ResourceData, client *VSphereClient, ref types.ManagedObjectReference, timeout string) error {
+	desired := d.Get("power_state").(string)
+	ctx, cancel := taskContext(d.Timeout(timeout))
+	defer cancel()
+
+	if ref.Type == vAppEntityTypeVApp {
+		vapp := &vApp{
+			name:        d.Get("name").(string),
+			c:           client.vimClient,
+			d:           d,
+			createdVApp: object.NewVirtualApp(client.vimClient.Client, ref),
+			taskCtx:     ctx,
+			taskTimeout: d.Timeout(timeout),
+		}
+		return vapp.setVAppPowerState(desired)
+	}
+
+	current, err := readEntityPowerState(client, ref)
+	if err != nil {
+		return err
+	}
+	if current == desired {
+		return nil
+	}
+	log.Printf("[INFO] Changing power state of virtual machine %s from %s to %s", d.Get("name").(string), current, desired)
+
+	vm := object.NewVirtualMachine(client.vimClient.Client, ref)
+	var steps []func(context.Context) (*object.Task, error)
+	switch desired {
+	case vAppPowerStateOn:
+		steps = append(steps, vm.PowerOn)
+	case vAppPowerStateOff:
+		steps = append(steps, vm.PowerOff)
+	case vAppPowerStateSuspended:
+		// Only a running VM can be suspended.
+		if current == vAppPowerStateOff {
+			steps = append(steps, vm.PowerOn)
+		}
+		steps = append(steps, vm.Suspend)
+	}
+	for _, step := range steps {
+		task, err := step(ctx)
+		if err != nil {
+			return err
+		}
+		operation := fmt.Sprintf("change power state of virtual machine %s to %s", d.Get("name").(string), desired)
+		if err := waitForTaskWithProgress(ctx, task, operation); err != nil {
+			return taskTimeoutError(ctx, err, operation, d.Timeout(timeout))
+		}
+	}
+	return nil
+}
+
+// taskSpec returns the spec of the scheduled task changing the power state
+// of the named entity.
+func (s powerSchedule) taskSpec(name string, action *types.MethodAction) *types.ScheduledTaskSpec {
+	return &types.ScheduledTaskSpec{
+		Name:        s.name,
+		Description: fmt.Sprintf("Changes the power state of %s to %s", name, s.powerState),
+		Enabled:     true,
+		Scheduler:   s.scheduler(),
+		Action:      action,
+	}
+}
+
+// createPowerSchedules creates the scheduled tasks of the schedules and
+// records their IDs.
+func createPowerSchedules(d *schema.ResourceData, client *VSphereClient, ref types.ManagedObjectReference) error {
+	var ids []string
+	defer func() { d.Set("scheduled_task_ids", ids) }()
+
+	for _, s := range parsePowerSchedules(d) {
+		action, err := powerAction(ref.Type, s.powerState)
+		if err != nil {
+			return err
+		}
+		req := types.CreateScheduledTask{
+			This:   *client.vimClient.ServiceContent.ScheduledTaskManager,
+			Entity: ref,
+			Spec:   s.taskSpec(d.Get("name").(string), action),
+		}
+		log.Printf("[DEBUG] Creating scheduled task %s: %#v", s.name, req.Spec)
+		res, err := methods.CreateScheduledTask(context.TODO(), client.vimClient, &req)
+		if err != nil {
+			return fmt.Errorf("Error creating scheduled task %s: %s", s.name, err)
+		}
+		ids = append(ids, res.Returnval.Value)
+	}
+	return nil
+}
+
+// removePowerSchedules removes the recorded scheduled tasks. Tasks which are
+// gone already are skipped.
+func removePowerSchedules(d *schema.ResourceData, client *VSphereClient) error {
+	ids := d.Get("scheduled_task_ids").([]interface{})
+	for i, v := range ids {
+		req := types.RemoveScheduledTask{
+			This: types.ManagedObjectReference{Type: "ScheduledTask", Value: v.(string)},
+		}
+		if _, err := methods.RemoveScheduledTask(context.TODO(), client.vimClient, &req); err != nil && !isManagedObjectNotFoundError(err) {
+			d.Set("scheduled_task_ids", ids[i:])
+			return fmt.Errorf("Error removing scheduled task %s: %s", v.(string), err)
+		}
+	}
+	d.Set("scheduled_task_ids", []string{})
+	return nil
+}
+
+func resourceVSphereVMPowerPolicyCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vm_power_policy", resourceLogName(d, "name"), "create")
+	client := meta.(*VSphereClient)
+
+	ref, err := powerPolicyEntityRef(d, client)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Enforcing power state %s on %s", d.Get("power_state").(string), ref.Value)
+	if err := enforcePowerState(d, client, ref, schema.TimeoutCreate); err != nil {
+		return translateVSphereError(err, fmt.Sprintf("%s %s", d.Get("type").(string), d.Get("name").(string)))
+	}
+	d.SetId(ref.Value)
+
+	if err := createPowerSchedules(d, client, ref); err != nil {
+		return err
+	}
+
+	return resourceVSphereVMPowerPolicyRead(d, meta)
+}
+
+func resourceVSphereVMPowerPolicyRead(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	client := meta.(*VSphereClient)
+
+	ref, err := powerPolicyEntityRef(d, client)
+	if err != nil {
+		return err
+	}
+	powerState, err := readEntityPowerState(client, ref)
+	if err != nil {
+		if isManagedObjectNotFoundError(err) {
+			log.Printf("[WARN] %s %s is gone, removing it from state", d.Get("type").(string), d.Get("name").(string))
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+	d.Set("power_state", powerState)
+	return nil
+}
+
+func resourceVSphereVMPowerPolicyUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vm_power_policy", resourceLogName(d, "name"), "update")
+	client := meta.(*VSphereClient)
+
+	ref, err := powerPolicyEntityRef(d, client)
+	if err != nil {
+		return err
+	}
+	if d.HasChange("power_state") {
+		logger.Infof("Enforcing power state %s", d.Get("power_state").(string))
+		if err := enforcePowerState(d, client, ref, schema.TimeoutUpdate); err != nil {
+			return translateVSphereError(err, fmt.Sprintf("%s %s", d.Get("type").(string), d.Get("name").(string)))
+		}
+	}
+
+	if d.HasChange("schedule") {
+		logger.Infof("Replacing the scheduled tasks")
+		if err := removePowerSchedules(d, client); err != nil {
+			return err
+		}
+		if err := createPowerSchedules(d, client, ref); err != nil {
+			return err
+		}
+	}
+
+	return resourceVSphereVMPowerPolicyRead(d, meta)
+}
+
+func resourceVSphereVMPowerPolicyDelete(d *schema.ResourceData, meta interface{}) error {
+	if err := checkVCenterServer(d, meta.(*VSphereClient)); err != nil {
+		return err
+	}
+	logger := newResourceLogger(meta, "vsphere_vm_power_policy", resourceLogName(d, "name"), "delete")
+	client := meta.(*VSphereClient)
+
+	if ids := d.Get("scheduled_task_ids").([]interface{}); len(ids) > 0 {
+		logger.Infof("Removing the scheduled tasks %v", ids)
+		if err := removePowerSchedules(d, client); err != nil {
+			return err
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,58 @@
+package vsphere
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestAccVSphereVMPowerPolicy_schedule(t *testing.T) {
+	daily := powerSchedule{hour: 19, minute: 30}
+	scheduler, ok := daily.scheduler().(*types.DailyTaskScheduler)
+	if !ok || scheduler.Hour != 19 || scheduler.Minute != 30 || scheduler.Interval != 1 {
+		t.Fatalf("unexpected daily scheduler %#v", daily.scheduler())
+	}
+
+	weekdays := powerSchedule{hour: 7, days: []string{"monday", "friday"}}
+	weekly, ok := weekdays.scheduler().(*types.WeeklyTaskScheduler)
+	if !ok || !weekly.Monday || !weekly.Friday || weekly.Sunday || weekly.Hour != 7 {
+		t.Fatalf("unexpected weekly scheduler %#v", weekdays.scheduler())
+	}
+}
+
+func TestAccVSphereVMPowerPolicy_taskSpec(t *testing.T) {
+	action, err := powerAction(vAppEntityTypeVm, vAppPowerStateOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := powerSchedule{name: "nightly", powerState: vAppPowerStateOff, hour: 22}
+	req := types.CreateScheduledTask{
+		Entity: types.ManagedObjectReference{Type: vAppEntityTypeVm, Value: "vm-1"},
+		Spec:   s.taskSpec("web", action),
+	}
+	spec := req.Spec.GetScheduledTaskSpec()
+	if spec.Name != "nightly" || !spec.Enabled || spec.Action != action {
+		t.Fatalf("unexpected spec %#v", spec)
+	}
+	if spec.Description != "Changes the power state of web to poweredOff" {
+		t.Fatalf("unexpected description %q", spec.Description)
+	}
+	if _, ok := spec.Scheduler.(*types.DailyTaskScheduler); !ok {
+		t.Fatalf("expected a daily scheduler, got %#v", spec.Scheduler)
+	}
+}
+
+func TestAccVSphereVMPowerPolicy_action(t *testing.T) {
+	action, err := powerAction(vAppEntityTypeVm, vAppPowerStateSuspended)
+	if err != nil || action.Name != "SuspendVM_Task" || len(action.Argument) != 0 {
+		t.Fatalf("unexpected action %#v (%v)", action, err)
+	}
+	// vApps are powered off without force.
+	action, err = powerAction(vAppEntityTypeVApp, vAppPowerStateOff)
+	if err != nil || action.Name != "PowerOffVApp_Task" || len(action.Argument) != 1 || action.Argument[0].Value != false {
+		t.Fatalf("unexpected action %#v (%v)", action, err)
+	}
+	if _, err := powerAction(vAppEntityTypeVm, "rebooted"); err == nil {
+		t.Fatal("expected an error for an unknown power state")
+	}
+}
@@ -0,0 +1,190 @@
+package vsphere
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"golang.org/x/net/context"
+)
+
+// The vCenter simulator of govmomi (vcsim) serves an in-memory inventory, so
+// the CRUD and finder logic can be tested without a vCenter. Its default
+// inventory has the datacenter DC0 with the cluster DC0_C0, the vDS DC0_DVS,
+// the datastore LocalDS_0 and the VMs DC0_H0_VM0 and DC0_C0_RP0_VM0.
+const (
+	simDatacenter = "DC0"
+	simVdsName    = "DC0_DVS"
+	simDatastore  = "LocalDS_0"
+	simVMName     = "DC0_H0_VM0"
+)
+
+// TestMain points the acceptance tests at a simulator when VSPHERE_SIMULATOR
+// is set, see make testsim.
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		if os.Getenv("VSPHERE_SIMULATOR") != "" {
+			server, stop, err := startSimulator()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "starting the vCenter simulator failed: %s\n", err)
+				return 1
+			}
+			defer stop()
+			password, _ := server.URL.User.Password()
+			os.Setenv("VSPHERE_SERVER", server.URL.Host)
+			os.Setenv("VSPHERE_USER", server.URL.User.Username())
+			os.Setenv("VSPHERE_PASSWORD", password)
+			os.Setenv("VSPHERE_ALLOW_UNVERIFIED_SSL", "true")
+		}
+		return m.Run()
+	}())
+}
+
+// startSimulator serves a vCenter inventory over TLS, like a vCenter.
+func startSimulator() (*simulator.Server, func(), error) {
+	model := simulator.VPX()
+	if err := model.Create(); err != nil {
+		return nil, nil, err
+	}
+	model.Service.TLS = new(tls.Config)
+	server := model.Service.NewServer()
+	return server, func() {
+		server.Close()
+		model.Remove()
+	}, nil
+}
+
+// testSimulatorClient returns a provider client connected to a simulator of
+// its own and the function stopping it.
+func testSimulatorClient(t *testing.T) (*VSphereClient, func()) {
+	if testing.Short() {
+		t.Skip("skipping vCenter simulator test in short mode")
+	}
+	server, stop, err := startSimulator()
+	if err != nil {
+		t.Fatalf("starting the vCenter simulator failed: %s", err)
+	}
+	password, _ := server.URL.User.Password()
+	config := Config{
+		User:          server.URL.User.Username(),
+		Password:      password,
+		VSphereServer: server.URL.Host,
+		InsecureFlag:  true,
+	}
+	client, err := config.Client()
+	if err != nil {
+		stop()
+		t.Fatalf("connecting to the vCenter simulator failed: %s", err)
+	}
+	return client, stop
+}
+
+func TestAccVSphereSimulator_finder(t *testing.T) {
+	client, stop := testSimulatorClient(t)
+	defer stop()
+
+	dc, err := client.getDatacenter(simDatacenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dcFolders, err := client.getDatacenterFolders(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vds, err := findNetObjectByName(simDatacenter, simVdsName, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vds.(*object.DistributedVirtualSwitch); !ok {
+		t.Fatalf("expected a vDS, got %#v", vds)
+	}
+	if _, err := findNetObjectByName(simDatacenter, "missing", client); err == nil {
+		t.Fatal("expected an error for a missing network")
+	}
+
+	ds, err := getDatastoreObject(client.vimClient, dcFolders, simDatastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Type != "Datastore" {
+		t.Fatalf("expected a datastore, got %#v", ds)
+	}
+	if _, err := resolveDatastore(client.vimClient, dcFolders, simDatastore); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.getFinder(dc) == client.getFinder(dc) {
+		t.Fatal("expected a new finder per call")
+	}
+	if again, _ := client.getDatacenter(simDatacenter); again != dc {
+		t.Fatal("expected the datacenter to be cached")
+	}
+	client.invalidateCache()
+	if again, _ := client.getDatacenter(simDatacenter); again == dc {
+		t.Fatal("expected a new lookup after invalidating the cache")
+	}
+}
+
+func TestAccVSphereVdsPortgroup_simulator(t *testing.T) {
+	client, stop := testSimulatorClient(t)
+	defer stop()
+
+	d := schema.TestResourceDataRaw(t, resourceVSphereVdPortgroup().Schema, map[string]interface{}{
+		"datacenter":     simDatacenter,
+		"vds_name":       simVdsName,
+		"portgroup_name": "tf-sim",
+	})
+	if err := resourceVSphereVdPortgroupCreate(d, client); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	if !isManagedObjectID(d.Id()) || d.Get("moid").(string) != d.Id() {
+		t.Fatalf("expected a managed object ID, got %q", d.Id())
+	}
+	if d.Get("uplink").(bool) {
+		t.Fatal("expected a portgroup which is not an uplink portgroup")
+	}
+
+	id := d.Id()
+	if err := resourceVSphereVdPortgroupRead(d, client); err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+	if d.Id() != id || d.Get("portgroup_name").(string) != "tf-sim" {
+		t.Fatalf("unexpected state after read: %s %s", d.Id(), d.Get("portgroup_name"))
+	}
+
+	if err := resourceVSphereVdPortgroupDelete(d, client); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	client.invalidateCache()
+	if _, err := findNetObjectByName(simDatacenter, "tf-sim", client); err == nil {
+		t.Fatal("expected the portgroup to be gone")
+	}
+}
+
+func TestAccVSphereVirtualMachine_simulatorPath(t *testing.T) {
+	client, stop := testSimulatorClient(t)
+	defer stop()
+
+	dc, err := client.getDatacenter(simDatacenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finder := find.NewFinder(client.vimClient.Client, true).SetDatacenter(dc)
+	vm, err := finder.VirtualMachine(context.TODO(), simVMName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := managedObjectInventoryPath(client.vimClient.Client, vm.Reference())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/" + simDatacenter + "/vm/" + simVMName; path != want {
+		t.Fatalf("expected %s, got %s", want, path)
+	}
+}
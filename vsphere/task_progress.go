@@ -0,0 +1,72 @@
+package vsphere
+
+import (
+	"log"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/progress"
+	"golang.org/x/net/context"
+)
+
+// taskProgressStep is the change in percent after which the progress of a
+// task is logged again.
+const taskProgressStep = 10
+
+// taskProgressLogger logs the progress of a task at INFO, so clones and
+// relocations running for many minutes show in the Terraform output with
+// TF_LOG=INFO.
+type taskProgressLogger struct {
+	operation string
+	ch        chan progress.Report
+	done      chan struct{}
+}
+
+func newTaskProgressLogger(operation string) *taskProgressLogger {
+	l := &taskProgressLogger{
+		operation: operation,
+		ch:        make(chan progress.Report),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Sink is called once by the task wait, which closes the channel when the
+// task has finished.
+func (l *taskProgressLogger) Sink() chan<- progress.Report {
+	return l.ch
+}
+
+func (l *taskProgressLogger) run() {
+	defer close(l.done)
+	last := -1
+	for report := range l.ch {
+		if report.Error() != nil {
+			continue
+		}
+		percentage := int(report.Percentage())
+		if !shouldLogTaskProgress(last, percentage) {
+			continue
+		}
+		last = percentage
+		if detail := report.Detail(); detail != "" {
+			log.Printf("[INFO] %s: %d%% (%s)", l.operation, percentage, detail)
+		} else {
+			log.Printf("[INFO] %s: %d%%", l.operation, percentage)
+		}
+	}
+}
+
+// shouldLogTaskProgress reports whether progress moved far enough since it
+// was last logged, the first report is always logged.
+func shouldLogTaskProgress(last int, percentage int) bool {
+	return last < 0 || percentage >= last+taskProgressStep || (percentage == 100 && last != 100)
+}
+
+// waitForTaskWithProgress waits on a task and logs its progress.
+func waitForTaskWithProgress(ctx context.Context, task *object.Task, operation string) error {
+	l := newTaskProgressLogger(operation)
+	_, err := task.WaitForResult(ctx, l)
+	<-l.done
+	return err
+}
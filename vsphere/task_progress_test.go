@@ -0,0 +1,40 @@
+package vsphere
+
+import (
+	"testing"
+)
+
+type testProgressReport struct {
+	percentage float32
+}
+
+func (r testProgressReport) Percentage() float32 { return r.percentage }
+func (r testProgressReport) Detail() string      { return "" }
+func (r testProgressReport) Error() error        { return nil }
+
+func TestTaskProgress(t *testing.T) {
+	cases := []struct {
+		last, percentage int
+		expected         bool
+	}{
+		{-1, 0, true},
+		{0, 5, false},
+		{0, 10, true},
+		{95, 100, true},
+		{100, 100, false},
+	}
+	for _, c := range cases {
+		if actual := shouldLogTaskProgress(c.last, c.percentage); actual != c.expected {
+			t.Errorf("expected %t for %d%% after %d%%, got %t", c.expected, c.percentage, c.last, actual)
+		}
+	}
+
+	// The logger finishes once the task wait closes its sink.
+	l := newTaskProgressLogger("clone vApp foo")
+	sink := l.Sink()
+	for _, p := range []float32{0, 42, 100} {
+		sink <- testProgressReport{percentage: p}
+	}
+	close(sink)
+	<-l.done
+}
@@ -0,0 +1,45 @@
+package vsphere
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultCreateTimeout = 30 * time.Minute
+	defaultUpdateTimeout = 30 * time.Minute
+	defaultDeleteTimeout = 10 * time.Minute
+)
+
+// resourceTimeouts returns the default timeouts of the resources which wait
+// on long running vSphere tasks. Users can raise them per resource with a
+// timeouts block.
+func resourceTimeouts() *schema.ResourceTimeout {
+	return &schema.ResourceTimeout{
+		Create: schema.DefaultTimeout(defaultCreateTimeout),
+		Update: schema.DefaultTimeout(defaultUpdateTimeout),
+		Delete: schema.DefaultTimeout(defaultDeleteTimeout),
+	}
+}
+
+// taskContext returns the context to wait on the tasks of one resource
+// operation with. A zero timeout does not limit the wait.
+func taskContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// taskTimeoutError turns the error of a task wait which ran out of time into
+// one that names the operation and the timeout, so the user knows which
+// timeouts entry to raise.
+func taskTimeoutError(ctx context.Context, err error, operation string, timeout time.Duration) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timeout after %s while waiting to %s", timeout, operation)
+	}
+	return err
+}
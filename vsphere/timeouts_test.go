@@ -0,0 +1,30 @@
+package vsphere
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestTaskTimeoutError(t *testing.T) {
+	ctx, cancel := taskContext(time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err := taskTimeoutError(ctx, ctx.Err(), "destroy vApp foo", time.Nanosecond)
+	if !strings.Contains(err.Error(), "while waiting to destroy vApp foo") {
+		t.Errorf("expected timeout error, got %q", err)
+	}
+
+	plain := errors.New("task failed")
+	if err := taskTimeoutError(context.Background(), plain, "destroy vApp foo", time.Minute); err != plain {
+		t.Errorf("expected task error to be passed through, got %q", err)
+	}
+
+	if err := taskTimeoutError(ctx, nil, "destroy vApp foo", time.Nanosecond); err != nil {
+		t.Errorf("expected nil error to stay nil, got %q", err)
+	}
+}
@@ -3,9 +3,11 @@ package vsphere
 import (
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/vim25/types"
@@ -19,6 +21,12 @@ type userPermission struct {
 	roleId    int32
 	group     bool
 	propagate bool
+}
+
+// resourcePermission holds the permissions Terraform manages on a resource.
+// Permissions of other principals on the entity are left alone.
+type resourcePermission struct {
+	permissions []*userPermission
 
 	am *object.AuthorizationManager
 	d  *schema.ResourceData
@@ -34,9 +42,8 @@ func NewUserPermission() *userPermission {
 
 func permissionSchema() *schema.Schema {
 	return &schema.Schema{
-		Type:     schema.TypeList,
+		Type:     schema.TypeSet,
 		Optional: true,
-		MaxItems: 1,
 		Elem: &schema.Resource{
 			Schema: map[string]*schema.Schema{
 				"user_name": &schema.Schema{
@@ -48,19 +55,71 @@ func permissionSchema() *schema.Schema {
 					Type:     schema.TypeString,
 					Required: true,
 				},
+
+				// user_name is a group of the identity source.
+				"group": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+
+				// The permission also applies to the children of the entity.
+				"propagate": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+				},
 			},
 		},
 	}
 }
 
-func parseUserPermissionData(d *schema.ResourceData, c *govmomi.Client) *userPermission {
+// migratePermissionListToSet moves the permission of a state written while
+// permission was a list of at most one entry to its key in the set.
+func migratePermissionListToSet(is *terraform.InstanceState) error {
+	if is.Empty() || is.Attributes == nil {
+		return nil
+	}
+	userName, ok := is.Attributes["permission.0.user_name"]
+	if !ok {
+		return nil
+	}
 
-	p := NewUserPermission()
-	p.d = d
-	p.am = object.NewAuthorizationManager(c.Client)
+	perm := map[string]interface{}{
+		"user_name": userName,
+		"role":      is.Attributes["permission.0.role"],
+		"group":     false,
+		"propagate": true,
+	}
+	for _, k := range []string{"group", "propagate"} {
+		if v, ok := is.Attributes["permission.0."+k]; ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("Invalid permission.0.%s %q: %s", k, v, err)
+			}
+			perm[k] = b
+		}
+	}
+
+	code := strconv.Itoa(schema.HashResource(permissionSchema().Elem.(*schema.Resource))(perm))
+	for k, v := range perm {
+		delete(is.Attributes, "permission.0."+k)
+		is.Attributes["permission."+code+"."+k] = fmt.Sprintf("%v", v)
+	}
+	is.Attributes["permission.#"] = "1"
+	return nil
+}
 
-	if permList, ok := d.GetOk("permission"); ok {
-		permObj := (permList.([]interface{}))[0].(map[string]interface{})
+// principalKey identifies the principal of a permission. vCenter compares
+// principals case insensitively and keeps users and groups apart.
+func principalKey(userName string, group bool) string {
+	return fmt.Sprintf("%s/%t", strings.ToLower(userName), group)
+}
+
+func parseUserPermissions(vL []interface{}) []*userPermission {
+	var perms []*userPermission
+	for _, raw := range vL {
+		permObj := raw.(map[string]interface{})
+		p := NewUserPermission()
 
 		if v, ok := permObj["user_name"].(string); ok && v != "" {
 			p.userName = v
@@ -69,127 +128,224 @@ func parseUserPermissionData(d *schema.ResourceData, c *govmomi.Client) *userPer
 		if v, ok := permObj["role"].(string); ok && v != "" {
 			p.roleName = v
 		}
+
+		if v, ok := permObj["group"].(bool); ok {
+			p.group = v
+		}
+
+		if v, ok := permObj["propagate"].(bool); ok {
+			p.propagate = v
+		}
+
+		perms = append(perms, p)
 	}
+	return perms
+}
 
-	log.Printf("[DEBUG] User permission data %#v", p)
-	return p
+func parseUserPermissionData(d *schema.ResourceData, c *govmomi.Client) *resourcePermission {
+
+	rp := &resourcePermission{
+		d:  d,
+		am: object.NewAuthorizationManager(c.Client),
+	}
+
+	if v, ok := d.GetOk("permission"); ok {
+		rp.permissions = parseUserPermissions(v.(*schema.Set).List())
+	}
+
+	log.Printf("[DEBUG] User permission data %#v", rp.permissions)
+	return rp
+}
+
+// validatePermissions checks that a principal is given a single role, vCenter
+// keeps one permission per principal and entity.
+func validatePermissions(perms []*userPermission) error {
+	seen := make(map[string]bool)
+	for _, p := range perms {
+		key := principalKey(p.userName, p.group)
+		if seen[key] {
+			return fmt.Errorf("%s is given more than one permission, only one role per principal can be set on an entity", p.userName)
+		}
+		seen[key] = true
+	}
+	return nil
 }
 
-func (p *userPermission) getRoleId() error {
+func (rp *resourcePermission) getRoleIds(perms []*userPermission) error {
 
-	roleList, err := p.am.RoleList(context.TODO())
+	roleList, err := rp.am.RoleList(context.TODO())
 	if err != nil {
 		return err
 	}
 
-	authRole := roleList.ByName(p.roleName)
-	if authRole == nil {
-		return fmt.Errorf("Role '%q' not found.", p.roleName)
+	for _, p := range perms {
+		authRole := roleList.ByName(p.roleName)
+		if authRole == nil {
+			return fmt.Errorf("Role '%q' not found.", p.roleName)
+		}
+		p.roleId = authRole.RoleId
 	}
-	p.roleId = authRole.RoleId
 
 	return nil
 }
 
-func (p *userPermission) setPermission(entity types.ManagedObjectReference) error {
-	var perm types.Permission
-
-	perm.Entity = &entity
-	perm.Principal = p.userName
-	perm.Group = p.group
-	perm.RoleId = p.roleId
-	perm.Propagate = p.propagate
+func (rp *resourcePermission) setPermissions(entity types.ManagedObjectReference, perms []*userPermission) error {
+	var permList []types.Permission
+
+	for _, p := range perms {
+		var perm types.Permission
+		perm.Entity = &entity
+		perm.Principal = p.userName
+		perm.Group = p.group
+		perm.RoleId = p.roleId
+		perm.Propagate = p.propagate
+		permList = append(permList, perm)
+	}
 
-	err := p.am.SetEntityPermissions(context.TODO(),
-		entity, []types.Permission{perm})
+	err := rp.am.SetEntityPermissions(context.TODO(), entity, permList)
 	return err
 }
 
-func (p *userPermission) unsetPermission(entity types.ManagedObjectReference) error {
+func (rp *resourcePermission) unsetPermission(entity types.ManagedObjectReference, p *userPermission) error {
 
-	err := p.am.RemoveEntityPermission(context.TODO(), entity, p.userName, p.group)
+	err := rp.am.RemoveEntityPermission(context.TODO(), entity, p.userName, p.group)
 	return err
 }
 
-func (p *userPermission) setResourcePermission(entity types.ManagedObjectReference) error {
-
-	log.Printf("[DEBUG] Setting permission while creating resource %#v.", entity)
+func (rp *resourcePermission) applyPermissions(entity types.ManagedObjectReference, perms []*userPermission) error {
+	if len(perms) == 0 {
+		return nil
+	}
 
-	err := p.getRoleId()
+	err := rp.getRoleIds(perms)
 	if err != nil {
-		log.Printf("[ERROR] Could not convert role '%s' into it's ID value.", p.roleName)
+		log.Printf("[ERROR] Could not convert roles into their ID values.")
 		return err
 	}
 
-	log.Printf("[DEBUG] Permission being set %#v.", p)
-	err = p.setPermission(entity)
+	log.Printf("[DEBUG] Permissions being set %#v.", perms)
+	err = rp.setPermissions(entity, perms)
 	if err != nil {
-		log.Printf("[ERROR] Failed to set permission to entity. Reference %#v",
+		log.Printf("[ERROR] Failed to set permissions to entity. Reference %#v",
 			entity)
 		return err
 	}
+	return nil
+}
+
+func (rp *resourcePermission) setResourcePermission(entity types.ManagedObjectReference) error {
+
+	log.Printf("[DEBUG] Setting permission while creating resource %#v.", entity)
+
+	if err := validatePermissions(rp.permissions); err != nil {
+		return err
+	}
+
+	err := rp.applyPermissions(entity, rp.permissions)
+	if err != nil {
+		return err
+	}
 
 	log.Printf("[DEBUG] User permission set successfully.")
 	return nil
 }
 
-func (p *userPermission) updateResourcePermission(entity types.ManagedObjectReference) error {
+// updateResourcePermission sets the added and changed permissions, then
+// removes the permissions of principals no longer in the configuration.
+func (rp *resourcePermission) updateResourcePermission(entity types.ManagedObjectReference) error {
 	log.Printf("[DEBUG] Setting permission while updating resource %#v.", entity)
 
-	old, new := p.d.GetChange("permission")
-	oldPermList := old.([]interface{})
-	newPermList := new.([]interface{})
-
-	if len(oldPermList) > 0 && len(newPermList) == 0 {
-		// Permission configuration removed
-		// So get value of old user_name and remove permission
-		//
-		oldPerm := oldPermList[0].(map[string]interface{})
-		if oldName, ok := oldPerm["user_name"].(string); ok && oldName != "" {
-			p.userName = oldName
-		}
+	if err := validatePermissions(rp.permissions); err != nil {
+		return err
+	}
 
-		err := p.unsetPermission(entity)
+	old, new := rp.d.GetChange("permission")
+	oldSet := old.(*schema.Set)
+	newSet := new.(*schema.Set)
+
+	// A changed role or propagate flag shows up as an added entry, setting
+	// it replaces the permission of the principal.
+	added := parseUserPermissions(newSet.Difference(oldSet).List())
+	err := rp.applyPermissions(entity, added)
+	if err != nil {
+		log.Printf("[ERROR] Could not set permissions in update operation.")
+		return err
+	}
+
+	kept := make(map[string]bool)
+	for _, p := range rp.permissions {
+		kept[principalKey(p.userName, p.group)] = true
+	}
+	for _, p := range parseUserPermissions(oldSet.Difference(newSet).List()) {
+		if kept[principalKey(p.userName, p.group)] {
+			continue
+		}
+		err = rp.unsetPermission(entity, p)
 		if err != nil {
-			log.Printf("[ERROR] Could not unset permission in update operation.")
+			log.Printf("[WARN] Could not unset old permission of %s properly.", p.userName)
 			return err
 		}
+	}
 
-	} else if len(oldPermList) == 0 && len(newPermList) > 0 {
-		// Permission configuration added
-		//
-		err := p.setResourcePermission(entity)
-		if err != nil {
-			log.Printf("[ERROR] Could not set permission in update operation.")
-			return err
+	log.Printf("[DEBUG] User permission updated successfully.")
+	return nil
+}
+
+// flattenEntityPermission returns the permission block of the principal from
+// the permissions defined on an entity, or an empty list when the principal
+// has no permission on it any more.
+func flattenEntityPermission(perms []types.Permission, roleList object.AuthorizationRoleList, userName string, group bool) ([]interface{}, error) {
+	for _, perm := range perms {
+		if strings.ToLower(perm.Principal) != strings.ToLower(userName) || perm.Group != group {
+			continue
 		}
+		role := roleList.ById(perm.RoleId)
+		if role == nil {
+			return nil, fmt.Errorf("Role with ID %d of %s not found.", perm.RoleId, perm.Principal)
+		}
+		return []interface{}{
+			map[string]interface{}{
+				"user_name": userName,
+				"role":      role.Name,
+				"group":     perm.Group,
+				"propagate": perm.Propagate,
+			},
+		}, nil
+	}
+	return []interface{}{}, nil
+}
+
+// readResourcePermission reconciles the permissions in state with the ones
+// set on the entity, so changes made in vCenter show up in the plan. A changed
+// role is read back as is, a permission removed outside of Terraform is
+// dropped from state, so it is set again. Only the principals in state are
+// looked at.
+func readResourcePermission(d *schema.ResourceData, c *govmomi.Client, entity types.ManagedObjectReference) error {
+	permSet, ok := d.GetOk("permission")
+	if !ok {
+		return nil
+	}
 
-	} else {
-		// Either 'user_name' and/or 'role' has been changed.
-		// Preserve new name and delete old permission first.
-		// Then add new permission.
-		//
+	am := object.NewAuthorizationManager(c.Client)
+	perms, err := am.RetrieveEntityPermissions(context.TODO(), entity, false)
+	if err != nil {
+		return err
+	}
+	roleList, err := am.RoleList(context.TODO())
+	if err != nil {
+		return err
+	}
 
-		newName := p.userName
-		err := p.setResourcePermission(entity)
+	var result []interface{}
+	for _, p := range parseUserPermissions(permSet.(*schema.Set).List()) {
+		perm, err := flattenEntityPermission(perms, roleList, p.userName, p.group)
 		if err != nil {
-			log.Printf("[ERROR] Could not change permission in update operation.")
 			return err
 		}
-
-		oldPerm := oldPermList[0].(map[string]interface{})
-		oldName, ok := oldPerm["user_name"].(string)
-
-		if ok && oldName != "" && strings.ToLower(oldName) != strings.ToLower(newName) {
-			p.userName = oldName
-			err = p.unsetPermission(entity)
-			if err != nil {
-				log.Printf("[WARN] Could not unset old permission properly.")
-				return err
-			}
+		if len(perm) == 0 {
+			log.Printf("[DEBUG] Permission of %s not found on entity %#v", p.userName, entity)
 		}
+		result = append(result, perm...)
 	}
-
-	log.Printf("[DEBUG] User permission updated successfully.")
-	return nil
+	return d.Set("permission", result)
 }
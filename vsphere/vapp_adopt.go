@@ -0,0 +1,106 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// findExistingVApp returns the vApp at the path of the resource, if one
+// exists already.
+func (vapp *vApp) findExistingVApp() (*object.VirtualApp, error) {
+	existing, err := vapp.finder.VirtualApp(context.TODO(), getVAppPath(vapp.d))
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return existing, nil
+}
+
+// vAppMembers returns the moids of the virtual machines and child vApps of a
+// vApp by entity type and name.
+func (vapp *vApp) vAppMembers(mvapp *mo.VirtualApp) (map[string]string, error) {
+	refs := append([]types.ManagedObjectReference{}, mvapp.Vm...)
+	for _, ref := range mvapp.ResourcePool.ResourcePool {
+		if ref.Type == vAppEntityTypeVApp {
+			refs = append(refs, ref)
+		}
+	}
+
+	members := make(map[string]string)
+	if len(refs) == 0 {
+		return members, nil
+	}
+	var entities []mo.ManagedEntity
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.Retrieve(context.TODO(), refs, []string{"name"}, &entities); err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		members[e.Self.Type+"/"+e.Name] = e.Self.Value
+	}
+	return members, nil
+}
+
+// adoptExistingVApp takes over a vApp which exists at the path of the
+// resource instead of creating it. The vApp has to be in the resource pool
+// the new one would be placed in, and entities cloned from template_vapp
+// have to be members already. Configured entities which are not members yet
+// are moved in as on create.
+func (vapp *vApp) adoptExistingVApp(existing *object.VirtualApp) error {
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), existing.Reference(), []string{"parent", "vm", "resourcePool"}, &mvapp); err != nil {
+		return err
+	}
+
+	if vapp.parentVApp == "" && vapp.resourcePoolObj != nil && mvapp.Parent != nil &&
+		*mvapp.Parent != vapp.resourcePoolObj.Reference() {
+		return fmt.Errorf("existing vApp %s is in resource pool %s, not in %s, it cannot be adopted",
+			vapp.name, mvapp.Parent.Value, vapp.resourcePoolObj.InventoryPath)
+	}
+
+	members, err := vapp.vAppMembers(&mvapp)
+	if err != nil {
+		return err
+	}
+	memberMoids := make(map[string]bool)
+	for _, moid := range members {
+		memberMoids[moid] = true
+	}
+	var errs []string
+	for i, entity := range vapp.vAppEntities {
+		if entity.byMoid() {
+			if memberMoids[entity.entityMoid] {
+				vapp.vAppEntities[i].cloned = true
+			}
+			continue
+		}
+		if moid, ok := members[entity.entityType+"/"+entity.name]; ok {
+			// Members stay in the vApp when removed, as cloned entities.
+			vapp.vAppEntities[i].cloned = true
+			vapp.vAppEntities[i].entityMoid = moid
+			continue
+		}
+		if entity.cloned {
+			errs = append(errs, fmt.Sprintf("entity %s of template_vapp is not a member of the existing vApp", entity.name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("existing vApp %s cannot be adopted:\n%s", vapp.name, strings.Join(errs, "\n"))
+	}
+
+	log.Printf("[INFO] Adopting existing vApp %s", getVAppPath(vapp.d))
+	vapp.createdVApp = existing
+	vapp.adopted = true
+	return nil
+}
@@ -0,0 +1,42 @@
+package vsphere
+
+import (
+	"log"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// The annotation of types.VAppConfigSpec is left out of the request when it
+// is empty, so it cannot clear the description of a vApp. An empty
+// description is set with a request of its own which always carries the
+// annotation.
+
+type vAppAnnotationSpec struct {
+	Annotation string `xml:"annotation"`
+}
+
+type updateVAppAnnotation struct {
+	This types.ManagedObjectReference `xml:"_this"`
+	Spec vAppAnnotationSpec           `xml:"spec"`
+}
+
+type updateVAppAnnotationBody struct {
+	Req    *updateVAppAnnotation           `xml:"urn:vim25 UpdateVAppConfig,omitempty"`
+	Res    *types.UpdateVAppConfigResponse `xml:"urn:vim25 UpdateVAppConfigResponse,omitempty"`
+	Fault_ *soap.Fault                     `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault,omitempty"`
+}
+
+func (b *updateVAppAnnotationBody) Fault() *soap.Fault { return b.Fault_ }
+
+// setVAppAnnotation sets the description of the vApp, which may be empty.
+func (vapp *vApp) setVAppAnnotation(annotation string) error {
+	log.Printf("[DEBUG] Setting the description of vApp %s to %q", vapp.name, annotation)
+	var reqBody, resBody updateVAppAnnotationBody
+	reqBody.Req = &updateVAppAnnotation{
+		This: vapp.createdVApp.Reference(),
+		Spec: vAppAnnotationSpec{Annotation: annotation},
+	}
+	return vapp.c.RoundTrip(context.TODO(), &reqBody, &resBody)
+}
@@ -0,0 +1,154 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+const (
+	sourcePowerHandlingClone    = "clone"
+	sourcePowerHandlingFail     = "fail"
+	sourcePowerHandlingSnapshot = "snapshot"
+	sourcePowerHandlingPowerOff = "power_off"
+)
+
+var sourcePowerHandlingList = []string{
+	sourcePowerHandlingClone,
+	sourcePowerHandlingFail,
+	sourcePowerHandlingSnapshot,
+	sourcePowerHandlingPowerOff,
+}
+
+func validateSourcePowerHandling(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, sourcePowerHandlingList)
+}
+
+// getPoweredOnVMs returns the VMs of the vApp which are powered on.
+func (vapp *vApp) getPoweredOnVMs(vappRef types.ManagedObjectReference) ([]types.ManagedObjectReference, error) {
+	collector := property.DefaultCollector(vapp.c.Client)
+
+	var mvapp mo.VirtualApp
+	if err := collector.RetrieveOne(context.TODO(), vappRef, []string{"vm"}, &mvapp); err != nil {
+		return nil, err
+	}
+	if len(mvapp.Vm) == 0 {
+		return nil, nil
+	}
+
+	var mvms []mo.VirtualMachine
+	if err := collector.Retrieve(context.TODO(), mvapp.Vm, []string{"runtime.powerState"}, &mvms); err != nil {
+		return nil, err
+	}
+
+	var refs []types.ManagedObjectReference
+	for _, mvm := range mvms {
+		if mvm.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn {
+			refs = append(refs, mvm.Reference())
+		}
+	}
+	return refs, nil
+}
+
+// prepareSourceVApp readies a running source vApp for CloneVApp_Task as
+// configured by source_power_handling, as a clone of running VMs is only
+// crash consistent. With the default clone the running VMs are cloned as they
+// are. The returned function restores the source vApp and has to be called
+// once the clone is done, whether it succeeded or not.
+func (vapp *vApp) prepareSourceVApp(sourceVApp *object.VirtualApp) (func(), error) {
+	noop := func() {}
+	if vapp.vAppToClone.powerHandling == sourcePowerHandlingClone {
+		return noop, nil
+	}
+
+	poweredOn, err := vapp.getPoweredOnVMs(sourceVApp.Reference())
+	if err != nil {
+		return noop, err
+	}
+	if len(poweredOn) == 0 {
+		return noop, nil
+	}
+
+	switch vapp.vAppToClone.powerHandling {
+	case sourcePowerHandlingSnapshot:
+		return vapp.snapshotSourceVMs(poweredOn)
+	case sourcePowerHandlingPowerOff:
+		return vapp.powerOffSourceVApp(sourceVApp)
+	default:
+		return noop, fmt.Errorf("template_vapp %s has %d powered on VM(s); set source_power_handling "+
+			"to %q or %q to clone it anyway", vapp.vAppToClone.name, len(poweredOn),
+			sourcePowerHandlingSnapshot, sourcePowerHandlingPowerOff)
+	}
+}
+
+// snapshotSourceVMs takes a snapshot of every running VM, quiescing the guest
+// file systems if source_quiesce is set, so their buffers are flushed to disk
+// right before the clone copies them.
+func (vapp *vApp) snapshotSourceVMs(vms []types.ManagedObjectReference) (func(), error) {
+	name := fmt.Sprintf("terraform-clone-%s", vapp.name)
+	snapshots := make(map[string]interface{})
+	remove := func() {
+		if err := removeVAppSnapshots(context.TODO(), vapp.c, snapshots, false); err != nil {
+			log.Printf("[ERROR] Could not remove clone snapshots of vApp %s: %s", vapp.vAppToClone.name, err)
+		}
+	}
+
+	for _, vm := range vms {
+		log.Printf("[INFO] Taking snapshot %s of source VM %s", name, vm.Value)
+		req := types.CreateSnapshot_Task{
+			This:    vm,
+			Name:    name,
+			Memory:  false,
+			Quiesce: vapp.vAppToClone.quiesce,
+		}
+		res, err := methods.CreateSnapshot_Task(context.TODO(), vapp.c, &req)
+		if err != nil {
+			remove()
+			return nil, err
+		}
+		task := object.NewTask(vapp.c.Client, res.Returnval)
+		info, err := task.WaitForResult(context.TODO(), nil)
+		if err != nil {
+			remove()
+			return nil, fmt.Errorf("Error taking snapshot of source VM %s: %s", vm.Value, err)
+		}
+		snapshot, ok := info.Result.(types.ManagedObjectReference)
+		if !ok {
+			remove()
+			return nil, fmt.Errorf("Unexpected result %T of snapshot task of source VM %s", info.Result, vm.Value)
+		}
+		snapshots[vm.Value] = snapshot.Value
+	}
+
+	return remove, nil
+}
+
+// powerOffSourceVApp stops the source vApp with its configured stop actions
+// for the duration of the clone.
+func (vapp *vApp) powerOffSourceVApp(sourceVApp *object.VirtualApp) (func(), error) {
+	log.Printf("[INFO] Powering off source vApp %s for the clone", vapp.vAppToClone.name)
+	task, err := sourceVApp.PowerOff(context.TODO(), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := vapp.waitForTask(task, "power off source vApp "+vapp.vAppToClone.name); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		log.Printf("[INFO] Powering on source vApp %s after the clone", vapp.vAppToClone.name)
+		task, err := sourceVApp.PowerOn(context.TODO())
+		if err == nil {
+			err = vapp.waitForTask(task, "power on source vApp "+vapp.vAppToClone.name)
+		}
+		if err != nil {
+			log.Printf("[ERROR] Could not power on source vApp %s again: %s", vapp.vAppToClone.name, err)
+		}
+	}, nil
+}
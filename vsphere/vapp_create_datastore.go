@@ -0,0 +1,114 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// Without template_vapp nothing is cloned, so datastore only matters for the
+// virtual machines added as entities. When it names a datastore cluster, the
+// VMs added while the vApp is created which are not on it yet are moved to
+// the datastore Storage DRS recommends for them. VMs added later, by update,
+// vsphere_vapp_entity or entity_ids, stay on their datastores, as do all
+// VMs when datastore is unset or a datastore.
+
+// entityStoragePod returns the datastore cluster entities are placed on, or
+// nil when the vApp is cloned or datastore is unset or a datastore.
+func (vapp *vApp) entityStoragePod() (*types.ManagedObjectReference, error) {
+	if vapp.vAppToClone.name != "" || vapp.datastore == "" {
+		return nil, nil
+	}
+	ref, err := getDatastoreObject(vapp.c, vapp.dcFolders, vapp.datastore)
+	if err != nil {
+		return nil, fmt.Errorf("datastore %s of vApp %s has to be a datastore cluster when template_vapp is not set: %s",
+			vapp.datastore, vapp.name, err)
+	}
+	if ref.Type != "StoragePod" {
+		log.Printf("[WARN] datastore %s of vApp %s is not a datastore cluster, it is only used with template_vapp",
+			vapp.datastore, vapp.name)
+		return nil, nil
+	}
+	return &ref, nil
+}
+
+// vmsOutsidePod returns the moids of the VMs which have a file on a datastore
+// outside of the datastore cluster, sorted.
+func vmsOutsidePod(vmDatastores map[string][]types.ManagedObjectReference, podDatastores []types.ManagedObjectReference) []string {
+	inPod := make(map[types.ManagedObjectReference]bool)
+	for _, ds := range podDatastores {
+		inPod[ds] = true
+	}
+	var moids []string
+	for moid, datastores := range vmDatastores {
+		for _, ds := range datastores {
+			if !inPod[ds] {
+				moids = append(moids, moid)
+				break
+			}
+		}
+	}
+	sort.Strings(moids)
+	return moids
+}
+
+// placeAddedEntities places the VMs added to the vApp on create on the
+// datastore cluster of datastore. Entities cloned from template_vapp or
+// adopted with the vApp are left alone.
+func (vapp *vApp) placeAddedEntities() error {
+	pod, err := vapp.entityStoragePod()
+	if err != nil || pod == nil {
+		return err
+	}
+	var vmList []types.ManagedObjectReference
+	for _, e := range vapp.vAppEntities {
+		if !e.cloned && e.entityType == vAppEntityTypeVm && e.entityMoid != "" {
+			vmList = append(vmList, types.ManagedObjectReference{Type: e.entityType, Value: e.entityMoid})
+		}
+	}
+	return vapp.placeEntitiesOnStoragePod(*pod, vmList)
+}
+
+// placeEntitiesOnStoragePod moves the VMs which are not on the datastore
+// cluster to the datastore Storage DRS recommends.
+func (vapp *vApp) placeEntitiesOnStoragePod(pod types.ManagedObjectReference, vmList []types.ManagedObjectReference) error {
+	if len(vmList) == 0 {
+		return nil
+	}
+	collector := property.DefaultCollector(vapp.c.Client)
+	var mpod mo.StoragePod
+	if err := collector.RetrieveOne(context.TODO(), pod, []string{"childEntity"}, &mpod); err != nil {
+		return err
+	}
+	var mvms []mo.VirtualMachine
+	if err := collector.Retrieve(context.TODO(), vmList, []string{"datastore"}, &mvms); err != nil {
+		return err
+	}
+	vmDatastores := make(map[string][]types.ManagedObjectReference)
+	for _, mvm := range mvms {
+		vmDatastores[mvm.Self.Value] = mvm.Datastore
+	}
+
+	for _, moid := range vmsOutsidePod(vmDatastores, mpod.ChildEntity) {
+		vmObj := object.NewVirtualMachine(vapp.c.Client, types.ManagedObjectReference{Type: vAppEntityTypeVm, Value: moid})
+		ds, err := recommendRelocateDatastore(vapp.c, vmObj, pod)
+		if err != nil {
+			return fmt.Errorf("cannot place entity %s on datastore cluster %s: %s", moid, vapp.datastore, err)
+		}
+		log.Printf("[INFO] Moving entity %s of vApp %s to datastore %s", moid, vapp.name, ds.Value)
+		task, err := vmObj.Relocate(context.TODO(), types.VirtualMachineRelocateSpec{Datastore: &ds}, types.VirtualMachineMovePriorityDefaultPriority)
+		if err != nil {
+			return err
+		}
+		if err := vapp.waitForTask(task, "move entity "+moid+" to datastore cluster "+vapp.datastore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
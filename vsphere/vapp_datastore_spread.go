@@ -0,0 +1,147 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vAppDatastoreSpreadRuleName returns the name of the Storage DRS
+// anti-affinity rule which keeps the virtual machines of a vApp on different
+// datastores.
+func vAppDatastoreSpreadRuleName(vappName string) string {
+	return fmt.Sprintf("terraform-%s-datastore-spread", vappName)
+}
+
+// vAppStoragePod returns the datastore cluster the vApp is placed on, which
+// is the only kind of datastore Storage DRS rules apply to.
+func (vapp *vApp) vAppStoragePod() (types.ManagedObjectReference, error) {
+	name := vapp.d.Get("datastore").(string)
+	if name == "" {
+		return types.ManagedObjectReference{}, fmt.Errorf("spread_datastores requires the datastore of vApp %s to be a datastore cluster", vapp.name)
+	}
+	ref, err := getDatastoreObject(vapp.c, vapp.dcFolders, name)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if ref.Type != "StoragePod" {
+		return types.ManagedObjectReference{}, fmt.Errorf("spread_datastores requires the datastore of vApp %s to be a datastore cluster, %s is a datastore", vapp.name, name)
+	}
+	return ref, nil
+}
+
+// findStoragePodRule looks up a Storage DRS rule of the datastore cluster by
+// name.
+func (vapp *vApp) findStoragePodRule(pod types.ManagedObjectReference, name string) (*types.ClusterRuleInfo, error) {
+	var mpod mo.StoragePod
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), pod, []string{"podStorageDrsEntry"}, &mpod); err != nil {
+		return nil, err
+	}
+	if mpod.PodStorageDrsEntry == nil {
+		return nil, nil
+	}
+	for _, rule := range mpod.PodStorageDrsEntry.StorageDrsConfig.PodConfig.Rule {
+		if r := rule.GetClusterRuleInfo(); r.Name == name {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (vapp *vApp) reconfigureStoragePod(pod types.ManagedObjectReference, rule types.ClusterRuleSpec) error {
+	req := types.ConfigureStorageDrsForPod_Task{
+		This: *vapp.c.ServiceContent.StorageResourceManager,
+		Pod:  pod,
+		Spec: types.StorageDrsConfigSpec{
+			PodConfigSpec: &types.StorageDrsPodConfigSpec{
+				Rule: []types.ClusterRuleSpec{rule},
+			},
+		},
+		Modify: true,
+	}
+	res, err := methods.ConfigureStorageDrsForPod_Task(context.TODO(), vapp.c, &req)
+	if err != nil {
+		return err
+	}
+	task := object.NewTask(vapp.c.Client, res.Returnval)
+	return vapp.waitForTask(task, "reconfigure datastore cluster "+pod.Value)
+}
+
+// applyDatastoreSpreadRule creates or updates the Storage DRS anti-affinity
+// rule placing the virtual machines of the vApp on different datastores of
+// its datastore cluster. Storage DRS moves disks which break the rule, with
+// fewer than two virtual machines the rule is removed.
+func (vapp *vApp) applyDatastoreSpreadRule() error {
+	pod, err := vapp.vAppStoragePod()
+	if err != nil {
+		return err
+	}
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"vm"}, &mvapp); err != nil {
+		return err
+	}
+	vms := mvapp.Vm
+	name := vAppDatastoreSpreadRuleName(vapp.name)
+	existing, err := vapp.findStoragePodRule(pod, name)
+	if err != nil {
+		return err
+	}
+
+	if len(vms) < 2 {
+		log.Printf("[DEBUG] vApp %s has %d virtual machine(s), not spreading their datastores", vapp.name, len(vms))
+		return vapp.removeDatastoreSpreadRule(pod, existing)
+	}
+
+	rule := &types.ClusterAntiAffinityRuleSpec{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:    name,
+			Enabled: types.NewBool(true),
+		},
+		Vm: vms,
+	}
+	op := types.ArrayUpdateOperationAdd
+	if existing != nil {
+		op = types.ArrayUpdateOperationEdit
+		rule.Key = existing.Key
+	}
+
+	log.Printf("[DEBUG] Spreading datastores of the virtual machines of vApp %s: %#v", vapp.name, vms)
+	return vapp.reconfigureStoragePod(pod, types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: op},
+		Info:            rule,
+	})
+}
+
+// clearDatastoreSpreadRule removes the Storage DRS anti-affinity rule of the
+// vApp, if any.
+func (vapp *vApp) clearDatastoreSpreadRule() error {
+	pod, err := vapp.vAppStoragePod()
+	if err != nil {
+		return err
+	}
+	existing, err := vapp.findStoragePodRule(pod, vAppDatastoreSpreadRuleName(vapp.name))
+	if err != nil {
+		return err
+	}
+	return vapp.removeDatastoreSpreadRule(pod, existing)
+}
+
+func (vapp *vApp) removeDatastoreSpreadRule(pod types.ManagedObjectReference, rule *types.ClusterRuleInfo) error {
+	if rule == nil {
+		return nil
+	}
+	return vapp.reconfigureStoragePod(pod, types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{
+			Operation: types.ArrayUpdateOperationRemove,
+			RemoveKey: rule.Key,
+		},
+	})
+}
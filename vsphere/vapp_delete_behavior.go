@@ -0,0 +1,79 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// What destroying the resource does with the entities of the vApp. Configured
+// entities are moved back to where they came from either way. With destroy the
+// vApp is destroyed with the entities that remain in it, like the ones cloned
+// from template_vapp; with detach_entities_only they are moved out too and only
+// the empty vApp is destroyed.
+const (
+	vAppDeleteBehaviorDestroy = "destroy"
+	vAppDeleteBehaviorDetach  = "detach_entities_only"
+)
+
+var deleteBehaviorList = []string{
+	vAppDeleteBehaviorDestroy,
+	vAppDeleteBehaviorDetach,
+}
+
+func validateDeleteBehavior(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, deleteBehaviorList)
+}
+
+// detachRemainingEntities moves the virtual machines and child vApps which are
+// still in the vApp into the resource pool and folder of the vApp, so they are
+// not destroyed with it. A nested vApp hands them to its parent vApp.
+func (vapp *vApp) detachRemainingEntities() error {
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"parent", "parentFolder", "vm", "resourcePool"}, &mvapp); err != nil {
+		return err
+	}
+
+	refs := append([]types.ManagedObjectReference{}, mvapp.Vm...)
+	for _, ref := range mvapp.ResourcePool.ResourcePool {
+		if ref.Type == vAppEntityTypeVApp {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	if mvapp.Parent == nil {
+		return fmt.Errorf("vApp %s has no parent resource pool to detach its entities to", vapp.name)
+	}
+
+	log.Printf("[INFO] Detaching %d entities of vApp %s to %s", len(refs), vapp.name, mvapp.Parent.Value)
+	req := types.MoveIntoResourcePool{
+		This: *mvapp.Parent,
+		List: refs,
+	}
+	if _, err := methods.MoveIntoResourcePool(context.TODO(), vapp.c, &req); err != nil {
+		return err
+	}
+
+	if mvapp.ParentFolder == nil {
+		return nil
+	}
+	reqf := types.MoveIntoFolder_Task{
+		This: *mvapp.ParentFolder,
+		List: refs,
+	}
+	res, err := methods.MoveIntoFolder_Task(context.TODO(), vapp.c, &reqf)
+	if err != nil {
+		return err
+	}
+	task := object.NewTask(vapp.c.Client, res.Returnval)
+	return vapp.waitForTask(task, "move the entities of vApp "+vapp.name+" into its folder")
+}
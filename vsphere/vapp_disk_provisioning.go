@@ -0,0 +1,169 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+func validateDiskProvisioning(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, diskFormatTypeList)
+}
+
+// getVAppVMsByName returns the VMs of a vApp with their guest ID and devices,
+// keyed by name.
+func (vapp *vApp) getVAppVMsByName(vappRef types.ManagedObjectReference) (map[string]mo.VirtualMachine, error) {
+	collector := property.DefaultCollector(vapp.c.Client)
+
+	var mvapp mo.VirtualApp
+	if err := collector.RetrieveOne(context.TODO(), vappRef, []string{"vm"}, &mvapp); err != nil {
+		return nil, err
+	}
+
+	var mvms []mo.VirtualMachine
+	if len(mvapp.Vm) > 0 {
+		if err := collector.Retrieve(context.TODO(), mvapp.Vm, []string{"name", "config.guestId", "config.hardware.device"}, &mvms); err != nil {
+			return nil, err
+		}
+	}
+
+	vms := make(map[string]mo.VirtualMachine)
+	for _, mvm := range mvms {
+		// Entities refer to these VMs by name, which has to be unique.
+		if other, ok := vms[mvm.Name]; ok {
+			return nil, fmt.Errorf("vApp %s has more than one VM named %s (%s, %s)",
+				vappRef.Value, mvm.Name, other.Reference().Value, mvm.Reference().Value)
+		}
+		vms[mvm.Name] = mvm
+	}
+	return vms, nil
+}
+
+// validateDiskProvisioningOverrides checks that every entity of
+// entity_disk_provisioning is a VM of the source vApp.
+func (vapp *vApp) validateDiskProvisioningOverrides() error {
+	if len(vapp.vAppToClone.entityDiskFormats) == 0 {
+		return nil
+	}
+
+	sourceVApp, err := vapp.finder.VirtualApp(context.TODO(), vapp.vAppToClone.name)
+	if err != nil {
+		return fmt.Errorf("template_vapp %s not found: %s", vapp.vAppToClone.name, err)
+	}
+	sourceVMs, err := vapp.getVAppVMsByName(sourceVApp.Reference())
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for name := range vapp.vAppToClone.entityDiskFormats {
+		if _, ok := sourceVMs[name]; !ok {
+			errs = append(errs, fmt.Sprintf("entity_disk_provisioning: %s is not a VM of vApp %s",
+				name, vapp.vAppToClone.name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid disk provisioning of template_vapp:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// applyDiskProvisioningOverrides converts the disks of the cloned VMs listed
+// in entity_disk_provisioning. CloneVApp_Task only takes one provisioning
+// type for all VMs, so each listed VM is relocated with the requested disk
+// backing once the clone exists.
+func (vapp *vApp) applyDiskProvisioningOverrides(sourceVApp *object.VirtualApp) error {
+	if len(vapp.vAppToClone.entityDiskFormats) == 0 {
+		return nil
+	}
+
+	clonedVMs, err := vapp.getVAppVMsByName(vapp.createdVApp.Reference())
+	if err != nil {
+		return err
+	}
+	sourceVMs, err := vapp.getVAppVMsByName(sourceVApp.Reference())
+	if err != nil {
+		return err
+	}
+
+	for name, format := range vapp.vAppToClone.entityDiskFormats {
+		mvm, ok := clonedVMs[name]
+		if !ok {
+			return fmt.Errorf("VM %s not found in cloned vApp %s", name, vapp.name)
+		}
+
+		// Disk keys are kept by the clone.
+		sourceThin := make(map[int32]bool)
+		for _, backing := range flatDiskBackings(sourceVMs[name]) {
+			sourceThin[backing.key] = backing.thin()
+		}
+
+		var spec types.VirtualMachineRelocateSpec
+		for _, backing := range flatDiskBackings(mvm) {
+			thin := format == types.VAppCloneSpecProvisioningTypeThin
+			if format == types.VAppCloneSpecProvisioningTypeSameAsSource {
+				thin = sourceThin[backing.key]
+			}
+			if backing.thin() == thin {
+				continue
+			}
+			spec.Disk = append(spec.Disk, types.VirtualMachineRelocateSpecDiskLocator{
+				DiskId:    backing.key,
+				Datastore: *backing.Datastore,
+				DiskBackingInfo: &types.VirtualDiskFlatVer2BackingInfo{
+					DiskMode:        backing.DiskMode,
+					ThinProvisioned: types.NewBool(thin),
+					EagerlyScrub:    types.NewBool(false),
+				},
+			})
+		}
+		if len(spec.Disk) == 0 {
+			continue
+		}
+
+		log.Printf("[INFO] Converting %d disk(s) of VM %s to %s", len(spec.Disk), name, format)
+		vm := object.NewVirtualMachine(vapp.c.Client, mvm.Reference())
+		task, err := vm.Relocate(context.TODO(), spec, types.VirtualMachineMovePriorityDefaultPriority)
+		if err != nil {
+			return err
+		}
+		if err := vapp.waitForTask(task, fmt.Sprintf("convert the disks of VM %s", name)); err != nil {
+			return fmt.Errorf("Error converting the disks of VM %s to %s: %s", name, format, err)
+		}
+	}
+	return nil
+}
+
+type flatDiskBacking struct {
+	*types.VirtualDiskFlatVer2BackingInfo
+	key int32
+}
+
+func (b flatDiskBacking) thin() bool {
+	return b.ThinProvisioned != nil && *b.ThinProvisioned
+}
+
+// flatDiskBackings returns the flat file backings of the disks of the VM.
+// Other backings, e.g. RDMs, cannot be converted.
+func flatDiskBackings(mvm mo.VirtualMachine) []flatDiskBacking {
+	var backings []flatDiskBacking
+	if mvm.Config == nil {
+		return backings
+	}
+	for _, device := range mvm.Config.Hardware.Device {
+		disk, ok := device.(*types.VirtualDisk)
+		if !ok {
+			continue
+		}
+		if backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok && backing.Datastore != nil {
+			backings = append(backings, flatDiskBacking{backing, disk.Key})
+		}
+	}
+	return backings
+}
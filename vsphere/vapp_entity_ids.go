@@ -0,0 +1,173 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"golang.org/x/net/context"
+)
+
+// entity_ids adds virtual machines to the vApp by the ID or uuid of their
+// vsphere_virtual_machine resource, e.g. "${vsphere_virtual_machine.web.id}",
+// which also makes the vApp depend on them. They are entities with the default
+// start settings. Where they were moved from is kept in entity_id_members, so
+// they are moved back when they are removed.
+
+func vAppEntityIDMembersSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Computed: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"id": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"moid": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"folder_path": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"resourcepool_path": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+			},
+		},
+	}
+}
+
+// resolveEntityID returns the moid of the virtual machine of an ID, which is
+// an inventory path as used by vsphere_virtual_machine, a BIOS uuid or a moid.
+func (vapp *vApp) resolveEntityID(id string) (string, error) {
+	si := object.NewSearchIndex(vapp.c.Client)
+	var ref object.Reference
+	var err error
+	switch {
+	case strings.HasPrefix(id, "/"):
+		ref, err = si.FindByInventoryPath(context.TODO(), strings.TrimPrefix(id, "/"))
+	case strings.Count(id, "-") == 4:
+		ref, err = si.FindByUuid(context.TODO(), vapp.datacenterObj, id, true, nil)
+	default:
+		entity := vAppEntity{entityType: vAppEntityTypeVm, entityMoid: id}
+		if _, _, err := vapp.entityRef(entity); err != nil {
+			return "", fmt.Errorf("entity_ids: %s", err)
+		}
+		return id, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("entity_ids: Error looking up %s: %s", id, err)
+	}
+	if ref == nil {
+		return "", fmt.Errorf("entity_ids: virtual machine %s not found", id)
+	}
+	if ref.Reference().Type != vAppEntityTypeVm {
+		return "", fmt.Errorf("entity_ids: %s is a %s, not a virtual machine", id, ref.Reference().Type)
+	}
+	return ref.Reference().Value, nil
+}
+
+// entityIDEntities returns the entities of the IDs. An ID cannot name a
+// virtual machine which is an entity already.
+func (vapp *vApp) entityIDEntities(ids []interface{}, entities []vAppEntity) ([]vAppEntity, error) {
+	moids := make(map[string]string)
+	for _, entity := range entities {
+		if entity.entityMoid != "" {
+			moids[entity.entityMoid] = entity.label()
+		}
+	}
+
+	var added []vAppEntity
+	for _, v := range ids {
+		id := v.(string)
+		moid, err := vapp.resolveEntityID(id)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := moids[moid]; ok {
+			return nil, fmt.Errorf("entity_ids: %s is the virtual machine of entity %s", id, other)
+		}
+		moids[moid] = id
+		entity := vAppEntity{
+			entityType: vAppEntityTypeVm,
+			entityMoid: moid,
+			entityID:   id,
+		}
+		entity.StartOrder = vAppStartOrderDefault
+		added = append(added, entity)
+	}
+	return added, nil
+}
+
+// setEntityIDMembers records the entities added by entity_ids.
+func (vapp *vApp) setEntityIDMembers(entities []vAppEntity) error {
+	var members []interface{}
+	for _, entity := range entities {
+		if entity.entityID == "" {
+			continue
+		}
+		members = append(members, map[string]interface{}{
+			"id":                entity.entityID,
+			"moid":              entity.entityMoid,
+			"folder_path":       entity.entityFolderPath,
+			"resourcepool_path": entity.entityRPPath,
+		})
+	}
+	return vapp.d.Set("entity_id_members", members)
+}
+
+// entityIDMembers returns the recorded entities of entity_ids.
+func (vapp *vApp) entityIDMembers() []vAppEntity {
+	var entities []vAppEntity
+	for _, v := range vapp.d.Get("entity_id_members").([]interface{}) {
+		m := v.(map[string]interface{})
+		entities = append(entities, vAppEntity{
+			entityType:       vAppEntityTypeVm,
+			entityID:         m["id"].(string),
+			entityMoid:       m["moid"].(string),
+			entityFolderPath: m["folder_path"].(string),
+			entityRPPath:     m["resourcepool_path"].(string),
+		})
+	}
+	return entities
+}
+
+// updateEntityIDs moves the virtual machines of removed IDs out of the vApp
+// and the ones of added IDs in. It returns the added entities, whose entity
+// configuration is still to be set.
+func (vapp *vApp) updateEntityIDs(entities []vAppEntity) ([]vAppEntity, error) {
+	o, n := vapp.d.GetChange("entity_ids")
+	oldIDs, newIDs := o.(*schema.Set), n.(*schema.Set)
+
+	var kept []vAppEntity
+	for _, member := range vapp.entityIDMembers() {
+		if newIDs.Contains(member.entityID) {
+			kept = append(kept, member)
+			continue
+		}
+		log.Printf("[DEBUG] Moving entity %s of entity_ids out of vApp %s", member.entityID, vapp.name)
+		if err := vapp.moveEntityOut(member.entityType, member.entityMoid, member.entityRPPath, member.entityFolderPath); err != nil {
+			return nil, err
+		}
+	}
+
+	added, err := vapp.entityIDEntities(newIDs.Difference(oldIDs).List(), append(entities, kept...))
+	if err != nil {
+		return nil, err
+	}
+	if len(added) > 0 {
+		if err := vapp.addEntities(added); err != nil {
+			return nil, err
+		}
+	}
+	if err := vapp.setEntityIDMembers(append(kept, added...)); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
@@ -0,0 +1,121 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// The guest IP addresses of the virtual machines of the vApp are read from
+// VMware Tools. After the vApp is powered on, create and update wait up to
+// entity_ip_address_timeout seconds for the powered on VMs to report one,
+// within the timeout of the operation. By default they do not wait, and the
+// addresses show up with the next refresh.
+
+const (
+	vAppEntityIPAddressTimeoutDefault = 0
+	vAppEntityIPAddressPollInterval   = 5 * time.Second
+)
+
+func vAppEntityIPAddressesSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeMap,
+		Computed:    true,
+		Description: "Guest IP address of every powered on virtual machine of the vApp, keyed by name.",
+	}
+}
+
+func vAppEntityIPAddressTimeoutSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeInt,
+		Optional:     true,
+		Default:      vAppEntityIPAddressTimeoutDefault,
+		ValidateFunc: validateEntityIPAddressTimeout,
+		Description:  "Seconds to wait for the virtual machines to report an IP address after power on. The default 0 does not wait.",
+	}
+}
+
+func validateEntityIPAddressTimeout(v interface{}, k string) (ws []string, errors []error) {
+	if v.(int) < 0 {
+		errors = append(errors, fmt.Errorf("%s: timeout cannot be negative, got %d", k, v.(int)))
+	}
+	return
+}
+
+// entityIPAddresses returns the guest IP addresses of the virtual machines by
+// name, and the names of the powered on ones which have none yet.
+func entityIPAddresses(mvms []mo.VirtualMachine) (map[string]string, []string) {
+	addresses := make(map[string]string)
+	var pending []string
+	for _, mvm := range mvms {
+		if mvm.Guest != nil && mvm.Guest.IpAddress != "" {
+			addresses[mvm.Name] = mvm.Guest.IpAddress
+			continue
+		}
+		if mvm.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn {
+			pending = append(pending, mvm.Name)
+		}
+	}
+	sort.Strings(pending)
+	return addresses, pending
+}
+
+// readEntityIPAddresses reads the guest IP addresses of the virtual machines
+// of the vApp.
+func (vapp *vApp) readEntityIPAddresses() (map[string]string, []string, error) {
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"vm"}, &mvapp); err != nil {
+		return nil, nil, err
+	}
+	if len(mvapp.Vm) == 0 {
+		return map[string]string{}, nil, nil
+	}
+	var mvms []mo.VirtualMachine
+	if err := collector.Retrieve(context.TODO(), mvapp.Vm, []string{"name", "runtime.powerState", "guest.ipAddress"}, &mvms); err != nil {
+		return nil, nil, err
+	}
+	addresses, pending := entityIPAddresses(mvms)
+	return addresses, pending, nil
+}
+
+// waitForEntityIPAddresses waits for the powered on virtual machines of the
+// vApp to report a guest IP address and sets entity_ip_addresses. VMs which
+// do not report one within the timeout are left out with a warning, e.g.
+// VMs without VMware Tools.
+func (vapp *vApp) waitForEntityIPAddresses(d *schema.ResourceData) error {
+	ctx := vapp.taskCtx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	timeout := time.Duration(d.Get("entity_ip_address_timeout").(int)) * time.Second
+	deadline := time.Now().Add(timeout)
+	for {
+		addresses, pending, err := vapp.readEntityIPAddresses()
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 || !time.Now().Before(deadline) {
+			if len(pending) > 0 && timeout > 0 {
+				log.Printf("[WARN] No guest IP address of %s of vApp %s after %s", strings.Join(pending, ", "), vapp.name, timeout)
+			}
+			d.Set("entity_ip_addresses", addresses)
+			return nil
+		}
+		log.Printf("[DEBUG] Waiting for the guest IP address of %s of vApp %s", strings.Join(pending, ", "), vapp.name)
+
+		select {
+		case <-ctx.Done():
+			return taskTimeoutError(ctx, ctx.Err(), "wait for the guest IP addresses of vApp "+vapp.name, vapp.taskTimeout)
+		case <-time.After(vAppEntityIPAddressPollInterval):
+		}
+	}
+}
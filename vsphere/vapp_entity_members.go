@@ -0,0 +1,108 @@
+package vsphere
+
+import (
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// The moid and the previous folder and resource pool of the entities are kept
+// in entity_members, keyed by type and name, and not in the entity set. The
+// set only holds what is configured, so its elements keep their hash when the
+// computed data changes, and an entity whose start settings change keeps its
+// members data without having to be matched to its old element.
+
+func vAppEntityMembersSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Computed: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"key": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"moid": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"folder_path": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"resourcepool_path": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+			},
+		},
+	}
+}
+
+// vAppEntityKey returns the key of an entity in entity_members, e.g.
+// "VirtualMachine/apps/web", or "VirtualMachine/vm-42" for an entity
+// configured by moid. The folder tells apart VMs of the same name in
+// different folders.
+func vAppEntityKey(entityType string, folder string, label string) string {
+	return entityType + "/" + vAppPathString(normalizeFolderPath(folder), label)
+}
+
+// vAppEntityMapKey returns the key of an entity of the entity attribute.
+func vAppEntityMapKey(entity map[string]interface{}) string {
+	folder, _ := entity["folder"].(string)
+	return vAppEntityKey(getEntityType(entity["type"].(string)), folder, vAppEntityLabel(entity))
+}
+
+// key returns the key of the entity in entity_members.
+func (e vAppEntity) key() string {
+	return vAppEntityKey(e.entityType, e.folder, e.label())
+}
+
+// entityMembers returns the recorded moids and previous locations of the
+// entities by key.
+func (vapp *vApp) entityMembers() map[string]vAppEntity {
+	members := make(map[string]vAppEntity)
+	if vapp.d == nil {
+		return members
+	}
+	for _, v := range vapp.d.Get("entity_members").([]interface{}) {
+		m := v.(map[string]interface{})
+		members[m["key"].(string)] = vAppEntity{
+			entityMoid:       m["moid"].(string),
+			entityFolderPath: m["folder_path"].(string),
+			entityRPPath:     m["resourcepool_path"].(string),
+		}
+	}
+	return members
+}
+
+// setEntityMembers records the moids and previous locations of the configured
+// entities. The given entities were added or changed, the others keep their
+// recorded data, and entities which are no longer configured are dropped.
+func (vapp *vApp) setEntityMembers(changed []vAppEntity) error {
+	members := vapp.entityMembers()
+	for _, entity := range changed {
+		if entity.entityID != "" {
+			continue
+		}
+		log.Printf("[DEBUG] Recording entity %s: %s", entity.key(), entity.entityMoid)
+		members[entity.key()] = entity
+	}
+
+	var records []interface{}
+	for _, value := range vapp.d.Get("entity").(*schema.Set).List() {
+		entity := value.(map[string]interface{})
+		key := vAppEntityMapKey(entity)
+		member, ok := members[key]
+		if !ok || member.entityMoid == "" {
+			continue
+		}
+		records = append(records, map[string]interface{}{
+			"key":               key,
+			"moid":              member.entityMoid,
+			"folder_path":       member.entityFolderPath,
+			"resourcepool_path": member.entityRPPath,
+		})
+	}
+	return vapp.d.Set("entity_members", records)
+}
@@ -0,0 +1,80 @@
+package vsphere
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// Entities are configured by name and folder, or by moid. An entity
+// configured by moid has no name in the configuration and stays in the vApp
+// when the VM is moved to another folder. For entities configured by name the
+// moid is computed.
+
+// vAppEntityLabel returns the name of an entity, or the moid of an entity
+// configured by moid.
+func vAppEntityLabel(entity map[string]interface{}) string {
+	if name, _ := entity["name"].(string); name != "" {
+		return name
+	}
+	moid, _ := entity["moid"].(string)
+	return moid
+}
+
+// label returns the name of the entity, or its moid if it is configured by
+// moid.
+func (e vAppEntity) label() string {
+	if e.name != "" {
+		return e.name
+	}
+	return e.entityMoid
+}
+
+// byMoid reports whether the entity is configured by moid.
+func (e vAppEntity) byMoid() bool {
+	return e.name == "" && e.entityMoid != ""
+}
+
+// validateEntityReferences checks that every entity is configured either by
+// name, optionally with a folder, or by moid, but not both.
+func validateEntityReferences(entities []interface{}) error {
+	for _, value := range entities {
+		entity := value.(map[string]interface{})
+		name, _ := entity["name"].(string)
+		folder, _ := entity["folder"].(string)
+		folder = normalizeFolderPath(folder)
+		moid, _ := entity["moid"].(string)
+		switch {
+		case name == "" && moid == "":
+			return fmt.Errorf("entity of type %s: one of name or moid must be set", entity["type"])
+		case name != "" && moid != "":
+			return fmt.Errorf("entity %s: only one of name or moid can be set, not %s too", name, moid)
+		case name == "" && folder != "":
+			return fmt.Errorf("entity %s: folder can only be set with name, not with moid", moid)
+		}
+	}
+	return nil
+}
+
+// entityRef returns the reference and the folder path of an entity.
+func (vapp *vApp) entityRef(e vAppEntity) (types.ManagedObjectReference, string, error) {
+	if !e.byMoid() {
+		return getEntityRef(vapp.finder, e.entityType, vAppPathString(e.folder, e.name))
+	}
+
+	ref := types.ManagedObjectReference{Type: e.entityType, Value: e.entityMoid}
+	var me mo.ManagedEntity
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"name"}, &me); err != nil {
+		return ref, "", fmt.Errorf("%s %s not found: %s", e.entityType, e.entityMoid, err)
+	}
+	entityPath, err := managedObjectInventoryPath(vapp.c.Client, ref)
+	if err != nil {
+		return ref, "", err
+	}
+	return ref, path.Dir(entityPath), nil
+}
@@ -0,0 +1,196 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+var guestHostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+const (
+	// sysprepTimeZoneDefault is the Windows time zone index of GMT.
+	sysprepTimeZoneDefault = 85
+	sysprepNameDefault     = "terraform"
+)
+
+// sysprepSettings are the settings Sysprep needs besides the computer name
+// when it customizes a Windows VM cloned from template_vapp.
+type sysprepSettings struct {
+	timeZone int32
+	fullName string
+	orgName  string
+}
+
+func validateGuestHostname(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	if !guestHostnameRegexp.MatchString(value) {
+		errors = append(errors, fmt.Errorf(
+			"%q must be a single DNS label of at most 63 letters, digits and hyphens: %q", k, value))
+	}
+	return
+}
+
+func entityHasGuestCustomization(entity map[string]interface{}) bool {
+	hostname, _ := entity["hostname"].(string)
+	domain, _ := entity["domain"].(string)
+	return hostname != "" || domain != "" || len(ovfPropertiesMap(entity["ovf_properties"])) > 0
+}
+
+// validateEntityCustomization checks the hostname and domain attributes of
+// the entities. The guest customization only runs on the VMs cloned from
+// template_vapp, when the vApp is created.
+func validateEntityCustomization(entities []interface{}, fromTemplate bool) error {
+	for _, value := range entities {
+		entity := value.(map[string]interface{})
+		if !entityHasGuestCustomization(entity) {
+			continue
+		}
+		if entity["type"].(string) != entityInputVm {
+			return fmt.Errorf("entity %s: hostname, domain and ovf_properties are only supported for entities of type %s",
+				entity["name"], entityInputVm)
+		}
+		if !fromTemplate {
+			return fmt.Errorf("entity %s: hostname, domain and ovf_properties can only be set on VMs cloned from "+
+				"template_vapp when the vApp is created", entity["name"])
+		}
+	}
+	return nil
+}
+
+// markClonedEntities flags the VM entities which name a VM of template_vapp.
+// These refer to the clones of the VMs, which are members of the new vApp
+// from the start, instead of existing VMs to move into it.
+func (vapp *vApp) markClonedEntities() error {
+	sourceVApp, err := vapp.finder.VirtualApp(context.TODO(), vapp.vAppToClone.name)
+	if err != nil {
+		return fmt.Errorf("template_vapp %s not found: %s", vapp.vAppToClone.name, err)
+	}
+	sourceVMs, err := vapp.getVAppVMsByName(sourceVApp.Reference())
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for i, entity := range vapp.vAppEntities {
+		if entity.entityType != vAppEntityTypeVm {
+			continue
+		}
+		if _, ok := sourceVMs[entity.name]; ok {
+			vapp.vAppEntities[i].cloned = true
+		} else if entity.hostname != "" || entity.domain != "" || len(entity.ovfProperties) > 0 {
+			errs = append(errs, fmt.Sprintf("entity %s: hostname, domain and ovf_properties can only be set on VMs of vApp %s",
+				entity.name, vapp.vAppToClone.name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid vApp entities:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// customizeClonedEntities resolves the cloned entities to the VMs of the new
+// vApp and runs the guest customization on those which set hostname or
+// domain, so the clones do not boot with the identity of their source. The
+// VMs are still powered off, the customization is applied on their first
+// power on.
+func (vapp *vApp) customizeClonedEntities() error {
+	clonedVMs, err := vapp.getVAppVMsByName(vapp.createdVApp.Reference())
+	if err != nil {
+		return err
+	}
+
+	for i, entity := range vapp.vAppEntities {
+		if !entity.cloned {
+			continue
+		}
+		mvm, ok := clonedVMs[entity.name]
+		if !ok {
+			return fmt.Errorf("VM %s not found in cloned vApp %s", entity.name, vapp.name)
+		}
+		vapp.vAppEntities[i].entityMoid = mvm.Reference().Value
+
+		if err := vapp.setEntityOvfProperties(mvm.Reference(), entity); err != nil {
+			return err
+		}
+		if entity.hostname == "" && entity.domain == "" {
+			continue
+		}
+		spec := guestCustomizationSpec(mvm, entity.hostname, entity.domain, vapp.vAppToClone.sysprep)
+		log.Printf("[DEBUG] Customization spec for VM %s: %#v", entity.name, spec)
+
+		vm := object.NewVirtualMachine(vapp.c.Client, mvm.Reference())
+		task, err := vm.Customize(context.TODO(), spec)
+		if err != nil {
+			return err
+		}
+		if err := vapp.waitForTask(task, fmt.Sprintf("customize VM %s", entity.name)); err != nil {
+			return fmt.Errorf("Error customizing VM %s: %s", entity.name, err)
+		}
+	}
+	return nil
+}
+
+// guestCustomizationSpec builds a customization spec which sets the hostname
+// and domain of the guest and keeps DHCP on all of its network adapters. The
+// hostname defaults to the name of the VM.
+func guestCustomizationSpec(mvm mo.VirtualMachine, hostname string, domain string, sysprep sysprepSettings) types.CustomizationSpec {
+	if hostname == "" {
+		hostname = mvm.Name
+	}
+
+	var guestID string
+	var nics int
+	if mvm.Config != nil {
+		guestID = mvm.Config.GuestId
+		for _, device := range mvm.Config.Hardware.Device {
+			if _, ok := device.(types.BaseVirtualEthernetCard); ok {
+				nics++
+			}
+		}
+	}
+
+	spec := types.CustomizationSpec{
+		GlobalIPSettings: types.CustomizationGlobalIPSettings{},
+	}
+	for i := 0; i < nics; i++ {
+		spec.NicSettingMap = append(spec.NicSettingMap, types.CustomizationAdapterMapping{
+			Adapter: types.CustomizationIPSettings{
+				Ip: &types.CustomizationDhcpIpGenerator{},
+			},
+		})
+	}
+
+	if strings.HasPrefix(guestID, "win") {
+		// The domain is only used as DNS suffix, joining a Windows domain
+		// needs credentials which the entity does not carry.
+		spec.Identity = &types.CustomizationSysprep{
+			GuiUnattended: types.CustomizationGuiUnattended{
+				AutoLogon:      false,
+				AutoLogonCount: 1,
+				TimeZone:       sysprep.timeZone,
+			},
+			Identification: types.CustomizationIdentification{},
+			UserData: types.CustomizationUserData{
+				ComputerName: &types.CustomizationFixedName{Name: hostname},
+				FullName:     sysprep.fullName,
+				OrgName:      sysprep.orgName,
+			},
+		}
+		if domain != "" {
+			spec.GlobalIPSettings.DnsSuffixList = []string{domain}
+		}
+	} else {
+		spec.Identity = &types.CustomizationLinuxPrep{
+			HostName: &types.CustomizationFixedName{Name: hostname},
+			Domain:   domain,
+		}
+	}
+	return spec
+}
@@ -0,0 +1,255 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vAppAffinityNames returns the names of the VM group, the host group and the
+// rule which pin an entity of a vApp to its hosts. The host group is only
+// created for entities that set host.
+func vAppAffinityNames(vappName string, entityName string) (vmGroup string, hostGroup string, rule string) {
+	prefix := fmt.Sprintf("terraform-%s-%s", vappName, entityName)
+	return prefix + "-vms", prefix + "-hosts", prefix
+}
+
+func entityHasHostAffinity(entity map[string]interface{}) bool {
+	host, _ := entity["host"].(string)
+	hostGroup, _ := entity["host_group"].(string)
+	return host != "" || hostGroup != ""
+}
+
+// validateEntityAffinity checks the host and host_group attributes of the
+// entities, as the rules are only created after the entities were moved into
+// the vApp.
+func validateEntityAffinity(entities []interface{}) error {
+	for _, value := range entities {
+		entity := value.(map[string]interface{})
+		if !entityHasHostAffinity(entity) {
+			continue
+		}
+		if entity["type"].(string) != entityInputVm {
+			return fmt.Errorf("entity %s: host and host_group are only supported for entities of type %s",
+				entity["name"], entityInputVm)
+		}
+		if entity["host"].(string) != "" && entity["host_group"].(string) != "" {
+			return fmt.Errorf("entity %s: only one of host or host_group can be set", entity["name"])
+		}
+	}
+	return nil
+}
+
+// applyHostAffinity creates or updates a mandatory VM-host affinity rule in
+// the owning cluster for every entity that sets host or host_group.
+func (vapp *vApp) applyHostAffinity(entities []vAppEntity) error {
+	for _, entity := range entities {
+		if entity.host == "" && entity.hostGroup == "" {
+			continue
+		}
+		if err := vapp.setHostAffinity(entity); err != nil {
+			return fmt.Errorf("Error setting host affinity of entity %s: %s", entity.name, err)
+		}
+	}
+	return nil
+}
+
+// vAppEntitiesWithHostAffinity returns the entities of the vApp which set
+// host or host_group.
+func (vapp *vApp) vAppEntitiesWithHostAffinity() []vAppEntity {
+	var entities []vAppEntity
+	for _, entity := range vapp.vAppEntities {
+		if entity.host != "" || entity.hostGroup != "" {
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+func (vapp *vApp) setHostAffinity(entity vAppEntity) error {
+	vmRef := types.ManagedObjectReference{Type: vAppEntityTypeVm, Value: entity.entityMoid}
+	cluster, err := getVMCluster(vapp.c, vmRef)
+	if err != nil {
+		return err
+	}
+	info, err := getClusterConfigInfoEx(cluster)
+	if err != nil {
+		return err
+	}
+
+	vmGroupName, hostGroupName, ruleName := vAppAffinityNames(vapp.name, entity.label())
+	spec := &types.ClusterConfigSpecEx{}
+
+	affineGroupName := entity.hostGroup
+	if entity.host != "" {
+		hostRef, err := findClusterHost(vapp.c, cluster, entity.host)
+		if err != nil {
+			return err
+		}
+		spec.GroupSpec = append(spec.GroupSpec, types.ClusterGroupSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: clusterGroupOperation(info, hostGroupName)},
+			Info: &types.ClusterHostGroup{
+				ClusterGroupInfo: types.ClusterGroupInfo{Name: hostGroupName},
+				Host:             []types.ManagedObjectReference{hostRef},
+			},
+		})
+		affineGroupName = hostGroupName
+	} else if findClusterGroup(info, entity.hostGroup) == nil {
+		return fmt.Errorf("host group %s not found in cluster %s", entity.hostGroup, cluster.Reference().Value)
+	}
+
+	spec.GroupSpec = append(spec.GroupSpec, types.ClusterGroupSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: clusterGroupOperation(info, vmGroupName)},
+		Info: &types.ClusterVmGroup{
+			ClusterGroupInfo: types.ClusterGroupInfo{Name: vmGroupName},
+			Vm:               []types.ManagedObjectReference{vmRef},
+		},
+	})
+
+	rule := &types.ClusterVmHostRuleInfo{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:      ruleName,
+			Enabled:   types.NewBool(true),
+			Mandatory: types.NewBool(true),
+		},
+		VmGroupName:         vmGroupName,
+		AffineHostGroupName: affineGroupName,
+	}
+	op := types.ArrayUpdateOperationAdd
+	if existing := findClusterRule(info, ruleName); existing != nil {
+		op = types.ArrayUpdateOperationEdit
+		rule.Key = existing.Key
+	}
+	spec.RulesSpec = append(spec.RulesSpec, types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: op},
+		Info:            rule,
+	})
+
+	log.Printf("[DEBUG] Host affinity spec for entity %s: %#v", entity.name, spec)
+	if err := vapp.reconfigureCluster(cluster, spec); err != nil {
+		return err
+	}
+
+	// Drop the host group of a previous host once the rule no longer uses it.
+	if entity.host == "" && findClusterGroup(info, hostGroupName) != nil {
+		return vapp.reconfigureCluster(cluster, &types.ClusterConfigSpecEx{
+			GroupSpec: []types.ClusterGroupSpec{{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{
+					Operation: types.ArrayUpdateOperationRemove,
+					RemoveKey: hostGroupName,
+				},
+			}},
+		})
+	}
+	return nil
+}
+
+// clearHostAffinity removes the rules and groups created for the entities.
+// The rules have to be gone before their groups can be removed.
+func (vapp *vApp) clearHostAffinity(entities []vAppEntity) error {
+	for _, entity := range entities {
+		vmRef := types.ManagedObjectReference{Type: vAppEntityTypeVm, Value: entity.entityMoid}
+		cluster, err := getVMCluster(vapp.c, vmRef)
+		if err != nil {
+			return err
+		}
+		info, err := getClusterConfigInfoEx(cluster)
+		if err != nil {
+			return err
+		}
+
+		vmGroupName, hostGroupName, ruleName := vAppAffinityNames(vapp.name, entity.label())
+		if rule := findClusterRule(info, ruleName); rule != nil {
+			err := vapp.reconfigureCluster(cluster, &types.ClusterConfigSpecEx{
+				RulesSpec: []types.ClusterRuleSpec{{
+					ArrayUpdateSpec: types.ArrayUpdateSpec{
+						Operation: types.ArrayUpdateOperationRemove,
+						RemoveKey: rule.Key,
+					},
+				}},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		spec := &types.ClusterConfigSpecEx{}
+		for _, name := range []string{vmGroupName, hostGroupName} {
+			if findClusterGroup(info, name) != nil {
+				spec.GroupSpec = append(spec.GroupSpec, types.ClusterGroupSpec{
+					ArrayUpdateSpec: types.ArrayUpdateSpec{
+						Operation: types.ArrayUpdateOperationRemove,
+						RemoveKey: name,
+					},
+				})
+			}
+		}
+		if len(spec.GroupSpec) > 0 {
+			if err := vapp.reconfigureCluster(cluster, spec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (vapp *vApp) reconfigureCluster(cluster *object.ClusterComputeResource, spec *types.ClusterConfigSpecEx) error {
+	task, err := cluster.Reconfigure(context.TODO(), spec, true)
+	if err != nil {
+		return err
+	}
+	return vapp.waitForTask(task, "reconfigure cluster "+cluster.Reference().Value)
+}
+
+// findClusterHost looks up a host of the cluster by name.
+func findClusterHost(c *govmomi.Client, cluster *object.ClusterComputeResource, name string) (types.ManagedObjectReference, error) {
+	var mcl mo.ClusterComputeResource
+	if err := cluster.Properties(context.TODO(), cluster.Reference(), []string{"host"}, &mcl); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+
+	var hosts []mo.HostSystem
+	if len(mcl.Host) > 0 {
+		collector := property.DefaultCollector(c.Client)
+		if err := collector.Retrieve(context.TODO(), mcl.Host, []string{"name"}, &hosts); err != nil {
+			return types.ManagedObjectReference{}, err
+		}
+	}
+	for _, host := range hosts {
+		if host.Name == name {
+			return host.Reference(), nil
+		}
+	}
+	return types.ManagedObjectReference{}, fmt.Errorf("host %s not found in cluster %s", name, cluster.Reference().Value)
+}
+
+func findClusterGroup(info *types.ClusterConfigInfoEx, name string) *types.ClusterGroupInfo {
+	for _, group := range info.Group {
+		if g := group.GetClusterGroupInfo(); g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func findClusterRule(info *types.ClusterConfigInfoEx, name string) *types.ClusterRuleInfo {
+	for _, rule := range info.Rule {
+		if r := rule.GetClusterRuleInfo(); r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func clusterGroupOperation(info *types.ClusterConfigInfoEx, name string) types.ArrayUpdateOperation {
+	if findClusterGroup(info, name) != nil {
+		return types.ArrayUpdateOperationEdit
+	}
+	return types.ArrayUpdateOperationAdd
+}
@@ -0,0 +1,135 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// ovfPropertySpecs returns the edits setting the OVF properties of a vApp or
+// VM to the given values. Properties are keyed by their ID, the key of the
+// OVF environment, and have to be user configurable.
+func ovfPropertySpecs(props []types.VAppPropertyInfo, values map[string]string) ([]types.VAppPropertySpec, error) {
+	byID := make(map[string]types.VAppPropertyInfo)
+	var configurable []string
+	for _, p := range props {
+		byID[p.Id] = p
+		if p.UserConfigurable != nil && *p.UserConfigurable {
+			configurable = append(configurable, p.Id)
+		}
+	}
+	sort.Strings(configurable)
+
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var specs []types.VAppPropertySpec
+	var errs []string
+	for _, key := range keys {
+		p, ok := byID[key]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("OVF property %s not found", key))
+			continue
+		case p.UserConfigurable == nil || !*p.UserConfigurable:
+			errs = append(errs, fmt.Sprintf("OVF property %s is not user configurable", key))
+			continue
+		}
+		specs = append(specs, types.VAppPropertySpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationEdit,
+			},
+			Info: &types.VAppPropertyInfo{
+				Key:   p.Key,
+				Value: values[key],
+			},
+		})
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s, the user configurable properties are %s",
+			strings.Join(errs, ", "), strings.Join(configurable, ", "))
+	}
+	return specs, nil
+}
+
+// applyOvfProperties sets the OVF properties of the cloned vApp listed in
+// template_vapp, before its VMs first power on and read their environment.
+func (vapp *vApp) applyOvfProperties() error {
+	if len(vapp.vAppToClone.ovfProperties) == 0 {
+		return nil
+	}
+
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"vAppConfig"}, &mvapp); err != nil {
+		return err
+	}
+	var props []types.VAppPropertyInfo
+	if mvapp.VAppConfig != nil {
+		props = mvapp.VAppConfig.Property
+	}
+	specs, err := ovfPropertySpecs(props, vapp.vAppToClone.ovfProperties)
+	if err != nil {
+		return fmt.Errorf("vApp %s: %s", vapp.name, err)
+	}
+
+	log.Printf("[INFO] Setting %d OVF properties of vApp %s", len(specs), vapp.name)
+	return vapp.updateVApp(types.VAppConfigSpec{
+		VmConfigSpec: types.VmConfigSpec{Property: specs},
+	})
+}
+
+// setEntityOvfProperties sets the OVF properties of a VM cloned from
+// template_vapp.
+func (vapp *vApp) setEntityOvfProperties(ref types.ManagedObjectReference, entity vAppEntity) error {
+	if len(entity.ovfProperties) == 0 {
+		return nil
+	}
+
+	var mvm mo.VirtualMachine
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"config.vAppConfig"}, &mvm); err != nil {
+		return err
+	}
+	var props []types.VAppPropertyInfo
+	if mvm.Config != nil && mvm.Config.VAppConfig != nil {
+		props = mvm.Config.VAppConfig.GetVmConfigInfo().Property
+	}
+	specs, err := ovfPropertySpecs(props, entity.ovfProperties)
+	if err != nil {
+		return fmt.Errorf("entity %s: %s", entity.name, err)
+	}
+
+	log.Printf("[INFO] Setting %d OVF properties of VM %s", len(specs), entity.name)
+	vm := object.NewVirtualMachine(vapp.c.Client, ref)
+	task, err := vm.Reconfigure(context.TODO(), types.VirtualMachineConfigSpec{
+		VAppConfig: &types.VmConfigSpec{Property: specs},
+	})
+	if err != nil {
+		return err
+	}
+	return vapp.waitForTask(task, fmt.Sprintf("set OVF properties of VM %s", entity.name))
+}
+
+// ovfPropertiesMap converts the ovf_properties attribute.
+func ovfPropertiesMap(v interface{}) map[string]string {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	values := make(map[string]string)
+	for key, value := range m {
+		values[key] = value.(string)
+	}
+	return values
+}
@@ -0,0 +1,94 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vAppRelativePath returns the path of a vApp relative to the VM folder of
+// its datacenter, the form parent_vapp and the finder use.
+func vAppRelativePath(c *govmomi.Client, ref types.ManagedObjectReference) (string, error) {
+	collector := property.DefaultCollector(c.Client)
+
+	var mvapp mo.VirtualApp
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"name", "parentFolder", "parentVApp"}, &mvapp); err != nil {
+		return "", err
+	}
+	if mvapp.ParentVApp != nil {
+		parent, err := vAppRelativePath(c, *mvapp.ParentVApp)
+		if err != nil {
+			return "", err
+		}
+		return vAppPathString(parent, mvapp.Name), nil
+	}
+
+	// Walk up the folders until the VM folder, whose parent is the
+	// datacenter.
+	var names []string
+	next := mvapp.ParentFolder
+	for next != nil {
+		var folder mo.Folder
+		if err := collector.RetrieveOne(context.TODO(), *next, []string{"name", "parent"}, &folder); err != nil {
+			return "", err
+		}
+		if folder.Parent == nil || folder.Parent.Type == "Datacenter" {
+			break
+		}
+		names = append([]string{folder.Name}, names...)
+		next = folder.Parent
+	}
+	return vAppPathString(strings.Join(names, "/"), mvapp.Name), nil
+}
+
+// resolveParentVApp finds the parent vApp given by parent_vapp_id or
+// parent_vapp before anything is created. parent_vapp is set to the path of
+// a parent given by its ID, which also places the vApp in the parent.
+func (vapp *vApp) resolveParentVApp(d *schema.ResourceData) error {
+	var ref types.ManagedObjectReference
+	if v, ok := d.GetOk("parent_vapp_id"); ok && v != "" {
+		ref = types.ManagedObjectReference{Type: "VirtualApp", Value: v.(string)}
+		path, err := vAppRelativePath(vapp.c, ref)
+		if err != nil {
+			return fmt.Errorf("parent vApp %s not found: %s", ref.Value, err)
+		}
+		log.Printf("[DEBUG] Parent vApp %s is %s", ref.Value, path)
+		vapp.parentVApp = path
+		d.Set("parent_vapp", path)
+	} else if vapp.parentVApp != "" {
+		parent, err := vapp.finder.VirtualApp(context.TODO(), vapp.parentVApp)
+		if err != nil {
+			return fmt.Errorf("parent vApp %s not found, if it is created in the same configuration use parent_vapp_id: %s",
+				vapp.parentVApp, err)
+		}
+		ref = parent.Reference()
+	} else {
+		return nil
+	}
+
+	// The vApp and its entities are powered on once created, which fails
+	// while the parent is being started or stopped itself.
+	if len(vapp.vAppEntities) == 0 {
+		return nil
+	}
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"summary"}, &mvapp); err != nil {
+		return err
+	}
+	if summary, ok := mvapp.Summary.(*types.VirtualAppSummary); ok {
+		switch summary.VAppState {
+		case types.VirtualAppVAppStateStarting, types.VirtualAppVAppStateStopping:
+			return fmt.Errorf("parent vApp %s is %s, retry once it is started or stopped",
+				vapp.parentVApp, summary.VAppState)
+		}
+	}
+	return nil
+}
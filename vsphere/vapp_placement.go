@@ -0,0 +1,157 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// The policies placing a vApp in one of several clusters or resource pools.
+const (
+	placementPolicyMostFreeMemory = "most_free_memory"
+	placementPolicyMostFreeCpu    = "most_free_cpu"
+	placementPolicyRoundRobin     = "round_robin"
+)
+
+var placementPolicyList = []string{
+	placementPolicyMostFreeMemory,
+	placementPolicyMostFreeCpu,
+	placementPolicyRoundRobin,
+}
+
+// placementCounter spreads the vApps created with round_robin by one
+// provider run over the candidates.
+var placementCounter struct {
+	sync.Mutex
+	next int
+}
+
+func validatePlacementPolicy(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, placementPolicyList)
+}
+
+// placementCandidate is a resource pool a vApp can be placed in, with its
+// unused memory in bytes and CPU in MHz.
+type placementCandidate struct {
+	path       string
+	pool       *object.ResourcePool
+	freeMemory int64
+	freeCpu    int64
+}
+
+// selectPlacement returns the index of the candidate chosen by the policy.
+// Candidates are sorted by path, ties go to the first one.
+func selectPlacement(policy string, candidates []placementCandidate, counter int) int {
+	best := 0
+	switch policy {
+	case placementPolicyRoundRobin:
+		return counter % len(candidates)
+	case placementPolicyMostFreeCpu:
+		for i, c := range candidates {
+			if c.freeCpu > candidates[best].freeCpu {
+				best = i
+			}
+		}
+	default:
+		for i, c := range candidates {
+			if c.freeMemory > candidates[best].freeMemory {
+				best = i
+			}
+		}
+	}
+	return best
+}
+
+// findPlacementCandidates returns the resource pools given by
+// placement_candidates, as resource pool paths or cluster names, or the root
+// resource pools of all clusters of the datacenter.
+func (vapp *vApp) findPlacementCandidates(names []string) ([]placementCandidate, error) {
+	var pools []*object.ResourcePool
+	if len(names) == 0 {
+		all, err := vapp.finder.ResourcePoolList(context.TODO(), "*/Resources")
+		if err != nil {
+			return nil, fmt.Errorf("no clusters found to place vApp %s in: %s", vapp.name, err)
+		}
+		pools = all
+	}
+	for _, name := range names {
+		pool, err := vapp.finder.ResourcePool(context.TODO(), name)
+		if err != nil {
+			pool, err = vapp.finder.ResourcePool(context.TODO(), clusterResourcePoolPath(name))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("placement candidate %s is neither a resource pool nor a cluster: %s", name, err)
+		}
+		pools = append(pools, pool)
+	}
+
+	refs := make([]types.ManagedObjectReference, 0, len(pools))
+	for _, pool := range pools {
+		refs = append(refs, pool.Reference())
+	}
+	var mpools []mo.ResourcePool
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.Retrieve(context.TODO(), refs, []string{"runtime"}, &mpools); err != nil {
+		return nil, err
+	}
+	runtimes := make(map[types.ManagedObjectReference]types.ResourcePoolRuntimeInfo)
+	for _, mpool := range mpools {
+		runtimes[mpool.Reference()] = mpool.Runtime
+	}
+
+	candidates := make([]placementCandidate, 0, len(pools))
+	for _, pool := range pools {
+		runtime := runtimes[pool.Reference()]
+		candidates = append(candidates, placementCandidate{
+			path:       pool.InventoryPath,
+			pool:       pool,
+			freeMemory: runtime.Memory.MaxUsage - runtime.Memory.OverallUsage,
+			freeCpu:    runtime.Cpu.MaxUsage - runtime.Cpu.OverallUsage,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].path < candidates[j].path })
+	return candidates, nil
+}
+
+// applyPlacementPolicy chooses the resource pool of a new vApp by its
+// placement_policy. The choice is written to resource_pool, so it stays the
+// same on later runs.
+func (vapp *vApp) applyPlacementPolicy(d *schema.ResourceData) error {
+	policy, ok := d.GetOk("placement_policy")
+	if !ok || vapp.parentVApp != "" {
+		return nil
+	}
+
+	var names []string
+	for _, v := range d.Get("placement_candidates").([]interface{}) {
+		names = append(names, v.(string))
+	}
+	candidates, err := vapp.findPlacementCandidates(names)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no placement candidates found for vApp %s", vapp.name)
+	}
+
+	placementCounter.Lock()
+	counter := placementCounter.next
+	placementCounter.next++
+	placementCounter.Unlock()
+
+	chosen := candidates[selectPlacement(policy.(string), candidates, counter)]
+	log.Printf("[INFO] Placing vApp %s in %s by %s, free memory %d bytes, free CPU %d MHz",
+		vapp.name, chosen.path, policy, chosen.freeMemory, chosen.freeCpu)
+
+	vapp.resourcePool = chosen.path
+	d.Set("resource_pool", chosen.path)
+	return nil
+}
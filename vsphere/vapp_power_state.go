@@ -0,0 +1,168 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// The power states of a vApp. vSphere reports a suspended vApp as stopped,
+// it is told apart by its suspended virtual machines.
+const (
+	vAppPowerStateOn        = "poweredOn"
+	vAppPowerStateOff       = "poweredOff"
+	vAppPowerStateSuspended = "suspended"
+)
+
+var vAppPowerStateList = []string{
+	vAppPowerStateOn,
+	vAppPowerStateOff,
+	vAppPowerStateSuspended,
+}
+
+func validateVAppPowerState(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, vAppPowerStateList)
+}
+
+// vAppPowerState returns the power state of the vApp from its state and the
+// power states of its virtual machines.
+func vAppPowerState(state types.VirtualAppVAppState, vmStates []types.VirtualMachinePowerState) string {
+	switch state {
+	case types.VirtualAppVAppStateStarted, types.VirtualAppVAppStateStarting:
+		return vAppPowerStateOn
+	}
+
+	suspended := false
+	for _, s := range vmStates {
+		switch s {
+		case types.VirtualMachinePowerStatePoweredOn:
+			return vAppPowerStateOn
+		case types.VirtualMachinePowerStateSuspended:
+			suspended = true
+		}
+	}
+	if suspended {
+		return vAppPowerStateSuspended
+	}
+	return vAppPowerStateOff
+}
+
+// vAppRuntime is the runtime state of a vApp and its entities.
+type vAppRuntime struct {
+	powerState    string
+	overallStatus string
+	// Power states of the virtual machines and child vApps by name.
+	entityPowerStates map[string]string
+}
+
+// readVAppRuntime reads the power state and health of the vApp and the power
+// states of its entities.
+func (vapp *vApp) readVAppRuntime() (*vAppRuntime, error) {
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	props := []string{"summary", "overallStatus", "vm", "resourcePool"}
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), props, &mvapp); err != nil {
+		return nil, err
+	}
+
+	runtime := &vAppRuntime{
+		overallStatus:     string(mvapp.OverallStatus),
+		entityPowerStates: make(map[string]string),
+	}
+
+	var vmStates []types.VirtualMachinePowerState
+	if len(mvapp.Vm) > 0 {
+		var mvms []mo.VirtualMachine
+		if err := collector.Retrieve(context.TODO(), mvapp.Vm, []string{"name", "runtime.powerState"}, &mvms); err != nil {
+			return nil, err
+		}
+		for _, mvm := range mvms {
+			vmStates = append(vmStates, mvm.Runtime.PowerState)
+			runtime.entityPowerStates[mvm.Name] = string(mvm.Runtime.PowerState)
+		}
+	}
+
+	var children []types.ManagedObjectReference
+	for _, ref := range mvapp.ResourcePool.ResourcePool {
+		if ref.Type == vAppEntityTypeVApp {
+			children = append(children, ref)
+		}
+	}
+	if len(children) > 0 {
+		var mchildren []mo.VirtualApp
+		if err := collector.Retrieve(context.TODO(), children, []string{"name", "summary"}, &mchildren); err != nil {
+			return nil, err
+		}
+		for _, child := range mchildren {
+			if summary, ok := child.Summary.(*types.VirtualAppSummary); ok {
+				runtime.entityPowerStates[child.Name] = vAppPowerState(summary.VAppState, nil)
+			}
+		}
+	}
+
+	var state types.VirtualAppVAppState
+	if summary, ok := mvapp.Summary.(*types.VirtualAppSummary); ok {
+		state = summary.VAppState
+	}
+	runtime.powerState = vAppPowerState(state, vmStates)
+	return runtime, nil
+}
+
+// readVAppPowerState reads the power state of the vApp and its virtual
+// machines.
+func (vapp *vApp) readVAppPowerState() (string, error) {
+	runtime, err := vapp.readVAppRuntime()
+	if err != nil {
+		return "", err
+	}
+	return runtime.powerState, nil
+}
+
+// suspendVApp suspends the virtual machines of the vApp, which have to be
+// powered on.
+func (vapp *vApp) suspendVApp() error {
+	req := types.SuspendVApp_Task{
+		This: vapp.createdVApp.Reference(),
+	}
+	res, err := methods.SuspendVApp_Task(context.TODO(), vapp.c, &req)
+	if err != nil {
+		return err
+	}
+	task := object.NewTask(vapp.c.Client, res.Returnval)
+	return vapp.waitForTask(task, "suspend vApp "+vapp.name)
+}
+
+// setVAppPowerState powers on, powers off or suspends the vApp. Powering on
+// resumes a suspended vApp, a powered off vApp is powered on to be
+// suspended.
+func (vapp *vApp) setVAppPowerState(desired string) error {
+	current, err := vapp.readVAppPowerState()
+	if err != nil {
+		return err
+	}
+	if current == desired {
+		return nil
+	}
+	log.Printf("[INFO] Changing power state of vApp %s from %s to %s", vapp.name, current, desired)
+
+	switch desired {
+	case vAppPowerStateOn:
+		return vapp.powerOnVApp(vAppStartPolicyAlways)
+	case vAppPowerStateOff:
+		return vapp.powerOffVApp()
+	case vAppPowerStateSuspended:
+		if current == vAppPowerStateOff {
+			if err := vapp.powerOnVApp(vAppStartPolicyAlways); err != nil {
+				return err
+			}
+		}
+		return vapp.suspendVApp()
+	}
+	return fmt.Errorf("unsupported power state %s for vApp %s", desired, vapp.name)
+}
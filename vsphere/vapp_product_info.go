@@ -0,0 +1,79 @@
+package vsphere
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// The product sections of the OVF a vApp was deployed from, e.g. the name
+// and version of an appliance, read back as product.
+
+func vAppProductSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Computed: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"key": &schema.Schema{
+					Type:     schema.TypeInt,
+					Computed: true,
+				},
+				"class_id": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"instance_id": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"name": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"vendor": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"version": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"full_version": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"vendor_url": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"product_url": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"app_url": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+			},
+		},
+	}
+}
+
+func flattenVAppProducts(products []types.VAppProductInfo) []interface{} {
+	var result []interface{}
+	for _, p := range products {
+		result = append(result, map[string]interface{}{
+			"key":          int(p.Key),
+			"class_id":     p.ClassId,
+			"instance_id":  p.InstanceId,
+			"name":         p.Name,
+			"vendor":       p.Vendor,
+			"version":      p.Version,
+			"full_version": p.FullVersion,
+			"vendor_url":   p.VendorUrl,
+			"product_url":  p.ProductUrl,
+			"app_url":      p.AppUrl,
+		})
+	}
+	return result
+}
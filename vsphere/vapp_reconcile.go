@@ -0,0 +1,83 @@
+package vsphere
+
+import (
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+// vAppMemberMoids returns the moids of the entities of the vApp.
+func vAppMemberMoids(mvapp *mo.VirtualApp) map[string]bool {
+	members := make(map[string]bool)
+	if mvapp.VAppConfig == nil {
+		return members
+	}
+	for _, c := range mvapp.VAppConfig.EntityConfig {
+		if c.Key != nil {
+			members[c.Key.Value] = true
+		}
+	}
+	return members
+}
+
+// reconcileEntities drops the entities from the state which are no longer
+// members of the vApp, e.g. because a VM was moved out of it or deleted in
+// vCenter. The plan then shows them to be added again, instead of a later
+// update or destroy acting on their stale moids and paths.
+func (vapp *vApp) reconcileEntities(mvapp *mo.VirtualApp) error {
+	members := vAppMemberMoids(mvapp)
+
+	if entitySet, ok := vapp.d.Get("entity").(*schema.Set); ok && entitySet.Len() > 0 {
+		recorded := vapp.entityMembers()
+		var kept []interface{}
+		for _, value := range entitySet.List() {
+			entity := value.(map[string]interface{})
+			// Entities without moid were never added, e.g. after a failed
+			// create.
+			moid, _ := entity["moid"].(string)
+			key := vAppEntityMapKey(entity)
+			if member, ok := recorded[key]; ok {
+				moid = member.entityMoid
+			}
+			if moid != "" && !members[moid] {
+				log.Printf("[WARN] Entity %s (%s) is no longer a member of vApp %s, removing it from the state",
+					vAppEntityLabel(entity), moid, vapp.name)
+				continue
+			}
+			kept = append(kept, entity)
+		}
+		if len(kept) != entitySet.Len() {
+			if err := vapp.d.Set("entity", kept); err != nil {
+				return err
+			}
+			if err := vapp.setEntityMembers(nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	idMembers := vapp.entityIDMembers()
+	var keptMembers []vAppEntity
+	for _, member := range idMembers {
+		if !members[member.entityMoid] {
+			log.Printf("[WARN] Entity %s (%s) of entity_ids is no longer a member of vApp %s, removing it from the state",
+				member.entityID, member.entityMoid, vapp.name)
+			continue
+		}
+		keptMembers = append(keptMembers, member)
+	}
+	if len(keptMembers) != len(idMembers) {
+		ids := make([]interface{}, 0, len(keptMembers))
+		for _, member := range keptMembers {
+			ids = append(ids, member.entityID)
+		}
+		if err := vapp.d.Set("entity_ids", ids); err != nil {
+			return err
+		}
+		if err := vapp.setEntityIDMembers(keptMembers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// checkEntityReparent fails for entities which are members of another vApp,
+// as moving them into the vApp silently takes them out of the other one.
+// With allow the entities are moved anyway, and return to the other vApp when
+// they are removed. parents holds the parent resource pool or vApp of the
+// entities by moid.
+func checkEntityReparent(parents map[string]types.ManagedObjectReference, vapp types.ManagedObjectReference, allow bool) error {
+	var errs []string
+	for moid, parent := range parents {
+		if parent.Type != vAppEntityTypeVApp || parent == vapp {
+			continue
+		}
+		if allow {
+			log.Printf("[INFO] Moving entity %s out of vApp %s", moid, parent.Value)
+			continue
+		}
+		errs = append(errs, fmt.Sprintf("entity %s is a member of vApp %s", moid, parent.Value))
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("Entities of other vApps cannot be added, set allow_reparent to move them:\n%s",
+			strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package vsphere
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// Changed start settings of the entities of a running vApp only take effect
+// when it is powered on again. With restart_on_entity_change update restarts
+// the changed entities the way the vApp would: they are stopped in reverse
+// start order with their stop actions and stop delays, then started in start
+// order with their start actions and start delays, waiting for the guests
+// of the entities with waiting_for_guest. The other entities keep running.
+// Entities added to a running vApp are not restarted, they keep their power
+// state until the vApp is powered on again. The delays count against the
+// timeout of the update.
+
+func vAppRestartOnEntityChangeSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Description: "Restarts the changed entities of a powered on vApp in start order, instead of waiting for the next power on of the vApp.",
+	}
+}
+
+// restartSequence groups the entities by start order, in the order they
+// start.
+func restartSequence(entities []vAppEntity) [][]vAppEntity {
+	byOrder := make(map[int32][]vAppEntity)
+	var orders []int
+	for _, e := range entities {
+		if _, ok := byOrder[e.StartOrder]; !ok {
+			orders = append(orders, int(e.StartOrder))
+		}
+		byOrder[e.StartOrder] = append(byOrder[e.StartOrder], e)
+	}
+	sort.Ints(orders)
+
+	var groups [][]vAppEntity
+	for _, order := range orders {
+		groups = append(groups, byOrder[int32(order)])
+	}
+	return groups
+}
+
+// groupDelay returns the longest delay of the entities of a group.
+func groupDelay(group []vAppEntity, delay func(vAppEntity) int32) time.Duration {
+	var longest int32
+	for _, e := range group {
+		if d := delay(e); d > longest {
+			longest = d
+		}
+	}
+	return time.Duration(longest) * time.Second
+}
+
+// groupGuestWaitRefs returns the VM entities of a group with
+// waiting_for_guest.
+func groupGuestWaitRefs(group []vAppEntity) []types.ManagedObjectReference {
+	var refs []types.ManagedObjectReference
+	for _, e := range group {
+		if e.entityType != vAppEntityTypeVm || e.entityMoid == "" {
+			continue
+		}
+		if e.WaitingForGuest != nil && *e.WaitingForGuest {
+			refs = append(refs, types.ManagedObjectReference{Type: e.entityType, Value: e.entityMoid})
+		}
+	}
+	return refs
+}
+
+// waitDelay waits for the stop or start delay of a group, failing when the
+// operation times out first.
+func (vapp *vApp) waitDelay(delay time.Duration, operation string) error {
+	if delay <= 0 {
+		return nil
+	}
+	ctx := vapp.taskCtx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	select {
+	case <-ctx.Done():
+		return taskTimeoutError(ctx, ctx.Err(), operation, vapp.taskTimeout)
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// restartEntities restarts the entities of a powered on vApp in start order.
+func (vapp *vApp) restartEntities(entities []vAppEntity) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	state, err := vapp.readVAppPowerState()
+	if err != nil {
+		return err
+	}
+	if state != vAppPowerStateOn {
+		log.Printf("[DEBUG] vApp %s is %s, the changed entities start with it", vapp.name, state)
+		return nil
+	}
+
+	groups := restartSequence(entities)
+	for i := len(groups) - 1; i >= 0; i-- {
+		for _, e := range groups[i] {
+			if err := vapp.stopEntity(e); err != nil {
+				return err
+			}
+		}
+		if i > 0 {
+			delay := groupDelay(groups[i], func(e vAppEntity) int32 { return e.StopDelay })
+			if err := vapp.waitDelay(delay, "wait for the stop delay of vApp "+vapp.name); err != nil {
+				return err
+			}
+		}
+	}
+	for i, group := range groups {
+		for _, e := range group {
+			if err := vapp.startEntity(e); err != nil {
+				return err
+			}
+		}
+		if err := vapp.waitForGuestRefs(groupGuestWaitRefs(group)); err != nil {
+			return err
+		}
+		if i < len(groups)-1 {
+			delay := groupDelay(group, func(e vAppEntity) int32 { return e.StartDelay })
+			if err := vapp.waitDelay(delay, "wait for the start delay of vApp "+vapp.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// entityPowerState reads the power state of a VM entity.
+func (vapp *vApp) entityPowerState(ref types.ManagedObjectReference) (types.VirtualMachinePowerState, error) {
+	var mvm mo.VirtualMachine
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), ref, []string{"runtime.powerState"}, &mvm); err != nil {
+		return "", err
+	}
+	return mvm.Runtime.PowerState, nil
+}
+
+// stopEntity stops an entity with its stop action. Child vApps stop their
+// entities with their own stop actions.
+func (vapp *vApp) stopEntity(e vAppEntity) error {
+	ref := types.ManagedObjectReference{Type: e.entityType, Value: e.entityMoid}
+	if e.entityType == vAppEntityTypeVApp {
+		log.Printf("[INFO] Powering off vApp %s of vApp %s", e.label(), vapp.name)
+		task, err := object.NewVirtualApp(vapp.c.Client, ref).PowerOff(context.TODO(), false)
+		if err != nil {
+			return err
+		}
+		return ignoreInvalidPowerState(vapp.waitForTask(task, "power off vApp "+e.label()))
+	}
+
+	state, err := vapp.entityPowerState(ref)
+	if err != nil {
+		return err
+	}
+	if state != types.VirtualMachinePowerStatePoweredOn || e.StopAction == string(types.VAppAutoStartActionNone) {
+		return nil
+	}
+
+	vm := object.NewVirtualMachine(vapp.c.Client, ref)
+	var task *object.Task
+	switch e.StopAction {
+	case string(types.VAppAutoStartActionGuestShutdown):
+		log.Printf("[INFO] Shutting down the guest of VM %s of vApp %s", e.label(), vapp.name)
+		if err := vm.ShutdownGuest(context.TODO()); err != nil {
+			return err
+		}
+		ctx := vapp.taskCtx
+		if ctx == nil {
+			ctx = context.TODO()
+		}
+		err := vm.WaitForPowerState(ctx, types.VirtualMachinePowerStatePoweredOff)
+		return taskTimeoutError(ctx, err, "shut down VM "+e.label(), vapp.taskTimeout)
+	case string(types.VAppAutoStartActionSuspend):
+		log.Printf("[INFO] Suspending VM %s of vApp %s", e.label(), vapp.name)
+		task, err = vm.Suspend(context.TODO())
+	default:
+		log.Printf("[INFO] Powering off VM %s of vApp %s", e.label(), vapp.name)
+		task, err = vm.PowerOff(context.TODO())
+	}
+	if err != nil {
+		return err
+	}
+	return vapp.waitForTask(task, "stop VM "+e.label())
+}
+
+// startEntity starts an entity unless its start action is none.
+func (vapp *vApp) startEntity(e vAppEntity) error {
+	if e.StartAction == string(types.VAppAutoStartActionNone) {
+		return nil
+	}
+	ref := types.ManagedObjectReference{Type: e.entityType, Value: e.entityMoid}
+	if e.entityType == vAppEntityTypeVApp {
+		log.Printf("[INFO] Powering on vApp %s of vApp %s", e.label(), vapp.name)
+		task, err := object.NewVirtualApp(vapp.c.Client, ref).PowerOn(context.TODO())
+		if err != nil {
+			return err
+		}
+		return ignoreInvalidPowerState(vapp.waitForTask(task, "power on vApp "+e.label()))
+	}
+
+	state, err := vapp.entityPowerState(ref)
+	if err != nil {
+		return err
+	}
+	if state == types.VirtualMachinePowerStatePoweredOn {
+		return nil
+	}
+	log.Printf("[INFO] Powering on VM %s of vApp %s", e.label(), vapp.name)
+	task, err := object.NewVirtualMachine(vapp.c.Client, ref).PowerOn(context.TODO())
+	if err != nil {
+		return err
+	}
+	return vapp.waitForTask(task, "power on VM "+e.label())
+}
+
+// ignoreInvalidPowerState drops the fault of powering an entity on or off
+// which already is.
+func ignoreInvalidPowerState(err error) error {
+	if _, ok := vimFaultFromError(err).(*types.InvalidPowerState); ok {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vAppSpreadRuleName returns the name of the anti-affinity rule which keeps
+// the virtual machines of a vApp on different hosts.
+func vAppSpreadRuleName(vappName string) string {
+	return fmt.Sprintf("terraform-%s-spread", vappName)
+}
+
+// vAppClusterAndVMs returns the cluster owning the vApp and the virtual
+// machines directly in it.
+func (vapp *vApp) vAppClusterAndVMs() (*object.ClusterComputeResource, []types.ManagedObjectReference, error) {
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"owner", "vm"}, &mvapp); err != nil {
+		return nil, nil, err
+	}
+	if mvapp.Owner.Type != "ClusterComputeResource" {
+		return nil, nil, fmt.Errorf("vApp %s is not placed in a cluster; spread_entities is only supported for clustered vApps", vapp.name)
+	}
+	return object.NewClusterComputeResource(vapp.c.Client, mvapp.Owner), mvapp.Vm, nil
+}
+
+// applySpreadRule creates or updates the anti-affinity rule spreading the
+// virtual machines of the vApp across the hosts of its cluster. A rule needs
+// two virtual machines, with fewer the rule is removed.
+func (vapp *vApp) applySpreadRule() error {
+	cluster, vms, err := vapp.vAppClusterAndVMs()
+	if err != nil {
+		return err
+	}
+	if len(vms) < 2 {
+		log.Printf("[DEBUG] vApp %s has %d virtual machine(s), not spreading them", vapp.name, len(vms))
+		return vapp.removeSpreadRule(cluster)
+	}
+	info, err := getClusterConfigInfoEx(cluster)
+	if err != nil {
+		return err
+	}
+
+	rule := &types.ClusterAntiAffinityRuleSpec{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:    vAppSpreadRuleName(vapp.name),
+			Enabled: types.NewBool(true),
+		},
+		Vm: vms,
+	}
+	op := types.ArrayUpdateOperationAdd
+	if existing := findClusterRule(info, rule.Name); existing != nil {
+		op = types.ArrayUpdateOperationEdit
+		rule.Key = existing.Key
+	}
+
+	log.Printf("[DEBUG] Spreading virtual machines of vApp %s: %#v", vapp.name, vms)
+	return vapp.reconfigureCluster(cluster, &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: op},
+			Info:            rule,
+		}},
+	})
+}
+
+// clearSpreadRule removes the anti-affinity rule of the vApp, if any.
+func (vapp *vApp) clearSpreadRule() error {
+	cluster, _, err := vapp.vAppClusterAndVMs()
+	if err != nil {
+		return err
+	}
+	return vapp.removeSpreadRule(cluster)
+}
+
+func (vapp *vApp) removeSpreadRule(cluster *object.ClusterComputeResource) error {
+	info, err := getClusterConfigInfoEx(cluster)
+	if err != nil {
+		return err
+	}
+	rule := findClusterRule(info, vAppSpreadRuleName(vapp.name))
+	if rule == nil {
+		return nil
+	}
+	return vapp.reconfigureCluster(cluster, &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationRemove,
+				RemoveKey: rule.Key,
+			},
+		}},
+	})
+}
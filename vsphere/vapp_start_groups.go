@@ -0,0 +1,196 @@
+package vsphere
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vAppStartGroup is a named group of entities which start together, e.g. the
+// database VMs, before the entities of the groups listed after it.
+type vAppStartGroup struct {
+	name     string
+	entities []string
+}
+
+func vAppStartGroupSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		Description: "Groups of entities in boot order. The entities of a group share start_order, start_delay and stop_delay, and start after the entities of the groups before it.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"entities": &schema.Schema{
+					Type:     schema.TypeList,
+					Required: true,
+					MinItems: 1,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+				},
+			},
+		},
+	}
+}
+
+func parseVAppStartGroups(vL []interface{}) []vAppStartGroup {
+	var groups []vAppStartGroup
+	for _, v := range vL {
+		m := v.(map[string]interface{})
+		g := vAppStartGroup{name: m["name"].(string)}
+		for _, e := range m["entities"].([]interface{}) {
+			g.entities = append(g.entities, e.(string))
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// validateStartGroups checks the start groups against the entities. The
+// entities of a group have to share their start_order and delays, and the
+// start orders of the groups have to increase in the order of the groups.
+// Entities outside of the groups cannot share a start order with a group, so
+// the boot sequence is the one the groups describe.
+func validateStartGroups(groups []vAppStartGroup, entities []interface{}) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	byName := make(map[string]map[string]interface{})
+	for _, v := range entities {
+		entity := v.(map[string]interface{})
+		byName[vAppEntityLabel(entity)] = entity
+	}
+
+	var errs []string
+	groupNames := make(map[string]bool)
+	grouped := make(map[string]string)
+	groupOrders := make(map[int]string)
+	lastOrder := -1
+	for _, g := range groups {
+		if groupNames[g.name] {
+			errs = append(errs, fmt.Sprintf("start_group %s is defined more than once", g.name))
+		}
+		groupNames[g.name] = true
+
+		var first map[string]interface{}
+		for _, name := range g.entities {
+			entity, ok := byName[name]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("start_group %s: %s is not an entity of the vApp", g.name, name))
+				continue
+			}
+			if other, ok := grouped[name]; ok {
+				errs = append(errs, fmt.Sprintf("start_group %s: entity %s is already in start_group %s", g.name, name, other))
+				continue
+			}
+			grouped[name] = g.name
+			if first == nil {
+				first = entity
+				continue
+			}
+			for _, k := range []string{"start_order", "start_delay", "stop_delay"} {
+				if entity[k].(int) != first[k].(int) {
+					errs = append(errs, fmt.Sprintf("start_group %s: entity %s has %s %d, entity %s has %d",
+						g.name, name, k, entity[k].(int), vAppEntityLabel(first), first[k].(int)))
+				}
+			}
+		}
+		if first == nil {
+			continue
+		}
+
+		order := first["start_order"].(int)
+		if order <= lastOrder {
+			errs = append(errs, fmt.Sprintf("start_group %s has start_order %d, it has to start after the groups before it (start_order %d)",
+				g.name, order, lastOrder))
+		}
+		lastOrder = order
+		groupOrders[order] = g.name
+	}
+
+	for name, entity := range byName {
+		if _, ok := grouped[name]; ok {
+			continue
+		}
+		if g, ok := groupOrders[entity["start_order"].(int)]; ok {
+			errs = append(errs, fmt.Sprintf("entity %s is not in start_group %s but shares its start_order %d",
+				name, g, entity["start_order"].(int)))
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("Invalid start_group:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// formatBootSequence describes the boot sequence of the entities, one line per
+// start order, e.g. "1: db1, db2 (start delay 30s)".
+func formatBootSequence(configs []types.VAppEntityConfigInfo, names map[string]string) []string {
+	byOrder := make(map[int32][]types.VAppEntityConfigInfo)
+	var orders []int
+	for _, c := range configs {
+		if _, ok := byOrder[c.StartOrder]; !ok {
+			orders = append(orders, int(c.StartOrder))
+		}
+		byOrder[c.StartOrder] = append(byOrder[c.StartOrder], c)
+	}
+	sort.Ints(orders)
+
+	var sequence []string
+	for _, order := range orders {
+		var entities []string
+		var delay int32
+		for _, c := range byOrder[int32(order)] {
+			name := c.Tag
+			if c.Key != nil && names[c.Key.Value] != "" {
+				name = names[c.Key.Value]
+			}
+			entities = append(entities, name)
+			if c.StartDelay > delay {
+				delay = c.StartDelay
+			}
+		}
+		sort.Strings(entities)
+		line := fmt.Sprintf("%d: %s", order, strings.Join(entities, ", "))
+		if delay > 0 {
+			line += fmt.Sprintf(" (start delay %ds)", delay)
+		}
+		sequence = append(sequence, line)
+	}
+	return sequence
+}
+
+// readBootSequence returns the boot sequence of the vApp.
+func (vapp *vApp) readBootSequence(mvapp *mo.VirtualApp) ([]string, error) {
+	if mvapp.VAppConfig == nil || len(mvapp.VAppConfig.EntityConfig) == 0 {
+		return nil, nil
+	}
+	var refs []types.ManagedObjectReference
+	for _, c := range mvapp.VAppConfig.EntityConfig {
+		if c.Key != nil {
+			refs = append(refs, *c.Key)
+		}
+	}
+	names := make(map[string]string)
+	if len(refs) > 0 {
+		var entities []mo.ManagedEntity
+		collector := property.DefaultCollector(vapp.c.Client)
+		if err := collector.Retrieve(context.TODO(), refs, []string{"name"}, &entities); err != nil {
+			return nil, err
+		}
+		for _, e := range entities {
+			names[e.Self.Value] = e.Name
+		}
+	}
+	return formatBootSequence(mvapp.VAppConfig.EntityConfig, names), nil
+}
@@ -0,0 +1,97 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// vCenter starts the next group of a vApp once the VMs with
+// waiting_for_guest report VMware Tools, but the power on task of the vApp
+// already completes before. After powering on, create and update wait until
+// the Tools of those VMs run, bounded by the timeout of the operation.
+
+const vAppGuestPollInterval = 5 * time.Second
+
+// guestWaitRefs returns the VM entities of the vApp with waiting_for_guest.
+func guestWaitRefs(configs []types.VAppEntityConfigInfo) []types.ManagedObjectReference {
+	var refs []types.ManagedObjectReference
+	for _, c := range configs {
+		if c.Key == nil || c.Key.Type != vAppEntityTypeVm {
+			continue
+		}
+		if c.WaitingForGuest != nil && *c.WaitingForGuest {
+			refs = append(refs, *c.Key)
+		}
+	}
+	return refs
+}
+
+// guestsNotReady returns the names of the powered on VMs whose VMware Tools
+// do not run yet. VMs which were not started, e.g. with start_action none,
+// are not waited for.
+func guestsNotReady(mvms []mo.VirtualMachine) []string {
+	var names []string
+	for _, mvm := range mvms {
+		if mvm.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+			continue
+		}
+		if mvm.Guest == nil || mvm.Guest.ToolsRunningStatus != string(types.VirtualMachineToolsRunningStatusGuestToolsRunning) {
+			names = append(names, mvm.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitForGuests waits for the VMware Tools of the entities with
+// waiting_for_guest, failing with the names of the VMs still waited for when
+// the operation times out.
+func (vapp *vApp) waitForGuests() error {
+	var mvapp mo.VirtualApp
+	collector := property.DefaultCollector(vapp.c.Client)
+	if err := collector.RetrieveOne(context.TODO(), vapp.createdVApp.Reference(), []string{"vAppConfig"}, &mvapp); err != nil {
+		return err
+	}
+	if mvapp.VAppConfig == nil {
+		return nil
+	}
+	return vapp.waitForGuestRefs(guestWaitRefs(mvapp.VAppConfig.EntityConfig))
+}
+
+// waitForGuestRefs waits for the VMware Tools of the given VMs of the vApp.
+func (vapp *vApp) waitForGuestRefs(refs []types.ManagedObjectReference) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	collector := property.DefaultCollector(vapp.c.Client)
+	ctx := vapp.taskCtx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	for {
+		var mvms []mo.VirtualMachine
+		if err := collector.Retrieve(context.TODO(), refs, []string{"name", "runtime.powerState", "guest.toolsRunningStatus"}, &mvms); err != nil {
+			return err
+		}
+		pending := guestsNotReady(mvms)
+		if len(pending) == 0 {
+			return nil
+		}
+		log.Printf("[DEBUG] Waiting for VMware Tools of %s of vApp %s", strings.Join(pending, ", "), vapp.name)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("VMware Tools of %s of vApp %s did not start within %s, check the guest or unset waiting_for_guest",
+				strings.Join(pending, ", "), vapp.name, vapp.taskTimeout)
+		case <-time.After(vAppGuestPollInterval):
+		}
+	}
+}
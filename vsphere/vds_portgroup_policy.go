@@ -0,0 +1,302 @@
+package vsphere
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// The teaming and security policies of a portgroup override the defaults of
+// its vDS. With inherit_from_switch a policy block clears the override, so
+// the portgroup follows the switch again. Removing a block does the same.
+
+const (
+	portgroupTeamingLoadbalanceIP       = "loadbalance_ip"
+	portgroupTeamingLoadbalanceSrcMac   = "loadbalance_srcmac"
+	portgroupTeamingLoadbalanceSrcID    = "loadbalance_srcid"
+	portgroupTeamingFailoverExplicit    = "failover_explicit"
+	portgroupTeamingLoadbalanceLoadBase = "loadbalance_loadbased"
+)
+
+var portgroupTeamingPolicyList = []string{
+	portgroupTeamingLoadbalanceIP,
+	portgroupTeamingLoadbalanceSrcMac,
+	portgroupTeamingLoadbalanceSrcID,
+	portgroupTeamingFailoverExplicit,
+	portgroupTeamingLoadbalanceLoadBase,
+}
+
+// pgTeaming is the teaming block of a portgroup.
+type pgTeaming struct {
+	inherit        bool
+	policy         string
+	activeUplinks  []string
+	standbyUplinks []string
+	notifySwitches bool
+	failback       bool
+}
+
+// pgSecurity is the security block of a portgroup.
+type pgSecurity struct {
+	inherit              bool
+	allowPromiscuous     bool
+	allowMacChanges      bool
+	allowForgedTransmits bool
+}
+
+func inheritFromSwitchSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Description: "Clears the override of the portgroup, so it inherits the policy of the vDS. The other attributes of the block are ignored.",
+	}
+}
+
+func portgroupTeamingSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"inherit_from_switch": inheritFromSwitchSchema(),
+				"policy": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      portgroupTeamingLoadbalanceSrcID,
+					ValidateFunc: validatePortgroupTeamingPolicy,
+				},
+				"active_uplinks": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+				},
+				"standby_uplinks": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+				},
+				"notify_switches": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+				},
+				"failback": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+				},
+			},
+		},
+	}
+}
+
+func portgroupSecuritySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"inherit_from_switch": inheritFromSwitchSchema(),
+				"allow_promiscuous": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				"allow_mac_changes": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				"allow_forged_transmits": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+func validatePortgroupTeamingPolicy(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, portgroupTeamingPolicyList)
+}
+
+// parsePortgroupTeaming returns nil when no teaming block is configured.
+func parsePortgroupTeaming(d *schema.ResourceData) *pgTeaming {
+	vL := d.Get("teaming").([]interface{})
+	if len(vL) == 0 || vL[0] == nil {
+		return nil
+	}
+	m := vL[0].(map[string]interface{})
+	t := &pgTeaming{
+		inherit:        m["inherit_from_switch"].(bool),
+		policy:         m["policy"].(string),
+		notifySwitches: m["notify_switches"].(bool),
+		failback:       m["failback"].(bool),
+	}
+	for _, v := range m["active_uplinks"].([]interface{}) {
+		t.activeUplinks = append(t.activeUplinks, v.(string))
+	}
+	for _, v := range m["standby_uplinks"].([]interface{}) {
+		t.standbyUplinks = append(t.standbyUplinks, v.(string))
+	}
+	return t
+}
+
+// parsePortgroupSecurity returns nil when no security block is configured.
+func parsePortgroupSecurity(d *schema.ResourceData) *pgSecurity {
+	vL := d.Get("security").([]interface{})
+	if len(vL) == 0 || vL[0] == nil {
+		return nil
+	}
+	m := vL[0].(map[string]interface{})
+	return &pgSecurity{
+		inherit:              m["inherit_from_switch"].(bool),
+		allowPromiscuous:     m["allow_promiscuous"].(bool),
+		allowMacChanges:      m["allow_mac_changes"].(bool),
+		allowForgedTransmits: m["allow_forged_transmits"].(bool),
+	}
+}
+
+// teamingPolicy returns the teaming policy of the block. A nil block
+// inherits the policy of the vDS.
+func (t *pgTeaming) teamingPolicy() *types.VmwareUplinkPortTeamingPolicy {
+	if t == nil || t.inherit {
+		return &types.VmwareUplinkPortTeamingPolicy{
+			InheritablePolicy: types.InheritablePolicy{Inherited: true},
+		}
+	}
+	return &types.VmwareUplinkPortTeamingPolicy{
+		Policy:         &types.StringPolicy{Value: t.policy},
+		NotifySwitches: &types.BoolPolicy{Value: types.NewBool(t.notifySwitches)},
+		// Rolling order keeps the standby uplink active after the failed
+		// one recovered, i.e. no failback.
+		RollingOrder: &types.BoolPolicy{Value: types.NewBool(!t.failback)},
+		UplinkPortOrder: &types.VMwareUplinkPortOrderPolicy{
+			ActiveUplinkPort:  t.activeUplinks,
+			StandbyUplinkPort: t.standbyUplinks,
+		},
+	}
+}
+
+// securityPolicy returns the security policy of the block. A nil block
+// inherits the policy of the vDS.
+func (s *pgSecurity) securityPolicy() *types.DVSSecurityPolicy {
+	if s == nil || s.inherit {
+		return &types.DVSSecurityPolicy{
+			InheritablePolicy: types.InheritablePolicy{Inherited: true},
+		}
+	}
+	return &types.DVSSecurityPolicy{
+		AllowPromiscuous: &types.BoolPolicy{Value: types.NewBool(s.allowPromiscuous)},
+		MacChanges:       &types.BoolPolicy{Value: types.NewBool(s.allowMacChanges)},
+		ForgedTransmits:  &types.BoolPolicy{Value: types.NewBool(s.allowForgedTransmits)},
+	}
+}
+
+// policyInherited reports whether a policy is unset or inherited.
+func policyInherited(p types.BaseInheritablePolicy) bool {
+	return p == nil || p.GetInheritablePolicy().Inherited
+}
+
+// flattenPortgroupTeaming returns the teaming block of the teaming policy of
+// a portgroup. An inherited policy is only reported as inherited, with the
+// defaults of the block.
+func flattenPortgroupTeaming(policy *types.VmwareUplinkPortTeamingPolicy) map[string]interface{} {
+	teaming := map[string]interface{}{
+		"inherit_from_switch": true,
+		"policy":              portgroupTeamingLoadbalanceSrcID,
+		"active_uplinks":      []string{},
+		"standby_uplinks":     []string{},
+		"notify_switches":     true,
+		"failback":            true,
+	}
+	if policy == nil || policy.Inherited {
+		return teaming
+	}
+	var policyValue, notifySwitches, rollingOrder, uplinkOrder types.BaseInheritablePolicy
+	if policy.Policy != nil {
+		policyValue = policy.Policy
+	}
+	if policy.NotifySwitches != nil {
+		notifySwitches = policy.NotifySwitches
+	}
+	if policy.RollingOrder != nil {
+		rollingOrder = policy.RollingOrder
+	}
+	if policy.UplinkPortOrder != nil {
+		uplinkOrder = policy.UplinkPortOrder
+	}
+	if policyInherited(policyValue) && policyInherited(notifySwitches) &&
+		policyInherited(rollingOrder) && policyInherited(uplinkOrder) {
+		return teaming
+	}
+
+	teaming["inherit_from_switch"] = false
+	if policy.Policy != nil {
+		teaming["policy"] = policy.Policy.Value
+	}
+	if policy.NotifySwitches != nil && policy.NotifySwitches.Value != nil {
+		teaming["notify_switches"] = *policy.NotifySwitches.Value
+	}
+	if policy.RollingOrder != nil && policy.RollingOrder.Value != nil {
+		teaming["failback"] = !*policy.RollingOrder.Value
+	}
+	if policy.UplinkPortOrder != nil {
+		teaming["active_uplinks"] = policy.UplinkPortOrder.ActiveUplinkPort
+		teaming["standby_uplinks"] = policy.UplinkPortOrder.StandbyUplinkPort
+	}
+	return teaming
+}
+
+// flattenPortgroupSecurity returns the security block of the security policy
+// of a portgroup. An inherited policy is only reported as inherited.
+func flattenPortgroupSecurity(policy *types.DVSSecurityPolicy) map[string]interface{} {
+	security := map[string]interface{}{
+		"inherit_from_switch":    true,
+		"allow_promiscuous":      false,
+		"allow_mac_changes":      false,
+		"allow_forged_transmits": false,
+	}
+	if policy == nil || policy.Inherited {
+		return security
+	}
+	values := map[string]*types.BoolPolicy{
+		"allow_promiscuous":      policy.AllowPromiscuous,
+		"allow_mac_changes":      policy.MacChanges,
+		"allow_forged_transmits": policy.ForgedTransmits,
+	}
+	for k, v := range values {
+		if v != nil && !v.Inherited {
+			security["inherit_from_switch"] = false
+		}
+		if v != nil && v.Value != nil {
+			security[k] = *v.Value
+		}
+	}
+	return security
+}
+
+// readPortgroupPolicies sets the teaming and security blocks. Without a
+// block only a policy set on the portgroup itself is drift, an inherited one
+// is not. A configured block which inherits keeps its other attributes, as
+// they are ignored then.
+func readPortgroupPolicies(d *schema.ResourceData, setting *types.VMwareDVSPortSetting) error {
+	blocks := map[string]map[string]interface{}{
+		"teaming":  flattenPortgroupTeaming(setting.UplinkTeamingPolicy),
+		"security": flattenPortgroupSecurity(setting.SecurityPolicy),
+	}
+	for name, block := range blocks {
+		vL := d.Get(name).([]interface{})
+		configured := len(vL) > 0 && vL[0] != nil
+		if !configured && block["inherit_from_switch"].(bool) {
+			continue
+		}
+		if configured && block["inherit_from_switch"].(bool) {
+			block = vL[0].(map[string]interface{})
+			block["inherit_from_switch"] = true
+		}
+		if err := d.Set(name, []interface{}{block}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
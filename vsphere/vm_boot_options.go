@@ -0,0 +1,275 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	bootDeviceDisk    = "disk"
+	bootDeviceCdrom   = "cdrom"
+	bootDeviceNetwork = "network"
+	bootDeviceFloppy  = "floppy"
+
+	bootDelayMin = 0
+	bootDelayMax = 10000
+
+	bootDelayExtraConfigKey = "bios.bootDelay"
+	bootOrderExtraConfigKey = "bios.bootOrder"
+)
+
+var firmwareTypeList = []string{
+	string(types.GuestOsDescriptorFirmwareTypeBios),
+	string(types.GuestOsDescriptorFirmwareTypeEfi),
+}
+
+var bootDeviceList = []string{
+	bootDeviceDisk,
+	bootDeviceCdrom,
+	bootDeviceNetwork,
+	bootDeviceFloppy,
+}
+
+type bootOptions struct {
+	firmware             string
+	bootDelay            int64
+	efiSecureBootEnabled bool
+	bootOrder            []string
+}
+
+func bootOptionsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"firmware": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      string(types.GuestOsDescriptorFirmwareTypeBios),
+					ValidateFunc: validateFirmware,
+				},
+
+				"efi_secure_boot_enabled": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+				},
+
+				"boot_delay": &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      0,
+					ValidateFunc: validateBootDelay,
+				},
+
+				"boot_order": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type:         schema.TypeString,
+						ValidateFunc: validateBootDevice,
+					},
+				},
+			},
+		},
+	}
+}
+
+// defaultBootOptions are the boot options of a VM without a boot_options
+// block, which are applied when the block is removed.
+func defaultBootOptions() *bootOptions {
+	return &bootOptions{
+		firmware: string(types.GuestOsDescriptorFirmwareTypeBios),
+	}
+}
+
+// parseBootOptionsData returns nil when no boot_options block is configured.
+func parseBootOptionsData(d *schema.ResourceData) (*bootOptions, error) {
+
+	vL, ok := d.GetOk("boot_options")
+	if !ok {
+		return nil, nil
+	}
+
+	opts := defaultBootOptions()
+
+	bootObj := (vL.([]interface{}))[0].(map[string]interface{})
+
+	if v, ok := bootObj["firmware"].(string); ok && v != "" {
+		opts.firmware = v
+	}
+
+	if v, ok := bootObj["efi_secure_boot_enabled"].(bool); ok {
+		opts.efiSecureBootEnabled = v
+	}
+
+	if v, ok := bootObj["boot_delay"].(int); ok {
+		opts.bootDelay = int64(v)
+	}
+
+	if v, ok := bootObj["boot_order"].([]interface{}); ok {
+		for _, dev := range v {
+			opts.bootOrder = append(opts.bootOrder, dev.(string))
+		}
+	}
+
+	if opts.efiSecureBootEnabled &&
+		opts.firmware != string(types.GuestOsDescriptorFirmwareTypeEfi) {
+		return nil, fmt.Errorf("efi_secure_boot_enabled requires firmware to be '%s'",
+			types.GuestOsDescriptorFirmwareTypeEfi)
+	}
+
+	log.Printf("[DEBUG] Boot options data %#v", opts)
+	return opts, nil
+}
+
+// buildBootOptions maps the configured boot order onto the devices of the VM.
+// Disk and network entries select the first device of that kind, so it has to
+// be called once all devices have been attached.
+func (b *bootOptions) buildBootOptions(devices object.VirtualDeviceList) (*types.VirtualMachineBootOptions, error) {
+
+	bootOpts := &types.VirtualMachineBootOptions{
+		BootDelay:            b.bootDelay,
+		EfiSecureBootEnabled: types.NewBool(b.efiSecureBootEnabled),
+	}
+
+	for _, dev := range b.bootOrder {
+		switch dev {
+		case bootDeviceDisk:
+			disks := devices.SelectByType((*types.VirtualDisk)(nil))
+			if len(disks) == 0 {
+				return nil, fmt.Errorf("boot_order contains '%s' but the VM has no disk", dev)
+			}
+			bootOpts.BootOrder = append(bootOpts.BootOrder,
+				&types.VirtualMachineBootOptionsBootableDiskDevice{
+					DeviceKey: disks[0].GetVirtualDevice().Key,
+				})
+
+		case bootDeviceNetwork:
+			nics := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+			if len(nics) == 0 {
+				return nil, fmt.Errorf("boot_order contains '%s' but the VM has no network interface", dev)
+			}
+			bootOpts.BootOrder = append(bootOpts.BootOrder,
+				&types.VirtualMachineBootOptionsBootableEthernetDevice{
+					DeviceKey: nics[0].GetVirtualDevice().Key,
+				})
+
+		case bootDeviceCdrom:
+			bootOpts.BootOrder = append(bootOpts.BootOrder,
+				&types.VirtualMachineBootOptionsBootableCdromDevice{})
+
+		case bootDeviceFloppy:
+			bootOpts.BootOrder = append(bootOpts.BootOrder,
+				&types.VirtualMachineBootOptionsBootableFloppyDevice{})
+
+		default:
+			return nil, fmt.Errorf("Unsupported boot device '%s'", dev)
+		}
+	}
+
+	return bootOpts, nil
+}
+
+// resetOptions returns the extra config which resets a zero boot delay and an
+// empty boot order. Both are left out of the boot options of a config spec
+// when unset, which keeps the current values of the VM, while clearing their
+// VMX options restores the defaults.
+func (b *bootOptions) resetOptions() []types.BaseOptionValue {
+	var ov []types.BaseOptionValue
+	if b.bootDelay == 0 {
+		ov = append(ov, &types.OptionValue{Key: bootDelayExtraConfigKey, Value: ""})
+	}
+	if len(b.bootOrder) == 0 {
+		ov = append(ov, &types.OptionValue{Key: bootOrderExtraConfigKey, Value: ""})
+	}
+	return ov
+}
+
+func readBootOptions(config *types.VirtualMachineConfigInfo, d *schema.ResourceData) error {
+
+	if _, ok := d.GetOk("boot_options"); !ok || config == nil {
+		return nil
+	}
+
+	bootOpts := map[string]interface{}{
+		"firmware": config.Firmware,
+	}
+
+	var bootOrder []interface{}
+	if config.BootOptions != nil {
+		bootOpts["boot_delay"] = int(config.BootOptions.BootDelay)
+		if config.BootOptions.EfiSecureBootEnabled != nil {
+			bootOpts["efi_secure_boot_enabled"] = *config.BootOptions.EfiSecureBootEnabled
+		}
+
+		for _, dev := range config.BootOptions.BootOrder {
+			switch dev.(type) {
+			case *types.VirtualMachineBootOptionsBootableDiskDevice:
+				bootOrder = append(bootOrder, bootDeviceDisk)
+			case *types.VirtualMachineBootOptionsBootableEthernetDevice:
+				bootOrder = append(bootOrder, bootDeviceNetwork)
+			case *types.VirtualMachineBootOptionsBootableCdromDevice:
+				bootOrder = append(bootOrder, bootDeviceCdrom)
+			case *types.VirtualMachineBootOptionsBootableFloppyDevice:
+				bootOrder = append(bootOrder, bootDeviceFloppy)
+			}
+		}
+	}
+	bootOpts["boot_order"] = bootOrder
+
+	log.Printf("[DEBUG] Boot options read %#v", bootOpts)
+	return d.Set("boot_options", []interface{}{bootOpts})
+}
+
+func validateFirmware(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	found := false
+
+	for _, t := range firmwareTypeList {
+		if t == value {
+			found = true
+		}
+	}
+	if !found {
+		errors = append(errors, fmt.Errorf(
+			"%s: Supported values are %s", k, strings.Join(firmwareTypeList, ", ")))
+	}
+
+	return
+}
+
+func validateBootDevice(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	found := false
+
+	for _, t := range bootDeviceList {
+		if t == value {
+			found = true
+		}
+	}
+	if !found {
+		errors = append(errors, fmt.Errorf(
+			"%s: Supported values are %s", k, strings.Join(bootDeviceList, ", ")))
+	}
+
+	return
+}
+
+func validateBootDelay(v interface{}, k string) (ws []string, errors []error) {
+	delay := v.(int)
+
+	if delay < bootDelayMin || delay > bootDelayMax {
+		errors = append(errors, fmt.Errorf(
+			"%s: Boot delay '%d' is out of allowed range (%d - %d).",
+			k, delay, bootDelayMin, bootDelayMax))
+	}
+	return
+}
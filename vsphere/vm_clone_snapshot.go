@@ -0,0 +1,72 @@
+package vsphere
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// findTemplateSnapshot returns the snapshot of the template a virtual machine
+// is cloned from, given by its managed object ID, like snapshot-42, or by its
+// name. Names are not unique within the snapshot tree, so an ambiguous name
+// is an error asking for the ID.
+func findTemplateSnapshot(info *types.VirtualMachineSnapshotInfo, snapshot string) (*types.ManagedObjectReference, error) {
+	if info == nil {
+		return nil, fmt.Errorf("template has no snapshots, snapshot %s not found", snapshot)
+	}
+
+	var byName []types.ManagedObjectReference
+	var names []string
+	var walk func(tree []types.VirtualMachineSnapshotTree) *types.ManagedObjectReference
+	walk = func(tree []types.VirtualMachineSnapshotTree) *types.ManagedObjectReference {
+		for _, node := range tree {
+			if node.Snapshot.Value == snapshot {
+				ref := node.Snapshot
+				return &ref
+			}
+			if node.Name == snapshot {
+				byName = append(byName, node.Snapshot)
+			}
+			names = append(names, node.Name)
+			if ref := walk(node.ChildSnapshotList); ref != nil {
+				return ref
+			}
+		}
+		return nil
+	}
+	if ref := walk(info.RootSnapshotList); ref != nil {
+		return ref, nil
+	}
+
+	switch len(byName) {
+	case 0:
+		sort.Strings(names)
+		return nil, fmt.Errorf("snapshot %s of the template not found, the snapshots are %s",
+			snapshot, strings.Join(names, ", "))
+	case 1:
+		return &byName[0], nil
+	}
+	var ids []string
+	for _, ref := range byName {
+		ids = append(ids, ref.Value)
+	}
+	return nil, fmt.Errorf("template has %d snapshots named %s, set template_snapshot to one of their IDs: %s",
+		len(byName), snapshot, strings.Join(ids, ", "))
+}
+
+// cloneSnapshot returns the snapshot of the template the clone is taken
+// from. Linked clones need one and default to the current snapshot.
+func (vm *virtualMachine) cloneSnapshot(info *types.VirtualMachineSnapshotInfo) (*types.ManagedObjectReference, error) {
+	if vm.templateSnapshot != "" {
+		return findTemplateSnapshot(info, vm.templateSnapshot)
+	}
+	if !vm.linkedClone {
+		return nil, nil
+	}
+	if info == nil || info.CurrentSnapshot == nil {
+		return nil, fmt.Errorf("`linkedClone=true`, but image VM has no snapshots")
+	}
+	return info.CurrentSnapshot, nil
+}
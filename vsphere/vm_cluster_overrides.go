@@ -0,0 +1,265 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+var drsAutomationLevelList = []string{
+	string(types.DrsBehaviorManual),
+	string(types.DrsBehaviorPartiallyAutomated),
+	string(types.DrsBehaviorFullyAutomated),
+}
+
+var haRestartPriorityList = []string{
+	string(types.ClusterDasVmSettingsRestartPriorityDisabled),
+	string(types.ClusterDasVmSettingsRestartPriorityLow),
+	string(types.ClusterDasVmSettingsRestartPriorityMedium),
+	string(types.ClusterDasVmSettingsRestartPriorityHigh),
+	string(types.ClusterDasVmSettingsRestartPriorityClusterRestartPriority),
+}
+
+var haIsolationResponseList = []string{
+	string(types.ClusterDasVmSettingsIsolationResponseNone),
+	string(types.ClusterDasVmSettingsIsolationResponsePowerOff),
+	string(types.ClusterDasVmSettingsIsolationResponseShutdown),
+	string(types.ClusterDasVmSettingsIsolationResponseClusterIsolationResponse),
+}
+
+// clusterVmOverrides holds the per-VM DRS and HA settings which are stored
+// in the configuration of the cluster owning the VM.
+type clusterVmOverrides struct {
+	drsAutomationLevel  string
+	haRestartPriority   string
+	haIsolationResponse string
+}
+
+func parseClusterVmOverrides(d *schema.ResourceData) *clusterVmOverrides {
+	o := &clusterVmOverrides{}
+
+	if v, ok := d.GetOk("drs_automation_level"); ok {
+		o.drsAutomationLevel = v.(string)
+	}
+
+	if v, ok := d.GetOk("ha_restart_priority"); ok {
+		o.haRestartPriority = v.(string)
+	}
+
+	if v, ok := d.GetOk("ha_isolation_response"); ok {
+		o.haIsolationResponse = v.(string)
+	}
+
+	log.Printf("[DEBUG] Cluster VM overrides %#v", o)
+	return o
+}
+
+func (o *clusterVmOverrides) isEmpty() bool {
+	return o.drsAutomationLevel == "" && o.haRestartPriority == "" &&
+		o.haIsolationResponse == ""
+}
+
+// getVMCluster returns the cluster owning the resource pool of the VM.
+func getVMCluster(c *govmomi.Client, vm types.ManagedObjectReference) (*object.ClusterComputeResource, error) {
+	collector := property.DefaultCollector(c.Client)
+
+	var mvm mo.VirtualMachine
+	if err := collector.RetrieveOne(context.TODO(), vm, []string{"resourcePool"}, &mvm); err != nil {
+		return nil, err
+	}
+	if mvm.ResourcePool == nil {
+		return nil, fmt.Errorf("VM %s has no resource pool", vm.Value)
+	}
+
+	var mrp mo.ResourcePool
+	if err := collector.RetrieveOne(context.TODO(), *mvm.ResourcePool, []string{"owner"}, &mrp); err != nil {
+		return nil, err
+	}
+	if mrp.Owner.Type != "ClusterComputeResource" {
+		return nil, fmt.Errorf("VM %s is not placed in a cluster; DRS and HA overrides "+
+			"are only supported for clustered VMs", vm.Value)
+	}
+
+	return object.NewClusterComputeResource(c.Client, mrp.Owner), nil
+}
+
+func getClusterConfigInfoEx(cluster *object.ClusterComputeResource) (*types.ClusterConfigInfoEx, error) {
+	var mcl mo.ClusterComputeResource
+	err := cluster.Properties(context.TODO(), cluster.Reference(), []string{"configurationEx"}, &mcl)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := mcl.ConfigurationEx.(*types.ClusterConfigInfoEx)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected configuration type for cluster %s", cluster.Reference().Value)
+	}
+	return info, nil
+}
+
+// applyClusterVmOverrides adds, edits or removes the DRS and HA entries of
+// the VM so the cluster matches the configured overrides.
+func (o *clusterVmOverrides) applyClusterVmOverrides(c *govmomi.Client, vm types.ManagedObjectReference) error {
+
+	cluster, err := getVMCluster(c, vm)
+	if err != nil {
+		return err
+	}
+
+	info, err := getClusterConfigInfoEx(cluster)
+	if err != nil {
+		return err
+	}
+
+	var drsExists, dasExists bool
+	for _, cfg := range info.DrsVmConfig {
+		if cfg.Key == vm {
+			drsExists = true
+		}
+	}
+	for _, cfg := range info.DasVmConfig {
+		if cfg.Key == vm {
+			dasExists = true
+		}
+	}
+
+	spec := &types.ClusterConfigSpecEx{}
+
+	if o.drsAutomationLevel != "" {
+		op := types.ArrayUpdateOperationAdd
+		if drsExists {
+			op = types.ArrayUpdateOperationEdit
+		}
+		spec.DrsVmConfigSpec = append(spec.DrsVmConfigSpec, types.ClusterDrsVmConfigSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: op},
+			Info: &types.ClusterDrsVmConfigInfo{
+				Key:      vm,
+				Enabled:  types.NewBool(true),
+				Behavior: types.DrsBehavior(o.drsAutomationLevel),
+			},
+		})
+	} else if drsExists {
+		spec.DrsVmConfigSpec = append(spec.DrsVmConfigSpec, types.ClusterDrsVmConfigSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationRemove,
+				RemoveKey: vm,
+			},
+		})
+	}
+
+	if o.haRestartPriority != "" || o.haIsolationResponse != "" {
+		op := types.ArrayUpdateOperationAdd
+		if dasExists {
+			op = types.ArrayUpdateOperationEdit
+		}
+		spec.DasVmConfigSpec = append(spec.DasVmConfigSpec, types.ClusterDasVmConfigSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: op},
+			Info: &types.ClusterDasVmConfigInfo{
+				Key: vm,
+				DasSettings: &types.ClusterDasVmSettings{
+					RestartPriority:   o.haRestartPriority,
+					IsolationResponse: o.haIsolationResponse,
+				},
+			},
+		})
+	} else if dasExists {
+		spec.DasVmConfigSpec = append(spec.DasVmConfigSpec, types.ClusterDasVmConfigSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationRemove,
+				RemoveKey: vm,
+			},
+		})
+	}
+
+	if len(spec.DrsVmConfigSpec) == 0 && len(spec.DasVmConfigSpec) == 0 {
+		return nil
+	}
+
+	log.Printf("[DEBUG] Cluster VM override spec %#v", spec)
+	task, err := cluster.Reconfigure(context.TODO(), spec, true)
+	if err != nil {
+		return err
+	}
+	_, err = task.WaitForResult(context.TODO(), nil)
+	if err != nil {
+		log.Printf("[ERROR] Applying cluster overrides for VM %s failed.", vm.Value)
+		return err
+	}
+
+	return nil
+}
+
+// readClusterVmOverrides only queries the cluster when overrides are managed
+// by the resource, as VMs outside of clusters cannot have them.
+func readClusterVmOverrides(c *govmomi.Client, vm types.ManagedObjectReference, d *schema.ResourceData) error {
+
+	if parseClusterVmOverrides(d).isEmpty() {
+		return nil
+	}
+
+	cluster, err := getVMCluster(c, vm)
+	if err != nil {
+		return err
+	}
+
+	info, err := getClusterConfigInfoEx(cluster)
+	if err != nil {
+		return err
+	}
+
+	var drsLevel, restartPriority, isolationResponse string
+	for _, cfg := range info.DrsVmConfig {
+		if cfg.Key == vm {
+			drsLevel = string(cfg.Behavior)
+		}
+	}
+	for _, cfg := range info.DasVmConfig {
+		if cfg.Key == vm && cfg.DasSettings != nil {
+			restartPriority = cfg.DasSettings.RestartPriority
+			isolationResponse = cfg.DasSettings.IsolationResponse
+		}
+	}
+
+	d.Set("drs_automation_level", drsLevel)
+	d.Set("ha_restart_priority", restartPriority)
+	d.Set("ha_isolation_response", isolationResponse)
+
+	return nil
+}
+
+func validateDrsAutomationLevel(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, drsAutomationLevelList)
+}
+
+func validateHaRestartPriority(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, haRestartPriorityList)
+}
+
+func validateHaIsolationResponse(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, haIsolationResponseList)
+}
+
+func validateStringInList(v interface{}, k string, list []string) (ws []string, errors []error) {
+	value := v.(string)
+	found := false
+
+	for _, t := range list {
+		if t == value {
+			found = true
+		}
+	}
+	if !found {
+		errors = append(errors, fmt.Errorf(
+			"%s: Supported values are %s", k, strings.Join(list, ", ")))
+	}
+
+	return
+}
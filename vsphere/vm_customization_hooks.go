@@ -0,0 +1,145 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/event"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// Hooks into the first boot of a customized clone. Windows guests run the
+// run_once_commands of windows_opt_config at the first logon, which sysprep
+// does automatically when admin_password is set. post_customization_commands
+// run in any guest through VMware Tools once the customized VM is powered
+// on and the guest reported the outcome of the customization, e.g. to
+// register an agent.
+
+// customizationEventTypes are the events closing the customization of a
+// guest, which runs after the first power on.
+var customizationEventTypes = []string{
+	"CustomizationSucceeded",
+	"CustomizationSysprepFailed",
+	"CustomizationLinuxIdentityFailed",
+	"CustomizationNetworkSetupFailed",
+	"CustomizationUnknownFailure",
+}
+
+func postCustomizationCommandsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		ForceNew:    true,
+		Description: "Commands run in the guest with guest_credentials after the customization of a clone, in order.",
+		Elem:        &schema.Schema{Type: schema.TypeString},
+	}
+}
+
+func parsePostCustomizationCommands(d *schema.ResourceData) []string {
+	var commands []string
+	for _, v := range d.Get("post_customization_commands").([]interface{}) {
+		commands = append(commands, v.(string))
+	}
+	return commands
+}
+
+// validatePostCustomizationCommands checks that the commands can run, which
+// needs a customized clone and credentials of the guest.
+func (vm *virtualMachine) validatePostCustomizationCommands() error {
+	if len(vm.postCustomizationCommands) == 0 {
+		return nil
+	}
+	if vm.template == "" || vm.skipCustomization {
+		return fmt.Errorf("post_customization_commands need a template and customization")
+	}
+	if vm.guestAuth == nil {
+		return fmt.Errorf("guest_credentials are required to run post_customization_commands")
+	}
+	return nil
+}
+
+// customizationResult returns whether the events include the end of the
+// customization, and the error of a failed one.
+func customizationResult(events []types.BaseEvent) (bool, error) {
+	for _, e := range events {
+		switch e.(type) {
+		case *types.CustomizationSucceeded:
+			return true, nil
+		case types.BaseCustomizationFailed:
+			return true, fmt.Errorf("guest customization failed: %s", e.GetEvent().FullFormattedMessage)
+		}
+	}
+	return false, nil
+}
+
+// waitForCustomization waits for the guest to report the end of its
+// customization. The customization reboots the guest, so commands run
+// before it ends could be cut off or undone.
+func (vm *virtualMachine) waitForCustomization(vmObj *object.VirtualMachine) error {
+	ctx := vm.taskCtx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	filter := types.EventFilterSpec{
+		Entity: &types.EventFilterSpecByEntity{
+			Entity:    vmObj.Reference(),
+			Recursion: types.EventFilterSpecRecursionOptionSelf,
+		},
+		EventTypeId: customizationEventTypes,
+	}
+	manager := event.NewManager(vmObj.Client())
+
+	log.Printf("[DEBUG] Waiting for the customization of virtual machine %s", vm.name)
+	for {
+		events, err := manager.QueryEvents(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if done, err := customizationResult(events); done {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return taskTimeoutError(ctx, ctx.Err(), "wait for the customization of virtual machine "+vm.name, vm.taskTimeout)
+		case <-time.After(guestCommandPollInterval):
+		}
+	}
+}
+
+// runPostCustomizationCommands waits for the customization to end, then runs
+// the commands in order and stops at the first one which fails.
+func (vm *virtualMachine) runPostCustomizationCommands(vmObj *object.VirtualMachine) error {
+	if len(vm.postCustomizationCommands) == 0 {
+		return nil
+	}
+	if err := vm.waitForCustomization(vmObj); err != nil {
+		return err
+	}
+	for _, command := range vm.postCustomizationCommands {
+		if err := vm.runGuestCommand(vmObj, vm.guestAuth, command); err != nil {
+			return fmt.Errorf("post customization command failed: %s", err)
+		}
+	}
+	return nil
+}
+
+// setGuiRunOnce adds the run once commands to the sysprep settings. They
+// run at the first logon, so the administrator logs on automatically once
+// if its password is set.
+func (w windowsOptConfig) setGuiRunOnce(sysprep *types.CustomizationSysprep) {
+	if len(w.runOnceCommands) == 0 {
+		return
+	}
+	sysprep.GuiRunOnce = &types.CustomizationGuiRunOnce{
+		CommandList: w.runOnceCommands,
+	}
+	if w.adminPassword != "" {
+		sysprep.GuiUnattended.AutoLogon = true
+		sysprep.GuiUnattended.AutoLogonCount = 1
+	}
+}
@@ -0,0 +1,64 @@
+package vsphere
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// A change of customization_trigger applies the customization of the
+// network interfaces again to the existing VM, e.g. after a new IP plan,
+// without tainting it. The VM is powered off for the customization and
+// powered on again. A change of the domain, time zone, DNS or
+// skip_customization settings recreates the VM.
+
+func customizationTriggerSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "Any value, a change customizes the VM again with its current network_interface settings.",
+	}
+}
+
+// linuxPrepIdentity returns the identity settings used when the VM is
+// customized again on update.
+func (vm *virtualMachine) linuxPrepIdentity() types.BaseCustomizationIdentitySettings {
+	return &types.CustomizationLinuxPrep{
+		HostName: &types.CustomizationFixedName{
+			Name: strings.Split(vm.name, ".")[0],
+		},
+		Domain:     vm.domain,
+		TimeZone:   vm.timeZone,
+		HwClockUTC: types.NewBool(true),
+	}
+}
+
+// recustomization returns the identity and network settings to customize
+// the VM with again. Only Linux guests cloned from a template with
+// customization can be customized again.
+func (vm *virtualMachine) recustomization(d *schema.ResourceData, guestID string) (types.BaseCustomizationIdentitySettings, []types.CustomizationAdapterMapping, error) {
+	if vm.template == "" || vm.skipCustomization {
+		return nil, nil, fmt.Errorf("customization_trigger needs a template and customization")
+	}
+	if strings.HasPrefix(guestID, "win") {
+		return nil, nil, fmt.Errorf("customization_trigger only supports Linux guests, %s is a Windows guest", vm.name)
+	}
+
+	err, networkInterfaces := parseNetworkInterfaceData(d.Get("network_interface").([]interface{}))
+	if err != nil {
+		return nil, nil, err
+	}
+	vm.networkInterfaces = networkInterfaces
+
+	var netConf []types.CustomizationAdapterMapping
+	for _, n := range networkInterfaces {
+		config, err := buildNetworkConfig(n)
+		if err != nil {
+			return nil, nil, err
+		}
+		netConf = append(netConf, config)
+	}
+	return vm.linuxPrepIdentity(), netConf, nil
+}
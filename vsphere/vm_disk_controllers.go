@@ -0,0 +1,220 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+const (
+	scsiTypeLsiLogic = "lsilogic"
+	scsiTypePvscsi   = "pvscsi"
+	scsiTypeNvme     = "nvme"
+
+	// vSphere supports up to four controllers of each kind per VM.
+	scsiControllerCountMin = 1
+	scsiControllerCountMax = 4
+
+	// SCSI controllers reserve unit 7 for themselves, NVMe controllers
+	// have 15 units.
+	scsiReservedUnitNumber = 7
+	scsiUnitNumberCount    = 16
+	nvmeUnitNumberCount    = 15
+)
+
+var scsiTypeList = []string{
+	scsiTypeLsiLogic,
+	scsiTypePvscsi,
+	scsiTypeNvme,
+}
+
+func validateScsiType(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, scsiTypeList)
+}
+
+func validateScsiControllerCount(v interface{}, k string) (ws []string, errors []error) {
+	count := v.(int)
+
+	if count < scsiControllerCountMin || count > scsiControllerCountMax {
+		errors = append(errors, fmt.Errorf(
+			"%s: Controller count '%d' is out of allowed range (%d - %d).",
+			k, count, scsiControllerCountMin, scsiControllerCountMax))
+	}
+	return
+}
+
+func validateDiskUnitNumber(v interface{}, k string) (ws []string, errors []error) {
+	unit := v.(int)
+
+	if unit < 0 || unit >= scsiUnitNumberCount {
+		errors = append(errors, fmt.Errorf(
+			"%s: Unit number '%d' is out of allowed range (0 - %d).",
+			k, unit, scsiUnitNumberCount-1))
+	}
+	return
+}
+
+func validateDiskControllerNumber(v interface{}, k string) (ws []string, errors []error) {
+	bus := v.(int)
+
+	if bus < 0 || bus >= scsiControllerCountMax {
+		errors = append(errors, fmt.Errorf(
+			"%s: Controller number '%d' is out of allowed range (0 - %d).",
+			k, bus, scsiControllerCountMax-1))
+	}
+	return
+}
+
+// getDiskControllers returns the SCSI and NVMe controllers of the VM, the
+// controllers disks with controller_type "scsi" are attached to.
+func getDiskControllers(devices object.VirtualDeviceList) []types.BaseVirtualController {
+	var controllers []types.BaseVirtualController
+	for _, device := range devices {
+		switch c := device.(type) {
+		case types.BaseVirtualSCSIController:
+			controllers = append(controllers, c.(types.BaseVirtualController))
+		case *types.VirtualNVMEController:
+			controllers = append(controllers, c)
+		}
+	}
+	return controllers
+}
+
+// findDiskControllerByBus returns the SCSI or NVMe controller with the bus
+// number. SCSI controllers are preferred, VMs using NVMe usually have no SCSI
+// controller at all.
+func findDiskControllerByBus(devices object.VirtualDeviceList, bus int32) (types.BaseVirtualController, error) {
+	var nvme types.BaseVirtualController
+	for _, c := range getDiskControllers(devices) {
+		if c.GetVirtualController().BusNumber != bus {
+			continue
+		}
+		if _, ok := c.(*types.VirtualNVMEController); ok {
+			nvme = c
+			continue
+		}
+		return c, nil
+	}
+	if nvme != nil {
+		return nvme, nil
+	}
+	return nil, fmt.Errorf("no disk controller with number %d found, raise scsi_controller_count to add it", bus)
+}
+
+// newDiskControllers returns the controllers of scsiType needed for the VM to
+// have count of them. Existing controllers keep their bus numbers, a bus
+// number used by a controller of another SCSI type is an error, as changing
+// the controller of existing disks can leave the guest unable to boot.
+func newDiskControllers(devices object.VirtualDeviceList, scsiType string, count int) ([]types.BaseVirtualDevice, error) {
+	var created []types.BaseVirtualDevice
+	existing := make(map[int32]string)
+	for _, c := range getDiskControllers(devices) {
+		_, isNvme := c.(*types.VirtualNVMEController)
+		if isNvme != (scsiType == scsiTypeNvme) {
+			continue
+		}
+		existing[c.GetVirtualController().BusNumber] = devices.Type(c.(types.BaseVirtualDevice))
+	}
+
+	for bus := int32(0); bus < int32(count); bus++ {
+		if t, ok := existing[bus]; ok {
+			if scsiType != scsiTypeNvme && t != scsiType {
+				return nil, fmt.Errorf("SCSI controller %d is of type %s, not %s", bus, t, scsiType)
+			}
+			continue
+		}
+
+		var c types.BaseVirtualDevice
+		if scsiType == scsiTypeNvme {
+			c = &types.VirtualNVMEController{
+				VirtualController: types.VirtualController{
+					VirtualDevice: types.VirtualDevice{Key: devices.NewKey()},
+					BusNumber:     bus,
+				},
+			}
+		} else {
+			scsi, err := devices.CreateSCSIController(scsiType)
+			if err != nil {
+				return nil, err
+			}
+			scsi.(types.BaseVirtualController).GetVirtualController().BusNumber = bus
+			c = scsi
+		}
+		// Later controllers need a key of their own.
+		devices = append(devices, c)
+		created = append(created, c)
+	}
+	return created, nil
+}
+
+// addDiskControllers adds the controllers of scsi_type missing on the VM,
+// e.g. after it was cloned from a template with fewer of them.
+func (vm *virtualMachine) addDiskControllers(newVM *object.VirtualMachine) error {
+	if vm.scsiType == "" {
+		return nil
+	}
+	devices, err := newVM.Device(context.TODO())
+	if err != nil {
+		return err
+	}
+	controllers, err := newDiskControllers(devices, vm.scsiType, vm.scsiControllerCount)
+	if err != nil {
+		return err
+	}
+	if len(controllers) == 0 {
+		return nil
+	}
+	log.Printf("[DEBUG] Adding %d %s controller(s) to virtual machine %s", len(controllers), vm.scsiType, vm.name)
+	return newVM.AddDevice(context.TODO(), controllers...)
+}
+
+// pickUnitNumber returns the requested unit number of a disk on the
+// controller, or the next free one if none was requested.
+func pickUnitNumber(devices object.VirtualDeviceList, c types.BaseVirtualController, unit int32) (int32, error) {
+	if unit <= 0 {
+		return getNextUnitNumber(devices, c)
+	}
+	if _, ok := c.(*types.VirtualNVMEController); ok {
+		if unit >= nvmeUnitNumberCount {
+			return -1, fmt.Errorf("unit number %d is out of range for a NVMe controller", unit)
+		}
+	} else if unit == scsiReservedUnitNumber {
+		return -1, fmt.Errorf("unit number %d is reserved for the SCSI controller", unit)
+	}
+
+	key := c.GetVirtualController().Key
+	for _, device := range devices {
+		d := device.GetVirtualDevice()
+		if d.ControllerKey == key && d.UnitNumber != nil && *d.UnitNumber == unit {
+			return -1, fmt.Errorf("unit number %d of controller %d is already in use",
+				unit, c.GetVirtualController().BusNumber)
+		}
+	}
+	return unit, nil
+}
+
+// readDiskControllers returns the type and count of the controllers the disks
+// of the VM are attached to, going by the type of the first one.
+func readDiskControllers(devices object.VirtualDeviceList) (string, int) {
+	controllers := getDiskControllers(devices)
+	if len(controllers) == 0 {
+		return "", 0
+	}
+
+	primary, err := findDiskControllerByBus(devices, 0)
+	if err != nil {
+		primary = controllers[0]
+	}
+	scsiType := devices.Type(primary.(types.BaseVirtualDevice))
+
+	count := 0
+	for _, c := range controllers {
+		if devices.Type(c.(types.BaseVirtualDevice)) == scsiType {
+			count++
+		}
+	}
+	return scsiType, count
+}
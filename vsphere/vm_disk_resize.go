@@ -0,0 +1,235 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/guest"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+const guestCommandPollInterval = 2 * time.Second
+
+// Built-in guest commands extending a partition and its file system onto a
+// grown disk.
+const (
+	guestResizeTemplateGrowpart = "growpart"
+	guestResizeTemplateDiskpart = "diskpart"
+)
+
+var guestResizeTemplates = []string{
+	guestResizeTemplateGrowpart,
+	guestResizeTemplateDiskpart,
+}
+
+func validateGuestResizeTemplate(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, guestResizeTemplates)
+}
+
+func guestCredentialsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: "Guest OS account used to run commands in the guest through VMware Tools.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"username": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"password": &schema.Schema{
+					Type:      schema.TypeString,
+					Required:  true,
+					Sensitive: true,
+				},
+			},
+		},
+	}
+}
+
+func parseGuestCredentials(d *schema.ResourceData) *types.NamePasswordAuthentication {
+	l := d.Get("guest_credentials").([]interface{})
+	if len(l) == 0 || l[0] == nil {
+		return nil
+	}
+	creds := l[0].(map[string]interface{})
+	return &types.NamePasswordAuthentication{
+		Username: creds["username"].(string),
+		Password: creds["password"].(string),
+	}
+}
+
+// validateDiskResize only lets disks grow, as vSphere cannot shrink a VMDK
+// and replacing the disk would lose its data.
+func validateDiskResize(disk map[string]interface{}, oldSize int, newSize int) error {
+	if newSize < oldSize {
+		name, _ := disk["name"].(string)
+		return fmt.Errorf("[ERROR] disk %s cannot be shrunk from %d GB to %d GB, only growing a disk is supported",
+			name, oldSize, newSize)
+	}
+	return nil
+}
+
+// guestResizeCommand returns the command run in the guest after the disk
+// grew, either guest_resize_command or the one of guest_resize_template.
+func guestResizeCommand(disk map[string]interface{}) (string, error) {
+	command, _ := disk["guest_resize_command"].(string)
+	template, _ := disk["guest_resize_template"].(string)
+	target, _ := disk["guest_resize_target"].(string)
+	if template == "" {
+		return command, nil
+	}
+	if command != "" {
+		return "", fmt.Errorf("disk %s: only one of guest_resize_command and guest_resize_template can be set", disk["name"])
+	}
+
+	switch template {
+	case guestResizeTemplateGrowpart:
+		if target == "" {
+			target = "/"
+		}
+		if !strings.HasPrefix(target, "/") || strings.ContainsAny(target, "\"$`\\") {
+			return "", fmt.Errorf("disk %s: guest_resize_target of growpart must be a mount point, got %q", disk["name"], target)
+		}
+		return growpartCommand(target), nil
+	case guestResizeTemplateDiskpart:
+		if target == "" {
+			target = "C"
+		}
+		target = strings.TrimSuffix(strings.ToUpper(target), ":")
+		if len(target) != 1 || target[0] < 'A' || target[0] > 'Z' {
+			return "", fmt.Errorf("disk %s: guest_resize_target of diskpart must be a drive letter, got %q", disk["name"], target)
+		}
+		return diskpartCommand(target), nil
+	}
+	return "", fmt.Errorf("disk %s: unknown guest_resize_template %s", disk["name"], template)
+}
+
+// growpartCommand extends the partition holding the mount point onto the
+// free space of its disk and grows the ext or XFS file system on it. growpart
+// exits with 1 when the partition already fills the disk. A mount point on
+// an LVM logical volume grows the physical volume of its volume group with
+// pvresize and the logical volume with lvextend; volume groups spanning
+// several physical volumes are rejected, as it is unknown which one grew.
+func growpartCommand(mountPoint string) string {
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf(`src=$(findmnt -n -o SOURCE --target "%s")`, mountPoint),
+		`dev="$src"`,
+		`vg=`,
+		`if [ "$(lsblk -n -o TYPE "$src" | head -n 1)" = lvm ]; then`,
+		`vg=$(lvs --noheadings -o vg_name "$src" | tr -d " ")`,
+		`pvs=$(pvs --noheadings -o pv_name -S vg_name="$vg" | tr -d " ")`,
+		`[ "$(echo "$pvs" | wc -l)" -eq 1 ] || { echo "volume group $vg of $src has several physical volumes" >&2; exit 1; }`,
+		`dev="$pvs"`,
+		`fi`,
+		`part=$(basename "$(readlink -f "$dev")")`,
+		`if [ -e "/sys/class/block/$part/partition" ]; then`,
+		`disk=$(lsblk -n -o PKNAME "$dev" | head -n 1)`,
+		`{ echo 1 > "/sys/class/block/$disk/device/rescan"; } 2>/dev/null || true`,
+		`growpart "/dev/$disk" "$(cat "/sys/class/block/$part/partition")" || [ $? -eq 1 ]`,
+		`else`,
+		`{ echo 1 > "/sys/class/block/$part/device/rescan"; } 2>/dev/null || true`,
+		`fi`,
+		`if [ -n "$vg" ]; then`,
+		`pvresize "$dev"`,
+		`[ "$(vgs --noheadings -o vg_free_count "$vg" | tr -d " ")" -eq 0 ] || lvextend -l +100%FREE "$src"`,
+		`fi`,
+		fmt.Sprintf(`case "$(findmnt -n -o FSTYPE --target "%s")" in`, mountPoint),
+		fmt.Sprintf(`xfs) xfs_growfs "%s" ;;`, mountPoint),
+		`ext*) resize2fs "$src" ;;`,
+		`*) echo "unsupported file system on $src" >&2; exit 1 ;;`,
+		"esac",
+	}, "\n")
+}
+
+// diskpartCommand rescans the disks and extends the volume of the drive onto
+// the free space behind it.
+func diskpartCommand(driveLetter string) string {
+	script := `"%TEMP%\terraform-extend-` + driveLetter + `.txt"`
+	return fmt.Sprintf("(echo rescan& echo select volume %s& echo extend)> %s && diskpart /s %s",
+		driveLetter, script, script)
+}
+
+// guestCommandSpec wraps the command into the shell of the guest OS.
+func guestCommandSpec(guestID string, command string) *types.GuestProgramSpec {
+	if strings.HasPrefix(guestID, "win") {
+		return &types.GuestProgramSpec{
+			ProgramPath: `C:\Windows\System32\cmd.exe`,
+			Arguments:   "/c " + command,
+		}
+	}
+	return &types.GuestProgramSpec{
+		ProgramPath: "/bin/sh",
+		Arguments:   fmt.Sprintf("-c '%s'", strings.Replace(command, "'", `'\''`, -1)),
+	}
+}
+
+// runGuestCommand runs the command in the guest through VMware Tools and
+// waits for it to exit, e.g. to extend a partition and file system onto a
+// grown disk.
+func (vm *virtualMachine) runGuestCommand(vmObj *object.VirtualMachine, auth *types.NamePasswordAuthentication, command string) error {
+	ctx := vm.taskCtx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+
+	// VMware Tools may still be starting after a power on.
+	var mvm mo.VirtualMachine
+	for {
+		props := []string{"config.guestId", "runtime.powerState", "guest.toolsRunningStatus"}
+		if err := vmObj.Properties(ctx, vmObj.Reference(), props, &mvm); err != nil {
+			return err
+		}
+		if mvm.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+			return fmt.Errorf("virtual machine %s has to be powered on to run guest commands", vm.name)
+		}
+		if mvm.Guest != nil && mvm.Guest.ToolsRunningStatus == string(types.VirtualMachineToolsRunningStatusGuestToolsRunning) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return taskTimeoutError(ctx, ctx.Err(), "wait for VMware Tools in virtual machine "+vm.name, vm.taskTimeout)
+		case <-time.After(guestCommandPollInterval):
+		}
+	}
+
+	opsManager := guest.NewOperationsManager(vmObj.Client(), vmObj.Reference())
+	processManager, err := opsManager.ProcessManager(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Running guest command on virtual machine %s: %s", vm.name, command)
+	pid, err := processManager.StartProgram(ctx, auth, guestCommandSpec(mvm.Config.GuestId, command))
+	if err != nil {
+		return err
+	}
+
+	for {
+		procs, err := processManager.ListProcesses(ctx, auth, []int64{pid})
+		if err != nil {
+			return err
+		}
+		if len(procs) > 0 && procs[0].EndTime != nil {
+			if procs[0].ExitCode != 0 {
+				return fmt.Errorf("guest command %q exited with code %d", command, procs[0].ExitCode)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return taskTimeoutError(ctx, ctx.Err(), "run guest command on virtual machine "+vm.name, vm.taskTimeout)
+		case <-time.After(guestCommandPollInterval):
+		}
+	}
+}
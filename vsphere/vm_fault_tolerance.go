@@ -0,0 +1,184 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+type faultTolerance struct {
+	secondaryHost      string
+	secondaryDatastore string
+}
+
+func faultToleranceSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"secondary_host": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+
+				"secondary_datastore": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+// parseFaultToleranceData returns nil when no fault_tolerance block is configured.
+func parseFaultToleranceData(ftList []interface{}) *faultTolerance {
+
+	if len(ftList) == 0 {
+		return nil
+	}
+
+	ft := &faultTolerance{}
+	if ftList[0] == nil {
+		return ft
+	}
+	ftObj := ftList[0].(map[string]interface{})
+
+	if v, ok := ftObj["secondary_host"].(string); ok && v != "" {
+		ft.secondaryHost = v
+	}
+
+	if v, ok := ftObj["secondary_datastore"].(string); ok && v != "" {
+		ft.secondaryDatastore = v
+	}
+
+	log.Printf("[DEBUG] Fault tolerance data %#v", ft)
+	return ft
+}
+
+// buildFaultToleranceSpec places the secondary VM configuration, metadata and
+// all disks on the secondary datastore. Without a datastore the placement is
+// left to vCenter.
+func (ft *faultTolerance) buildFaultToleranceSpec(f *find.Finder, vm *object.VirtualMachine) (*types.FaultToleranceConfigSpec, error) {
+
+	if ft.secondaryDatastore == "" {
+		return nil, nil
+	}
+
+	ds, err := f.Datastore(context.TODO(), ft.secondaryDatastore)
+	if err != nil {
+		return nil, fmt.Errorf("Error finding secondary datastore %s: %s", ft.secondaryDatastore, err)
+	}
+	dsRef := ds.Reference()
+
+	devices, err := vm.Device(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	var diskSpecs []types.FaultToleranceDiskSpec
+	for _, disk := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		diskSpecs = append(diskSpecs, types.FaultToleranceDiskSpec{
+			Disk:      disk,
+			Datastore: dsRef,
+		})
+	}
+
+	return &types.FaultToleranceConfigSpec{
+		MetaDataPath: &types.FaultToleranceMetaSpec{
+			MetaDataDatastore: dsRef,
+		},
+		SecondaryVmSpec: &types.FaultToleranceVMConfigSpec{
+			VmConfig: &dsRef,
+			Disks:    diskSpecs,
+		},
+	}, nil
+}
+
+func (ft *faultTolerance) enableFaultTolerance(c *govmomi.Client, f *find.Finder, vm *object.VirtualMachine) error {
+
+	log.Printf("[INFO] Enabling fault tolerance for VM %s", vm.InventoryPath)
+
+	req := types.CreateSecondaryVMEx_Task{
+		This: vm.Reference(),
+	}
+
+	if ft.secondaryHost != "" {
+		host, err := f.HostSystem(context.TODO(), ft.secondaryHost)
+		if err != nil {
+			return fmt.Errorf("Error finding secondary host %s: %s", ft.secondaryHost, err)
+		}
+		hostRef := host.Reference()
+		req.Host = &hostRef
+	}
+
+	spec, err := ft.buildFaultToleranceSpec(f, vm)
+	if err != nil {
+		return err
+	}
+	req.Spec = spec
+
+	res, err := methods.CreateSecondaryVMEx_Task(context.TODO(), c, &req)
+	if err != nil {
+		return err
+	}
+
+	task := object.NewTask(c.Client, res.Returnval)
+	_, err = task.WaitForResult(context.TODO(), nil)
+	if err != nil {
+		log.Printf("[ERROR] Enabling fault tolerance for VM %s failed.", vm.InventoryPath)
+		return err
+	}
+
+	return nil
+}
+
+func disableFaultTolerance(c *govmomi.Client, vm *object.VirtualMachine) error {
+
+	log.Printf("[INFO] Disabling fault tolerance for VM %s", vm.InventoryPath)
+
+	req := types.TurnOffFaultToleranceForVM_Task{
+		This: vm.Reference(),
+	}
+
+	res, err := methods.TurnOffFaultToleranceForVM_Task(context.TODO(), c, &req)
+	if err != nil {
+		return err
+	}
+
+	task := object.NewTask(c.Client, res.Returnval)
+	_, err = task.WaitForResult(context.TODO(), nil)
+	if err != nil {
+		log.Printf("[ERROR] Disabling fault tolerance for VM %s failed.", vm.InventoryPath)
+		return err
+	}
+
+	return nil
+}
+
+func faultToleranceConfigured(mvm *mo.VirtualMachine) bool {
+	state := mvm.Runtime.FaultToleranceState
+	return state != "" && state != types.VirtualMachineFaultToleranceStateNotConfigured
+}
+
+func readFaultToleranceData(mvm *mo.VirtualMachine, d *schema.ResourceData) error {
+
+	d.Set("fault_tolerance_state", string(mvm.Runtime.FaultToleranceState))
+
+	if _, ok := d.GetOk("fault_tolerance"); ok && !faultToleranceConfigured(mvm) {
+		// Fault tolerance was turned off outside of Terraform.
+		log.Printf("[WARN] Fault tolerance is not configured for VM %s", d.Id())
+		return d.Set("fault_tolerance", []interface{}{})
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// defaultGuestID is used for VMs which are neither cloned nor set guest_id.
+const defaultGuestID = "otherLinux64Guest"
+
+func validateGuestID(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	// Guest IDs of the VirtualMachineGuestOsIdentifier enum all end in
+	// "Guest", e.g. "rhel7_64Guest" or "windows9Server64Guest".
+	if !strings.HasSuffix(value, "Guest") || len(value) == len("Guest") {
+		errors = append(errors, fmt.Errorf(
+			"%s: %q is not a vSphere guest OS identifier, e.g. rhel7_64Guest", k, value))
+	}
+	return
+}
+
+// getSupportedGuestIDs returns the guest OS identifiers the environment
+// browser of a compute resource or VM supports, with their full names.
+func getSupportedGuestIDs(c *govmomi.Client, envBrowser types.ManagedObjectReference) (map[string]string, error) {
+	res, err := methods.QueryConfigOption(context.TODO(), c.Client, &types.QueryConfigOption{This: envBrowser})
+	if err != nil {
+		return nil, err
+	}
+	if res.Returnval == nil {
+		return nil, fmt.Errorf("environment browser %s returned no config option", envBrowser.Value)
+	}
+
+	guests := make(map[string]string)
+	for _, descriptor := range res.Returnval.GuestOSDescriptor {
+		guests[descriptor.Id] = descriptor.FullName
+	}
+	return guests, nil
+}
+
+// checkGuestIDSupported fails for a guest ID vCenter does not know, as it
+// would otherwise be accepted and the VM silently configured as another OS.
+func checkGuestIDSupported(c *govmomi.Client, envBrowser types.ManagedObjectReference, guestID string) error {
+	guests, err := getSupportedGuestIDs(c, envBrowser)
+	if err != nil {
+		return fmt.Errorf("Error querying supported guest OS types: %s", err)
+	}
+	if _, ok := guests[guestID]; ok {
+		return nil
+	}
+
+	ids := make([]string, 0, len(guests))
+	for id := range guests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return fmt.Errorf("guest_id %s is not supported by this host, supported values are %s",
+		guestID, strings.Join(ids, ", "))
+}
+
+// resourcePoolEnvironmentBrowser returns the environment browser of the
+// compute resource owning the resource pool.
+func resourcePoolEnvironmentBrowser(c *govmomi.Client, rp *object.ResourcePool) (types.ManagedObjectReference, error) {
+	var mrp mo.ResourcePool
+	if err := rp.Properties(context.TODO(), rp.Reference(), []string{"owner"}, &mrp); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+
+	var mcr mo.ComputeResource
+	collector := property.DefaultCollector(c.Client)
+	if err := collector.RetrieveOne(context.TODO(), mrp.Owner, []string{"environmentBrowser"}, &mcr); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if mcr.EnvironmentBrowser == nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("compute resource %s has no environment browser", mrp.Owner.Value)
+	}
+	return *mcr.EnvironmentBrowser, nil
+}
+
+// readGuestOS sets the configured guest ID and the OS detected by VMware
+// Tools, falling back to the configured OS while Tools are not running.
+func readGuestOS(d *schema.ResourceData, mvm *mo.VirtualMachine) {
+	if mvm.Config == nil {
+		return
+	}
+	d.Set("guest_id", mvm.Config.GuestId)
+
+	fullName := mvm.Config.GuestFullName
+	var family string
+	if mvm.Guest != nil {
+		if mvm.Guest.GuestFullName != "" {
+			fullName = mvm.Guest.GuestFullName
+		}
+		family = mvm.Guest.GuestFamily
+	}
+	log.Printf("[DEBUG] Guest OS of virtual machine %s: %s (%s)", mvm.Config.Name, fullName, family)
+	d.Set("guest_full_name", fullName)
+	d.Set("guest_family", family)
+}
@@ -0,0 +1,148 @@
+package vsphere
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// nicBandwidthKeys are the attributes of network_interface which are changed
+// in place.
+var nicBandwidthKeys = map[string]bool{
+	"bandwidth_reservation": true,
+	"bandwidth_limit":       true,
+	"bandwidth_share_level": true,
+	"bandwidth_share_count": true,
+}
+
+// nicBandwidth is the network I/O control allocation of a NIC in Mbit/s,
+// which takes effect on a vDS with NIOC version 3. A limit of -1 means
+// unlimited.
+type nicBandwidth struct {
+	reservation int64
+	limit       int64
+	shareLevel  string
+	shareCount  int32
+}
+
+// parseNicBandwidth returns the bandwidth allocation of a network_interface,
+// or nil if it sets none.
+func parseNicBandwidth(network map[string]interface{}) (*nicBandwidth, error) {
+	reservation, _ := network["bandwidth_reservation"].(int)
+	limit, _ := network["bandwidth_limit"].(int)
+	shareLevel, _ := network["bandwidth_share_level"].(string)
+	shareCount, _ := network["bandwidth_share_count"].(int)
+	if reservation == 0 && limit == 0 && shareLevel == "" {
+		return nil, nil
+	}
+
+	b := &nicBandwidth{
+		reservation: int64(reservation),
+		limit:       int64(limit),
+		shareLevel:  shareLevel,
+		shareCount:  int32(shareCount),
+	}
+	if b.limit == 0 {
+		b.limit = -1
+	}
+	if b.shareLevel == "" {
+		b.shareLevel = string(types.SharesLevelNormal)
+	}
+	if b.shareLevel == string(types.SharesLevelCustom) && b.shareCount <= 0 {
+		return nil, fmt.Errorf("bandwidth_share_count must be set when bandwidth_share_level is '%s'", types.SharesLevelCustom)
+	}
+	if b.limit >= 0 && b.reservation > b.limit {
+		return nil, fmt.Errorf("bandwidth_reservation (%d) cannot exceed bandwidth_limit (%d)", b.reservation, b.limit)
+	}
+	return b, nil
+}
+
+func (b *nicBandwidth) resourceAllocation() *types.VirtualEthernetCardResourceAllocation {
+	reservation := b.reservation
+	limit := b.limit
+	return &types.VirtualEthernetCardResourceAllocation{
+		Reservation: &reservation,
+		Limit:       &limit,
+		Share: types.SharesInfo{
+			Level:  types.SharesLevel(b.shareLevel),
+			Shares: b.shareCount,
+		},
+	}
+}
+
+// onlyNicBandwidthChanged reports whether the network interfaces only differ
+// in their bandwidth allocation.
+func onlyNicBandwidthChanged(oldNics []interface{}, newNics []interface{}) bool {
+	if len(oldNics) != len(newNics) {
+		return false
+	}
+	for i := range oldNics {
+		o := oldNics[i].(map[string]interface{})
+		n := newNics[i].(map[string]interface{})
+		for k := range n {
+			if !nicBandwidthKeys[k] && !reflect.DeepEqual(o[k], n[k]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// nicBandwidthChanges returns the device changes editing the bandwidth
+// allocation of the existing NICs, so they keep their MAC address and
+// connection. ok is false if anything else of network_interface changed,
+// which replaces the NICs through handleNetworkUpdate.
+func nicBandwidthChanges(d *schema.ResourceData, devices object.VirtualDeviceList) (changes []types.BaseVirtualDeviceConfigSpec, ok bool, err error) {
+	o, n := d.GetChange("network_interface")
+	oldNics := o.([]interface{})
+	newNics := n.([]interface{})
+	if !onlyNicBandwidthChanged(oldNics, newNics) {
+		return nil, false, nil
+	}
+
+	for i, v := range newNics {
+		network := v.(map[string]interface{})
+		if reflect.DeepEqual(oldNics[i], network) {
+			continue
+		}
+		bandwidth, err := parseNicBandwidth(network)
+		if err != nil {
+			return nil, false, fmt.Errorf("network interface %d: %s", i, err)
+		}
+		// Without allocation the NIC goes back to the vSphere defaults.
+		if bandwidth == nil {
+			bandwidth = &nicBandwidth{limit: -1, shareLevel: string(types.SharesLevelNormal)}
+		}
+
+		device := devices.FindByKey(int32(network["deviceId"].(int)))
+		card, isCard := device.(types.BaseVirtualEthernetCard)
+		if !isCard {
+			return nil, false, nil
+		}
+		card.GetVirtualEthernetCard().ResourceAllocation = bandwidth.resourceAllocation()
+		changes = append(changes, &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+			Device:    device,
+		})
+	}
+	return changes, true, nil
+}
+
+// flattenNicBandwidth sets the bandwidth allocation of the NIC on its
+// network_interface.
+func flattenNicBandwidth(networkInterface map[string]interface{}, allocation *types.VirtualEthernetCardResourceAllocation) {
+	if allocation == nil {
+		return
+	}
+	if allocation.Reservation != nil {
+		networkInterface["bandwidth_reservation"] = int(*allocation.Reservation)
+	}
+	if allocation.Limit != nil {
+		networkInterface["bandwidth_limit"] = int(*allocation.Limit)
+	}
+	networkInterface["bandwidth_share_level"] = string(allocation.Share.Level)
+	networkInterface["bandwidth_share_count"] = int(allocation.Share.Shares)
+}
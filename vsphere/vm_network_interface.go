@@ -15,6 +15,33 @@ import (
 	"golang.org/x/net/context"
 )
 
+const (
+	addressModeDhcp     = "dhcp"
+	addressModeStatic   = "static"
+	addressModeManual   = "manual"
+	addressModeAutoconf = "autoconf"
+	addressModeNone     = "none"
+)
+
+// An IPv4 address mode of none leaves IPv4 unconfigured on IPv6-only
+// networks.
+var ipv4AddressModeList = []string{
+	addressModeDhcp,
+	addressModeStatic,
+	addressModeManual,
+	addressModeNone,
+}
+
+// IPv6 addresses can also be configured by router advertisements, or not at
+// all.
+var ipv6AddressModeList = []string{
+	addressModeDhcp,
+	addressModeStatic,
+	addressModeAutoconf,
+	addressModeManual,
+	addressModeNone,
+}
+
 type networkInterface struct {
 	deviceName       string
 	label            string
@@ -24,9 +51,14 @@ type networkInterface struct {
 	ipv6Address      string
 	ipv6PrefixLength int
 	ipv6Gateway      string
+	ipv4Mode         string
+	ipv6Mode         string
+	defaultGateway   bool
+	routes           []networkRoute
 	adapterType      string // TODO: Make "adapter_type" argument
 	macAddress       string
 	deviceId         int32
+	bandwidth        *nicBandwidth
 }
 
 func networkInterfaceSchema() *schema.Schema {
@@ -93,6 +125,29 @@ func networkInterfaceSchema() *schema.Schema {
 					Computed: true,
 				},
 
+				// How the guest gets its addresses, by default static if
+				// an address is set, DHCP otherwise.
+				"ipv4_mode": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: validateIpv4AddressMode,
+				},
+
+				"ipv6_mode": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: validateIpv6AddressMode,
+				},
+
+				// If any interface sets default_gateway, only the gateways
+				// of those interfaces are configured in the guest.
+				"default_gateway": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+
+				"route": networkRouteSchema(),
+
 				"adapter_type": &schema.Schema{
 					Type:     schema.TypeString,
 					Optional: true,
@@ -105,6 +160,33 @@ func networkInterfaceSchema() *schema.Schema {
 					Computed: true,
 				},
 
+				// Network I/O control allocation of the NIC in Mbit/s, a
+				// limit of -1 means unlimited.
+				"bandwidth_reservation": &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+					Computed: true,
+				},
+
+				"bandwidth_limit": &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+					Computed: true,
+				},
+
+				"bandwidth_share_level": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Computed:     true,
+					ValidateFunc: validateSharesLevel,
+				},
+
+				"bandwidth_share_count": &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+					Computed: true,
+				},
+
 				"deviceId": &schema.Schema{
 					Type:     schema.TypeInt,
 					Computed: true,
@@ -154,18 +236,123 @@ func parseNetworkInterfaceData(vL []interface{}) (error, []networkInterface) {
 		if v, ok := network["mac_address"].(string); ok && v != "" {
 			nic.macAddress = v
 		}
+		if v, ok := network["ipv4_mode"].(string); ok {
+			nic.ipv4Mode = v
+		}
+		if v, ok := network["ipv6_mode"].(string); ok {
+			nic.ipv6Mode = v
+		}
+		if v, ok := network["default_gateway"].(bool); ok {
+			nic.defaultGateway = v
+		}
+		if v, ok := network["route"].([]interface{}); ok {
+			routes, err := parseNetworkRoutes(v)
+			if err != nil {
+				return fmt.Errorf("network interface %s: %s", nic.label, err), nil
+			}
+			nic.routes = routes
+		}
+		bandwidth, err := parseNicBandwidth(network)
+		if err != nil {
+			return fmt.Errorf("network interface %s: %s", nic.label, err), nil
+		}
+		nic.bandwidth = bandwidth
+		if err := nic.resolveAddressModes(); err != nil {
+			return err, nil
+		}
 		networks = append(networks, nic)
 	}
+	if err := selectDefaultGateways(networks); err != nil {
+		return err, nil
+	}
 	return nil, networks
 }
 
+// selectDefaultGateways clears the gateways of the interfaces which do not
+// set default_gateway, if any does, so a multi-homed guest gets one default
+// route per address family. The gateways of the other interfaces can still
+// be used by their routes.
+func selectDefaultGateways(networks []networkInterface) error {
+	var ipv4Default, ipv6Default []string
+	for _, n := range networks {
+		if !n.defaultGateway {
+			continue
+		}
+		if n.ipv4Gateway != "" {
+			ipv4Default = append(ipv4Default, n.label)
+		}
+		if n.ipv6Gateway != "" {
+			ipv6Default = append(ipv6Default, n.label)
+		}
+	}
+	if len(ipv4Default) > 1 {
+		return fmt.Errorf("only one network interface can set default_gateway with an ipv4_gateway, got %s", strings.Join(ipv4Default, ", "))
+	}
+	if len(ipv6Default) > 1 {
+		return fmt.Errorf("only one network interface can set default_gateway with an ipv6_gateway, got %s", strings.Join(ipv6Default, ", "))
+	}
+	if len(ipv4Default) == 0 && len(ipv6Default) == 0 {
+		return nil
+	}
+
+	for i := range networks {
+		if !networks[i].defaultGateway {
+			networks[i].ipv4Gateway = ""
+			networks[i].ipv6Gateway = ""
+		}
+	}
+	return nil
+}
+
+func validateIpv4AddressMode(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, ipv4AddressModeList)
+}
+
+func validateIpv6AddressMode(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, ipv6AddressModeList)
+}
+
+// resolveAddressModes sets the address modes left unset from whether an
+// address is given. With an explicit mode other than static, the addresses
+// are only read from the guest and not used for customization.
+func (n *networkInterface) resolveAddressModes() error {
+	if n.ipv4Mode == "" {
+		n.ipv4Mode = addressModeDhcp
+		if n.ipv4Address != "" {
+			n.ipv4Mode = addressModeStatic
+		}
+	}
+	if n.ipv6Mode == "" {
+		n.ipv6Mode = addressModeDhcp
+		if n.ipv6Address != "" {
+			n.ipv6Mode = addressModeStatic
+		}
+	}
+
+	if n.ipv4Mode == addressModeStatic && n.ipv4Address == "" {
+		return fmt.Errorf("network interface %s: ipv4_address is required with ipv4_mode %s", n.label, addressModeStatic)
+	}
+	if n.ipv6Mode == addressModeStatic && n.ipv6Address == "" {
+		return fmt.Errorf("network interface %s: ipv6_address is required with ipv6_mode %s", n.label, addressModeStatic)
+	}
+	if n.ipv4Mode == addressModeNone && n.ipv6Mode == addressModeNone {
+		return fmt.Errorf("network interface %s: ipv4_mode and ipv6_mode cannot both be %s", n.label, addressModeNone)
+	}
+	return nil
+}
+
 func buildNetworkConfig(n networkInterface) (types.CustomizationAdapterMapping, error) {
 
 	var config types.CustomizationAdapterMapping
 	var ipSetting types.CustomizationIPSettings
-	if n.ipv4Address == "" {
+	switch n.ipv4Mode {
+	case addressModeManual, addressModeNone:
+		// Customization requires an IPv4 generator, the unknown one leaves
+		// the address alone.
+		ipSetting.Ip = &types.CustomizationUnknownIpGenerator{}
+	case addressModeDhcp, "":
 		ipSetting.Ip = &types.CustomizationDhcpIpGenerator{}
-	} else {
+	default:
 		if n.ipv4PrefixLength == 0 {
 			return config, fmt.Errorf("Error: ipv4_prefix_length argument is empty.")
 		}
@@ -176,8 +363,10 @@ func buildNetworkConfig(n networkInterface) (types.CustomizationAdapterMapping,
 		log.Printf("[DEBUG] ipv4 address: %v\n", n.ipv4Address)
 		log.Printf("[DEBUG] ipv4 prefix length: %v\n", n.ipv4PrefixLength)
 		log.Printf("[DEBUG] ipv4 subnet mask: %v\n", subnetMask)
-		ipSetting.Gateway = []string{
-			n.ipv4Gateway,
+		if n.ipv4Gateway != "" {
+			ipSetting.Gateway = []string{
+				n.ipv4Gateway,
+			}
 		}
 		ipSetting.Ip = &types.CustomizationFixedIp{
 			IpAddress: n.ipv4Address,
@@ -186,11 +375,25 @@ func buildNetworkConfig(n networkInterface) (types.CustomizationAdapterMapping,
 	}
 
 	ipv6Spec := &types.CustomizationIPSettingsIpV6AddressSpec{}
-	if n.ipv6Address == "" {
+	switch n.ipv6Mode {
+	case addressModeNone:
+		ipv6Spec = nil
+	case addressModeAutoconf:
+		ipv6Spec.Ip = []types.BaseCustomizationIpV6Generator{
+			&types.CustomizationAutoIpV6Generator{},
+		}
+	case addressModeManual:
+		ipv6Spec.Ip = []types.BaseCustomizationIpV6Generator{
+			&types.CustomizationUnknownIpV6Generator{},
+		}
+	case addressModeDhcp, "":
 		ipv6Spec.Ip = []types.BaseCustomizationIpV6Generator{
 			&types.CustomizationDhcpIpV6Generator{},
 		}
-	} else {
+	default:
+		if n.ipv6PrefixLength == 0 {
+			return config, fmt.Errorf("Error: ipv6_prefix_length argument is empty.")
+		}
 		log.Printf("[DEBUG] ipv6 gateway: %v\n", n.ipv6Gateway)
 		log.Printf("[DEBUG] ipv6 address: %v\n", n.ipv6Address)
 		log.Printf("[DEBUG] ipv6 prefix length: %v\n", n.ipv6PrefixLength)
@@ -201,7 +404,9 @@ func buildNetworkConfig(n networkInterface) (types.CustomizationAdapterMapping,
 				SubnetMask: int32(n.ipv6PrefixLength),
 			},
 		}
-		ipv6Spec.Gateway = []string{n.ipv6Gateway}
+		if n.ipv6Gateway != "" {
+			ipv6Spec.Gateway = []string{n.ipv6Gateway}
+		}
 	}
 	ipSetting.IpV6Spec = ipv6Spec
 
@@ -271,8 +476,9 @@ func buildNetworkDevice(f *find.Finder, n networkInterface) (*types.VirtualDevic
 		address_type = string(types.VirtualEthernetCardMacTypeManual)
 	}
 
+	var spec *types.VirtualDeviceConfigSpec
 	if n.adapterType == "vmxnet3" {
-		return &types.VirtualDeviceConfigSpec{
+		spec = &types.VirtualDeviceConfigSpec{
 			Operation: types.VirtualDeviceConfigSpecOperationAdd,
 			Device: &types.VirtualVmxnet3{
 				VirtualVmxnet: types.VirtualVmxnet{
@@ -286,9 +492,9 @@ func buildNetworkDevice(f *find.Finder, n networkInterface) (*types.VirtualDevic
 					},
 				},
 			},
-		}, nil
+		}
 	} else if n.adapterType == "e1000" {
-		return &types.VirtualDeviceConfigSpec{
+		spec = &types.VirtualDeviceConfigSpec{
 			Operation: types.VirtualDeviceConfigSpecOperationAdd,
 			Device: &types.VirtualE1000{
 				VirtualEthernetCard: types.VirtualEthernetCard{
@@ -300,38 +506,158 @@ func buildNetworkDevice(f *find.Finder, n networkInterface) (*types.VirtualDevic
 					MacAddress:  n.macAddress,
 				},
 			},
-		}, nil
+		}
 	} else {
 		return nil, fmt.Errorf("Invalid network n.adapter type.")
 	}
+
+	if n.bandwidth != nil {
+		card := spec.Device.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		card.ResourceAllocation = n.bandwidth.resourceAllocation()
+	}
+	return spec, nil
 }
 
-func readNetworkData(mvm *mo.VirtualMachine, d *schema.ResourceData) error {
-	networkInterfaces := make([]map[string]interface{}, 0)
-	for _, v := range mvm.Guest.Net {
-		if v.DeviceConfigId >= 0 {
-			networkInterface := make(map[string]interface{})
+// networkBackingName returns the name of the network a NIC is connected to,
+// or "" for backings which only reference it by key, e.g. a distributed
+// port group.
+func networkBackingName(card *types.VirtualEthernetCard) string {
+	switch backing := card.Backing.(type) {
+	case *types.VirtualEthernetCardNetworkBackingInfo:
+		return backing.DeviceName
+	case *types.VirtualEthernetCardOpaqueNetworkBackingInfo:
+		return backing.OpaqueNetworkId
+	}
+	return ""
+}
+
+// mergeNetworkInterfaces builds the network interfaces from the NICs
+// configured on the VM, reconciled onto the interfaces in state. They are
+// matched by the device key stored in deviceId, so the interfaces keep their
+// order however the devices or the guest order them. Interfaces without a
+// device key yet take the unmatched NICs in device order, NICs unknown to
+// the state are appended and interfaces of removed NICs dropped.
+//
+// The addresses reported by the guest are merged in when VMware Tools
+// provide them, otherwise the last known ones are kept. The merged interfaces
+// are also returned by their index in the guest NIC list.
+func mergeNetworkInterfaces(current []interface{}, devices object.VirtualDeviceList, guestNics []types.GuestNicInfo) ([]map[string]interface{}, map[int]map[string]interface{}) {
+	var cards []*types.VirtualEthernetCard
+	for _, device := range devices.SelectByType((*types.VirtualEthernetCard)(nil)) {
+		cards = append(cards, device.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard())
+	}
+
+	entries := make([]map[string]interface{}, 0, len(current))
+	inState := make(map[int32]int)
+	for i, raw := range current {
+		networkInterface := make(map[string]interface{})
+		if m, ok := raw.(map[string]interface{}); ok {
+			for k, v := range m {
+				networkInterface[k] = v
+			}
+		}
+		if key, ok := networkInterface["deviceId"].(int); ok && key != 0 {
+			inState[int32(key)] = i
+		}
+		entries = append(entries, networkInterface)
+	}
+
+	entryOfCard := make(map[int32]int)
+	var unmatched []*types.VirtualEthernetCard
+	for _, card := range cards {
+		if i, ok := inState[card.Key]; ok {
+			entryOfCard[card.Key] = i
+		} else {
+			unmatched = append(unmatched, card)
+		}
+	}
+	next := 0
+	for _, card := range unmatched {
+		for next < len(entries) {
+			if key, ok := entries[next]["deviceId"].(int); !ok || key == 0 {
+				break
+			}
+			next++
+		}
+		if next == len(entries) {
+			entries = append(entries, make(map[string]interface{}))
+		}
+		entryOfCard[card.Key] = next
+		next++
+	}
+
+	used := make([]bool, len(entries))
+	byKey := make(map[int32]map[string]interface{})
+	for key, i := range entryOfCard {
+		used[i] = true
+		byKey[key] = entries[i]
+	}
+	networkInterfaces := make([]map[string]interface{}, 0, len(cards))
+	for i, networkInterface := range entries {
+		if used[i] {
+			networkInterfaces = append(networkInterfaces, networkInterface)
+		}
+	}
+
+	for _, card := range cards {
+		networkInterface := byKey[card.Key]
+		networkInterface["deviceId"] = int(card.Key)
+		networkInterface["mac_address"] = card.MacAddress
+		flattenNicBandwidth(networkInterface, card.ResourceAllocation)
+		if label := networkBackingName(card); label != "" {
+			networkInterface["label"] = label
+		}
+	}
+
+	byGuestIndex := make(map[int]map[string]interface{})
+	for i, v := range guestNics {
+		networkInterface, ok := byKey[v.DeviceConfigId]
+		if v.DeviceConfigId < 0 || !ok {
+			continue
+		}
+		if v.Network != "" {
 			networkInterface["label"] = v.Network
-			networkInterface["mac_address"] = v.MacAddress
-			networkInterface["deviceId"] = v.DeviceConfigId
+		}
+		if v.IpConfig != nil {
+			globalIpv6 := false
 			for _, ip := range v.IpConfig.IpAddress {
 				p := net.ParseIP(ip.IpAddress)
+				if p == nil {
+					continue
+				}
 				if p.To4() != nil {
 					log.Printf("[DEBUG] p.String - %#v", p.String())
 					log.Printf("[DEBUG] ip.PrefixLength - %#v", ip.PrefixLength)
 					networkInterface["ipv4_address"] = p.String()
-					networkInterface["ipv4_prefix_length"] = ip.PrefixLength
-				} else if p.To16() != nil {
+					networkInterface["ipv4_prefix_length"] = int(ip.PrefixLength)
+				} else if !globalIpv6 || !p.IsLinkLocalUnicast() {
+					// Link-local addresses are only used when the
+					// interface has no other IPv6 address.
+					globalIpv6 = !p.IsLinkLocalUnicast()
 					log.Printf("[DEBUG] p.String - %#v", p.String())
 					log.Printf("[DEBUG] ip.PrefixLength - %#v", ip.PrefixLength)
 					networkInterface["ipv6_address"] = p.String()
-					networkInterface["ipv6_prefix_length"] = ip.PrefixLength
+					networkInterface["ipv6_prefix_length"] = int(ip.PrefixLength)
 				}
 			}
-			networkInterfaces = append(networkInterfaces, networkInterface)
 		}
-	}	
-	if len(networkInterfaces) > 0 {
+		byGuestIndex[i] = networkInterface
+	}
+	return networkInterfaces, byGuestIndex
+}
+
+func readNetworkData(mvm *mo.VirtualMachine, d *schema.ResourceData) error {
+	var guestNics []types.GuestNicInfo
+	if mvm.Guest != nil {
+		guestNics = mvm.Guest.Net
+	}
+	var devices object.VirtualDeviceList
+	if mvm.Config != nil {
+		devices = object.VirtualDeviceList(mvm.Config.Hardware.Device)
+	}
+	networkInterfaces, byGuestIndex := mergeNetworkInterfaces(d.Get("network_interface").([]interface{}), devices, guestNics)
+
+	if len(byGuestIndex) > 0 {
 		if mvm.Guest.IpStack != nil {
 			for _, v := range mvm.Guest.IpStack {
 				if v.IpRouteConfig != nil && v.IpRouteConfig.IpRoute != nil {
@@ -344,8 +670,9 @@ func readNetworkData(mvm *mo.VirtualMachine, d *schema.ResourceData) error {
 								gatewaySetting = "ipv4_gateway"
 							}
 							if gatewaySetting != "" {
+								// The gateway device is the index of the NIC in guest.net.
 								deviceID, err := strconv.Atoi(route.Gateway.Device)
-								if len(networkInterfaces) == 1 {
+								if len(guestNics) == 1 {
 									deviceID = 0
 								}
 								if err != nil {
@@ -354,9 +681,9 @@ func readNetworkData(mvm *mo.VirtualMachine, d *schema.ResourceData) error {
 									log.Printf("[DEBUG] %s of device id %d: %s", gatewaySetting, deviceID, route.Gateway.IpAddress)
 									// if the VM is shutdown, guest.net is unset (which results in an empty list of network interfaces),
 									// whereas guest.ipstack is set and an error condition is created when we try to update a non-existing interface
-									if (networkInterfaces[deviceID] != nil) {
-										networkInterfaces[deviceID][gatewaySetting] = route.Gateway.IpAddress
-									}							
+									if networkInterface, ok := byGuestIndex[deviceID]; ok {
+										networkInterface[gatewaySetting] = route.Gateway.IpAddress
+									}
 								}
 							}
 						}
@@ -371,23 +698,77 @@ func readNetworkData(mvm *mo.VirtualMachine, d *schema.ResourceData) error {
 		return fmt.Errorf("Invalid network interfaces to set: %#v", networkInterfaces)
 	}
 
-	if len(networkInterfaces) > 0 {
-		if _, ok := networkInterfaces[0]["ipv4_address"]; ok {
-			log.Printf("[DEBUG] ip address: %v", networkInterfaces[0]["ipv4_address"].(string))
-			d.SetConnInfo(map[string]string{
-				"type": "ssh",
-				"host": networkInterfaces[0]["ipv4_address"].(string),
-			})
-		}
+	var guestFamily, guestID string
+	if mvm.Guest != nil {
+		guestFamily = mvm.Guest.GuestFamily
+	}
+	if mvm.Config != nil {
+		guestID = mvm.Config.GuestId
+	}
+	if connInfo := networkConnInfo(networkInterfaces, d.Get("connection_interface_index").(int), guestFamily, guestID); connInfo != nil {
+		log.Printf("[DEBUG] connection info: %v", connInfo)
+		d.SetConnInfo(connInfo)
 	}
 	return nil
 }
 
+func validateConnectionInterfaceIndex(v interface{}, k string) (ws []string, errors []error) {
+	if v.(int) < 0 {
+		errors = append(errors, fmt.Errorf("%s: index must not be negative", k))
+	}
+	return
+}
+
+// isWindowsGuest reports whether the guest runs Windows, from the guest
+// family reported by VMware Tools or else the configured guest ID.
+func isWindowsGuest(guestFamily string, guestID string) bool {
+	if guestFamily != "" {
+		return guestFamily == string(types.VirtualMachineGuestOsFamilyWindowsGuest)
+	}
+	return strings.HasPrefix(guestID, "win")
+}
+
+// networkConnInfo returns the connection info of provisioners, SSH or WinRM
+// for Windows guests, to the address of the network interface at index.
+func networkConnInfo(networkInterfaces []map[string]interface{}, index int, guestFamily string, guestID string) map[string]string {
+	if index >= len(networkInterfaces) {
+		if len(networkInterfaces) > 0 {
+			log.Printf("[WARN] connection_interface_index %d is out of range, the VM has %d network interface(s)",
+				index, len(networkInterfaces))
+		}
+		return nil
+	}
+
+	// IPv6-only guests are connected to over IPv6.
+	ip, _ := networkInterfaces[index]["ipv4_address"].(string)
+	if ip == "" {
+		ip, _ = networkInterfaces[index]["ipv6_address"].(string)
+	}
+	if ip == "" {
+		return nil
+	}
+	if isWindowsGuest(guestFamily, guestID) {
+		return map[string]string{
+			"type": "winrm",
+			"host": ip,
+			"port": "5985",
+		}
+	}
+	return map[string]string{
+		"type": "ssh",
+		"host": ip,
+	}
+}
+
+// handleNetworkUpdate returns the device changes replacing the network
+// interfaces of the VM in netMap["deviceChange"], to be applied with the
+// other changes of the update in a single reconfiguration.
 func handleNetworkUpdate(d *schema.ResourceData, netMap map[string]interface{}, finder *find.Finder) error {
 
 	vmConf := netMap["vmUpdateConf"].(*virtualMachine)
-	vmMO := netMap["vmMO"].(*object.VirtualMachine)
+	devices := netMap["devices"].(object.VirtualDeviceList)
 
+	var deviceChange []types.BaseVirtualDeviceConfigSpec
 	var netDev []types.BaseVirtualDeviceConfigSpec
 	var netConf []types.CustomizationAdapterMapping
 	var identity_options types.BaseCustomizationIdentitySettings
@@ -396,26 +777,19 @@ func handleNetworkUpdate(d *schema.ResourceData, netMap map[string]interface{},
 	oldNetInterfaces := o.([]interface{})
 	newNetInterfaces := n.([]interface{})
 
-	if len(oldNetInterfaces) > 0 {
-
-		devices, err := vmMO.Device(context.TODO())
-		if err != nil {
-			log.Printf("[ERROR] unable to retrieve devices from VM")
-			return err
-		}
-
-		for _, val := range oldNetInterfaces {
-			deletedNet := val.(map[string]interface{})
-			devId := deletedNet["deviceId"].(int)
-
-			deviceToDelete := devices.FindByKey(int32(devId))
-			err := vmMO.RemoveDevice(context.TODO(), false, deviceToDelete)
-			if err != nil {
-				log.Printf("[ERROR] unable to remove device[%+v] from VM", deviceToDelete)
-				return err
-			}
+	for _, val := range oldNetInterfaces {
+		deletedNet := val.(map[string]interface{})
+		devId := deletedNet["deviceId"].(int)
 
+		deviceToDelete := devices.FindByKey(int32(devId))
+		if deviceToDelete == nil {
+			log.Printf("[DEBUG] network device %d is already gone from VM", devId)
+			continue
 		}
+		deviceChange = append(deviceChange, &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationRemove,
+			Device:    deviceToDelete,
+		})
 	}
 
 	if len(newNetInterfaces) > 0 {
@@ -425,6 +799,7 @@ func handleNetworkUpdate(d *schema.ResourceData, netMap map[string]interface{},
 			log.Printf("[ERROR] unable to parse new network interface data")
 			return err
 		}
+		vmConf.networkInterfaces = networkIntfData
 		var er error
 		netDev, netConf, er = populateNetworkDeviceAndConfig(networkIntfData, vmConf.template, finder)
 		if er != nil {
@@ -432,30 +807,26 @@ func handleNetworkUpdate(d *schema.ResourceData, netMap map[string]interface{},
 			return er
 		}
 
-		// Add Network devices
-		if err := addNetworkDevices(netDev, vmMO); err != nil {
-			log.Printf("[ERROR] unable to add network device")
-			return err
+		// Devices added in one reconfiguration need distinct temporary keys.
+		for _, dvc := range netDev {
+			device := dvc.GetVirtualDeviceConfigSpec().Device
+			device.GetVirtualDevice().Key = devices.NewKey()
+			devices = append(devices, device)
+			deviceChange = append(deviceChange, dvc)
 		}
-		log.Printf("[DEBUG] successfully added network devices")
 
 		if vmConf.skipCustomization || vmConf.template == "" {
 			log.Printf("[DEBUG] VM customization during update skipped")
 		} else {
 			// update the device list
-			identity_options = &types.CustomizationLinuxPrep{
-				HostName: &types.CustomizationFixedName{
-					Name: strings.Split(vmConf.name, ".")[0],
-				},
-				Domain:     vmConf.domain,
-				TimeZone:   vmConf.timeZone,
-				HwClockUTC: types.NewBool(true),
-			}
+			identity_options = vmConf.linuxPrepIdentity()
 			netMap["rebootRequired"] = true
 			netMap["customizationReq"] = true
 			netMap["identity_options"] = identity_options
 			netMap["netConf"] = netConf
 		}
 	}
+	netMap["deviceChange"] = deviceChange
+	netMap["devices"] = devices
 	return nil
 }
@@ -0,0 +1,172 @@
+package vsphere
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// networkRoute is a static route of a network interface. Guest customization
+// only configures gateways, so routes are added by commands in the guest.
+type networkRoute struct {
+	destination string
+	gateway     string
+}
+
+func networkRouteSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				// e.g. 10.1.0.0/16 or 2001:db8::/32
+				"destination": &schema.Schema{
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: validateRouteDestination,
+				},
+
+				"gateway": &schema.Schema{
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: validateRouteGateway,
+				},
+			},
+		},
+	}
+}
+
+func validateRouteDestination(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	if _, _, err := net.ParseCIDR(value); err != nil {
+		errors = append(errors, fmt.Errorf(
+			"%s: %q is not a network in CIDR notation, e.g. 10.1.0.0/16", k, value))
+	}
+	return
+}
+
+func validateRouteGateway(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	if net.ParseIP(value) == nil {
+		errors = append(errors, fmt.Errorf("%s: %q is not an IP address", k, value))
+	}
+	return
+}
+
+func parseNetworkRoutes(vL []interface{}) ([]networkRoute, error) {
+	var routes []networkRoute
+	for _, raw := range vL {
+		r := raw.(map[string]interface{})
+		route := networkRoute{
+			destination: r["destination"].(string),
+			gateway:     r["gateway"].(string),
+		}
+		_, destination, err := net.ParseCIDR(route.destination)
+		if err != nil {
+			return nil, fmt.Errorf("route destination %s is not a network in CIDR notation", route.destination)
+		}
+		gateway := net.ParseIP(route.gateway)
+		if gateway == nil || (destination.IP.To4() == nil) != (gateway.To4() == nil) {
+			return nil, fmt.Errorf("route gateway %s is not an address of the family of %s", route.gateway, route.destination)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// linuxPersistRouteScript adds the route to the network configuration of a
+// Linux guest, so it survives a reboot. The interface is the one the gateway
+// is reached through. NetworkManager stores the route in the connection,
+// otherwise it goes to the route file of Red Hat or SUSE, a netplan file or
+// an ifupdown hook, whichever the guest uses. Adding a route twice is a no-op.
+const linuxPersistRouteScript = `dev=$(ip -o route get {{gateway}} | sed -n "s/.* dev \([^ ]*\).*/\1/p")
+[ -n "$dev" ] || { echo "no interface reaches {{gateway}}" >&2; exit 1; }
+if command -v nmcli >/dev/null && nmcli -t general status >/dev/null 2>&1; then
+  con=$(nmcli -g GENERAL.CONNECTION device show "$dev")
+  nmcli -g {{family}}.routes connection show "$con" | grep -qF "{{destination}} {{gateway}}" && exit 0
+  exec nmcli connection modify "$con" +{{family}}.routes "{{destination}} {{gateway}}"
+elif [ -d /etc/sysconfig/network-scripts ]; then
+  file=/etc/sysconfig/network-scripts/route-$dev
+  line="{{destination}} via {{gateway}} dev $dev"
+elif [ -d /etc/sysconfig/network ]; then
+  file=/etc/sysconfig/network/routes
+  line="{{destination}} {{gateway}} - $dev"
+elif [ -d /etc/netplan ]; then
+  file=/etc/netplan/90-terraform-routes-$dev.yaml
+  [ -f "$file" ] || printf "network:\n  version: 2\n  ethernets:\n    %s:\n      routes:\n" "$dev" > "$file"
+  chmod 600 "$file"
+  line="        - {to: \"{{destination}}\", via: \"{{gateway}}\"}"
+elif [ -d /etc/network/if-up.d ]; then
+  file=/etc/network/if-up.d/terraform-routes
+  [ -f "$file" ] || echo "#!/bin/sh" > "$file"
+  chmod 755 "$file"
+  line="if [ \"\$IFACE\" = $dev ]; then ip route replace {{destination}} via {{gateway}}; fi"
+else
+  echo "no supported network configuration to persist the route to {{destination}}" >&2
+  exit 1
+fi
+grep -qxF "$line" "$file" 2>/dev/null || echo "$line" >> "$file"`
+
+// guestRouteCommand returns the command adding the route in the guest. Both
+// are persistent, Windows through route -p and Linux through the network
+// configuration of the guest.
+func guestRouteCommand(guestID string, r networkRoute) string {
+	ip, network, _ := net.ParseCIDR(r.destination)
+	if strings.HasPrefix(guestID, "win") {
+		if ip.To4() == nil {
+			return fmt.Sprintf("route -p add %s %s", network.String(), r.gateway)
+		}
+		return fmt.Sprintf("route -p add %s mask %s %s", network.IP.String(), net.IP(network.Mask).String(), r.gateway)
+	}
+
+	family := "ipv4"
+	if ip.To4() == nil {
+		family = "ipv6"
+	}
+	persist := strings.NewReplacer(
+		"{{destination}}", r.destination,
+		"{{gateway}}", r.gateway,
+		"{{family}}", family,
+	).Replace(linuxPersistRouteScript)
+	return fmt.Sprintf("ip route replace %s via %s && {\n%s\n}", r.destination, r.gateway, persist)
+}
+
+// networkRoutes returns the routes of all network interfaces.
+func (vm *virtualMachine) networkRoutes() []networkRoute {
+	var routes []networkRoute
+	for _, n := range vm.networkInterfaces {
+		routes = append(routes, n.routes...)
+	}
+	return routes
+}
+
+// addGuestRoutes adds the static routes of the network interfaces in the
+// guest through VMware Tools.
+func (vm *virtualMachine) addGuestRoutes(vmObj *object.VirtualMachine, auth *types.NamePasswordAuthentication) error {
+	routes := vm.networkRoutes()
+	if len(routes) == 0 {
+		return nil
+	}
+	if auth == nil {
+		return fmt.Errorf("guest_credentials are required to add the routes of the network interfaces")
+	}
+
+	var mvm mo.VirtualMachine
+	if err := vmObj.Properties(context.TODO(), vmObj.Reference(), []string{"config.guestId"}, &mvm); err != nil {
+		return err
+	}
+	for _, r := range routes {
+		if err := vm.runGuestCommand(vmObj, auth, guestRouteCommand(mvm.Config.GuestId, r)); err != nil {
+			return fmt.Errorf("adding route to %s via %s failed: %s", r.destination, r.gateway, err)
+		}
+	}
+	return nil
+}
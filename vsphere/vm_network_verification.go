@@ -0,0 +1,130 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"golang.org/x/net/context"
+)
+
+// network_verification probes the static addresses of the network
+// interfaces over TCP once the VM is up, so a wrong gateway or VLAN fails
+// the apply instead of showing up later. The probe runs from the host of
+// Terraform, which needs a route to the guest; ICMP is not used since it
+// needs raw sockets.
+
+const networkVerificationPollInterval = 5 * time.Second
+
+type networkVerification struct {
+	port    int
+	timeout time.Duration
+}
+
+func networkVerificationSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				// TCP port which has to accept connections, e.g. 22 for
+				// SSH or 5985 for WinRM.
+				"port": &schema.Schema{
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      22,
+					ValidateFunc: validateNetworkVerificationPort,
+				},
+				// In seconds.
+				"timeout": &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+					Default:  300,
+				},
+			},
+		},
+	}
+}
+
+func validateNetworkVerificationPort(v interface{}, k string) (ws []string, errors []error) {
+	if port := v.(int); port < 1 || port > 65535 {
+		errors = append(errors, fmt.Errorf("%s: Port '%d' is out of allowed range (1 - 65535).", k, port))
+	}
+	return
+}
+
+// parseNetworkVerification returns nil without a network_verification block.
+func parseNetworkVerification(d *schema.ResourceData) *networkVerification {
+	vL := d.Get("network_verification").([]interface{})
+	if len(vL) == 0 || vL[0] == nil {
+		return nil
+	}
+	m := vL[0].(map[string]interface{})
+	return &networkVerification{
+		port:    m["port"].(int),
+		timeout: time.Duration(m["timeout"].(int)) * time.Second,
+	}
+}
+
+// staticAddresses returns the static addresses of the network interfaces by
+// the label of their interface.
+func staticAddresses(networkInterfaces []networkInterface) map[string][]string {
+	addresses := make(map[string][]string)
+	for _, n := range networkInterfaces {
+		if n.ipv4Mode == addressModeStatic && n.ipv4Address != "" {
+			addresses[n.label] = append(addresses[n.label], n.ipv4Address)
+		}
+		if n.ipv6Mode == addressModeStatic && n.ipv6Address != "" {
+			addresses[n.label] = append(addresses[n.label], n.ipv6Address)
+		}
+	}
+	return addresses
+}
+
+// probeAddress connects to the port of the address until it answers or
+// the context is done.
+func probeAddress(ctx context.Context, address string, port int, interval time.Duration) error {
+	target := net.JoinHostPort(address, strconv.Itoa(port))
+	for {
+		conn, err := net.DialTimeout("tcp", target, interval)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		log.Printf("[DEBUG] %s does not answer yet: %s", target, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s did not answer: %s", target, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// verifyGuestNetwork probes the static addresses of the network interfaces.
+func (vm *virtualMachine) verifyGuestNetwork() error {
+	if vm.networkVerification == nil {
+		return nil
+	}
+	parent := vm.taskCtx
+	if parent == nil {
+		parent = context.TODO()
+	}
+	ctx, cancel := context.WithTimeout(parent, vm.networkVerification.timeout)
+	defer cancel()
+
+	for label, addresses := range staticAddresses(vm.networkInterfaces) {
+		for _, address := range addresses {
+			log.Printf("[INFO] Verifying %s of network interface %s on port %d", address, label, vm.networkVerification.port)
+			if err := probeAddress(ctx, address, vm.networkVerification.port, networkVerificationPollInterval); err != nil {
+				return fmt.Errorf("network interface %s: %s within %s, check its gateway and VLAN",
+					label, err, vm.networkVerification.timeout)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+var sharesLevelList = []string{
+	string(types.SharesLevelLow),
+	string(types.SharesLevelNormal),
+	string(types.SharesLevelHigh),
+	string(types.SharesLevelCustom),
+}
+
+var latencySensitivityList = []string{
+	string(types.LatencySensitivitySensitivityLevelNormal),
+	string(types.LatencySensitivitySensitivityLevelHigh),
+}
+
+// resourceAllocation describes the CPU (MHz) or memory (MB) allocation of a
+// VM. A limit of -1 means unlimited.
+type resourceAllocation struct {
+	reservation int64
+	limit       int64
+	shareLevel  string
+	shareCount  int32
+}
+
+// resourceAllocationSchema returns the reservation, limit and share attributes
+// for the given resource, e.g. "cpu" or "memory".
+func resourceAllocationSchema(prefix string) map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		prefix + "_reservation": &schema.Schema{
+			Type:     schema.TypeInt,
+			Optional: true,
+			Default:  0,
+		},
+
+		prefix + "_limit": &schema.Schema{
+			Type:     schema.TypeInt,
+			Optional: true,
+			Default:  -1,
+		},
+
+		prefix + "_share_level": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      string(types.SharesLevelNormal),
+			ValidateFunc: validateSharesLevel,
+		},
+
+		prefix + "_share_count": &schema.Schema{
+			Type:     schema.TypeInt,
+			Optional: true,
+			Computed: true,
+		},
+	}
+}
+
+func parseResourceAllocationData(d *schema.ResourceData, prefix string) (resourceAllocation, error) {
+	ra := resourceAllocation{
+		reservation: int64(d.Get(prefix + "_reservation").(int)),
+		limit:       int64(d.Get(prefix + "_limit").(int)),
+		shareLevel:  d.Get(prefix + "_share_level").(string),
+	}
+
+	if v, ok := d.GetOk(prefix + "_share_count"); ok {
+		ra.shareCount = int32(v.(int))
+	}
+
+	if ra.shareLevel == string(types.SharesLevelCustom) && ra.shareCount <= 0 {
+		return ra, fmt.Errorf("%s_share_count must be set when %s_share_level is '%s'",
+			prefix, prefix, types.SharesLevelCustom)
+	}
+
+	if ra.limit >= 0 && ra.reservation > ra.limit {
+		return ra, fmt.Errorf("%s_reservation (%d) cannot exceed %s_limit (%d)",
+			prefix, ra.reservation, prefix, ra.limit)
+	}
+
+	log.Printf("[DEBUG] %s allocation data %#v", prefix, ra)
+	return ra, nil
+}
+
+func resourceAllocationHasChange(d *schema.ResourceData, prefix string) bool {
+	return d.HasChange(prefix+"_reservation") || d.HasChange(prefix+"_limit") ||
+		d.HasChange(prefix+"_share_level") || d.HasChange(prefix+"_share_count")
+}
+
+func (ra resourceAllocation) buildResourceAllocationInfo() *types.ResourceAllocationInfo {
+	reservation := ra.reservation
+	limit := ra.limit
+
+	return &types.ResourceAllocationInfo{
+		Reservation: &reservation,
+		Limit:       &limit,
+		Shares: &types.SharesInfo{
+			Level:  types.SharesLevel(ra.shareLevel),
+			Shares: ra.shareCount,
+		},
+	}
+}
+
+func readResourceAllocation(d *schema.ResourceData, prefix string, info *types.ResourceAllocationInfo) {
+	if info == nil {
+		return
+	}
+
+	if info.Reservation != nil {
+		d.Set(prefix+"_reservation", *info.Reservation)
+	}
+	if info.Limit != nil {
+		d.Set(prefix+"_limit", *info.Limit)
+	}
+	if info.Shares != nil {
+		d.Set(prefix+"_share_level", string(info.Shares.Level))
+		d.Set(prefix+"_share_count", info.Shares.Shares)
+	}
+}
+
+func validateSharesLevel(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, sharesLevelList)
+}
+
+func validateLatencySensitivity(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, latencySensitivityList)
+}
@@ -0,0 +1,422 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+const (
+	serialPortTypeNetwork = "network"
+	serialPortTypeFile    = "file"
+
+	usbControllerTypeUsb2 = "usb2"
+	usbControllerTypeUsb3 = "usb3"
+)
+
+var serialPortTypeList = []string{
+	serialPortTypeNetwork,
+	serialPortTypeFile,
+}
+
+var serialPortDirectionList = []string{
+	string(types.VirtualDeviceURIBackingOptionDirectionServer),
+	string(types.VirtualDeviceURIBackingOptionDirectionClient),
+}
+
+var usbControllerTypeList = []string{
+	usbControllerTypeUsb2,
+	usbControllerTypeUsb3,
+}
+
+type serialPort struct {
+	portType  string
+	uri       string
+	direction string
+	proxyURI  string
+	datastore string
+	path      string
+	yield     bool
+}
+
+type usbDevice struct {
+	deviceName string
+	hostname   string
+}
+
+type usbConfig struct {
+	controllers []string
+	devices     []usbDevice
+}
+
+func serialPortSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		ForceNew: true,
+		MaxItems: 32,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"type": &schema.Schema{
+					Type:         schema.TypeString,
+					Required:     true,
+					ForceNew:     true,
+					ValidateFunc: validateSerialPortType,
+				},
+
+				// network backing, e.g. telnet://:23000
+				"uri": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					ForceNew: true,
+				},
+
+				"direction": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ForceNew:     true,
+					Default:      string(types.VirtualDeviceURIBackingOptionDirectionServer),
+					ValidateFunc: validateSerialPortDirection,
+				},
+
+				"proxy_uri": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					ForceNew: true,
+				},
+
+				// file backing
+				"datastore": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					ForceNew: true,
+				},
+
+				"path": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					ForceNew: true,
+				},
+
+				"yield_on_poll": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					ForceNew: true,
+					Default:  true,
+				},
+			},
+		},
+	}
+}
+
+func usbControllerSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		ForceNew: true,
+		MaxItems: 2,
+		Elem: &schema.Schema{
+			Type:         schema.TypeString,
+			ValidateFunc: validateUsbControllerType,
+		},
+	}
+}
+
+func usbDeviceSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		ForceNew: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				// e.g. "path:1/0/1 version:2" or "vid:0x0529 pid:0x0001"
+				"device_name": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+					ForceNew: true,
+				},
+
+				// Host the device is attached to, if not the host of the VM.
+				"hostname": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					ForceNew: true,
+				},
+			},
+		},
+	}
+}
+
+func validateSerialPortType(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, serialPortTypeList)
+}
+
+func validateSerialPortDirection(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, serialPortDirectionList)
+}
+
+func validateUsbControllerType(v interface{}, k string) (ws []string, errors []error) {
+	return validateStringInList(v, k, usbControllerTypeList)
+}
+
+func parseSerialPortData(d *schema.ResourceData) ([]serialPort, error) {
+	var ports []serialPort
+	for i, raw := range d.Get("serial_port").([]interface{}) {
+		p := raw.(map[string]interface{})
+		port := serialPort{
+			portType:  p["type"].(string),
+			uri:       p["uri"].(string),
+			direction: p["direction"].(string),
+			proxyURI:  p["proxy_uri"].(string),
+			datastore: p["datastore"].(string),
+			path:      p["path"].(string),
+			yield:     p["yield_on_poll"].(bool),
+		}
+
+		switch port.portType {
+		case serialPortTypeNetwork:
+			if port.uri == "" || port.datastore != "" || port.path != "" {
+				return nil, fmt.Errorf("serial_port %d: a network serial port needs uri and no datastore or path", i)
+			}
+		case serialPortTypeFile:
+			if port.datastore == "" || port.path == "" || port.uri != "" || port.proxyURI != "" {
+				return nil, fmt.Errorf("serial_port %d: a file serial port needs datastore and path and no uri or proxy_uri", i)
+			}
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func parseUsbData(d *schema.ResourceData) *usbConfig {
+	usb := &usbConfig{}
+	for _, v := range d.Get("usb_controller").([]interface{}) {
+		usb.controllers = append(usb.controllers, v.(string))
+	}
+	for _, raw := range d.Get("usb_device").([]interface{}) {
+		dev := raw.(map[string]interface{})
+		usb.devices = append(usb.devices, usbDevice{
+			deviceName: dev["device_name"].(string),
+			hostname:   dev["hostname"].(string),
+		})
+	}
+	if len(usb.controllers) == 0 && len(usb.devices) == 0 {
+		return nil
+	}
+	return usb
+}
+
+// buildSerialPort creates the serial port device. The file of a file backed
+// port is created by vSphere if it does not exist.
+func (p serialPort) buildSerialPort(devices object.VirtualDeviceList) *types.VirtualSerialPort {
+	port := &types.VirtualSerialPort{
+		VirtualDevice: types.VirtualDevice{
+			Key: devices.NewKey(),
+			Connectable: &types.VirtualDeviceConnectInfo{
+				StartConnected:    true,
+				AllowGuestControl: true,
+			},
+		},
+		YieldOnPoll: p.yield,
+	}
+
+	if p.portType == serialPortTypeNetwork {
+		port.Backing = &types.VirtualSerialPortURIBackingInfo{
+			VirtualDeviceURIBackingInfo: types.VirtualDeviceURIBackingInfo{
+				ServiceURI: p.uri,
+				Direction:  p.direction,
+				ProxyURI:   p.proxyURI,
+			},
+		}
+	} else {
+		port.Backing = &types.VirtualSerialPortFileBackingInfo{
+			VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{
+				FileName: fmt.Sprintf("[%s] %s", p.datastore, p.path),
+			},
+		}
+	}
+	return port
+}
+
+// buildUsbControllers creates the configured USB controllers. A USB 2.0
+// controller is added for the devices if the VM has no controller yet.
+func (u *usbConfig) buildUsbControllers(devices object.VirtualDeviceList) []types.BaseVirtualDevice {
+	controllers := u.controllers
+	hasController := len(devices.SelectByType((*types.VirtualUSBController)(nil))) > 0 ||
+		len(devices.SelectByType((*types.VirtualUSBXHCIController)(nil))) > 0
+	if len(controllers) == 0 && len(u.devices) > 0 && !hasController {
+		log.Printf("[DEBUG] Adding a %s controller for the USB devices", usbControllerTypeUsb2)
+		controllers = []string{usbControllerTypeUsb2}
+	}
+
+	var created []types.BaseVirtualDevice
+	for _, t := range controllers {
+		var c types.BaseVirtualDevice
+		if t == usbControllerTypeUsb3 {
+			c = &types.VirtualUSBXHCIController{
+				VirtualController: types.VirtualController{
+					VirtualDevice: types.VirtualDevice{Key: devices.NewKey()},
+				},
+				AutoConnectDevices: types.NewBool(false),
+			}
+		} else {
+			c = &types.VirtualUSBController{
+				VirtualController: types.VirtualController{
+					VirtualDevice: types.VirtualDevice{Key: devices.NewKey()},
+				},
+				AutoConnectDevices: types.NewBool(false),
+				EhciEnabled:        types.NewBool(true),
+			}
+		}
+		devices = append(devices, c)
+		created = append(created, c)
+	}
+	return created
+}
+
+// buildUsbDevice creates a passthrough device for a USB device of the host
+// of the VM or, with hostname, of another host.
+func (u usbDevice) buildUsbDevice(devices object.VirtualDeviceList) *types.VirtualUSB {
+	dev := &types.VirtualUSB{
+		VirtualDevice: types.VirtualDevice{
+			Key: devices.NewKey(),
+		},
+	}
+	if u.hostname != "" {
+		dev.Backing = &types.VirtualUSBRemoteHostBackingInfo{
+			VirtualDeviceDeviceBackingInfo: types.VirtualDeviceDeviceBackingInfo{DeviceName: u.deviceName},
+			Hostname:                       u.hostname,
+		}
+	} else {
+		dev.Backing = &types.VirtualUSBUSBBackingInfo{
+			VirtualDeviceDeviceBackingInfo: types.VirtualDeviceDeviceBackingInfo{DeviceName: u.deviceName},
+		}
+	}
+	return dev
+}
+
+// addSerialAndUsbDevices attaches the serial ports, USB controllers and USB
+// devices to the new VM. Controllers are added first, as the USB devices
+// attach to them.
+func (vm *virtualMachine) addSerialAndUsbDevices(newVM *object.VirtualMachine) error {
+	if len(vm.serialPorts) == 0 && vm.usb == nil {
+		return nil
+	}
+	devices, err := newVM.Device(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	var add []types.BaseVirtualDevice
+	for _, p := range vm.serialPorts {
+		port := p.buildSerialPort(devices)
+		devices = append(devices, port)
+		add = append(add, port)
+	}
+	if vm.usb != nil {
+		for _, c := range vm.usb.buildUsbControllers(devices) {
+			devices = append(devices, c)
+			add = append(add, c)
+		}
+	}
+	if len(add) > 0 {
+		log.Printf("[DEBUG] Adding serial ports and USB controllers: %#v", add)
+		if err := newVM.AddDevice(context.TODO(), add...); err != nil {
+			return err
+		}
+	}
+
+	if vm.usb == nil || len(vm.usb.devices) == 0 {
+		return nil
+	}
+	devices, err = newVM.Device(context.TODO())
+	if err != nil {
+		return err
+	}
+	var usbDevices []types.BaseVirtualDevice
+	for _, u := range vm.usb.devices {
+		dev := u.buildUsbDevice(devices)
+		devices = append(devices, dev)
+		usbDevices = append(usbDevices, dev)
+	}
+	log.Printf("[DEBUG] Adding USB devices: %#v", usbDevices)
+	return newVM.AddDevice(context.TODO(), usbDevices...)
+}
+
+// readSerialAndUsbDevices sets serial_port, usb_controller and usb_device
+// from the devices of the VM. Like boot_options, each is only read once it is
+// configured, as the devices a template brings along would otherwise force a
+// new VM.
+func readSerialAndUsbDevices(devices object.VirtualDeviceList, d *schema.ResourceData) error {
+	if _, ok := d.GetOk("serial_port"); ok {
+		var ports []interface{}
+		for _, dev := range devices.SelectByType((*types.VirtualSerialPort)(nil)) {
+			port := dev.(*types.VirtualSerialPort)
+			p := map[string]interface{}{
+				"yield_on_poll": port.YieldOnPoll,
+			}
+			switch backing := port.Backing.(type) {
+			case *types.VirtualSerialPortURIBackingInfo:
+				p["type"] = serialPortTypeNetwork
+				p["uri"] = backing.ServiceURI
+				p["direction"] = backing.Direction
+				p["proxy_uri"] = backing.ProxyURI
+			case *types.VirtualSerialPortFileBackingInfo:
+				var dp object.DatastorePath
+				if !dp.FromString(backing.FileName) {
+					return fmt.Errorf("Invalid file of serial port %d: %s", port.Key, backing.FileName)
+				}
+				p["type"] = serialPortTypeFile
+				p["datastore"] = dp.Datastore
+				p["path"] = dp.Path
+			default:
+				log.Printf("[DEBUG] Skipping serial port %d with backing %T", port.Key, port.Backing)
+				continue
+			}
+			ports = append(ports, p)
+		}
+		if err := d.Set("serial_port", ports); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := d.GetOk("usb_controller"); ok {
+		var controllers []interface{}
+		for _, dev := range devices {
+			switch dev.(type) {
+			case *types.VirtualUSBController:
+				controllers = append(controllers, usbControllerTypeUsb2)
+			case *types.VirtualUSBXHCIController:
+				controllers = append(controllers, usbControllerTypeUsb3)
+			}
+		}
+		if err := d.Set("usb_controller", controllers); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := d.GetOk("usb_device"); ok {
+		var usbDevices []interface{}
+		for _, dev := range devices.SelectByType((*types.VirtualUSB)(nil)) {
+			switch backing := dev.(*types.VirtualUSB).Backing.(type) {
+			case *types.VirtualUSBRemoteHostBackingInfo:
+				usbDevices = append(usbDevices, map[string]interface{}{
+					"device_name": backing.DeviceName,
+					"hostname":    backing.Hostname,
+				})
+			case *types.VirtualUSBUSBBackingInfo:
+				usbDevices = append(usbDevices, map[string]interface{}{
+					"device_name": backing.DeviceName,
+				})
+			}
+		}
+		if err := d.Set("usb_device", usbDevices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package vsphere
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"golang.org/x/net/context"
+)
+
+// diskMigration is a disk which is moved to another datastore or datastore
+// cluster because its datastore changed.
+type diskMigration struct {
+	key       int32
+	datastore string
+}
+
+// recommendRelocateDatastore asks Storage DRS for the datastore of the
+// datastore cluster the disks of a virtual machine are moved to.
+func recommendRelocateDatastore(c *govmomi.Client, vm *object.VirtualMachine, pod types.ManagedObjectReference) (types.ManagedObjectReference, error) {
+	vmr := vm.Reference()
+	sps := types.StoragePlacementSpec{
+		Type: string(types.StoragePlacementSpecPlacementTypeRelocate),
+		Vm:   &vmr,
+		PodSelectionSpec: types.StorageDrsPodSelectionSpec{
+			StoragePod: &pod,
+		},
+		RelocateSpec: &types.VirtualMachineRelocateSpec{},
+	}
+	srm := object.NewStorageResourceManager(c.Client)
+	rds, err := srm.RecommendDatastores(context.TODO(), sps)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	log.Printf("[DEBUG] recommendRelocateDatastore: recommendDatastores: %#v", rds)
+	if len(rds.Recommendations) == 0 || len(rds.Recommendations[0].Action) == 0 {
+		return types.ManagedObjectReference{}, fmt.Errorf("Storage DRS has no recommendation for datastore cluster %s", pod.Value)
+	}
+	spa, ok := rds.Recommendations[0].Action[0].(*types.StoragePlacementAction)
+	if !ok {
+		return types.ManagedObjectReference{}, fmt.Errorf("unexpected Storage DRS recommendation for datastore cluster %s", pod.Value)
+	}
+	return spa.Destination, nil
+}
+
+// buildDiskMigrationSpec returns the relocate spec moving the disks. When all
+// disks of the virtual machine go to the same datastore its configuration
+// files move with them.
+func buildDiskMigrationSpec(migrations []diskMigration, targets map[string]types.ManagedObjectReference, diskCount int) types.VirtualMachineRelocateSpec {
+	spec := types.VirtualMachineRelocateSpec{}
+	home := make(map[types.ManagedObjectReference]bool)
+	for _, m := range migrations {
+		ds := targets[m.datastore]
+		spec.Disk = append(spec.Disk, types.VirtualMachineRelocateSpecDiskLocator{
+			DiskId:    m.key,
+			Datastore: ds,
+		})
+		home[ds] = true
+	}
+	if len(migrations) == diskCount && len(home) == 1 {
+		ds := spec.Disk[0].Datastore
+		spec.Datastore = &ds
+	}
+	return spec
+}
+
+// migrateDisks moves disks to their new datastores with storage vMotion,
+// which works while the virtual machine is running.
+func (vm *virtualMachine) migrateDisks(c *govmomi.Client, dcFolders *object.DatacenterFolders, vmObj *object.VirtualMachine, migrations []diskMigration, diskCount int) error {
+	targets := make(map[string]types.ManagedObjectReference)
+	for _, m := range migrations {
+		if _, ok := targets[m.datastore]; ok {
+			continue
+		}
+		ref, err := getDatastoreObject(c, dcFolders, m.datastore)
+		if err != nil {
+			return err
+		}
+		if ref.Type == "StoragePod" {
+			ref, err = recommendRelocateDatastore(c, vmObj, ref)
+			if err != nil {
+				return err
+			}
+		}
+		targets[m.datastore] = ref
+	}
+
+	spec := buildDiskMigrationSpec(migrations, targets, diskCount)
+	log.Printf("[INFO] Migrating disks of virtual machine %s: %#v", vm.name, spec)
+	task, err := vmObj.Relocate(context.TODO(), spec, types.VirtualMachineMovePriorityDefaultPriority)
+	if err != nil {
+		return err
+	}
+	return vm.waitForTask(task, "migrate storage of virtual machine "+vm.name)
+}
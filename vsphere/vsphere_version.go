@@ -0,0 +1,137 @@
+package vsphere
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// vSphereVersion is the version of vCenter or of a distributed switch, e.g.
+// 6.5.0.
+type vSphereVersion struct {
+	major, minor, patch int
+}
+
+// parseVSphereVersion parses a version like "6.5" or "6.7.0".
+func parseVSphereVersion(s string) (vSphereVersion, error) {
+	var v vSphereVersion
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, fmt.Errorf("invalid vSphere version %q", s)
+	}
+	fields := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, fmt.Errorf("invalid vSphere version %q", s)
+		}
+		*fields[i] = n
+	}
+	return v, nil
+}
+
+func (v vSphereVersion) String() string {
+	if v.patch != 0 {
+		return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	}
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// known reports whether the version was detected.
+func (v vSphereVersion) known() bool {
+	return v != vSphereVersion{}
+}
+
+func (v vSphereVersion) atLeast(o vSphereVersion) bool {
+	if v.major != o.major {
+		return v.major > o.major
+	}
+	if v.minor != o.minor {
+		return v.minor > o.minor
+	}
+	return v.patch >= o.patch
+}
+
+// vSphereFeature is a feature which needs a minimum version of vCenter, or of
+// the distributed switch for the features of a vDS.
+type vSphereFeature struct {
+	name    string
+	version vSphereVersion
+}
+
+var (
+	featureEFISecureBoot = vSphereFeature{"efi_secure_boot_enabled", vSphereVersion{6, 5, 0}}
+	featureNVMe          = vSphereFeature{"scsi_type nvme", vSphereVersion{6, 5, 0}}
+	featureMultiVCPUFT   = vSphereFeature{"fault_tolerance with more than one vcpu", vSphereVersion{6, 0, 0}}
+	featureNICBandwidth  = vSphereFeature{"bandwidth allocation of network_interface", vSphereVersion{6, 0, 0}}
+
+	featureDVSPortMirror   = vSphereFeature{"port mirroring", vSphereVersion{5, 0, 0}}
+	featureDVSRemoteMirror = vSphereFeature{"session_type other than dvPortMirror", vSphereVersion{5, 1, 0}}
+)
+
+// requireFeatures fails for the first feature the connected vCenter is too
+// old for, instead of leaving it to a SOAP fault. An undetected version
+// passes.
+func (c *VSphereClient) requireFeatures(features ...vSphereFeature) error {
+	if !c.apiVersion.known() {
+		return nil
+	}
+	for _, f := range features {
+		if !c.apiVersion.atLeast(f.version) {
+			return fmt.Errorf("%s requires vSphere %s, connected to %s", f.name, f.version, c.apiVersion)
+		}
+	}
+	return nil
+}
+
+// requireDVSFeatures fails for the first feature the version of the
+// distributed switch is too old for.
+func requireDVSFeatures(vdsName string, config *types.VMwareDVSConfigInfo, features ...vSphereFeature) error {
+	if config.ProductInfo.Version == "" {
+		return nil
+	}
+	version, err := parseVSphereVersion(config.ProductInfo.Version)
+	if err != nil {
+		return nil
+	}
+	for _, f := range features {
+		if !version.atLeast(f.version) {
+			return fmt.Errorf("%s requires a vDS of version %s, vDS %s is %s", f.name, f.version, vdsName, version)
+		}
+	}
+	return nil
+}
+
+// virtualMachineFeatures returns the version gated features the
+// configuration of a virtual machine uses.
+func virtualMachineFeatures(d *schema.ResourceData) []vSphereFeature {
+	var features []vSphereFeature
+	if d.Get("boot_options.0.efi_secure_boot_enabled").(bool) {
+		features = append(features, featureEFISecureBoot)
+	}
+	if d.Get("scsi_type").(string) == scsiTypeNvme {
+		features = append(features, featureNVMe)
+	}
+	if len(d.Get("fault_tolerance").([]interface{})) > 0 && d.Get("vcpu").(int) > 1 {
+		features = append(features, featureMultiVCPUFT)
+	}
+	for _, v := range d.Get("network_interface").([]interface{}) {
+		if b, _ := parseNicBandwidth(v.(map[string]interface{})); b != nil {
+			features = append(features, featureNICBandwidth)
+			break
+		}
+	}
+	return features
+}
+
+// portMirrorFeatures returns the version gated features of a port mirror.
+func portMirrorFeatures(pm *vdsPortMirror) []vSphereFeature {
+	features := []vSphereFeature{featureDVSPortMirror}
+	if pm.sessionType != string(types.VMwareDVSVspanSessionTypeDvPortMirror) {
+		features = append(features, featureDVSRemoteMirror)
+	}
+	return features
+}
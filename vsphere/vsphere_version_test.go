@@ -0,0 +1,68 @@
+package vsphere
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestParseVSphereVersion(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected vSphereVersion
+		err      bool
+	}{
+		{in: "6.5", expected: vSphereVersion{6, 5, 0}},
+		{in: "6.7.0", expected: vSphereVersion{6, 7, 0}},
+		{in: "5.1.3", expected: vSphereVersion{5, 1, 3}},
+		{in: "6", err: true},
+		{in: "6.x", err: true},
+		{in: "", err: true},
+	}
+	for _, tc := range cases {
+		v, err := parseVSphereVersion(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("%q: expected an error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %s", tc.in, err)
+		}
+		if v != tc.expected {
+			t.Fatalf("%q: expected %#v, got %#v", tc.in, tc.expected, v)
+		}
+	}
+}
+
+func TestRequireFeatures(t *testing.T) {
+	c := &VSphereClient{apiVersion: vSphereVersion{6, 5, 0}}
+	if err := c.requireFeatures(featureEFISecureBoot, featureMultiVCPUFT); err != nil {
+		t.Fatalf("expected 6.5 to support the features, got %s", err)
+	}
+
+	feature := vSphereFeature{"instant clone", vSphereVersion{7, 0, 0}}
+	err := c.requireFeatures(feature)
+	if err == nil || err.Error() != "instant clone requires vSphere 7.0, connected to 6.5" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	unknown := &VSphereClient{}
+	if err := unknown.requireFeatures(feature); err != nil {
+		t.Fatalf("expected an undetected version to pass, got %s", err)
+	}
+}
+
+func TestRequireDVSFeatures(t *testing.T) {
+	config := &types.VMwareDVSConfigInfo{}
+	config.ProductInfo = types.DistributedVirtualSwitchProductSpec{Version: "5.0.0"}
+
+	if err := requireDVSFeatures("dvs1", config, featureDVSPortMirror); err != nil {
+		t.Fatalf("expected 5.0.0 to support port mirroring, got %s", err)
+	}
+	err := requireDVSFeatures("dvs1", config, featureDVSPortMirror, featureDVSRemoteMirror)
+	if err == nil || err.Error() != "session_type other than dvPortMirror requires a vDS of version 5.1, vDS dvs1 is 5.0" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}